@@ -43,6 +43,13 @@ type crawler struct {
 	beatDone        chan struct{}
 }
 
+// finiteRunner is implemented by input runners that can report when their
+// input stopped on its own after collecting all its data.
+type finiteRunner interface {
+	Finite() bool
+	Done() <-chan struct{}
+}
+
 func newCrawler(
 	inputFactory, module cfgfile.RunnerFactory,
 	inputConfigs []*conf.C,
@@ -189,3 +196,29 @@ func (c *crawler) Stop() {
 func (c *crawler) WaitForCompletion() {
 	c.wg.Wait()
 }
+
+// allInputsFinite reports whether all the inputs started by the crawler stop
+// on their own once their data has been collected. It is false if no input
+// was started or if inputs are loaded dynamically.
+func (c *crawler) allInputsFinite() bool {
+	if len(c.inputs) == 0 || c.inputReloader != nil || c.modulesReloader != nil {
+		return false
+	}
+	for _, r := range c.inputs {
+		fr, ok := r.(finiteRunner)
+		if !ok || !fr.Finite() {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForFiniteInputs blocks until all the inputs started by the crawler have
+// returned. It must only be called if allInputsFinite is true.
+func (c *crawler) waitForFiniteInputs() {
+	for _, r := range c.inputs {
+		if fr, ok := r.(finiteRunner); ok {
+			<-fr.Done()
+		}
+	}
+}
@@ -455,6 +455,17 @@ func (fb *Filebeat) Run(b *beat.Beat) error {
 		waitFinished.Add(runOnce)
 	}
 
+	// If all inputs stop on their own once their data has been collected, like
+	// filestream inputs in replay mode, shut down as soon as they are done.
+	finite := fb.config.Autodiscover == nil && !b.Manager.Enabled() && crawler.allInputsFinite()
+	if finite {
+		waitFinished.Add(func() {
+			fb.logger.Info("All inputs are finite. Waiting for completion ...")
+			crawler.waitForFiniteInputs()
+			fb.logger.Info("All inputs completed. Shutting down.")
+		})
+	}
+
 	// Register reloadable list of inputs and modules
 	inputs := cfgfile.NewRunnerList(management.DebugK, inputLoader, fb.pipeline, fb.logger)
 	b.Registry.MustRegisterInput(inputs)
@@ -502,7 +513,7 @@ func (fb *Filebeat) Run(b *beat.Beat) error {
 
 	timeout := fb.config.ShutdownTimeout
 	// Checks if on shutdown it should wait for all events to be published
-	waitPublished := fb.config.ShutdownTimeout > 0 || *once
+	waitPublished := fb.config.ShutdownTimeout > 0 || *once || finite
 	if waitPublished {
 		// Wait for registrar to finish writing registry
 		waitEvents.Add(withLog(wgEvents.Wait,
@@ -0,0 +1,338 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/filebeat/config"
+	"github.com/elastic/beats/v7/filebeat/input/filestream"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance/locks"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+func genRegistryCmd(settings instance.Settings) *cobra.Command {
+	registryCmd := &cobra.Command{
+		Use:   "registry",
+		Short: "Inspect and edit the filestream entries of the registry",
+		Long: `These commands give access to the states of the files harvested by the
+filestream inputs, as they are stored in the registry. Entries are identified
+by their key, which is made of the input ID, the file identifier and the
+identity of the file, as printed by the list command.
+
+Filebeat must not be running, the commands fail if the data path is locked.
+`,
+	}
+
+	registryCmd.AddCommand(genRegistryListCmd(settings))
+	registryCmd.AddCommand(genRegistryShowCmd(settings))
+	registryCmd.AddCommand(genRegistryResetOffsetCmd(settings))
+	registryCmd.AddCommand(genRegistryDeleteCmd(settings))
+	registryCmd.AddCommand(genRegistryExportCmd(settings))
+	registryCmd.AddCommand(genRegistryImportCmd(settings))
+
+	return registryCmd
+}
+
+func genRegistryListCmd(settings instance.Settings) *cobra.Command {
+	var inputID string
+	command := &cobra.Command{
+		Use:   "list",
+		Short: "List the filestream entries of the registry",
+		Args:  cobra.NoArgs,
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			return withRegistry(settings, func(r *filestream.Registry) error {
+				entries, err := registryEntries(r, inputID)
+				if err != nil {
+					return err
+				}
+
+				now := time.Now()
+				w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "KEY\tSOURCE\tOFFSET\tTTL\tUPDATED")
+				for _, e := range entries {
+					offset := fmt.Sprint(e.Offset)
+					if e.Completed {
+						offset += " (completed)"
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+						e.Key, e.Source, offset, formatTTL(e, now), e.Updated.Format(time.RFC3339))
+				}
+				return w.Flush()
+			})
+		}),
+	}
+	command.Flags().StringVar(&inputID, "input-id", "", "only list the entries of the filestream input with this ID")
+	return command
+}
+
+func genRegistryShowCmd(settings instance.Settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "show KEY",
+		Short: "Show a filestream entry of the registry",
+		Args:  cobra.ExactArgs(1),
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			return withRegistry(settings, func(r *filestream.Registry) error {
+				e, err := r.Entry(args[0])
+				if err != nil {
+					return err
+				}
+
+				w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+				fmt.Fprintf(w, "Key:\t%s\n", e.Key)
+				fmt.Fprintf(w, "Input ID:\t%s\n", e.InputID)
+				fmt.Fprintf(w, "Identifier:\t%s\n", e.Identifier)
+				fmt.Fprintf(w, "Identity:\t%s\n", e.Identity)
+				fmt.Fprintf(w, "Source:\t%s\n", e.Source)
+				fmt.Fprintf(w, "Offset:\t%d\n", e.Offset)
+				fmt.Fprintf(w, "Completed:\t%t\n", e.Completed)
+				fmt.Fprintf(w, "TTL:\t%s\n", formatTTL(e, time.Now()))
+				fmt.Fprintf(w, "Updated:\t%s\n", e.Updated.Format(time.RFC3339Nano))
+				return w.Flush()
+			})
+		}),
+	}
+}
+
+func genRegistryResetOffsetCmd(settings instance.Settings) *cobra.Command {
+	var offset int64
+	command := &cobra.Command{
+		Use:   "reset-offset KEY...",
+		Short: "Set the offset of filestream entries of the registry",
+		Long: `This command sets the offset the files are read from the next time they
+are harvested, by default they are read again from the beginning.
+`,
+		Args: cobra.MinimumNArgs(1),
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			return withRegistry(settings, func(r *filestream.Registry) error {
+				for _, key := range args {
+					if err := r.ResetOffset(key, offset); err != nil {
+						return fmt.Errorf("failed to reset the offset of %s: %w", key, err)
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "Offset of %s set to %d\n", key, offset)
+				}
+				return nil
+			})
+		}),
+	}
+	command.Flags().Int64Var(&offset, "offset", 0, "offset to read the files from")
+	return command
+}
+
+func genRegistryDeleteCmd(settings instance.Settings) *cobra.Command {
+	var inputID string
+	command := &cobra.Command{
+		Use:   "delete [KEY...]",
+		Short: "Delete filestream entries from the registry",
+		Long: `This command deletes the given entries, or all the entries of a filestream
+input. The files are read again from the beginning the next time they are
+found.
+`,
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			if (len(args) == 0) == (inputID == "") {
+				return errors.New("either keys or --input-id must be given, but not both")
+			}
+
+			return withRegistry(settings, func(r *filestream.Registry) error {
+				keys := args
+				if inputID != "" {
+					entries, err := registryEntries(r, inputID)
+					if err != nil {
+						return err
+					}
+					for _, e := range entries {
+						keys = append(keys, e.Key)
+					}
+				}
+
+				for _, key := range keys {
+					if err := r.Delete(key); err != nil {
+						return fmt.Errorf("failed to delete %s: %w", key, err)
+					}
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Deleted %d entries\n", len(keys))
+				return nil
+			})
+		}),
+	}
+	command.Flags().StringVar(&inputID, "input-id", "", "delete all the entries of the filestream input with this ID")
+	return command
+}
+
+func genRegistryExportCmd(settings instance.Settings) *cobra.Command {
+	var inputID, output string
+	command := &cobra.Command{
+		Use:   "export",
+		Short: "Export the filestream entries of the registry as JSON",
+		Args:  cobra.NoArgs,
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			return withRegistry(settings, func(r *filestream.Registry) error {
+				entries, err := registryEntries(r, inputID)
+				if err != nil {
+					return err
+				}
+
+				if output == "" {
+					return r.Export(cmd.OutOrStdout(), entries)
+				}
+				f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+				if err != nil {
+					return err
+				}
+				if err := r.Export(f, entries); err != nil {
+					_ = f.Close()
+					return err
+				}
+				return f.Close()
+			})
+		}),
+	}
+	command.Flags().StringVar(&inputID, "input-id", "", "only export the entries of the filestream input with this ID")
+	command.Flags().StringVarP(&output, "output", "o", "", "file to write the entries to, instead of stdout")
+	return command
+}
+
+func genRegistryImportCmd(settings instance.Settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "import FILE",
+		Short: "Import filestream entries exported as JSON into the registry",
+		Long: `This command writes the entries of a file written by the export command to
+the registry. Existing entries with the same keys are replaced. Use - to read
+the entries from stdin.
+`,
+		Args: cobra.ExactArgs(1),
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			var in io.Reader = cmd.InOrStdin()
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+
+			return withRegistry(settings, func(r *filestream.Registry) error {
+				n, err := r.Import(in)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Imported %d entries\n", n)
+				return nil
+			})
+		}),
+	}
+}
+
+// withRegistry opens the registry configured for Filebeat and calls fn with
+// it. It fails if another process, like a running Filebeat, holds the lock
+// of the data path, as the changes would be overwritten.
+func withRegistry(settings instance.Settings, fn func(*filestream.Registry) error) error {
+	b, err := instance.NewInitializedBeat(settings)
+	if err != nil {
+		return fmt.Errorf("error initializing beat: %w", err)
+	}
+
+	lock := locks.NewWithRetry(b.Info, 1, 0)
+	if err := lock.Lock(); err != nil {
+		if errors.Is(err, locks.ErrAlreadyLocked) {
+			return fmt.Errorf("the registry cannot be accessed while %s is running: %w", b.Info.Beat, err)
+		}
+		return err
+	}
+	defer func() {
+		_ = lock.Unlock()
+	}()
+
+	beatConfig, err := b.BeatConfig()
+	if err != nil {
+		return fmt.Errorf("error reading the %s configuration: %w", b.Info.Beat, err)
+	}
+	cfg := struct {
+		Registry config.Registry `config:"registry"`
+	}{Registry: config.DefaultConfig.Registry}
+	if err := beatConfig.Unpack(&cfg); err != nil {
+		return fmt.Errorf("error reading the registry configuration: %w", err)
+	}
+
+	// Opening a store creates it, make sure there is one to edit first.
+	root := paths.Resolve(paths.Data, cfg.Registry.Path)
+	if _, err := os.Stat(filepath.Join(root, b.Info.Beat)); err != nil {
+		return fmt.Errorf("no registry found in %s: %w", root, err)
+	}
+
+	backend, err := memlog.New(b.Info.Logger, memlog.Settings{
+		Root:     root,
+		FileMode: cfg.Registry.Permissions,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open the registry: %w", err)
+	}
+	registry := statestore.NewRegistry(backend)
+	defer registry.Close()
+
+	store, err := registry.Get(b.Info.Beat)
+	if err != nil {
+		return fmt.Errorf("failed to open the registry: %w", err)
+	}
+	defer store.Close()
+
+	return fn(filestream.NewRegistry(b.Info.Logger.Named("registry"), store))
+}
+
+// registryEntries returns the filestream entries of the registry, only the
+// ones of the input with the given ID if it is set.
+func registryEntries(r *filestream.Registry, inputID string) ([]filestream.RegistryEntry, error) {
+	entries, err := r.Entries()
+	if err != nil || inputID == "" {
+		return entries, err
+	}
+
+	filtered := entries[:0]
+	for _, e := range entries {
+		if e.InputID == inputID {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered, nil
+}
+
+func formatTTL(e filestream.RegistryEntry, now time.Time) string {
+	switch {
+	case e.Removed():
+		return "removed"
+	case e.TTL < 0:
+		return "never expires"
+	case e.Expired(now):
+		return e.TTL.String() + " (expired)"
+	default:
+		return e.TTL.String()
+	}
+}
@@ -0,0 +1,82 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/filebeat/input/filestream"
+	"github.com/elastic/beats/v7/libbeat/cfgfile"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestWithRegistry(t *testing.T) {
+	home := t.TempDir()
+	registryPath := filepath.Join(home, "my-registry")
+	cfgFile := filepath.Join(home, "filebeat.yml")
+	err := os.WriteFile(cfgFile, []byte("path.home: "+home+"\nfilebeat.registry.path: "+registryPath+"\n"), 0o600)
+	require.NoError(t, err)
+
+	// Set the configuration file path flag so the beat can read it.
+	cfgfile.Initialize()
+	require.NoError(t, flag.Set("c", cfgFile))
+
+	const exported = `[{"key": "filestream::my-id::native::123-456", "ttl": -1, "updated": "2024-01-02T03:04:05Z", ` +
+		`"cursor": {"offset": 42}, "meta": {"source": "/var/log/app.log", "identifier_name": "native"}}]`
+	createTestRegistry(t, registryPath, exported)
+
+	// The beat can only be initialized once per process, so withRegistry
+	// is only called once.
+	err = withRegistry(FilebeatSettings(""), func(r *filestream.Registry) error {
+		entries, err := r.Entries()
+		if err != nil {
+			return err
+		}
+		require.Len(t, entries, 1, "the entries must be read from the configured registry")
+		assert.Equal(t, "filestream::my-id::native::123-456", entries[0].Key)
+		assert.Equal(t, int64(42), entries[0].Offset)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+// createTestRegistry creates a filebeat registry in path holding the
+// exported entries.
+func createTestRegistry(t *testing.T, path, exported string) {
+	t.Helper()
+	logger := logptest.NewTestingLogger(t, "")
+	backend, err := memlog.New(logger, memlog.Settings{Root: path, FileMode: 0o600})
+	require.NoError(t, err)
+	registry := statestore.NewRegistry(backend)
+	defer registry.Close()
+	store, err := registry.Get("filebeat")
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, err = filestream.NewRegistry(logger, store).Import(strings.NewReader(exported))
+	require.NoError(t, err)
+}
@@ -50,6 +50,7 @@ type config struct {
 	IgnoreInactive ignoreInactiveType `config:"ignore_inactive"`
 	Rotation       *conf.Namespace    `config:"rotation"`
 	TakeOver       takeOverConfig     `config:"take_over"`
+	Replay         replayConfig       `config:"replay"`
 
 	// AllowIDDuplication is used by InputManager.Create
 	// (see internal/input-logfile/manager.go).
@@ -116,6 +117,7 @@ func defaultConfig() config {
 		CleanRemoved:   true,
 		HarvesterLimit: 0,
 		IgnoreOlder:    0,
+		Replay:         defaultReplayConfig(),
 	}
 }
 
@@ -168,6 +170,15 @@ func (c *config) Validate() error {
 		return errors.New("'take_over' mode is only allowed if an input ID is set")
 	}
 
+	if c.Replay.Enabled {
+		if c.ID == "" {
+			return errors.New("'replay' mode is only allowed if an input ID is set")
+		}
+		if c.TakeOver.Enabled {
+			return errors.New("replay and take_over cannot be enabled at the same time")
+		}
+	}
+
 	return nil
 }
 
@@ -55,6 +55,26 @@ func TestConfigValidate(t *testing.T) {
 		err := c.Validate()
 		assert.NoError(t, err)
 	})
+
+	t.Run("replay requires ID", func(t *testing.T) {
+		c := config{
+			Paths:  []string{"/foo/bar"},
+			Replay: replayConfig{Enabled: true},
+		}
+		err := c.Validate()
+		assert.Error(t, err, "replay.enabled can only be true if ID is set")
+	})
+
+	t.Run("replay cannot be used with take_over", func(t *testing.T) {
+		c := config{
+			Paths:    []string{"/foo/bar"},
+			ID:       "some id",
+			TakeOver: takeOverConfig{Enabled: true},
+			Replay:   replayConfig{Enabled: true},
+		}
+		err := c.Validate()
+		assert.Error(t, err)
+	})
 }
 
 func TestValidateInputIDs(t *testing.T) {
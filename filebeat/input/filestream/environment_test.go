@@ -64,7 +64,8 @@ type inputTestingEnvironment struct {
 
 type registryEntry struct {
 	Cursor struct {
-		Offset int `json:"offset"`
+		Offset    int  `json:"offset"`
+		Completed bool `json:"completed"`
 	} `json:"cursor"`
 	Meta any `json:"meta,omitempty"`
 }
@@ -130,6 +131,13 @@ func (e *inputTestingEnvironment) createInput(config map[string]any) (v2.Input,
 	return inp, nil
 }
 
+// resetManager makes the inputs created afterwards use a new input manager.
+// An input that stops shuts down the manager it was created with, so it must
+// be reset before an input is created again.
+func (e *inputTestingEnvironment) resetManager() {
+	e.pluginInitOnce = sync.Once{}
+}
+
 func (e *inputTestingEnvironment) getManager() v2.InputManager {
 	e.pluginInitOnce.Do(func() {
 		e.plugin = Plugin(e.logger, e.stateStore)
@@ -629,7 +637,13 @@ func (c *mockClient) PublishAll(events []beat.Event) {
 	}
 	c.ackHandler.ACKEvents(len(events))
 
-	c.published = append(c.published, events...)
+	// Like the publishing pipeline, empty events are acknowledged, but
+	// never published.
+	for _, event := range events {
+		if len(event.Fields) > 0 {
+			c.published = append(c.published, event)
+		}
+	}
 }
 
 func (c *mockClient) waitUntilPublishingHasStarted() {
@@ -654,8 +668,10 @@ func (c *mockClient) Close() error {
 // mockPipelineConnector mocks the PipelineConnector interface
 type mockPipelineConnector struct {
 	blocking bool
-	clients  []*mockClient
-	mtx      sync.Mutex
+	// connectErr is returned by ConnectWith if set.
+	connectErr error
+	clients    []*mockClient
+	mtx        sync.Mutex
 }
 
 // GetAllEvents returns all events associated with a pipeline
@@ -681,6 +697,9 @@ func (pc *mockPipelineConnector) ConnectWith(config beat.ClientConfig) (beat.Cli
 	pc.mtx.Lock()
 	defer pc.mtx.Unlock()
 
+	if pc.connectErr != nil {
+		return nil, pc.connectErr
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	c := &mockClient{
 		canceler:   cancel,
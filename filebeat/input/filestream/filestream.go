@@ -35,8 +35,9 @@ import (
 )
 
 var (
-	ErrFileTruncate = errors.New("detected file being truncated")
-	ErrClosed       = errors.New("reader closed")
+	ErrFileTruncate             = errors.New("detected file being truncated")
+	ErrClosed                   = errors.New("reader closed")
+	ErrIncompleteCompressedFile = errors.New("compressed file is incomplete")
 )
 
 // logFile contains all log related data
@@ -45,6 +46,10 @@ type logFile struct {
 	log       *logp.Logger
 	readerCtx ctxtool.CancelContext
 
+	// decompressed is the decompressed content of file, it is read
+	// instead of file when it is set.
+	decompressed io.ReadCloser
+
 	closeAfterInterval time.Duration
 	closeOnEOF         bool
 
@@ -101,8 +106,13 @@ func newFileReader(
 func (f *logFile) Read(buf []byte) (int, error) {
 	totalN := 0
 
+	var src io.Reader = f.file
+	if f.decompressed != nil {
+		src = f.decompressed
+	}
+
 	for f.readerCtx.Err() == nil {
-		n, err := f.file.Read(buf)
+		n, err := src.Read(buf)
 		if n > 0 {
 			f.offset += int64(n)
 			f.lastTimeRead = time.Now()
@@ -232,6 +242,10 @@ func isSameFile(path string, info os.FileInfo) bool {
 // errorChecks determines the cause for EOF errors, and how the EOF event should be handled
 // based on the config options.
 func (f *logFile) errorChecks(err error) error {
+	if f.decompressed != nil && errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrIncompleteCompressedFile
+	}
+
 	if !errors.Is(err, io.EOF) {
 		f.log.Error("Unexpected state reading from %s; error: %s", f.file.Name(), err)
 		return err
@@ -266,6 +280,9 @@ func (f *logFile) handleEOF() error {
 // Close
 func (f *logFile) Close() error {
 	f.readerCtx.Cancel()
+	if f.decompressed != nil {
+		_ = f.decompressed.Close()
+	}
 	err := f.file.Close()
 	_ = f.tg.Stop() // Wait until all resources are released for sure.
 	return err
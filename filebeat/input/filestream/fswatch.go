@@ -35,6 +35,7 @@ import (
 	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
 	commonfile "github.com/elastic/beats/v7/libbeat/common/file"
 	"github.com/elastic/beats/v7/libbeat/common/match"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
 )
@@ -44,6 +45,12 @@ const (
 	DefaultFingerprintSize int64 = 1024 // 1KB
 	scannerDebugKey              = "scanner"
 	watcherDebugKey              = "file_watcher"
+
+	watcherPolling = "polling"
+	watcherInotify = "inotify"
+
+	compressionNone = "none"
+	compressionAuto = "auto"
 )
 
 var (
@@ -56,6 +63,11 @@ type fileWatcherConfig struct {
 	// ResendOnModTime  if a file has been changed according to modtime but the size is the same
 	// it is still considered truncation.
 	ResendOnModTime bool `config:"resend_on_touch"`
+	// Watcher is how changes are detected, by polling or by inotify events.
+	Watcher string `config:"watcher"`
+	// RescanInterval is the time between two full scans of the inotify
+	// watcher, which catch the changes it may have missed.
+	RescanInterval time.Duration `config:"rescan_interval"`
 	// Scanner is the configuration of the scanner.
 	Scanner fileScannerConfig `config:",inline"`
 }
@@ -91,26 +103,54 @@ func newScannerWatcher(paths []string, c *conf.C) (loginp.FSWatcher, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &fileWatcher{
+	w := &fileWatcher{
 		log:     logp.NewLogger(watcherDebugKey),
 		cfg:     config,
 		prev:    make(map[string]loginp.FileDescriptor, 0),
 		scanner: scanner,
 		events:  make(chan loginp.FSEvent),
-	}, nil
+	}
+	if config.Watcher == watcherInotify {
+		return newInotifyWatcher(w, scanner)
+	}
+	return w, nil
 }
 
 func defaultFileWatcherConfig() fileWatcherConfig {
 	return fileWatcherConfig{
 		Interval:        10 * time.Second,
 		ResendOnModTime: false,
+		Watcher:         watcherPolling,
+		RescanInterval:  5 * time.Minute,
 		Scanner:         defaultFileScannerConfig(),
 	}
 }
 
+func (c *fileWatcherConfig) Validate() error {
+	switch c.Watcher {
+	case watcherPolling, watcherInotify:
+	default:
+		return fmt.Errorf("unknown watcher %q, must be %s or %s", c.Watcher, watcherPolling, watcherInotify)
+	}
+	if c.RescanInterval <= 0 {
+		return errors.New("rescan_interval must be greater than 0")
+	}
+	switch c.Scanner.Compression {
+	case compressionNone, compressionAuto:
+	default:
+		return fmt.Errorf("unknown compression %q, must be %s or %s", c.Scanner.Compression, compressionNone, compressionAuto)
+	}
+	return nil
+}
+
 func (w *fileWatcher) Run(ctx unison.Canceler) {
 	defer close(w.events)
 
+	w.poll(ctx)
+}
+
+// poll scans the files every check interval.
+func (w *fileWatcher) poll(ctx unison.Canceler) {
 	// run initial scan before starting regular
 	w.watch(ctx)
 
@@ -125,7 +165,15 @@ func (w *fileWatcher) watch(ctx unison.Canceler) {
 	w.log.Debug("Start next scan")
 
 	paths := w.scanner.GetFiles()
+	if w.compare(ctx, w.prev, paths) {
+		w.prev = paths
+	}
+}
 
+// compare sends the events describing the changes between the previous and
+// the current files. It consumes prev and removes the files that are not
+// worth reporting yet from paths. It returns false if it was cancelled.
+func (w *fileWatcher) compare(ctx unison.Canceler, prev, paths map[string]loginp.FileDescriptor) bool {
 	// for debugging purposes
 	writtenCount := 0
 	truncatedCount := 0
@@ -139,7 +187,7 @@ func (w *fileWatcher) watch(ctx unison.Canceler) {
 	for path, fd := range paths {
 		// if the scanner found a new path or an existing path
 		// with a different file, it is a new file
-		prevDesc, ok := w.prev[path]
+		prevDesc, ok := prev[path]
 		sfd := fd // to avoid memory aliasing
 		if !ok || !loginp.SameFile(&prevDesc, &sfd) {
 			newFilesByName[path] = &sfd
@@ -172,18 +220,18 @@ func (w *fileWatcher) watch(ctx unison.Canceler) {
 		if e.Op != loginp.OpDone {
 			select {
 			case <-ctx.Done():
-				return
+				return false
 			case w.events <- e:
 			}
 		}
 
 		// delete from previous state to mark that we've seen the existing file again
-		delete(w.prev, path)
+		delete(prev, path)
 	}
 
 	// remaining files in the prev map are the ones that are missing
 	// either because they have been deleted or renamed
-	for remainingPath, remainingDesc := range w.prev {
+	for remainingPath, remainingDesc := range prev {
 		var e loginp.FSEvent
 
 		id := remainingDesc.FileID()
@@ -198,7 +246,7 @@ func (w *fileWatcher) watch(ctx unison.Canceler) {
 		}
 		select {
 		case <-ctx.Done():
-			return
+			return false
 		case w.events <- e:
 		}
 	}
@@ -213,7 +261,7 @@ func (w *fileWatcher) watch(ctx unison.Canceler) {
 		}
 		select {
 		case <-ctx.Done():
-			return
+			return false
 		case w.events <- createEvent(path, *fd):
 			createdCount++
 		}
@@ -228,7 +276,7 @@ func (w *fileWatcher) watch(ctx unison.Canceler) {
 		"created", createdCount,
 	).Debugf("File scan complete")
 
-	w.prev = paths
+	return true
 }
 
 func createEvent(path string, fd loginp.FileDescriptor) loginp.FSEvent {
@@ -271,6 +319,9 @@ type fileScannerConfig struct {
 	Symlinks      bool              `config:"symlinks"`
 	RecursiveGlob bool              `config:"recursive_glob"`
 	Fingerprint   fingerprintConfig `config:"fingerprint"`
+	// Compression set to auto reads files with a .gz or .zst extension
+	// as compressed files.
+	Compression string `config:"compression"`
 }
 
 func defaultFileScannerConfig() fileScannerConfig {
@@ -282,6 +333,7 @@ func defaultFileScannerConfig() fileScannerConfig {
 			Offset:  0,
 			Length:  DefaultFingerprintSize,
 		},
+		Compression: compressionNone,
 	}
 }
 
@@ -383,19 +435,8 @@ func (s *fileScanner) GetFiles() map[string]loginp.FileDescriptor {
 			}
 			uniqueFiles[filename] = struct{}{}
 
-			it, err := s.getIngestTarget(filename)
-			if err != nil {
-				s.log.Debugf("cannot create an ingest target for file %q: %s", filename, err)
-				continue
-			}
-
-			fd, err := s.toFileDescriptor(&it)
-			if errors.Is(err, errFileTooSmall) {
-				s.log.Debugf("cannot start ingesting from file %q: %s", filename, err)
-				continue
-			}
-			if err != nil {
-				s.log.Warnf("cannot create a file descriptor for an ingest target %q: %s", filename, err)
+			fd, ok := s.describe(filename)
+			if !ok {
 				continue
 			}
 
@@ -412,6 +453,37 @@ func (s *fileScanner) GetFiles() map[string]loginp.FileDescriptor {
 	return fdByName
 }
 
+// describe returns the file descriptor of a file, or false if the file must
+// not be ingested.
+func (s *fileScanner) describe(filename string) (loginp.FileDescriptor, bool) {
+	it, err := s.getIngestTarget(filename)
+	if err != nil {
+		s.log.Debugf("cannot create an ingest target for file %q: %s", filename, err)
+		return loginp.FileDescriptor{}, false
+	}
+
+	fd, err := s.toFileDescriptor(&it)
+	if errors.Is(err, errFileTooSmall) {
+		s.log.Debugf("cannot start ingesting from file %q: %s", filename, err)
+		return loginp.FileDescriptor{}, false
+	}
+	if err != nil {
+		s.log.Warnf("cannot create a file descriptor for an ingest target %q: %s", filename, err)
+		return loginp.FileDescriptor{}, false
+	}
+	return fd, true
+}
+
+// matches tells whether a filename matches one of the configured paths.
+func (s *fileScanner) matches(filename string) bool {
+	for _, path := range s.paths {
+		if matched, _ := filepath.Match(path, filename); matched {
+			return true
+		}
+	}
+	return false
+}
+
 type ingestTarget struct {
 	filename         string
 	originalFilename string
@@ -476,8 +548,16 @@ func (s *fileScanner) getIngestTarget(filename string) (it ingestTarget, err err
 func (s *fileScanner) toFileDescriptor(it *ingestTarget) (fd loginp.FileDescriptor, err error) {
 	fd.Filename = it.filename
 	fd.Info = it.info
+	if s.cfg.Compression == compressionAuto {
+		fd.Compression = readfile.CompressionFromPath(it.originalFilename)
+	}
 
 	if s.cfg.Fingerprint.Enabled {
+		if fd.Compression != readfile.CompressionNone {
+			fd.Fingerprint, err = s.compressedFingerprint(it, fd.Compression)
+			return fd, err
+		}
+
 		fileSize := it.info.Size()
 		// we should not open the file if we know it's too small
 		minSize := s.cfg.Fingerprint.Offset + s.cfg.Fingerprint.Length
@@ -514,6 +594,52 @@ func (s *fileScanner) toFileDescriptor(it *ingestTarget) (fd loginp.FileDescript
 	return fd, nil
 }
 
+// compressedFingerprint computes the fingerprint of a compressed file from
+// its decompressed content, so it matches the fingerprint of the file it was
+// compressed from.
+func (s *fileScanner) compressedFingerprint(it *ingestTarget, c readfile.Compression) (string, error) {
+	file, err := os.Open(it.originalFilename)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %q for fingerprinting: %w", it.originalFilename, err)
+	}
+	defer file.Close()
+
+	r, err := readfile.NewDecompressReader(file, c)
+	if err != nil {
+		return "", compressedFingerprintError(it.filename, err)
+	}
+	defer r.Close()
+
+	if s.cfg.Fingerprint.Offset != 0 {
+		_, err = io.CopyN(io.Discard, r, s.cfg.Fingerprint.Offset)
+		if err != nil {
+			return "", compressedFingerprintError(it.filename, err)
+		}
+	}
+
+	s.hasher.Reset()
+	lr := io.LimitReader(r, s.cfg.Fingerprint.Length)
+	written, err := io.CopyBuffer(s.hasher, lr, s.readBuffer)
+	if err != nil {
+		return "", compressedFingerprintError(it.filename, err)
+	}
+	if written != s.cfg.Fingerprint.Length {
+		return "", fmt.Errorf("decompressed content of %q is %d bytes, expected at least %d bytes for fingerprinting: %w", it.filename, s.cfg.Fingerprint.Offset+written, s.cfg.Fingerprint.Offset+s.cfg.Fingerprint.Length, errFileTooSmall)
+	}
+
+	return hex.EncodeToString(s.hasher.Sum(nil)), nil
+}
+
+// compressedFingerprintError reports a compressed file that ends before
+// the fingerprint could be computed as too small, it is usually still
+// being written.
+func compressedFingerprintError(filename string, err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("compressed file %q is too short for fingerprinting: %w", filename, errFileTooSmall)
+	}
+	return fmt.Errorf("failed to decompress %q for fingerprinting: %w", filename, err)
+}
+
 func (s *fileScanner) isFileExcluded(file string) bool {
 	return len(s.cfg.ExcludedFiles) > 0 && s.matchAny(s.cfg.ExcludedFiles, file)
 }
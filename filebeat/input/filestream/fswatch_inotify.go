@@ -0,0 +1,280 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filestream
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-concert/unison"
+	"github.com/fsnotify/fsnotify"
+
+	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
+)
+
+// inotifyBatchInterval is how long changes are collected before being
+// compared, so a burst of writes to a file is reported once.
+const inotifyBatchInterval = 250 * time.Millisecond
+
+// inotifyWatcher creates events from the inotify events of the directories
+// holding the files, rather than from periodic scans. Only the files that
+// changed are compared to their previous state. All the files are rescanned
+// at start, every rescan interval, when a directory is created or removed
+// and when the inotify queue overflows, to catch the missed changes.
+type inotifyWatcher struct {
+	*fileWatcher
+	scanner *fileScanner
+	// dirs holds the watched directories.
+	dirs map[string]struct{}
+}
+
+func newInotifyWatcher(w *fileWatcher, scanner *fileScanner) (loginp.FSWatcher, error) {
+	return &inotifyWatcher{
+		fileWatcher: w,
+		scanner:     scanner,
+		dirs:        map[string]struct{}{},
+	}, nil
+}
+
+func (w *inotifyWatcher) Run(ctx unison.Canceler) {
+	defer close(w.events)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		w.log.Errorf("Failed to create the inotify watcher, falling back to polling: %v", err)
+		w.poll(ctx)
+		return
+	}
+	defer watcher.Close()
+
+	if !w.rescanOrPoll(ctx, watcher) {
+		return
+	}
+
+	rescanTicker := time.NewTicker(w.cfg.RescanInterval)
+	defer rescanTicker.Stop()
+
+	dirty := map[string]struct{}{}
+	needsRescan := false
+	var batch <-chan time.Time
+
+	handle := func(event fsnotify.Event) {
+		switch {
+		case w.isDirEvent(event):
+			needsRescan = true
+		case w.scanner.matches(event.Name):
+			dirty[event.Name] = struct{}{}
+		default:
+			return
+		}
+		if batch == nil {
+			batch = time.After(inotifyBatchInterval)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			handle(event)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.log.Warn("The inotify queue overflowed, rescanning all files")
+			} else {
+				w.log.Warnf("Error from the inotify watcher, rescanning all files: %v", err)
+			}
+			needsRescan = true
+			if batch == nil {
+				batch = time.After(inotifyBatchInterval)
+			}
+
+		case <-rescanTicker.C:
+			batch, needsRescan = nil, false
+			clear(dirty)
+			if !w.rescanOrPoll(ctx, watcher) {
+				return
+			}
+
+		case <-batch:
+			// Take the pending events, so both events of a rename end
+			// up in the same batch.
+		drain:
+			for {
+				select {
+				case event, ok := <-watcher.Events:
+					if !ok {
+						return
+					}
+					handle(event)
+				default:
+					break drain
+				}
+			}
+			batch = nil
+
+			if needsRescan {
+				needsRescan = false
+				clear(dirty)
+				if !w.rescanOrPoll(ctx, watcher) {
+					return
+				}
+				continue
+			}
+			w.update(ctx, dirty)
+			clear(dirty)
+		}
+	}
+}
+
+// isDirEvent tells whether an event changes the directories to watch.
+func (w *inotifyWatcher) isDirEvent(event fsnotify.Event) bool {
+	if _, watched := w.dirs[event.Name]; watched {
+		return event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename)
+	}
+	if !event.Has(fsnotify.Create) {
+		return false
+	}
+	info, err := os.Lstat(event.Name)
+	return err == nil && info.IsDir()
+}
+
+// rescanOrPoll rescans all the files. If the directories can't be watched,
+// it polls the files until ctx is cancelled and returns false.
+func (w *inotifyWatcher) rescanOrPoll(ctx unison.Canceler, watcher *fsnotify.Watcher) bool {
+	if err := w.rescan(ctx, watcher); err != nil {
+		w.log.Errorf("Failed to watch the directories, falling back to polling: %v", err)
+		w.poll(ctx)
+		return false
+	}
+	return true
+}
+
+// rescan watches the directories that may hold matching files and compares
+// all the files to their previous state.
+func (w *inotifyWatcher) rescan(ctx unison.Canceler, watcher *fsnotify.Watcher) error {
+	dirs := map[string]struct{}{}
+	for _, path := range w.scanner.paths {
+		for _, dir := range watchDirs(path) {
+			dirs[dir] = struct{}{}
+		}
+	}
+
+	for dir := range w.dirs {
+		if _, found := dirs[dir]; !found {
+			// The watch is already gone if the directory was removed.
+			_ = watcher.Remove(dir)
+		}
+	}
+	for dir := range dirs {
+		if _, found := w.dirs[dir]; found {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+	}
+	w.dirs = dirs
+
+	w.watch(ctx)
+	return nil
+}
+
+// update compares the given files to their previous state. A file matching
+// the configured paths under another name, like a symlink, is skipped as
+// GetFiles does.
+func (w *inotifyWatcher) update(ctx unison.Canceler, dirty map[string]struct{}) {
+	prev := make(map[string]loginp.FileDescriptor, len(dirty))
+	paths := make(map[string]loginp.FileDescriptor, len(dirty))
+	var knownIDs map[string]struct{}
+
+	for path := range dirty {
+		if fd, found := w.prev[path]; found {
+			prev[path] = fd
+		}
+		fd, ok := w.scanner.describe(path)
+		if !ok {
+			continue
+		}
+		if _, found := w.prev[path]; !found {
+			if knownIDs == nil {
+				knownIDs = make(map[string]struct{}, len(w.prev))
+				for known, knownFD := range w.prev {
+					if _, changed := dirty[known]; !changed {
+						knownIDs[knownFD.FileID()] = struct{}{}
+					}
+				}
+			}
+			if _, found := knownIDs[fd.FileID()]; found {
+				w.log.Debugf("%q points to an already known ingest target. Skipping", path)
+				continue
+			}
+		}
+		paths[path] = fd
+	}
+
+	if !w.compare(ctx, prev, paths) {
+		return
+	}
+	for path := range dirty {
+		delete(w.prev, path)
+	}
+	for path, fd := range paths {
+		w.prev[path] = fd
+	}
+}
+
+// watchDirs returns the existing directories to watch to be notified of
+// the changes of the files matching a pattern. Directories matching a
+// pattern are watched along with their parents, to be notified of their
+// creation.
+func watchDirs(pattern string) []string {
+	var dirs []string
+	dir := filepath.Dir(pattern)
+	for {
+		matches, _ := filepath.Glob(dir)
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				dirs = append(dirs, match)
+			}
+		}
+		parent := filepath.Dir(dir)
+		if !hasMeta(dir) || parent == dir {
+			return dirs
+		}
+		dir = parent
+	}
+}
+
+// hasMeta tells whether a path has glob characters.
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[\`)
+}
@@ -0,0 +1,171 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filestream
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
+	"github.com/elastic/beats/v7/libbeat/common/file"
+)
+
+func TestInotifyWatcher(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "*.log")}
+	// Long intervals, so only inotify events are reported.
+	cfgStr := `
+scanner:
+  watcher: inotify
+  check_interval: 1h
+  rescan_interval: 1h
+  resend_on_touch: true
+  fingerprint.enabled: false
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fw := createWatcherWithConfig(t, paths, cfgStr)
+	require.IsType(t, &inotifyWatcher{}, fw)
+	go fw.Run(ctx)
+
+	created := filepath.Join(dir, "created.log")
+	renamed := filepath.Join(dir, "renamed.log")
+
+	steps := []struct {
+		name   string
+		change func() error
+		event  loginp.FSEvent
+	}{
+		{
+			name:   "detects a new file",
+			change: func() error { return os.WriteFile(created, []byte("hello"), 0644) },
+			event:  createEvent(created, testDescriptor(created, 5)),
+		},
+		{
+			name: "ignores files not matching the paths",
+			change: func() error {
+				if err := os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("hello"), 0644); err != nil {
+					return err
+				}
+				return appendToFile(created, "world")
+			},
+			event: writeEvent(created, testDescriptor(created, 10)),
+		},
+		{
+			name:   "detects a file rename",
+			change: func() error { return os.Rename(created, renamed) },
+			event:  renamedEvent(created, renamed, testDescriptor(renamed, 10)),
+		},
+		{
+			name:   "detects a file truncate",
+			change: func() error { return os.Truncate(renamed, 2) },
+			event:  truncateEvent(renamed, testDescriptor(renamed, 2)),
+		},
+		{
+			name: "emits truncate on touch when resend_on_touch is enabled",
+			change: func() error {
+				later := time.Now().Add(time.Hour)
+				return os.Chtimes(renamed, later, later)
+			},
+			event: truncateEvent(renamed, testDescriptor(renamed, 2)),
+		},
+		{
+			name:   "detects a file remove",
+			change: func() error { return os.Remove(renamed) },
+			event:  deleteEvent(renamed, testDescriptor(renamed, 2)),
+		},
+	}
+
+	for _, step := range steps {
+		require.NoError(t, step.change(), step.name)
+		requireEqualEvents(t, step.event, fw.Event())
+	}
+
+	cancel()
+	require.Equal(t, loginp.OpDone, fw.Event().Op, "events must be closed once the watcher stops")
+}
+
+func TestInotifyWatcherNewDirectory(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "*", "app.log")}
+	cfgStr := `
+scanner:
+  watcher: inotify
+  check_interval: 1h
+  rescan_interval: 1h
+  fingerprint.enabled: false
+`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fw := createWatcherWithConfig(t, paths, cfgStr)
+	go fw.Run(ctx)
+
+	sub := filepath.Join(dir, "sub")
+	filename := filepath.Join(sub, "app.log")
+	require.NoError(t, os.Mkdir(sub, 0755))
+	require.NoError(t, os.WriteFile(filename, []byte("hello"), 0644))
+	requireEqualEvents(t, createEvent(filename, testDescriptor(filename, 5)), fw.Event())
+
+	require.NoError(t, appendToFile(filename, "world"))
+	requireEqualEvents(t, writeEvent(filename, testDescriptor(filename, 10)), fw.Event())
+}
+
+func TestWatchDirs(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"a", "b", "a/nested"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, sub), 0755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c"), nil, 0644))
+
+	require.ElementsMatch(t, []string{dir}, watchDirs(filepath.Join(dir, "*.log")))
+	require.ElementsMatch(t,
+		[]string{filepath.Join(dir, "a"), filepath.Join(dir, "b"), dir},
+		watchDirs(filepath.Join(dir, "*", "*.log")))
+	require.ElementsMatch(t,
+		[]string{filepath.Join(dir, "a", "nested"), filepath.Join(dir, "a"), filepath.Join(dir, "b"), dir},
+		watchDirs(filepath.Join(dir, "*", "*", "*.log")))
+	require.Empty(t, watchDirs(filepath.Join(dir, "missing", "*.log")))
+}
+
+func testDescriptor(filename string, size int64) loginp.FileDescriptor {
+	return loginp.FileDescriptor{
+		Filename: filename,
+		Info:     file.ExtendFileInfo(&testFileInfo{name: filepath.Base(filename), size: size}),
+	}
+}
+
+func appendToFile(filename, data string) error {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(data)
+	return err
+}
@@ -18,7 +18,9 @@
 package filestream
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -27,10 +29,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/require"
 
 	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
 	"github.com/elastic/beats/v7/libbeat/common/file"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
 )
@@ -848,6 +853,89 @@ scanner:
 
 const benchmarkFileCount = 1000
 
+func TestFileScannerCompressedFiles(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "app.log*")}
+
+	var content []byte
+	for i := range 64 {
+		// hashes keep the compressed files larger than the fingerprint
+		content = fmt.Appendf(content, "log line %d %x\n", i, sha256.Sum256([]byte{byte(i)}))
+	}
+	undersized := content[:100]
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, err := gw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	zw, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	zst := zw.EncodeAll(content, nil)
+	require.NoError(t, zw.Close())
+	undersizedZst := zw.EncodeAll(undersized, nil)
+
+	files := map[string][]byte{
+		"app.log.1":     content,
+		"app.log.2.gz":  gz.Bytes(),
+		"app.log.3.zst": zst,
+		"app.log.4.zst": undersizedZst,
+		// the scanner must not fail on a file that is still being compressed
+		"app.log.5.gz": gz.Bytes()[:8],
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+	}
+
+	cfg := fileScannerConfig{
+		Fingerprint: fingerprintConfig{
+			Enabled: true,
+			Offset:  64,
+			Length:  1024,
+		},
+		Compression: compressionAuto,
+	}
+	s, err := newFileScanner(paths, cfg)
+	require.NoError(t, err)
+
+	// the compressed files have the same fingerprint as the file they were
+	// compressed from, so they are reported once, as the plain file.
+	got := s.GetFiles()
+	require.Len(t, got, 1, filenames(got))
+	plain := got[filepath.Join(dir, "app.log.1")]
+	require.NotEmpty(t, plain.Fingerprint)
+	require.Equal(t, readfile.CompressionNone, plain.Compression)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "app.log.1")))
+	got = s.GetFiles()
+	require.Len(t, got, 1, filenames(got))
+	for filename, fd := range got {
+		require.Equal(t, plain.Fingerprint, fd.Fingerprint, filename)
+		require.Equal(t, readfile.CompressionFromPath(filename), fd.Compression, filename)
+	}
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "app.log.2.gz")))
+	got = s.GetFiles()
+	require.Len(t, got, 1, filenames(got))
+	fd, ok := got[filepath.Join(dir, "app.log.3.zst")]
+	require.True(t, ok, filenames(got))
+	require.Equal(t, plain.Fingerprint, fd.Fingerprint)
+	require.Equal(t, readfile.CompressionZstd, fd.Compression)
+
+	t.Run("compression disabled", func(t *testing.T) {
+		cfg.Compression = compressionNone
+		s, err := newFileScanner(paths, cfg)
+		require.NoError(t, err)
+
+		got := s.GetFiles()
+		fd, ok := got[filepath.Join(dir, "app.log.3.zst")]
+		require.True(t, ok, filenames(got))
+		require.NotEqual(t, plain.Fingerprint, fd.Fingerprint)
+		require.Equal(t, readfile.CompressionNone, fd.Compression)
+	})
+}
+
 func BenchmarkGetFiles(b *testing.B) {
 	dir := b.TempDir()
 	basenameFormat := "file-%d.log"
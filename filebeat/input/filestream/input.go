@@ -31,6 +31,7 @@ import (
 
 	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
 	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common/cleanup"
 	"github.com/elastic/beats/v7/libbeat/common/file"
 	"github.com/elastic/beats/v7/libbeat/common/match"
@@ -50,6 +51,8 @@ const pluginName = "filestream"
 
 type state struct {
 	Offset int64 `json:"offset" struct:"offset"`
+	// Completed is set once a compressed file has been fully read.
+	Completed bool `json:"completed,omitempty" struct:"completed,omitempty"`
 }
 
 type fileMeta struct {
@@ -65,6 +68,9 @@ type filestream struct {
 	closerConfig    closerConfig
 	parsers         parser.Config
 	takeOver        takeOverConfig
+
+	// replay is set if the input is in replay mode.
+	replay *replay
 }
 
 // Plugin creates a new filestream input plugin for creating a stateful input.
@@ -91,7 +97,18 @@ func configure(cfg *conf.C) (loginp.Prospector, loginp.Harvester, error) {
 		return nil, nil, err
 	}
 
-	prospector, err := newProspector(config)
+	var rp *replay
+	var prospector loginp.Prospector
+	var err error
+	if config.Replay.Enabled {
+		rp, err = newReplay(config.Replay)
+		if err != nil {
+			return nil, nil, err
+		}
+		prospector, err = newReplayProspector(config, rp)
+	} else {
+		prospector, err = newProspector(config)
+	}
 	if err != nil {
 		return nil, nil, fmt.Errorf("cannot create prospector: %w", err)
 	}
@@ -107,6 +124,7 @@ func configure(cfg *conf.C) (loginp.Prospector, loginp.Harvester, error) {
 		closerConfig:    config.Close,
 		parsers:         config.Reader.Parsers,
 		takeOver:        config.TakeOver,
+		replay:          rp,
 	}
 
 	return prospector, filestream, nil
@@ -141,6 +159,16 @@ func (inp *filestream) Run(
 
 	log := ctx.Logger.With("path", fs.newPath).With("state-id", src.Name())
 	state := initState(log, cursor, fs)
+	if inp.replay != nil {
+		// Replays read every file from the start and never update
+		// their cursor.
+		defer inp.replay.fileDone()
+		state.Offset, state.Completed = 0, false
+	}
+	if state.Completed {
+		log.Debug("Compressed file has already been read completely")
+		return nil
+	}
 
 	r, truncated, err := inp.open(log, ctx.Cancelation, fs, state.Offset)
 	if err != nil {
@@ -168,7 +196,7 @@ func (inp *filestream) Run(
 
 	// The caller of Run already reports the error and filters out errors that
 	// must not be reported, like 'context cancelled'.
-	return inp.readFromSource(ctx, log, r, fs.newPath, state, publisher, metrics)
+	return inp.readFromSource(ctx, log, r, fs, state, publisher, metrics)
 }
 
 func initState(log *logp.Logger, c loginp.Cursor, s fileSource) state {
@@ -192,7 +220,18 @@ func (inp *filestream) open(
 	offset int64,
 ) (reader.Reader, bool, error) {
 
-	f, encoding, truncated, err := inp.openFile(log, fs.newPath, offset)
+	var (
+		f            *os.File
+		decompressed io.ReadCloser
+		encoding     encoding.Encoding
+		truncated    bool
+		err          error
+	)
+	if fs.desc.Compression != readfile.CompressionNone {
+		f, decompressed, encoding, err = inp.openCompressedFile(fs.newPath, fs.desc.Compression, offset)
+	} else {
+		f, encoding, truncated, err = inp.openFile(log, fs.newPath, offset)
+	}
 	if err != nil {
 		return nil, truncated, err
 	}
@@ -203,13 +242,17 @@ func (inp *filestream) open(
 
 	ok := false // used for cleanup
 	defer cleanup.IfNot(&ok, cleanup.IgnoreError(f.Close))
+	if decompressed != nil {
+		defer cleanup.IfNot(&ok, cleanup.IgnoreError(decompressed.Close))
+	}
 
 	log.Debug("newLogFileReader with config.MaxBytes:", inp.readerConfig.MaxBytes)
 
 	// if the file is archived, it means that it is not going to be updated in the future
-	// thus, when EOF is reached, it can be closed
+	// thus, when EOF is reached, it can be closed. The same goes for compressed files,
+	// which are read once, and for all files in replay mode.
 	closerCfg := inp.closerConfig
-	if fs.archived && !inp.closerConfig.Reader.OnEOF {
+	if (fs.archived || decompressed != nil || inp.replay != nil) && !inp.closerConfig.Reader.OnEOF {
 		closerCfg = closerConfig{
 			Reader: readerCloserConfig{
 				OnEOF:         true,
@@ -225,6 +268,7 @@ func (inp *filestream) open(
 	if err != nil {
 		return nil, truncated, err
 	}
+	logReader.decompressed = decompressed
 
 	dbgReader, err := debug.AppendReaders(logReader)
 	if err != nil {
@@ -272,34 +316,13 @@ func (inp *filestream) openFile(
 	path string,
 	offset int64,
 ) (*os.File, encoding.Encoding, bool, error) {
-	fi, err := os.Stat(path)
-	if err != nil {
-		return nil, nil, false, fmt.Errorf("failed to stat source file %s: %w", path, err)
-	}
-
-	// it must be checked if the file is not a named pipe before we try to open it
-	// if it is a named pipe os.OpenFile fails, so there is no need to try opening it.
-	if fi.Mode()&os.ModeNamedPipe != 0 {
-		return nil, nil, false, fmt.Errorf("failed to open file %s, named pipes are not supported", fi.Name())
-	}
-
-	f, err := file.ReadOpen(path)
+	f, fi, err := openRegularFile(path)
 	if err != nil {
-		return nil, nil, false, fmt.Errorf("failed opening %s: %w", path, err)
+		return nil, nil, false, err
 	}
 	ok := false
 	defer cleanup.IfNot(&ok, cleanup.IgnoreError(f.Close))
 
-	fi, err = f.Stat()
-	if err != nil {
-		return nil, nil, false, fmt.Errorf("failed to stat source file %s: %w", path, err)
-	}
-
-	err = checkFileBeforeOpening(fi)
-	if err != nil {
-		return nil, nil, false, err
-	}
-
 	truncated := false
 	if fi.Size() < offset {
 		// if the file was truncated we need to reset the offset and notify
@@ -325,6 +348,80 @@ func (inp *filestream) openFile(
 	return f, encoding, truncated, nil
 }
 
+// openCompressedFile opens a compressed file and returns it alongside a reader
+// of its decompressed content. As compressed files cannot be seeked, the
+// decompressed content before offset is read and discarded.
+func (inp *filestream) openCompressedFile(
+	path string,
+	compression readfile.Compression,
+	offset int64,
+) (*os.File, io.ReadCloser, encoding.Encoding, error) {
+	f, _, err := openRegularFile(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ok := false
+	defer cleanup.IfNot(&ok, cleanup.IgnoreError(f.Close))
+
+	decompressed, err := readfile.NewDecompressReader(f, compression)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+	defer cleanup.IfNot(&ok, cleanup.IgnoreError(decompressed.Close))
+
+	if offset > 0 {
+		_, err = io.CopyN(io.Discard, decompressed, offset)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to skip the first %d decompressed bytes of %s: %w", offset, path, err)
+		}
+	}
+
+	encoding, err := inp.encodingFactory(decompressed)
+	if err != nil {
+		if errors.Is(err, transform.ErrShortSrc) {
+			return nil, nil, nil, fmt.Errorf("initialising encoding for '%v' failed due to file being too short", f)
+		}
+		return nil, nil, nil, fmt.Errorf("initialising encoding for '%v' failed: %w", f, err)
+	}
+
+	ok = true // no need to close the file
+	return f, decompressed, encoding, nil
+}
+
+// openRegularFile opens a file for reading, failing if it is not a regular file.
+func openRegularFile(path string) (*os.File, os.FileInfo, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat source file %s: %w", path, err)
+	}
+
+	// it must be checked if the file is not a named pipe before we try to open it
+	// if it is a named pipe os.OpenFile fails, so there is no need to try opening it.
+	if fi.Mode()&os.ModeNamedPipe != 0 {
+		return nil, nil, fmt.Errorf("failed to open file %s, named pipes are not supported", fi.Name())
+	}
+
+	f, err := file.ReadOpen(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed opening %s: %w", path, err)
+	}
+	ok := false
+	defer cleanup.IfNot(&ok, cleanup.IgnoreError(f.Close))
+
+	fi, err = f.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat source file %s: %w", path, err)
+	}
+
+	err = checkFileBeforeOpening(fi)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ok = true // no need to close the file
+	return f, fi, nil
+}
+
 func checkFileBeforeOpening(fi os.FileInfo) error {
 	if !fi.Mode().IsRegular() {
 		return fmt.Errorf("tried to open non regular file: %q %s", fi.Mode(), fi.Name())
@@ -348,11 +445,13 @@ func (inp *filestream) readFromSource(
 	ctx input.Context,
 	log *logp.Logger,
 	r reader.Reader,
-	path string,
+	fs fileSource,
 	s state,
 	p loginp.Publisher,
 	metrics *loginp.Metrics,
 ) error {
+	path := fs.newPath
+
 	metrics.FilesOpened.Inc()
 	metrics.HarvesterOpenFiles.Inc()
 	metrics.HarvesterStarted.Inc()
@@ -367,8 +466,13 @@ func (inp *filestream) readFromSource(
 				log.Infof("File was truncated, nothing to read. Path='%s'", path)
 			} else if errors.Is(err, ErrClosed) {
 				log.Debugf("Reader was closed. Closing. Path='%s'", path)
+			} else if errors.Is(err, ErrIncompleteCompressedFile) {
+				log.Debugf("Compressed file is incomplete, it might still be written. Closing. Path='%s'", path)
 			} else if errors.Is(err, io.EOF) {
 				log.Debugf("EOF has been reached. Closing. Path='%s'", path)
+				if fs.desc.Compression != readfile.CompressionNone && inp.replay == nil {
+					return inp.completeSource(p, s)
+				}
 			} else {
 				log.Errorf("Read line error: %v", err)
 				metrics.ProcessingErrors.Inc()
@@ -378,6 +482,9 @@ func (inp *filestream) readFromSource(
 		}
 
 		s.Offset += int64(message.Bytes) + int64(message.Offset)
+		if inp.replay != nil {
+			inp.replay.metrics.bytesRead.Add(uint64(message.Bytes) + uint64(message.Offset))
+		}
 
 		flags, err := message.Fields.GetValue("log.flags")
 		if err == nil {
@@ -400,7 +507,16 @@ func (inp *filestream) readFromSource(
 			_ = mapstr.AddTags(message.Fields, []string{"take_over"})
 		}
 
-		if err := p.Publish(message.ToEvent(), s); err != nil {
+		event := message.ToEvent()
+		var cursor interface{} = s
+		if inp.replay != nil {
+			if !inp.replay.keep(log, event) {
+				continue
+			}
+			cursor = nil
+		}
+
+		if err := p.Publish(event, cursor); err != nil {
 			metrics.ProcessingErrors.Inc()
 			return err
 		}
@@ -411,6 +527,14 @@ func (inp *filestream) readFromSource(
 	return nil
 }
 
+// completeSource marks a compressed file as completed in the registry, so
+// it is not read again. The state is updated by publishing an empty event,
+// which is filtered out by the pipeline, but still acknowledged.
+func (inp *filestream) completeSource(p loginp.Publisher, s state) error {
+	s.Completed = true
+	return p.Publish(beat.Event{}, s)
+}
+
 // isDroppedLine decides if the line is exported or not based on
 // the include_lines and exclude_lines options.
 func (inp *filestream) isDroppedLine(log *logp.Logger, line string) bool {
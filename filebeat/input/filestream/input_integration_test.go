@@ -22,7 +22,11 @@ package filestream
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
 	"strconv"
@@ -31,6 +35,8 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid/v5"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/unicode"
@@ -1161,3 +1167,181 @@ func TestRotatingCloseInactiveLowWriteRate(t *testing.T) {
 	cancelInput()
 	env.waitUntilInputStops()
 }
+
+func TestFilestreamCompressedRotatedFile(t *testing.T) {
+	compressors := map[string]func(t *testing.T, w io.Writer) io.WriteCloser{
+		".gz": func(t *testing.T, w io.Writer) io.WriteCloser {
+			return gzip.NewWriter(w)
+		},
+		".zst": func(t *testing.T, w io.Writer) io.WriteCloser {
+			zw, err := zstd.NewWriter(w)
+			require.NoError(t, err)
+			return zw
+		},
+	}
+
+	for ext, newCompressor := range compressors {
+		t.Run(ext, func(t *testing.T) {
+			env := newInputTestingEnvironment(t)
+
+			testlogName := "test.log"
+			id := "fake-ID-" + uuid.Must(uuid.NewV4()).String()
+			cfg := map[string]interface{}{
+				"id":                                    id,
+				"paths":                                 []string{env.abspath(testlogName) + "*"},
+				"prospector.scanner.check_interval":     "1ms",
+				"prospector.scanner.compression":        "auto",
+				"prospector.scanner.fingerprint.length": 64,
+			}
+
+			var lines []string
+			for i := range 10 {
+				lines = append(lines, fmt.Sprintf("log line %02d, long enough to be fingerprinted", i))
+			}
+			read := []byte(strings.Join(lines[:5], "\n") + "\n")
+			unread := []byte(strings.Join(lines[5:], "\n") + "\n")
+
+			env.mustWriteToFile(testlogName, read)
+
+			ctx, cancelInput := context.WithCancel(context.Background())
+			env.startInput(ctx, id, env.mustCreateInput(cfg))
+			env.waitUntilEventCount(5)
+			cancelInput()
+			env.waitUntilInputStops()
+
+			// The file is written to, rotated and compressed while the
+			// input is stopped.
+			env.mustAppendToFile(testlogName, unread)
+			compressed := &bytes.Buffer{}
+			w := newCompressor(t, compressed)
+			_, err := w.Write(append(read, unread...))
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+			env.mustWriteToFile(testlogName+".1"+ext, compressed.Bytes())
+			env.mustRemoveFile(testlogName)
+
+			ctx, cancelInput = context.WithCancel(context.Background())
+			env.resetManager()
+			env.startInput(ctx, id, env.mustCreateInput(cfg))
+			env.waitUntilEventCount(10)
+			env.requireEventsReceived(lines)
+
+			fingerprint := sha256.Sum256(read[:64])
+			key := "filestream::" + id + "::fingerprint::" + hex.EncodeToString(fingerprint[:])
+			require.Eventually(t, func() bool {
+				entry, err := env.getRegistryState(key)
+				require.NoError(t, err)
+				return entry.Cursor.Completed
+			}, 10*time.Second, 10*time.Millisecond, "compressed file is not completed in the registry")
+			env.requireOffsetInRegistryByID(key, len(read)+len(unread))
+
+			cancelInput()
+			env.waitUntilInputStops()
+
+			// The completed file is not read again.
+			ctx, cancelInput = context.WithCancel(context.Background())
+			env.resetManager()
+			env.startInput(ctx, id, env.mustCreateInput(cfg))
+			time.Sleep(100 * time.Millisecond)
+			cancelInput()
+			env.waitUntilInputStops()
+			env.waitUntilEventCount(10)
+		})
+	}
+}
+
+// TestFilestreamReplay checks that a replay reads a file from the start,
+// publishes only the lines within the time range, stops on its own and
+// leaves the registry entries of the live input untouched.
+func TestFilestreamReplay(t *testing.T) {
+	env := newInputTestingEnvironment(t)
+
+	testlogName := "test.log"
+	lines := []string{
+		"2025-06-01T09:59:59Z before the range",
+		"2025-06-01T10:00:00Z first line in the range",
+		"2025-06-01T11:59:59Z last line in the range",
+		"2025-06-01T12:00:00Z after the range",
+	}
+	content := []byte(strings.Join(lines, "\n") + "\n")
+	env.mustWriteToFile(testlogName, content)
+
+	liveID := "fake-ID-" + uuid.Must(uuid.NewV4()).String()
+	ctx, cancelInput := context.WithCancel(context.Background())
+	env.startInput(ctx, liveID, env.mustCreateInput(map[string]any{
+		"id":                                     liveID,
+		"paths":                                  []string{env.abspath(testlogName)},
+		"prospector.scanner.check_interval":      "1ms",
+		"prospector.scanner.fingerprint.enabled": false,
+		"file_identity.native":                   map[string]any{},
+	}))
+	env.waitUntilEventCount(len(lines))
+	env.requireOffsetInRegistry(testlogName, liveID, len(content))
+	cancelInput()
+	env.waitUntilInputStops()
+
+	replayID := "fake-ID-" + uuid.Must(uuid.NewV4()).String()
+	env.resetManager()
+	env.startInput(context.Background(), replayID, env.mustCreateInput(map[string]any{
+		"id":                                     replayID,
+		"paths":                                  []string{env.abspath(testlogName)},
+		"prospector.scanner.fingerprint.enabled": false,
+		"file_identity.native":                   map[string]any{},
+		"replay.enabled":                         true,
+		"replay.since":                           "2025-06-01T10:00:00Z",
+		"replay.until":                           "2025-06-01T12:00:00Z",
+		"replay.timestamp.pattern":               `^(\S+)`,
+		"replay.timestamp.layouts":               []string{time.RFC3339},
+	}))
+
+	// The replay input stops once the file has been read.
+	env.waitUntilInputStops()
+	env.waitUntilEventCount(len(lines) + 2)
+	env.requireEventsReceived(append(lines, lines[1], lines[2]))
+
+	env.requireOffsetInRegistry(testlogName, liveID, len(content))
+
+	// The state of the replay is removed, or marked for removal, once
+	// the replay completes.
+	fi, err := os.Stat(env.abspath(testlogName))
+	require.NoError(t, err)
+	inputStore, _ := env.stateStore.StoreFor("")
+	var replayEntry struct {
+		TTL time.Duration `json:"ttl"`
+	}
+	err = inputStore.Get(getIDFromPath(env.abspath(testlogName), ".replay::"+replayID, fi), &replayEntry)
+	if err == nil {
+		require.Zero(t, replayEntry.TTL, "replay state must be marked for removal")
+	}
+}
+
+// TestFilestreamReplayPipelineConnectFails checks that a replay stops when
+// its harvesters can't connect to the pipeline.
+func TestFilestreamReplayPipelineConnectFails(t *testing.T) {
+	env := newInputTestingEnvironment(t)
+	env.pipeline.connectErr = errors.New("pipeline is closed")
+
+	testlogName := "test.log"
+	env.mustWriteToFile(testlogName, []byte("first line\nsecond line\n"))
+
+	id := "fake-ID-" + uuid.Must(uuid.NewV4()).String()
+	env.startInput(context.Background(), id, env.mustCreateInput(map[string]any{
+		"id":                                     id,
+		"paths":                                  []string{env.abspath(testlogName)},
+		"prospector.scanner.fingerprint.enabled": false,
+		"file_identity.native":                   map[string]any{},
+		"replay.enabled":                         true,
+	}))
+
+	stopped := make(chan struct{})
+	go func() {
+		env.waitUntilInputStops()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "the replay must stop when the pipeline can't be connected")
+	}
+	require.Empty(t, env.pipeline.GetAllEvents())
+}
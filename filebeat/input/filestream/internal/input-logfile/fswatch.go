@@ -21,6 +21,7 @@ import (
 	"github.com/elastic/go-concert/unison"
 
 	"github.com/elastic/beats/v7/libbeat/common/file"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile"
 )
 
 const (
@@ -64,6 +65,9 @@ type FileDescriptor struct {
 	Info file.ExtendedFileInfo
 	// Fingerprint is a computed hash of the file header
 	Fingerprint string
+	// Compression is the compression format of the file. Compressed
+	// files are read once, decompressing their content on the fly.
+	Compression readfile.Compression
 }
 
 // FileID returns a unique file ID
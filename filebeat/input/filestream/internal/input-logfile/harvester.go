@@ -115,6 +115,9 @@ type HarvesterGroup interface {
 	Stop(Source)
 	// StopHarvesters cancels all running Harvesters.
 	StopHarvesters() error
+	// Wait waits until all Harvesters have stopped, including the ones that
+	// failed before they could run, or until the canceler is done.
+	Wait(inputv2.Canceler) error
 }
 
 type defaultHarvesterGroup struct {
@@ -300,6 +303,11 @@ func (hg *defaultHarvesterGroup) StopHarvesters() error {
 	return hg.tg.Stop()
 }
 
+// Wait waits until all Harvesters have stopped or the canceler is done.
+func (hg *defaultHarvesterGroup) Wait(c inputv2.Canceler) error {
+	return hg.tg.Wait(ctxtool.FromCanceller(c))
+}
+
 // Lock locks a key for exclusive access and returns a resource that can be used to modify
 // the cursor state and unlock the key.
 func lock(ctx inputv2.Context, store *store, key string) (*resource, error) {
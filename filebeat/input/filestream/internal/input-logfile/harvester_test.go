@@ -20,6 +20,7 @@ package input_logfile
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -362,6 +363,25 @@ func TestDefaultHarvesterGroup(t *testing.T) {
 		assert.Equal(t, 0, mockHarvester.getRunCount())
 	})
 
+	t.Run("assert Wait returns when the pipeline can't be connected", func(t *testing.T) {
+		testLog := &testLogger{}
+		mockHarvester := &mockHarvester{onRun: correctOnRun}
+		hg := testDefaultHarvesterGroup(t, mockHarvester)
+		hg.pipeline = &MockPipeline{err: errors.New("pipeline is closed")}
+		hg.tg = task.NewGroup(0, time.Second, testLog, "")
+		inputCtx := input.Context{Logger: logp.L(), Cancelation: context.Background()}
+
+		hg.Start(inputCtx, source)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, hg.Wait(ctx), "Wait must return once the harvester gave up")
+		assert.Equal(t, 0, mockHarvester.getRunCount())
+		requireSourceRemovedFromBookkeeper(t, hg, source)
+		assert.Contains(t, testLog.String(), "error while connecting to output with pipeline")
+		require.NoError(t, hg.StopHarvesters())
+	})
+
 	t.Run("assert harvester can be restarted", func(t *testing.T) {
 		var wg sync.WaitGroup
 		mockHarvester := &mockHarvester{onRun: blockUntilCancelOnRun, wg: &wg}
@@ -513,8 +533,9 @@ func (m *MockClient) Close() error {
 
 // MockPipeline is a mock implementation of the beat.Pipeline interface.
 type MockPipeline struct {
-	c  beat.Client // Client used by the pipeline
-	mu sync.Mutex  // Mutex to synchronize access to the client
+	c   beat.Client // Client used by the pipeline
+	mu  sync.Mutex  // Mutex to synchronize access to the client
+	err error       // Error returned by ConnectWith if set
 }
 
 // ConnectWith connects the mock pipeline with a client using the provided configuration.
@@ -522,6 +543,9 @@ func (mp *MockPipeline) ConnectWith(config beat.ClientConfig) (beat.Client, erro
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
+	if mp.err != nil {
+		return nil, mp.err
+	}
 	c := &MockClient{}
 
 	mp.c = c
@@ -39,11 +39,16 @@ type managedInput struct {
 	harvester        Harvester
 	cleanTimeout     time.Duration
 	harvesterLimit   uint64
+	replay           bool
 }
 
 // Name is required to implement the v2.Input interface
 func (inp *managedInput) Name() string { return inp.harvester.Name() }
 
+// Finite reports whether the input stops on its own once all the files have
+// been read. This is only the case in replay mode.
+func (inp *managedInput) Finite() bool { return inp.replay }
+
 // Test runs the Test method for each configured source.
 func (inp *managedInput) Test(ctx input.TestContext) error {
 	return inp.prospector.Test()
@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package input_logfile
+
+import (
+	"sort"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/transform/typeconv"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// StoredEntry is a registry entry as it is written to the persistent store.
+// It allows inspecting and editing the registry while no input is running,
+// e.g. from the command line.
+type StoredEntry struct {
+	Key     string
+	TTL     time.Duration
+	Updated time.Time
+	Cursor  interface{}
+	Meta    interface{}
+}
+
+// ReadStoredEntries returns the entries of the persistent store whose keys
+// start with prefix, sorted by key. Entries that cannot be decoded are
+// logged and skipped, like when the store is opened by the inputs.
+func ReadStoredEntries(log *logp.Logger, store *statestore.Store, prefix string) ([]StoredEntry, error) {
+	states, err := readStates(log, store, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]StoredEntry, 0, len(states.table))
+	for _, r := range states.table {
+		entries = append(entries, StoredEntry{
+			Key:     r.key,
+			TTL:     r.internalState.TTL,
+			Updated: r.internalState.Updated,
+			Cursor:  r.cursor,
+			Meta:    r.cursorMeta,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
+// WriteStoredEntry writes the entry to the persistent store, replacing the
+// entry with the same key if there is one.
+func WriteStoredEntry(store *statestore.Store, e StoredEntry) error {
+	return store.Set(e.Key, state{
+		TTL:     e.TTL,
+		Updated: e.Updated,
+		Cursor:  e.Cursor,
+		Meta:    e.Meta,
+	})
+}
+
+// UnpackCursor unpacks the cursor of the entry into to.
+func (e StoredEntry) UnpackCursor(to interface{}) error {
+	return typeconv.Convert(to, e.Cursor)
+}
+
+// UnpackCursorMeta unpacks the cursor metadata of the entry into to.
+func (e StoredEntry) UnpackCursorMeta(to interface{}) error {
+	return typeconv.Convert(to, e.Meta)
+}
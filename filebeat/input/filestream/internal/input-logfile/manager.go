@@ -87,6 +87,10 @@ var errNoInputRunner = errors.New("no input runner available")
 // Deprecated: Inputs without an ID are not supported anymore.
 const globalInputID = ".global"
 
+// replayInputIDPrefix is prepended to the ID of inputs in replay mode to keep
+// their states apart from the states of live inputs.
+const replayInputIDPrefix = ".replay::"
+
 func (cim *InputManager) init() error {
 	cim.initOnce.Do(func() {
 
@@ -159,6 +163,9 @@ func (cim *InputManager) Create(config *conf.C) (v2.Input, error) {
 			Enabled bool     `config:"enabled"`
 			FromIDs []string `config:"from_ids"`
 		} `config:"take_over"`
+		Replay struct {
+			Enabled bool `config:"enabled"`
+		} `config:"replay"`
 	}{
 		CleanInactive: cim.DefaultCleanTimeout,
 	}
@@ -219,7 +226,13 @@ func (cim *InputManager) Create(config *conf.C) (v2.Input, error) {
 		return nil, errNoInputRunner
 	}
 
-	srcIdentifier, err := newSourceIdentifier(cim.Type, settings.ID)
+	// Inputs in replay mode keep their states apart from the live inputs,
+	// so a replay never changes the state of an input with the same files.
+	storeID := settings.ID
+	if settings.Replay.Enabled {
+		storeID = replayInputIDPrefix + settings.ID
+	}
+	srcIdentifier, err := newSourceIdentifier(cim.Type, storeID)
 	if err != nil {
 		return nil, fmt.Errorf("error while creating source identifier for input: %w", err)
 	}
@@ -266,6 +279,7 @@ func (cim *InputManager) Create(config *conf.C) (v2.Input, error) {
 		sourceIdentifier: srcIdentifier,
 		cleanTimeout:     settings.CleanInactive,
 		harvesterLimit:   settings.HarvesterLimit,
+		replay:           settings.Replay.Enabled,
 	}, nil
 }
 
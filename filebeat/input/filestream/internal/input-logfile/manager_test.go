@@ -275,6 +275,50 @@ paths:
 		}
 	})
 
+	t.Run("replay inputs keep their states apart", func(t *testing.T) {
+		storeReg := statestore.NewRegistry(storetest.NewMemoryStoreBackend())
+		testStore, err := storeReg.Get("test")
+		require.NoError(t, err)
+
+		log, _ := newBufferLogger()
+
+		cim := &InputManager{
+			Logger:     log,
+			StateStore: testStateStore{Store: testStore},
+			Type:       "filestream",
+			Configure: func(_ *config.C) (Prospector, Harvester, error) {
+				var wg sync.WaitGroup
+
+				return &noopProspector{}, &mockHarvester{onRun: correctOnRun, wg: &wg}, nil
+			}}
+
+		live, err := cim.Create(config.MustNewConfigFrom(`
+type: filestream
+id: live-id
+paths:
+  - /var/log/foo
+`))
+		require.NoError(t, err)
+		replay, err := cim.Create(config.MustNewConfigFrom(`
+type: filestream
+id: replay-id
+replay.enabled: true
+paths:
+  - /var/log/foo
+`))
+		require.NoError(t, err)
+
+		liveInput, ok := live.(*managedInput)
+		require.True(t, ok)
+		replayInput, ok := replay.(*managedInput)
+		require.True(t, ok)
+
+		assert.False(t, liveInput.Finite())
+		assert.True(t, replayInput.Finite())
+		assert.Equal(t, "filestream::live-id::", liveInput.sourceIdentifier.prefix)
+		assert.Equal(t, "filestream::.replay::replay-id::", replayInput.sourceIdentifier.prefix)
+	})
+
 	t.Run("allow duplicated IDs setting", func(t *testing.T) {
 		storeReg := statestore.NewRegistry(storetest.NewMemoryStoreBackend())
 		testStore, err := storeReg.Get("test")
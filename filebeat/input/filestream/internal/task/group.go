@@ -120,6 +120,24 @@ func (g *Group) Go(fn func(context.Context) error) error {
 	return nil
 }
 
+// Wait waits until all tasks started so far have finished, including the
+// ones that were discarded while waiting to run, or ctx is done, whatever
+// happens first. It returns ctx.Err() if ctx is done first.
+func (g *Group) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
+
 // Stop stops the task group accepting new goroutines and waits until all
 // running tasks to finish or the stop timeout to elapse, whatever
 // happens first. It returns an error if the timout is reached, nil otherwise.
@@ -357,3 +357,58 @@ func TestGroup_Stop(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestGroup_Wait(t *testing.T) {
+	t.Run("all tasks finish", func(t *testing.T) {
+		g := NewGroup(1, time.Second, noopLogger{}, "")
+
+		var ran atomic.Int64
+		for i := 0; i < 3; i++ {
+			err := g.Go(func(_ context.Context) error {
+				ran.Add(1)
+				return errors.New("task failed")
+			})
+			require.NoError(t, err, "could not launch goroutine")
+		}
+
+		require.NoError(t, g.Wait(context.Background()))
+		assert.Equal(t, int64(3), ran.Load())
+	})
+
+	t.Run("discarded tasks", func(t *testing.T) {
+		g := NewGroup(1, 50*time.Millisecond, noopLogger{}, "")
+
+		running := make(chan struct{})
+		err := g.Go(func(ctx context.Context) error {
+			close(running)
+			<-ctx.Done()
+			return nil
+		})
+		require.NoError(t, err, "could not launch goroutine")
+		<-running
+		err = g.Go(func(_ context.Context) error {
+			t.Error("the task must be discarded once the group is stopped")
+			return nil
+		})
+		require.NoError(t, err, "could not launch goroutine")
+
+		require.NoError(t, g.Stop())
+		assert.NoError(t, g.Wait(context.Background()))
+	})
+
+	t.Run("context is done", func(t *testing.T) {
+		g := NewGroup(0, time.Second, noopLogger{}, "")
+
+		done := make(chan struct{})
+		defer close(done)
+		err := g.Go(func(_ context.Context) error {
+			<-done
+			return nil
+		})
+		require.NoError(t, err, "could not launch goroutine")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, g.Wait(ctx), context.DeadlineExceeded)
+	})
+}
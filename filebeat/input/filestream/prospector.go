@@ -26,6 +26,7 @@ import (
 	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
 	input "github.com/elastic/beats/v7/filebeat/input/v2"
 	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile"
 
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/go-concert/unison"
@@ -109,6 +110,13 @@ func (p *fileProspector) Init(
 	})
 
 	if p.cleanRemoved {
+		// Files renamed while the input was stopped, like rotated files
+		// that were compressed, are found by their ID under a new path.
+		ids := make(map[string]struct{}, len(files))
+		for path, fd := range files {
+			ids[newID(p.identifier.GetSource(loginp.FSEvent{NewPath: path, Descriptor: fd}))] = struct{}{}
+		}
+
 		prospectorStore.CleanIf(func(v loginp.Value) bool {
 			var fm fileMeta
 			err := v.UnpackCursorMeta(&fm)
@@ -117,6 +125,10 @@ func (p *fileProspector) Init(
 				return true
 			}
 
+			if _, ok := ids[v.Key()]; ok {
+				return false
+			}
+
 			_, ok := files[fm.Source]
 			return !ok
 		})
@@ -339,7 +351,13 @@ func (p *fileProspector) onFSEvent(
 		}
 
 		if p.isFileIgnored(log, event, ignoreSince) {
-			err := updater.ResetCursor(src, state{Offset: event.Descriptor.Info.Size()})
+			cur := state{Offset: event.Descriptor.Info.Size()}
+			if event.Descriptor.Compression != readfile.CompressionNone {
+				// The size of the decompressed content is unknown, so the
+				// file is marked as completed instead.
+				cur = state{Completed: true}
+			}
+			err := updater.ResetCursor(src, cur)
 			if err != nil {
 				log.Errorf("setting cursor for ignored file: %v", err)
 			}
@@ -432,6 +450,15 @@ func (p *fileProspector) onRename(log *logp.Logger, ctx input.Context, fe loginp
 			log.Errorf("Failed to update cursor meta data of entry %s: %v", src.Name(), err)
 		}
 
+		if fe.Descriptor.Compression != readfile.CompressionNone {
+			// A file renamed to a compressed file has usually been compressed
+			// by the log rotation. The harvester of the original file is
+			// replaced by one reading what is left from the compressed file.
+			log.Debugf("File %s has been compressed to %s, restarting harvester", fe.OldPath, fe.NewPath)
+			hg.Restart(ctx, src)
+			return
+		}
+
 		if p.stateChangeCloser.Renamed {
 			log.Debugf("Stopping harvester as file %s has been renamed and close.on_state_change.renamed is enabled.", src.Name())
 
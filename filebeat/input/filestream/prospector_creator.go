@@ -121,16 +121,27 @@ func checkConfigCompatibility(fileWatcher, fileIdentifier *conf.Namespace) error
 		Fingerprint struct {
 			Enabled bool `config:"enabled"`
 		} `config:"fingerprint"`
+		Compression string `config:"compression"`
 	}
 
-	if fileWatcher != nil && fileIdentifier != nil && fileIdentifier.Name() == fingerprintName {
-		err := fileWatcher.Config().Unpack(&fwCfg)
-		if err != nil {
-			return fmt.Errorf("failed to parse file watcher configuration: %w", err)
-		}
-		if !fwCfg.Fingerprint.Enabled {
-			return fmt.Errorf("fingerprint file identity can be used only when fingerprint is enabled in the scanner")
-		}
+	if fileWatcher == nil || fileIdentifier == nil {
+		return nil
+	}
+
+	err := fileWatcher.Config().Unpack(&fwCfg)
+	if err != nil {
+		return fmt.Errorf("failed to parse file watcher configuration: %w", err)
+	}
+
+	if fileIdentifier.Name() == fingerprintName && !fwCfg.Fingerprint.Enabled {
+		return fmt.Errorf("fingerprint file identity can be used only when fingerprint is enabled in the scanner")
+	}
+
+	// Compressed files are matched to the files they were rotated from by
+	// the fingerprint of their decompressed content, any other identity
+	// would ingest them a second time.
+	if fileIdentifier.Name() != fingerprintName && fwCfg.Compression == compressionAuto {
+		return fmt.Errorf("compressed files can be read only when the fingerprint file identity is used")
 	}
 
 	return nil
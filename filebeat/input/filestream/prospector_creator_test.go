@@ -90,6 +90,24 @@ prospector.scanner.fingerprint.enabled: false
 `,
 				err: "fingerprint file identity can be used only when fingerprint is enabled in the scanner",
 			},
+			{
+				name: "returns no error when compression and fingerprint identity is configured",
+				cfgStr: `
+paths: ['some']
+file_identity.fingerprint: ~
+prospector.scanner.fingerprint.enabled: true
+prospector.scanner.compression: auto
+`,
+			},
+			{
+				name: "returns error when compression is configured with another identity",
+				cfgStr: `
+paths: ['some']
+file_identity.native: ~
+prospector.scanner.compression: auto
+`,
+				err: "compressed files can be read only when the fingerprint file identity is used",
+			},
 		}
 
 		for _, tc := range cases {
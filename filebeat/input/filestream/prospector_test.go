@@ -100,6 +100,40 @@ func TestProspector_InitCleanIfRemoved(t *testing.T) {
 	}
 }
 
+func TestProspector_InitCleanIfRemovedKeepsRenamedFiles(t *testing.T) {
+	testStore := newMockStoreUpdater(map[string]loginp.Value{
+		"fingerprint::renamed": &mockUnpackValue{
+			key: "fingerprint::renamed",
+			fileMeta: fileMeta{
+				Source:         "/path/to/app.log",
+				IdentifierName: fingerprintName,
+			},
+		},
+		"fingerprint::removed": &mockUnpackValue{
+			key: "fingerprint::removed",
+			fileMeta: fileMeta{
+				Source:         "/path/to/other.log",
+				IdentifierName: fingerprintName,
+			},
+		},
+	})
+	identifier, err := newFingerprintIdentifier(nil)
+	require.NoError(t, err)
+
+	p := fileProspector{
+		logger:       logp.L(),
+		identifier:   identifier,
+		cleanRemoved: true,
+		filewatcher: newMockFileWatcherWithFiles(map[string]loginp.FileDescriptor{
+			"/path/to/app.log.1.gz": {Fingerprint: "renamed"},
+		}),
+	}
+	err = p.Init(testStore, newMockStoreUpdater(nil), func(s loginp.Source) string { return s.Name() })
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"fingerprint::removed"}, testStore.cleanedKeys)
+}
+
 func TestProspector_InitUpdateIdentifiers(t *testing.T) {
 	f, err := os.CreateTemp(t.TempDir(), "existing_file")
 	if err != nil {
@@ -637,6 +671,10 @@ func (t *testHarvesterGroup) StopHarvesters() error {
 	return nil
 }
 
+func (t *testHarvesterGroup) Wait(input.Canceler) error {
+	return nil
+}
+
 type mockFileWatcher struct {
 	events      []loginp.FSEvent
 	filesOnDisk map[string]loginp.FileDescriptor
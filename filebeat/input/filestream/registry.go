@@ -0,0 +1,259 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// ErrRegistryEntryNotFound is returned when there is no filestream entry
+// with the requested key in the registry.
+var ErrRegistryEntryNotFound = errors.New("registry entry not found")
+
+// RegistryEntry is the state of a file harvested by a filestream input, as
+// it is stored in the registry.
+type RegistryEntry struct {
+	Key string
+	// InputID is the ID of the filestream input the entry belongs to.
+	InputID string
+	// Identifier is the name of the file identity used to build the key.
+	Identifier string
+	// Identity is the identity of the file, e.g. its inode and device ID or
+	// its fingerprint.
+	Identity string
+	// Source is the path of the file the last time it was seen.
+	Source    string
+	Offset    int64
+	Completed bool
+	// TTL is the time to live of the entry after its last update. Entries
+	// with a TTL of 0 are removed by the next registry cleanup, entries with
+	// a negative TTL never expire.
+	TTL     time.Duration
+	Updated time.Time
+}
+
+// Removed returns true if the entry is going to be removed by the next
+// registry cleanup.
+func (e RegistryEntry) Removed() bool {
+	return e.TTL == 0
+}
+
+// Expired returns true if the TTL of the entry has passed at now. Expired
+// entries are removed by the registry cleanup, unless the file is still
+// being harvested.
+func (e RegistryEntry) Expired(now time.Time) bool {
+	return e.TTL >= 0 && e.Updated.Add(e.TTL).Before(now)
+}
+
+// MarshalJSON encodes the entry as it is stored in the registry. It is the
+// format used to export and import entries.
+func (e RegistryEntry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(exportedEntry{
+		Key:     e.Key,
+		TTL:     e.TTL,
+		Updated: e.Updated,
+		Cursor:  state{Offset: e.Offset, Completed: e.Completed},
+		Meta:    fileMeta{Source: e.Source, IdentifierName: e.Identifier},
+	})
+}
+
+// exportedEntry is the JSON representation of a registry entry.
+type exportedEntry struct {
+	Key     string        `json:"key"`
+	TTL     time.Duration `json:"ttl"`
+	Updated time.Time     `json:"updated"`
+	Cursor  state         `json:"cursor"`
+	Meta    fileMeta      `json:"meta"`
+}
+
+func (e exportedEntry) toStored() loginp.StoredEntry {
+	return loginp.StoredEntry{
+		Key:     e.Key,
+		TTL:     e.TTL,
+		Updated: e.Updated,
+		Cursor:  e.Cursor,
+		Meta:    e.Meta,
+	}
+}
+
+// Registry gives access to the filestream entries of the registry. It must
+// only be used while no filestream input is running, as the inputs keep the
+// state of the files in memory and overwrite any change.
+type Registry struct {
+	log   *logp.Logger
+	store *statestore.Store
+}
+
+// NewRegistry returns a Registry accessing the filestream entries of store.
+func NewRegistry(log *logp.Logger, store *statestore.Store) *Registry {
+	return &Registry{log: log, store: store}
+}
+
+// Entries returns the filestream entries of the registry, sorted by key.
+func (r *Registry) Entries() ([]RegistryEntry, error) {
+	stored, err := loginp.ReadStoredEntries(r.log, r.store, pluginName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the registry: %w", err)
+	}
+
+	entries := make([]RegistryEntry, 0, len(stored))
+	for _, s := range stored {
+		e, err := newRegistryEntry(s)
+		if err != nil {
+			r.log.Warnf("Ignoring registry entry %s: %v", s.Key, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Entry returns the filestream entry with the given key.
+func (r *Registry) Entry(key string) (RegistryEntry, error) {
+	entries, err := r.Entries()
+	if err != nil {
+		return RegistryEntry{}, err
+	}
+	for _, e := range entries {
+		if e.Key == key {
+			return e, nil
+		}
+	}
+	return RegistryEntry{}, fmt.Errorf("%w: %s", ErrRegistryEntryNotFound, key)
+}
+
+// ResetOffset sets the offset of the entry with the given key, so the file
+// is read from offset the next time it is harvested. Compressed files that
+// were read completely are read again.
+func (r *Registry) ResetOffset(key string, offset int64) error {
+	if offset < 0 {
+		return fmt.Errorf("invalid offset %d, it must not be negative", offset)
+	}
+
+	e, err := r.Entry(key)
+	if err != nil {
+		return err
+	}
+
+	// Updating the entry prevents the registry cleanup from removing it
+	// before the file is harvested again.
+	return loginp.WriteStoredEntry(r.store, exportedEntry{
+		Key:     e.Key,
+		TTL:     e.TTL,
+		Updated: time.Now(),
+		Cursor:  state{Offset: offset},
+		Meta:    fileMeta{Source: e.Source, IdentifierName: e.Identifier},
+	}.toStored())
+}
+
+// Delete removes the entry with the given key from the registry. The file
+// is read from the beginning the next time it is found.
+func (r *Registry) Delete(key string) error {
+	if _, err := r.Entry(key); err != nil {
+		return err
+	}
+	return r.store.Remove(key)
+}
+
+// Export writes entries to w as a JSON array, in the format read by Import.
+func (r *Registry) Export(w io.Writer, entries []RegistryEntry) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if entries == nil {
+		entries = []RegistryEntry{}
+	}
+	return enc.Encode(entries)
+}
+
+// Import reads entries written by Export from rd and writes them to the
+// registry, replacing the entries with the same keys. Nothing is written if
+// any of the entries is invalid. It returns the number of imported entries.
+func (r *Registry) Import(rd io.Reader) (int, error) {
+	var exported []exportedEntry
+	if err := json.NewDecoder(rd).Decode(&exported); err != nil {
+		return 0, fmt.Errorf("failed to decode registry entries: %w", err)
+	}
+
+	stored := make([]loginp.StoredEntry, len(exported))
+	for i, e := range exported {
+		stored[i] = e.toStored()
+		if _, err := newRegistryEntry(stored[i]); err != nil {
+			return 0, fmt.Errorf("invalid registry entry %q: %w", e.Key, err)
+		}
+	}
+
+	for i, s := range stored {
+		if err := loginp.WriteStoredEntry(r.store, s); err != nil {
+			return i, fmt.Errorf("failed to write registry entry %s: %w", s.Key, err)
+		}
+	}
+	return len(stored), nil
+}
+
+// newRegistryEntry decodes a filestream entry of the registry. Its key is
+// made of the plugin name, the input ID, the identifier name and the
+// identity of the file.
+func newRegistryEntry(s loginp.StoredEntry) (RegistryEntry, error) {
+	var meta fileMeta
+	if err := s.UnpackCursorMeta(&meta); err != nil {
+		return RegistryEntry{}, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	if meta.Source == "" || meta.IdentifierName == "" {
+		return RegistryEntry{}, errors.New("source and identifier name must be set in the metadata")
+	}
+
+	var cur state
+	if s.Cursor != nil {
+		if err := s.UnpackCursor(&cur); err != nil {
+			return RegistryEntry{}, fmt.Errorf("failed to decode cursor: %w", err)
+		}
+	}
+	if cur.Offset < 0 {
+		return RegistryEntry{}, fmt.Errorf("invalid offset %d", cur.Offset)
+	}
+
+	rest, ok := strings.CutPrefix(s.Key, pluginName+identitySep)
+	if !ok {
+		return RegistryEntry{}, fmt.Errorf("key does not start with %s%s", pluginName, identitySep)
+	}
+	inputID, identity, ok := strings.Cut(rest, identitySep+meta.IdentifierName+identitySep)
+	if !ok {
+		return RegistryEntry{}, fmt.Errorf("key does not match identifier %s", meta.IdentifierName)
+	}
+
+	return RegistryEntry{
+		Key:        s.Key,
+		InputID:    inputID,
+		Identifier: meta.IdentifierName,
+		Identity:   identity,
+		Source:     meta.Source,
+		Offset:     cur.Offset,
+		Completed:  cur.Completed,
+		TTL:        s.TTL,
+		Updated:    s.Updated,
+	}, nil
+}
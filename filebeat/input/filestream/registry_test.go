@@ -0,0 +1,192 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+const (
+	testNativeKey      = "filestream::my-id::native::123-456"
+	testFingerprintKey = "filestream::my-id::fingerprint::0fab"
+	testPathKey        = "filestream::other-id::path::/var/log/other.log"
+)
+
+func TestRegistryEntries(t *testing.T) {
+	updated := time.Now()
+	r := newTestRegistry(t, updated)
+
+	entries, err := r.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 3, "log input entries and invalid entries must be ignored")
+
+	assert.Equal(t, RegistryEntry{
+		Key:        testFingerprintKey,
+		InputID:    "my-id",
+		Identifier: fingerprintName,
+		Identity:   "0fab",
+		Source:     "/var/log/app.log.1.gz",
+		Offset:     2048,
+		Completed:  true,
+		TTL:        30 * time.Minute,
+		Updated:    entries[0].Updated,
+	}, entries[0])
+	assert.True(t, updated.Equal(entries[0].Updated), "updated time must be read from the registry")
+
+	assert.Equal(t, testNativeKey, entries[1].Key)
+	assert.Equal(t, "my-id", entries[1].InputID)
+	assert.Equal(t, nativeName, entries[1].Identifier)
+	assert.Equal(t, "123-456", entries[1].Identity)
+	assert.Equal(t, int64(42), entries[1].Offset)
+	assert.False(t, entries[1].Completed)
+
+	assert.Equal(t, testPathKey, entries[2].Key)
+	assert.Equal(t, "other-id", entries[2].InputID)
+	assert.Equal(t, "/var/log/other.log", entries[2].Identity)
+	assert.True(t, entries[2].Removed())
+}
+
+func TestRegistryEntryExpired(t *testing.T) {
+	now := time.Now()
+	e := RegistryEntry{TTL: time.Minute, Updated: now.Add(-2 * time.Minute)}
+	assert.True(t, e.Expired(now))
+
+	e.Updated = now
+	assert.False(t, e.Expired(now))
+
+	e.TTL = -1
+	e.Updated = now.Add(-time.Hour)
+	assert.False(t, e.Expired(now), "entries with a negative TTL never expire")
+}
+
+func TestRegistryResetOffset(t *testing.T) {
+	r := newTestRegistry(t, time.Now().Add(-time.Hour))
+
+	require.NoError(t, r.ResetOffset(testFingerprintKey, 10))
+
+	e, err := r.Entry(testFingerprintKey)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), e.Offset)
+	assert.False(t, e.Completed, "compressed files must be read again")
+	assert.Equal(t, "/var/log/app.log.1.gz", e.Source)
+	assert.Equal(t, fingerprintName, e.Identifier)
+	assert.False(t, e.Expired(time.Now()), "updating the offset must update the entry")
+
+	assert.Error(t, r.ResetOffset(testNativeKey, -1))
+	assert.ErrorIs(t, r.ResetOffset("filestream::my-id::native::1-1", 0), ErrRegistryEntryNotFound)
+}
+
+func TestRegistryDelete(t *testing.T) {
+	r := newTestRegistry(t, time.Now())
+
+	require.NoError(t, r.Delete(testNativeKey))
+	_, err := r.Entry(testNativeKey)
+	assert.ErrorIs(t, err, ErrRegistryEntryNotFound)
+
+	entries, err := r.Entries()
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	assert.ErrorIs(t, r.Delete(testNativeKey), ErrRegistryEntryNotFound)
+}
+
+func TestRegistryExportImport(t *testing.T) {
+	src := newTestRegistry(t, time.Now())
+	entries, err := src.Entries()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, src.Export(&buf, entries))
+
+	dst := openTestRegistry(t)
+	n, err := dst.Import(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, len(entries), n)
+
+	imported, err := dst.Entries()
+	require.NoError(t, err)
+	require.Len(t, imported, len(entries))
+	for i := range entries {
+		assert.True(t, entries[i].Updated.Equal(imported[i].Updated))
+		imported[i].Updated = entries[i].Updated
+	}
+	assert.Equal(t, entries, imported)
+
+	t.Run("invalid entries are not imported", func(t *testing.T) {
+		dst := openTestRegistry(t)
+		_, err := dst.Import(strings.NewReader(`[
+  {"key": "filestream::id::native::1-1", "ttl": -1, "cursor": {"offset": 1}, "meta": {"source": "/a.log", "identifier_name": "native"}},
+  {"key": "filestream::id::native::1-2", "ttl": -1, "cursor": {"offset": 1}, "meta": {"source": "/b.log", "identifier_name": "fingerprint"}}
+]`))
+		require.Error(t, err)
+
+		entries, err := dst.Entries()
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+// newTestRegistry returns a registry holding filestream entries for
+// different identifiers, an entry of the log input and an invalid entry.
+func newTestRegistry(t *testing.T, updated time.Time) *Registry {
+	r := openTestRegistry(t)
+
+	write := func(key string, ttl time.Duration, cursor, meta interface{}) {
+		err := loginp.WriteStoredEntry(r.store, loginp.StoredEntry{
+			Key:     key,
+			TTL:     ttl,
+			Updated: updated,
+			Cursor:  cursor,
+			Meta:    meta,
+		})
+		require.NoError(t, err)
+	}
+
+	write(testNativeKey, -1, state{Offset: 42}, fileMeta{Source: "/var/log/app.log", IdentifierName: nativeName})
+	write(testFingerprintKey, 30*time.Minute, state{Offset: 2048, Completed: true}, fileMeta{Source: "/var/log/app.log.1.gz", IdentifierName: fingerprintName})
+	write(testPathKey, 0, state{Offset: 7}, fileMeta{Source: "/var/log/other.log", IdentifierName: pathName})
+	write("filestream::my-id::native::1-2", -1, state{Offset: 1}, fileMeta{Source: "/var/log/mismatch.log", IdentifierName: fingerprintName})
+	write("filebeat::logs::native::123-456", -1, map[string]interface{}{"offset": 42, "source": "/var/log/app.log"}, nil)
+
+	return r
+}
+
+func openTestRegistry(t *testing.T) *Registry {
+	logger := logptest.NewTestingLogger(t, "")
+	backend, err := memlog.New(logger, memlog.Settings{Root: t.TempDir()})
+	require.NoError(t, err)
+	registry := statestore.NewRegistry(backend)
+	t.Cleanup(func() { _ = registry.Close() })
+
+	store, err := registry.Get("filebeat")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	return NewRegistry(logger, store)
+}
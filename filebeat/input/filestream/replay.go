@@ -0,0 +1,338 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/processors/timestamp"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+const replayProspectorDebugKey = "replay_prospector"
+
+// replayConfig configures the replay mode. In replay mode the input reads
+// all matching files once from the start, publishes the lines within the
+// time range and stops. Its states are kept apart from the states of the
+// live inputs.
+type replayConfig struct {
+	Enabled   bool                  `config:"enabled"`
+	Since     replayTime            `config:"since"`
+	Until     replayTime            `config:"until"`
+	Timestamp replayTimestampConfig `config:"timestamp"`
+}
+
+// replayTimestampConfig configures how the timestamp of a line is found.
+// Without layouts the event timestamp set by the parsers is used.
+type replayTimestampConfig struct {
+	Field    string            `config:"field"`
+	Pattern  string            `config:"pattern"`
+	Layouts  []string          `config:"layouts"`
+	Timezone *cfgtype.Timezone `config:"timezone"`
+}
+
+// replayTime is a point in time in RFC 3339 format.
+type replayTime struct {
+	time.Time
+}
+
+func (t *replayTime) Unpack(v string) error {
+	ts, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return fmt.Errorf("invalid time %q, it must be in RFC 3339 format: %w", v, err)
+	}
+	t.Time = ts
+	return nil
+}
+
+func defaultReplayConfig() replayConfig {
+	return replayConfig{
+		Timestamp: replayTimestampConfig{
+			Field: "message",
+		},
+	}
+}
+
+func (c *replayConfig) Validate() error {
+	if !c.Since.IsZero() && !c.Until.IsZero() && !c.Until.After(c.Since.Time) {
+		return errors.New("replay.until must be after replay.since")
+	}
+
+	if c.Timestamp.Pattern != "" {
+		if len(c.Timestamp.Layouts) == 0 {
+			return errors.New("replay.timestamp.pattern requires replay.timestamp.layouts to be set")
+		}
+		re, err := regexp.Compile(c.Timestamp.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid replay.timestamp.pattern: %w", err)
+		}
+		if re.NumSubexp() > 1 {
+			return errors.New("replay.timestamp.pattern must have at most one capture group")
+		}
+	}
+
+	return nil
+}
+
+// replay is shared by the prospector and the harvesters of an input in
+// replay mode. It filters the lines and reports the progress.
+type replay struct {
+	since   time.Time
+	filter  *replayFilter
+	metrics *replayMetrics
+}
+
+func newReplay(c replayConfig) (*replay, error) {
+	r := &replay{since: c.Since.Time}
+	if c.Since.IsZero() && c.Until.IsZero() {
+		return r, nil
+	}
+
+	r.filter = &replayFilter{
+		since: c.Since.Time,
+		until: c.Until.Time,
+	}
+	if len(c.Timestamp.Layouts) == 0 {
+		return r, nil
+	}
+
+	r.filter.field = c.Timestamp.Field
+	r.filter.parser = timestamp.NewParser(c.Timestamp.Layouts, c.Timestamp.Timezone.Location())
+	if c.Timestamp.Pattern != "" {
+		re, err := regexp.Compile(c.Timestamp.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replay.timestamp.pattern: %w", err)
+		}
+		r.filter.pattern = re
+	}
+	return r, nil
+}
+
+// keep reports whether a line must be published, counting the lines that
+// are dropped.
+func (r *replay) keep(log *logp.Logger, event beat.Event) bool {
+	if r.filter == nil {
+		return true
+	}
+
+	ts, err := r.filter.timestamp(event)
+	if err != nil {
+		log.Debugf("Dropping line without a valid timestamp: %v", err)
+		r.metrics.invalidTimestamp.Inc()
+		return false
+	}
+	if !r.filter.inRange(ts) {
+		r.metrics.outOfRange.Inc()
+		return false
+	}
+	return true
+}
+
+// fileDone must be called by the harvester once it stops reading a file.
+func (r *replay) fileDone() {
+	r.metrics.filesCompleted.Inc()
+}
+
+// replayFilter selects the lines whose timestamp is within [since, until).
+// A zero bound means the range is open on that side.
+type replayFilter struct {
+	since, until time.Time
+
+	// If parser is nil, the event timestamp is used.
+	field   string
+	pattern *regexp.Regexp
+	parser  *timestamp.Parser
+}
+
+func (f *replayFilter) timestamp(event beat.Event) (time.Time, error) {
+	if f.parser == nil {
+		return event.Timestamp, nil
+	}
+
+	v, err := event.GetValue(f.field)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get timestamp field %s: %w", f.field, err)
+	}
+
+	if f.pattern != nil {
+		s, ok := v.(string)
+		if !ok {
+			return time.Time{}, fmt.Errorf("unexpected type %T for timestamp field %s", v, f.field)
+		}
+		m := f.pattern.FindStringSubmatch(s)
+		if m == nil {
+			return time.Time{}, fmt.Errorf("timestamp pattern does not match field %s", f.field)
+		}
+		v = m[len(m)-1]
+	}
+
+	return f.parser.Parse(v)
+}
+
+func (f *replayFilter) inRange(ts time.Time) bool {
+	if !f.since.IsZero() && ts.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !ts.Before(f.until) {
+		return false
+	}
+	return true
+}
+
+// replayMetrics reports the progress of a replay on the input metrics.
+type replayMetrics struct {
+	filesTotal       *monitoring.Uint
+	filesCompleted   *monitoring.Uint
+	filesSkipped     *monitoring.Uint
+	bytesTotal       *monitoring.Uint
+	bytesRead        *monitoring.Uint
+	outOfRange       *monitoring.Uint
+	invalidTimestamp *monitoring.Uint
+}
+
+func newReplayMetrics(reg *monitoring.Registry) *replayMetrics {
+	return &replayMetrics{
+		filesTotal:       monitoring.NewUint(reg, "replay_files_total"),
+		filesCompleted:   monitoring.NewUint(reg, "replay_files_completed_total"),
+		filesSkipped:     monitoring.NewUint(reg, "replay_files_skipped_total"),
+		bytesTotal:       monitoring.NewUint(reg, "replay_bytes_total"),
+		bytesRead:        monitoring.NewUint(reg, "replay_bytes_read_total"),
+		outOfRange:       monitoring.NewUint(reg, "replay_messages_out_of_range_total"),
+		invalidTimestamp: monitoring.NewUint(reg, "replay_messages_invalid_timestamp_total"),
+	}
+}
+
+// replayProspector implements the Prospector interface for inputs in replay
+// mode. It starts a harvester for every file found when the input starts,
+// waits until all files have been read and removes the states of the files.
+type replayProspector struct {
+	logger      *logp.Logger
+	filewatcher loginp.FSWatcher
+	identifier  fileIdentifier
+	replay      *replay
+}
+
+func newReplayProspector(config config, r *replay) (loginp.Prospector, error) {
+	err := checkConfigCompatibility(config.FileWatcher, config.FileIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	filewatcher, err := newFileWatcher(config.Paths, config.FileWatcher)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating filewatcher %w", err)
+	}
+
+	identifier, err := newFileIdentifier(config.FileIdentity, config.Reader.Parsers.Suffix)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating file identifier: %w", err)
+	}
+
+	logger := logp.L().Named("input.filestream").With("filestream_id", config.ID)
+	return &replayProspector{
+		logger:      logger.Named("replay_prospector"),
+		filewatcher: filewatcher,
+		identifier:  identifier,
+		replay:      r,
+	}, nil
+}
+
+// Init drops the states left behind by a replay that did not complete. The
+// states of other inputs are never taken over.
+func (p *replayProspector) Init(local, _ loginp.StoreUpdater, _ func(loginp.Source) string) error {
+	local.CleanIf(func(loginp.Value) bool { return true })
+	return nil
+}
+
+// Run reads the files once and returns when all of them have been read or
+// the input is stopped.
+func (p *replayProspector) Run(ctx input.Context, s loginp.StateMetadataUpdater, hg loginp.HarvesterGroup) {
+	log := ctx.Logger.With("prospector", replayProspectorDebugKey)
+	log.Debug("Starting replay")
+	defer log.Debug("Replay has stopped")
+
+	metrics := newReplayMetrics(ctx.MetricsRegistry)
+	p.replay.metrics = metrics
+
+	files := p.filewatcher.GetFiles()
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	started := map[string]loginp.Source{}
+	for _, path := range paths {
+		fd := files[path]
+		if !p.replay.since.IsZero() && fd.Info.ModTime().Before(p.replay.since) {
+			log.Debugf("Skipping file %s as it was last modified before the replay start", path)
+			metrics.filesSkipped.Inc()
+			continue
+		}
+
+		src := p.identifier.GetSource(loginp.FSEvent{Op: loginp.OpCreate, NewPath: path, Descriptor: fd})
+		if _, ok := started[src.Name()]; ok {
+			// The same file can be matched by several paths.
+			continue
+		}
+		started[src.Name()] = src
+
+		err := s.UpdateMetadata(src, fileMeta{Source: path, IdentifierName: p.identifier.Name()})
+		if err != nil {
+			log.Errorf("Failed to set cursor meta data of entry %s: %v", src.Name(), err)
+		}
+
+		metrics.filesTotal.Inc()
+		metrics.bytesTotal.Add(uint64(fd.Info.Size()))
+		hg.Start(ctx, src)
+	}
+	log.Infof("Replaying %d files", len(started))
+
+	// The harvester group also returns once harvesters that couldn't be
+	// started have given up, so a replay can't hang on them.
+	if err := hg.Wait(ctx.Cancelation); err != nil {
+		log.Info("Replay was stopped before all files have been read")
+	} else {
+		log.Infof("Replay completed, %d of %d files have been read", metrics.filesCompleted.Get(), len(started))
+	}
+
+	err := hg.StopHarvesters()
+	if err != nil {
+		log.Errorf("Error while stopping harvester group: %v", err)
+	}
+
+	for _, src := range started {
+		err := s.Remove(src)
+		if err != nil {
+			log.Errorf("Error while removing replay state of %s: %v", src.Name(), err)
+		}
+	}
+}
+
+func (p *replayProspector) Test() error {
+	return nil
+}
@@ -0,0 +1,130 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestReplayConfig(t *testing.T) {
+	tcs := map[string]struct {
+		cfg    map[string]any
+		expErr string
+	}{
+		"time range": {
+			cfg: map[string]any{
+				"since": "2025-06-01T00:00:00Z",
+				"until": "2025-06-02T00:00:00Z",
+			},
+		},
+		"invalid time": {
+			cfg:    map[string]any{"since": "2025-06-01"},
+			expErr: "RFC 3339",
+		},
+		"until before since": {
+			cfg: map[string]any{
+				"since": "2025-06-02T00:00:00Z",
+				"until": "2025-06-01T00:00:00Z",
+			},
+			expErr: "replay.until must be after replay.since",
+		},
+		"pattern without layouts": {
+			cfg:    map[string]any{"timestamp.pattern": `^(\S+)`},
+			expErr: "requires replay.timestamp.layouts",
+		},
+		"pattern with several capture groups": {
+			cfg: map[string]any{
+				"timestamp.pattern": `^(\S+) (\S+)`,
+				"timestamp.layouts": []string{"2006-01-02"},
+			},
+			expErr: "at most one capture group",
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c := defaultReplayConfig()
+			err := conf.MustNewConfigFrom(tc.cfg).Unpack(&c)
+			if tc.expErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.expErr)
+		})
+	}
+}
+
+func TestReplayFilter(t *testing.T) {
+	since := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	until := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	newEvent := func(ts time.Time, msg string) beat.Event {
+		return beat.Event{Timestamp: ts, Fields: mapstr.M{"message": msg}}
+	}
+
+	t.Run("event timestamp", func(t *testing.T) {
+		c := defaultReplayConfig()
+		c.Since = replayTime{since}
+		c.Until = replayTime{until}
+		r, err := newReplay(c)
+		require.NoError(t, err)
+		r.metrics = newReplayMetrics(monitoring.NewRegistry())
+
+		log := logptest.NewTestingLogger(t, "")
+		assert.False(t, r.keep(log, newEvent(since.Add(-time.Second), "")))
+		assert.True(t, r.keep(log, newEvent(since, "")), "since must be inclusive")
+		assert.True(t, r.keep(log, newEvent(until.Add(-time.Second), "")))
+		assert.False(t, r.keep(log, newEvent(until, "")), "until must be exclusive")
+		assert.Equal(t, uint64(2), r.metrics.outOfRange.Get())
+	})
+
+	t.Run("timestamp parsed from the message", func(t *testing.T) {
+		c := defaultReplayConfig()
+		c.Since = replayTime{since}
+		c.Timestamp.Pattern = `^\[([^\]]+)\]`
+		c.Timestamp.Layouts = []string{"2006-01-02 15:04:05"}
+		r, err := newReplay(c)
+		require.NoError(t, err)
+		r.metrics = newReplayMetrics(monitoring.NewRegistry())
+
+		log := logptest.NewTestingLogger(t, "")
+		assert.True(t, r.keep(log, newEvent(time.Time{}, "[2025-06-01 10:30:00] in range")))
+		assert.False(t, r.keep(log, newEvent(time.Time{}, "[2025-06-01 09:30:00] too early")))
+		assert.False(t, r.keep(log, newEvent(time.Time{}, "no timestamp")))
+		assert.False(t, r.keep(log, newEvent(time.Time{}, "[yesterday] invalid timestamp")))
+		assert.Equal(t, uint64(1), r.metrics.outOfRange.Get())
+		assert.Equal(t, uint64(2), r.metrics.invalidTimestamp.Get())
+	})
+
+	t.Run("no time range", func(t *testing.T) {
+		r, err := newReplay(defaultReplayConfig())
+		require.NoError(t, err)
+		assert.Nil(t, r.filter)
+		assert.True(t, r.keep(logptest.NewTestingLogger(t, ""), newEvent(time.Time{}, "")))
+	})
+}
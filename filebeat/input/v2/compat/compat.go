@@ -58,6 +58,7 @@ type runner struct {
 	log            *logp.Logger
 	agent          *beat.Info
 	wg             sync.WaitGroup
+	done           chan struct{}
 	sig            ctxtool.CancelContext
 	input          v2.Input
 	connector      beat.PipelineConnector
@@ -115,6 +116,7 @@ func (f *factory) Create(
 		id:        id,
 		log:       f.log.Named(input.Name()).With("id", id),
 		agent:     &f.info,
+		done:      make(chan struct{}),
 		sig:       ctxtool.WithCancelContext(context.Background()),
 		input:     input,
 		connector: p,
@@ -134,6 +136,7 @@ func (r *runner) Start() {
 
 	go func() {
 		defer r.wg.Done()
+		defer close(r.done)
 		log.Infof("Input '%s' starting", name)
 
 		reg := inputmon.NewMetricsRegistry(
@@ -170,6 +173,18 @@ func (r *runner) Start() {
 	}()
 }
 
+// Finite reports whether the wrapped input stops on its own once all its data
+// has been collected. See v2.FiniteInput.
+func (r *runner) Finite() bool {
+	fin, ok := r.input.(v2.FiniteInput)
+	return ok && fin.Finite()
+}
+
+// Done returns a channel that is closed once the input has returned from Run.
+func (r *runner) Done() <-chan struct{} {
+	return r.done
+}
+
 func (r *runner) Stop() {
 	r.sig.Cancel()
 	r.wg.Wait()
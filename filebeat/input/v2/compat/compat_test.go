@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -188,6 +189,39 @@ func TestRunnerFactory_CreateAndRun(t *testing.T) {
 		assert.Equal(t, 1, countRun)
 	})
 
+	t.Run("done is closed once the input returns", func(t *testing.T) {
+		log := logp.NewLogger("test")
+		plugins := inputest.SinglePlugin("test", inputest.ConstInputManager(&inputest.MockInput{
+			OnRun: func(_ v2.Context, _ beat.PipelineConnector) error {
+				return nil
+			},
+		}))
+		loader := inputest.MustNewTestLoader(t, plugins, "type", "test")
+		factory := RunnerFactory(
+			log,
+			beat.Info{Monitoring: beat.Monitoring{
+				Namespace: monitoring.GetNamespace("TestRunnerFactory_Done")},
+				Logger: log},
+			loader.Loader)
+
+		created, err := factory.Create(nil, conf.MustNewConfigFrom(map[string]interface{}{
+			"type": "test",
+		}))
+		require.NoError(t, err)
+
+		r, ok := created.(*runner)
+		require.True(t, ok)
+		assert.False(t, r.Finite(), "mock input must not be reported as finite")
+
+		r.Start()
+		select {
+		case <-r.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("runner did not report the input as done")
+		}
+		r.Stop()
+	})
+
 	t.Run("fail if input type is unknown to loader", func(t *testing.T) {
 		log := logp.NewLogger("test")
 		plugins := inputest.SinglePlugin("test", inputest.ConstInputManager(nil))
@@ -76,6 +76,14 @@ type Input interface {
 	Run(Context, beat.PipelineConnector) error
 }
 
+// FiniteInput is implemented by inputs that may stop on their own once all
+// the data they were configured to collect has been read, instead of running
+// until they are cancelled.
+type FiniteInput interface {
+	// Finite reports whether Run returns once all the data has been collected.
+	Finite() bool
+}
+
 // Context provides the Input Run function with common environmental
 // information and services.
 type Context struct {
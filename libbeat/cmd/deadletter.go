@@ -0,0 +1,69 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+)
+
+func genDeadLetterCmd(settings instance.Settings) *cobra.Command {
+	deadLetterCmd := &cobra.Command{
+		Use:   "dead-letter",
+		Short: "Manage events rejected by Elasticsearch",
+	}
+
+	deadLetterCmd.AddCommand(genReplayDeadLetterCmd(settings))
+
+	return deadLetterCmd
+}
+
+func genReplayDeadLetterCmd(settings instance.Settings) *cobra.Command {
+	var timeout time.Duration
+	command := &cobra.Command{
+		Use:   "replay FILE...",
+		Short: "Publish the events of dead letter files to the configured output",
+		Long: `This command reads the events that were written to dead letter files
+by the Elasticsearch output's dead_letter_file non_indexable_policy and
+publishes them again to the configured output, e.g. after fixing the mapping
+that rejected them. Events are sent to the index and pipeline they were
+originally sent to.
+
+Events that are rejected again are written to the current dead letter file,
+move the files to replay to another directory first to keep them apart.
+`,
+		Args: cobra.MinimumNArgs(1),
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			b, err := instance.NewInitializedBeat(settings)
+			if err != nil {
+				return fmt.Errorf("error initializing beat: %w", err)
+			}
+
+			published, acked, err := b.ReplayDeadLetter(args, timeout)
+			fmt.Fprintf(cmd.OutOrStdout(), "Published %d events, %d acknowledged\n", published, acked)
+			return err
+		}),
+	}
+	command.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "maximum time to wait for the events to be acknowledged")
+	return command
+}
@@ -63,9 +63,11 @@ import (
 	"github.com/elastic/beats/v7/libbeat/outputs/elasticsearch"
 	"github.com/elastic/beats/v7/libbeat/plugin"
 	"github.com/elastic/beats/v7/libbeat/pprof"
+	"github.com/elastic/beats/v7/libbeat/processors/aggregate"
 	"github.com/elastic/beats/v7/libbeat/publisher/pipeline"
 	"github.com/elastic/beats/v7/libbeat/publisher/processing"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/hybridqueue"
 	"github.com/elastic/beats/v7/libbeat/version"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/file"
@@ -497,6 +499,7 @@ func NewBeatReceiver(settings Settings, receiverConfig map[string]interface{}, u
 	}
 	b.Registry.MustRegisterOutput(b.makeOutputReloader(publisher.OutputReloader()))
 	b.Publisher = publisher
+	aggregate.SetPipeline(publisher)
 
 	return b, nil
 }
@@ -620,6 +623,7 @@ func (b *Beat) createBeater(bt beat.Creator) (beat.Beater, error) {
 	b.Registry.MustRegisterOutput(b.makeOutputReloader(publisher.OutputReloader()))
 
 	b.Publisher = publisher
+	aggregate.SetPipeline(publisher)
 	beater, err := bt(&b.Beat, sub)
 	if err != nil {
 		return nil, err
@@ -1787,15 +1791,20 @@ func (bc *beatConfig) Validate() error {
 			return fmt.Errorf("top level queue and output level queue settings defined, only one is allowed")
 		}
 		// elastic-agent doesn't support disk queue yet
-		if bc.Management.Enabled() && outputPC.Queue.Config().Enabled() && outputPC.Queue.Name() == diskqueue.QueueType {
-			return fmt.Errorf("disk queue is not supported when management is enabled")
+		if bc.Management.Enabled() && outputPC.Queue.Config().Enabled() && usesDiskQueue(outputPC.Queue.Name()) {
+			return fmt.Errorf("%s queue is not supported when management is enabled", outputPC.Queue.Name())
 		}
 	}
 
 	// elastic-agent doesn't support disk queue yet
-	if bc.Management.Enabled() && bc.Pipeline.Queue.Config().Enabled() && bc.Pipeline.Queue.Name() == diskqueue.QueueType {
-		return fmt.Errorf("disk queue is not supported when management is enabled")
+	if bc.Management.Enabled() && bc.Pipeline.Queue.Config().Enabled() && usesDiskQueue(bc.Pipeline.Queue.Name()) {
+		return fmt.Errorf("%s queue is not supported when management is enabled", bc.Pipeline.Queue.Name())
 	}
 
 	return nil
 }
+
+// usesDiskQueue returns true if the queue type stores events on disk.
+func usesDiskQueue(queueType string) bool {
+	return queueType == diskqueue.QueueType || queueType == hybridqueue.QueueType
+}
@@ -0,0 +1,95 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/acker"
+	"github.com/elastic/beats/v7/libbeat/outputs/elasticsearch"
+	"github.com/elastic/beats/v7/libbeat/publisher/pipeline"
+)
+
+// ReplayDeadLetter publishes the events stored in Elasticsearch dead letter
+// files to the configured output. It waits until all events have been
+// acknowledged or timeout expired and returns the number of published and
+// acknowledged events.
+func (b *Beat) ReplayDeadLetter(files []string, timeout time.Duration) (published, acked int, err error) {
+	if !b.Config.Output.IsSet() || !b.Config.Output.Config().Enabled() {
+		return 0, 0, errors.New("no outputs are defined, please define one under the output section")
+	}
+
+	log := b.Info.Logger.Named("dead_letter")
+	monitors := pipeline.Monitors{
+		Logger: b.Info.Logger.Named("publisher"),
+		Tracer: b.Instrumentation.Tracer(),
+	}
+	// Events in dead letter files have already been processed, so no global
+	// processors are applied.
+	publisher, err := pipeline.LoadWithSettings(b.Info, monitors, b.Config.Pipeline,
+		b.makeOutputFactory(b.Config.Output), pipeline.Settings{})
+	if err != nil {
+		return 0, 0, fmt.Errorf("error initializing publisher: %w", err)
+	}
+	defer publisher.Close()
+
+	var pending sync.WaitGroup
+	var ackedCount atomic.Int64
+	client, err := publisher.ConnectWith(beat.ClientConfig{
+		PublishMode: beat.GuaranteedSend,
+		EventListener: acker.Counting(func(n int) {
+			ackedCount.Add(int64(n))
+			pending.Add(-n)
+		}),
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("error connecting to publisher: %w", err)
+	}
+	defer client.Close()
+
+	for _, path := range files {
+		n, err := elasticsearch.ReadDeadLetterFile(path, func(event beat.Event) error {
+			pending.Add(1)
+			client.Publish(event)
+			return nil
+		})
+		published += n
+		if err != nil {
+			return published, int(ackedCount.Load()), fmt.Errorf("failed to replay %s: %w", path, err)
+		}
+		log.Infof("Published %d events from %s", n, path)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		err = fmt.Errorf("timed out after %v waiting for events to be acknowledged", timeout)
+	}
+	return published, int(ackedCount.Load()), err
+}
@@ -0,0 +1,99 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/processors/pseudonymize"
+)
+
+func genPseudonymizeCmd(settings instance.Settings) *cobra.Command {
+	pseudonymizeCmd := &cobra.Command{
+		Use:   "pseudonymize",
+		Short: "Manage values pseudonymized by the pseudonymize processor",
+	}
+
+	pseudonymizeCmd.AddCommand(genDecryptPseudonymizeCmd(settings))
+
+	return pseudonymizeCmd
+}
+
+func genDecryptPseudonymizeCmd(settings instance.Settings) *cobra.Command {
+	var method, keySource string
+	command := &cobra.Command{
+		Use:   "decrypt VALUE...",
+		Short: "Decrypt values encrypted by the pseudonymize processor",
+		Long: `This command decrypts values encrypted by the encrypt or encrypt_ip
+methods of the pseudonymize processor and prints them, one per line. Values
+pseudonymized by the hmac method can't be decrypted.
+
+The key can be read from stdin, from an environment variable with
+env:VAR_NAME, or from the keystore with keystore:KEY_NAME.
+`,
+		Args: cobra.MinimumNArgs(1),
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			key, err := readPseudonymizeKey(settings, keySource)
+			if err != nil {
+				return err
+			}
+
+			for _, value := range args {
+				plain, err := pseudonymize.Decrypt(method, key, value)
+				if err != nil {
+					return fmt.Errorf("failed to decrypt %q: %w", value, err)
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), plain)
+			}
+			return nil
+		}),
+	}
+	command.Flags().StringVar(&method, "method", "encrypt", "method the values were encrypted with, encrypt or encrypt_ip")
+	command.Flags().StringVar(&keySource, "key", "stdin", "source of the key, stdin, env:VAR_NAME or keystore:KEY_NAME")
+	return command
+}
+
+func readPseudonymizeKey(settings instance.Settings, source string) ([]byte, error) {
+	name, found := strings.CutPrefix(source, "keystore:")
+	if !found {
+		key, err := cli.ReadPassword(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the key: %w", err)
+		}
+		return []byte(key), nil
+	}
+
+	store, err := getKeystore(settings)
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		return nil, errors.New("the keystore is not available")
+	}
+	secret, err := store.Retrieve(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve %s from the keystore: %w", name, err)
+	}
+	return secret.Get()
+}
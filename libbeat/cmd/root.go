@@ -34,13 +34,15 @@ import (
 // flags and runs subcommands
 type BeatsRootCmd struct {
 	cobra.Command
-	RunCmd        *cobra.Command
-	SetupCmd      *cobra.Command
-	VersionCmd    *cobra.Command
-	CompletionCmd *cobra.Command
-	ExportCmd     *cobra.Command
-	TestCmd       *cobra.Command
-	KeystoreCmd   *cobra.Command
+	RunCmd          *cobra.Command
+	SetupCmd        *cobra.Command
+	VersionCmd      *cobra.Command
+	CompletionCmd   *cobra.Command
+	ExportCmd       *cobra.Command
+	TestCmd         *cobra.Command
+	KeystoreCmd     *cobra.Command
+	DeadLetterCmd   *cobra.Command
+	PseudonymizeCmd *cobra.Command
 }
 
 // GenRootCmdWithSettings returns the root command to use for your beat. It take the
@@ -72,6 +74,8 @@ func GenRootCmdWithSettings(beatCreator beat.Creator, settings instance.Settings
 	rootCmd.TestCmd = genTestCmd(settings, beatCreator)
 	rootCmd.SetupCmd = genSetupCmd(settings, beatCreator)
 	rootCmd.KeystoreCmd = genKeystoreCmd(settings)
+	rootCmd.DeadLetterCmd = genDeadLetterCmd(settings)
+	rootCmd.PseudonymizeCmd = genPseudonymizeCmd(settings)
 	rootCmd.VersionCmd = GenVersionCmd(settings)
 	rootCmd.CompletionCmd = genCompletionCmd(settings, rootCmd)
 
@@ -105,6 +109,8 @@ func GenRootCmdWithSettings(beatCreator beat.Creator, settings instance.Settings
 	rootCmd.AddCommand(rootCmd.CompletionCmd)
 	rootCmd.AddCommand(rootCmd.ExportCmd)
 	rootCmd.AddCommand(rootCmd.TestCmd)
+	rootCmd.AddCommand(rootCmd.DeadLetterCmd)
+	rootCmd.AddCommand(rootCmd.PseudonymizeCmd)
 	if rootCmd.KeystoreCmd != nil {
 		rootCmd.AddCommand(rootCmd.KeystoreCmd)
 	}
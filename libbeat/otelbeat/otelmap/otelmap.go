@@ -23,10 +23,18 @@ import (
 	"reflect"
 	"time"
 
+	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/mapstr"
 
 	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+const (
+	// ESDocumentIDAttribute is the attribute key used to store the document ID in the log record.
+	ESDocumentIDAttribute = "elasticsearch.document_id"
 )
 
 // ToMapstr converts a [pcommon.Map] to a [mapstr.M].
@@ -87,3 +95,66 @@ func ConvertNonPrimitive(m mapstr.M) {
 		}
 	}
 }
+
+// ToLogRecord converts a beat event into the given log record. The encoding
+// we choose here is to set all fields in a Map in the Body of the log
+// record. Each log record encodes a single beats event.
+// This way we have full control over the final structure of the log in the
+// destination, as long as the exporter allows it.
+// For example, the elasticsearchexporter has an encoding specifically for this.
+// See https://github.com/open-telemetry/opentelemetry-collector-contrib/issues/35444.
+func ToLogRecord(log *logp.Logger, event *beat.Event, logRecord plog.LogRecord) {
+	if id, ok := event.Meta["_id"]; ok {
+		// Specify the id as an attribute used by the elasticsearchexporter
+		// to set the final document ID in Elasticsearch.
+		// When using the bodymap encoding in the exporter all attributes
+		// are stripped out of the final Elasticsearch document.
+		//
+		// See https://github.com/open-telemetry/opentelemetry-collector-contrib/issues/36882.
+		switch id := id.(type) {
+		case string:
+			logRecord.Attributes().PutStr(ESDocumentIDAttribute, id)
+		}
+	}
+
+	beatEvent := event.Fields
+	if beatEvent == nil {
+		beatEvent = mapstr.M{}
+	}
+	beatEvent["@timestamp"] = event.Timestamp
+	logRecord.SetTimestamp(pcommon.NewTimestampFromTime(event.Timestamp))
+
+	// Set the timestamp for when the event was first seen by the pipeline.
+	observedTimestamp := logRecord.Timestamp()
+	if created, err := beatEvent.GetValue("event.created"); err == nil {
+		switch created := created.(type) {
+		case time.Time:
+			observedTimestamp = pcommon.NewTimestampFromTime(created)
+		case common.Time:
+			observedTimestamp = pcommon.NewTimestampFromTime(time.Time(created))
+		default:
+			log.Warnf("Invalid 'event.created' type (%T); using log timestamp as observed timestamp.", created)
+		}
+	}
+	logRecord.SetObservedTimestamp(observedTimestamp)
+
+	ConvertNonPrimitive(beatEvent)
+
+	// if data_stream field is set on beatEvent. Add it to logrecord.Attributes to support dynamic indexing
+	if val, _ := beatEvent.GetValue("data_stream"); val != nil {
+		// If the below sub fields do not exist, it will return empty string.
+		var subFields = []string{"dataset", "namespace", "type"}
+
+		for _, subField := range subFields {
+			value, err := beatEvent.GetValue("data_stream." + subField)
+			if vStr, ok := value.(string); ok && err == nil {
+				// set log record attribute only if value is non empty
+				logRecord.Attributes().PutStr("data_stream."+subField, vStr)
+			}
+		}
+
+	}
+	if err := logRecord.Body().SetEmptyMap().FromRaw(map[string]any(beatEvent)); err != nil {
+		log.Errorf("received an error while converting map to plog.Log, some fields might be missing: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package avro provides a codec encoding events as Avro records, either
+// using a schema file or the schema registered for a subject in a
+// Confluent-compatible schema registry.
+package avro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/internal/schemacodec"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/schemaregistry"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// Config is used to pass encoding parameters to New.
+type Config struct {
+	SchemaFile     string    `config:"schema_file"`
+	SchemaID       int       `config:"schema_id" validate:"min=0"`
+	SchemaRegistry *config.C `config:"schema_registry"`
+
+	UnknownFields schemacodec.UnknownFields `config:",inline"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		UnknownFields: schemacodec.DefaultUnknownFields(),
+	}
+}
+
+func (c *Config) Validate() error {
+	if (c.SchemaFile == "") == (c.SchemaRegistry == nil) {
+		return errors.New("exactly one of schema_file or schema_registry must be configured")
+	}
+	if c.SchemaID != 0 && c.SchemaRegistry != nil {
+		return errors.New("schema_id can only be used with schema_file, the schema registry provides the ID")
+	}
+	return c.UnknownFields.Validate()
+}
+
+func init() {
+	codec.RegisterType("avro", func(info beat.Info, cfg *config.C) (codec.Codec, error) {
+		config := defaultConfig()
+		if cfg != nil {
+			if err := cfg.Unpack(&config); err != nil {
+				return nil, err
+			}
+		}
+
+		logger := info.Logger
+		if logger == nil {
+			logger = logp.NewLogger("")
+		}
+		return New(info.Version, config, logger.Named("avro"))
+	})
+}
+
+// Encoder serializes a beat.Event to an Avro record. If the schema has an
+// ID, the record is prefixed with the schema registry wire format header.
+type Encoder struct {
+	version  string
+	unknown  schemacodec.UnknownFields
+	registry *schemaregistry.Client
+	log      *logp.Logger
+
+	schema   *schema
+	schemaID int
+	buf      []byte
+
+	// compiled is only used by the refresh goroutine, of which there is at
+	// most one at a time.
+	compiled map[int]*schema
+
+	mu         sync.Mutex
+	refreshing bool
+	latest     *schema
+	latestID   int
+}
+
+// New creates a new Avro Encoder. Schemas from a schema registry are fetched
+// on creation, so configuration errors are reported early, and refreshed in
+// the background afterwards.
+func New(version string, config Config, log *logp.Logger) (*Encoder, error) {
+	e := &Encoder{
+		version:  version,
+		unknown:  config.UnknownFields,
+		log:      log,
+		compiled: map[int]*schema{},
+	}
+
+	if config.SchemaRegistry == nil {
+		text, err := os.ReadFile(config.SchemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read avro schema: %w", err)
+		}
+		s, err := e.compile(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid avro schema %s: %w", config.SchemaFile, err)
+		}
+		e.schema, e.schemaID = s, config.SchemaID
+		return e, nil
+	}
+
+	regConfig := schemaregistry.DefaultConfig()
+	if err := config.SchemaRegistry.Unpack(&regConfig); err != nil {
+		return nil, err
+	}
+	client, err := schemaregistry.NewClient(regConfig, "", log)
+	if err != nil {
+		return nil, err
+	}
+	e.registry = client
+
+	ctx, cancel := context.WithTimeout(context.Background(), schemaregistry.RefreshTimeout)
+	defer cancel()
+	e.schema, e.schemaID, err = e.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Encode serializes a beat event to an Avro record.
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	e.update()
+
+	doc := schemacodec.Document(index, e.version, event)
+	if e.unknown.Enabled() {
+		var unknown []schemacodec.Field
+		collectUnknown(e.schema, doc, nil, &unknown)
+		if err := e.unknown.Apply(doc, unknown); err != nil {
+			return nil, err
+		}
+	}
+
+	e.buf = e.buf[:0]
+	if e.schemaID > 0 {
+		e.buf = schemaregistry.AppendHeader(e.buf, e.schemaID)
+	}
+
+	var err error
+	e.buf, err = appendValue(e.buf, e.schema, doc, nil)
+	if err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// update switches to the schema loaded by the last refresh, and starts a
+// new refresh once the cached schema of the registry is stale. It never
+// waits for the registry.
+func (e *Encoder) update() {
+	if e.registry == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.latest != nil {
+		e.schema, e.schemaID = e.latest, e.latestID
+		e.latest = nil
+	}
+	if !e.refreshing && e.registry.Stale() {
+		e.refreshing = true
+		go e.refresh()
+	}
+}
+
+// refresh loads the current schema of the registry subject, for the next
+// call to update to switch to it.
+func (e *Encoder) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), schemaregistry.RefreshTimeout)
+	defer cancel()
+	s, id, err := e.load(ctx)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.refreshing = false
+	if err != nil {
+		e.log.Errorf("Failed to refresh the avro schema, keeping the current one: %v", err)
+		return
+	}
+	e.latest, e.latestID = s, id
+}
+
+// load returns the current schema of the registry subject and its ID.
+// Compiled schemas are kept by ID, so switching back and forth is cheap.
+func (e *Encoder) load(ctx context.Context) (*schema, int, error) {
+	rs, err := e.registry.Schema(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s, ok := e.compiled[rs.ID]
+	if !ok {
+		if rs.Type != schemaregistry.TypeAvro {
+			return nil, 0, fmt.Errorf("schema %d of subject %s has type %s, expected %s",
+				rs.ID, rs.Subject, rs.Type, schemaregistry.TypeAvro)
+		}
+
+		deps := make([]string, len(rs.Dependencies))
+		for i, dep := range rs.Dependencies {
+			deps[i] = dep.Schema
+		}
+		s, err = e.compile(rs.Schema, deps...)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid avro schema %d of subject %s: %w", rs.ID, rs.Subject, err)
+		}
+		e.compiled[rs.ID] = s
+	}
+	return s, rs.ID, nil
+}
+
+// compile parses the schema and checks it can hold events.
+func (e *Encoder) compile(text string, deps ...string) (*schema, error) {
+	s, err := parseSchema(text, deps...)
+	if err != nil {
+		return nil, err
+	}
+	if s.kind != kindRecord {
+		return nil, fmt.Errorf("the schema must be a record, got %v", s.kind)
+	}
+
+	if e.unknown.Mode == schemacodec.UnknownFieldsCollect {
+		f := s.lookupField(e.unknown.Target)
+		if f == nil || !f.typ.acceptsString() {
+			return nil, fmt.Errorf("the schema must define the string field %s to collect unknown fields", e.unknown.Target)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,282 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/internal/schemacodec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const testSchema = `{
+  "type": "record",
+  "name": "Event",
+  "namespace": "co.elastic.beats",
+  "fields": [
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}, "event_field": "@timestamp"},
+    {"name": "message", "type": "string"},
+    {"name": "count", "type": ["null", "int"]},
+    {"name": "level", "type": {"type": "enum", "name": "Level", "symbols": ["INFO", "ERROR"]}, "default": "INFO"},
+    {"name": "tags", "type": {"type": "array", "items": "string"}, "default": []},
+    {"name": "host", "type": ["null", {"type": "record", "name": "Host", "fields": [
+      {"name": "name", "type": "string"}
+    ]}]},
+    {"name": "unknown", "type": ["null", "string"]}
+  ]
+}`
+
+func writeSchema(t *testing.T, schema string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "event.avsc")
+	require.NoError(t, os.WriteFile(path, []byte(schema), 0o600))
+	return path
+}
+
+func newTestEncoder(t *testing.T, unknown string) *Encoder {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.SchemaFile = writeSchema(t, testSchema)
+	cfg.UnknownFields = schemacodec.UnknownFields{Mode: unknown, Target: "unknown"}
+	enc, err := New("1.2.3", cfg, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	return enc
+}
+
+// avroString and avroLong build the expected binary encoding.
+func avroLong(buf []byte, n int64) []byte {
+	return binary.AppendVarint(buf, n)
+}
+
+func avroString(buf []byte, s string) []byte {
+	return append(avroLong(buf, int64(len(s))), s...)
+}
+
+func TestEncode(t *testing.T) {
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	enc := newTestEncoder(t, schemacodec.UnknownFieldsIgnore)
+
+	got, err := enc.Encode("test", &beat.Event{
+		Timestamp: ts,
+		Fields: mapstr.M{
+			"message": "hello",
+			"count":   42,
+			"tags":    []string{"a", "b"},
+			"host":    mapstr.M{"name": "web-1", "ip": "10.0.0.1"},
+			"ignored": true,
+		},
+	})
+	require.NoError(t, err)
+
+	var want []byte
+	want = avroLong(want, ts.UnixMilli())
+	want = avroString(want, "hello")
+	want = avroLong(want, 1) // count: int branch
+	want = avroLong(want, 42)
+	want = avroLong(want, 0) // level: default INFO
+	want = avroLong(want, 2) // tags: one block with 2 items
+	want = avroString(want, "a")
+	want = avroString(want, "b")
+	want = avroLong(want, 0) // end of array
+	want = avroLong(want, 1) // host: record branch
+	want = avroString(want, "web-1")
+	want = avroLong(want, 0) // unknown: null branch
+	assert.Equal(t, want, got)
+}
+
+func TestEncodeErrors(t *testing.T) {
+	enc := newTestEncoder(t, schemacodec.UnknownFieldsIgnore)
+
+	tests := map[string]mapstr.M{
+		"missing required field": {},
+		"wrong type":             {"message": mapstr.M{"text": "hello"}},
+		"unknown enum symbol":    {"message": "hello", "level": "DEBUG"},
+		"int overflow":           {"message": "hello", "count": int64(1) << 40},
+	}
+	for name, fields := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := enc.Encode("test", &beat.Event{Timestamp: time.Now(), Fields: fields})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	event := &beat.Event{
+		Timestamp: time.Now(),
+		Fields: mapstr.M{
+			"message": "hello",
+			"host":    mapstr.M{"name": "web-1", "ip": "10.0.0.1"},
+			"user":    "alice",
+		},
+	}
+
+	t.Run("error", func(t *testing.T) {
+		enc := newTestEncoder(t, schemacodec.UnknownFieldsError)
+		_, err := enc.Encode("test", event)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "host.ip, user")
+	})
+
+	t.Run("collect", func(t *testing.T) {
+		enc := newTestEncoder(t, schemacodec.UnknownFieldsCollect)
+		got, err := enc.Encode("test", event)
+		require.NoError(t, err)
+
+		want, err := json.Marshal(map[string]interface{}{
+			"host": map[string]interface{}{"ip": "10.0.0.1"},
+			"user": "alice",
+		})
+		require.NoError(t, err)
+		suffix := avroString(avroLong(nil, 1), string(want))
+		assert.Equal(t, suffix, got[len(got)-len(suffix):])
+	})
+
+	t.Run("collect requires a string target field", func(t *testing.T) {
+		cfg := defaultConfig()
+		cfg.SchemaFile = writeSchema(t, testSchema)
+		cfg.UnknownFields = schemacodec.UnknownFields{Mode: schemacodec.UnknownFieldsCollect, Target: "count"}
+		_, err := New("1.2.3", cfg, logptest.NewTestingLogger(t, ""))
+		assert.Error(t, err)
+	})
+}
+
+func TestSchemaRegistry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/subjects/events-value/versions/latest":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"id": 7, "version": 2, "subject": "events-value",
+				"schema": `{"type": "record", "name": "Event", "fields": [
+					{"name": "message", "type": "string"},
+					{"name": "host", "type": "common.Host"}
+				]}`,
+				"references": []map[string]interface{}{
+					{"name": "common.Host", "subject": "host", "version": 1},
+				},
+			})
+		case "/subjects/host/versions/1":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"id": 1, "version": 1, "subject": "host",
+				"schema": `{"type": "record", "name": "Host", "namespace": "common", "fields": [{"name": "name", "type": "string"}]}`,
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.SchemaRegistry = config.MustNewConfigFrom(map[string]interface{}{
+		"url":     srv.URL,
+		"subject": "events-value",
+	})
+	enc, err := New("1.2.3", cfg, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+
+	got, err := enc.Encode("test", &beat.Event{
+		Timestamp: time.Now(),
+		Fields:    mapstr.M{"message": "hello", "host": mapstr.M{"name": "web-1"}},
+	})
+	require.NoError(t, err)
+
+	want := []byte{0, 0, 0, 0, 7}
+	want = avroString(want, "hello")
+	want = avroString(want, "web-1")
+	assert.Equal(t, want, got)
+}
+
+func TestSchemaRegistryRefresh(t *testing.T) {
+	var id atomic.Int32
+	id.Store(7)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := id.Load()
+		if current != 7 {
+			// Hold the refresh of the new schema until the test releases it.
+			<-release
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": current, "version": current, "subject": "events-value",
+			"schema": `{"type": "record", "name": "Event", "fields": [{"name": "message", "type": "string"}]}`,
+		})
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	cfg := defaultConfig()
+	cfg.SchemaRegistry = config.MustNewConfigFrom(map[string]interface{}{
+		"url":       srv.URL,
+		"subject":   "events-value",
+		"cache_ttl": "1ms",
+	})
+	// The refreshes and their connections can outlive the test, so they must
+	// not log to it.
+	enc, err := New("1.2.3", cfg, logp.NewLogger(""))
+	require.NoError(t, err)
+
+	schemaID := func() byte {
+		got, err := enc.Encode("test", &beat.Event{Fields: mapstr.M{"message": "hello"}})
+		require.NoError(t, err)
+		return got[4]
+	}
+
+	// The schema changes in the registry, but Encode keeps using the cached
+	// schema instead of waiting for the registry.
+	id.Store(8)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, byte(7), schemaID())
+	assert.Equal(t, byte(7), schemaID())
+
+	release <- struct{}{}
+	assert.Eventually(t, func() bool {
+		return schemaID() == 8
+	}, 5*time.Second, 10*time.Millisecond, "the new schema must be used once it is loaded")
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	tests := map[string]string{
+		"invalid json":       `{"type": "record"`,
+		"unknown type":       `{"type": "record", "name": "A", "fields": [{"name": "a", "type": "B"}]}`,
+		"nested union":       `["null", ["int", "string"]]`,
+		"enum without names": `{"type": "enum", "name": "E", "symbols": []}`,
+		"duplicate names":    `{"type": "record", "name": "A", "fields": [{"name": "a", "type": {"type": "fixed", "name": "A", "size": 1}}]}`,
+		"field without name": `{"type": "record", "name": "A", "fields": [{"type": "int"}]}`,
+	}
+	for name, schema := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseSchema(schema)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,358 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/internal/schemacodec"
+)
+
+// appendValue appends the Avro binary encoding of v to buf. The returned
+// slice must be used even if an error is returned.
+func appendValue(buf []byte, s *schema, v interface{}, path []string) ([]byte, error) {
+	switch s.kind {
+	case kindNull:
+		if v != nil {
+			return buf, typeError(path, s, v)
+		}
+		return buf, nil
+
+	case kindBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return buf, typeError(path, s, v)
+		}
+		if b {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+
+	case kindInt, kindLong:
+		n, ok := asLong(s, v)
+		if !ok || (s.kind == kindInt && (n < math.MinInt32 || n > math.MaxInt32)) {
+			return buf, typeError(path, s, v)
+		}
+		return binary.AppendVarint(buf, n), nil
+
+	case kindFloat:
+		f, ok := schemacodec.AsFloat(v)
+		if !ok {
+			return buf, typeError(path, s, v)
+		}
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(f))), nil
+
+	case kindDouble:
+		f, ok := schemacodec.AsFloat(v)
+		if !ok {
+			return buf, typeError(path, s, v)
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f)), nil
+
+	case kindBytes:
+		b, ok := asBytes(v)
+		if !ok {
+			return buf, typeError(path, s, v)
+		}
+		buf = binary.AppendVarint(buf, int64(len(b)))
+		return append(buf, b...), nil
+
+	case kindString:
+		str, ok := schemacodec.AsString(v)
+		if !ok {
+			return buf, typeError(path, s, v)
+		}
+		buf = binary.AppendVarint(buf, int64(len(str)))
+		return append(buf, str...), nil
+
+	case kindFixed:
+		b, ok := asBytes(v)
+		if !ok || len(b) != s.size {
+			return buf, typeError(path, s, v)
+		}
+		return append(buf, b...), nil
+
+	case kindEnum:
+		str, ok := v.(string)
+		if ok {
+			for i, sym := range s.symbols {
+				if sym == str {
+					return binary.AppendVarint(buf, int64(i)), nil
+				}
+			}
+		}
+		return buf, fmt.Errorf("%s: value %v is not a symbol of enum %s", pathString(path), v, s.name)
+
+	case kindArray:
+		items, ok := schemacodec.AsSlice(v)
+		if !ok {
+			return buf, typeError(path, s, v)
+		}
+		if len(items) > 0 {
+			buf = binary.AppendVarint(buf, int64(len(items)))
+			for _, item := range items {
+				var err error
+				if buf, err = appendValue(buf, s.items, item, path); err != nil {
+					return buf, err
+				}
+			}
+		}
+		return append(buf, 0), nil
+
+	case kindMap:
+		m, ok := schemacodec.AsMap(v)
+		if !ok {
+			return buf, typeError(path, s, v)
+		}
+		if len(m) > 0 {
+			buf = binary.AppendVarint(buf, int64(len(m)))
+			for key, value := range m {
+				buf = binary.AppendVarint(buf, int64(len(key)))
+				buf = append(buf, key...)
+
+				var err error
+				if buf, err = appendValue(buf, s.values, value, append(path, key)); err != nil {
+					return buf, err
+				}
+			}
+		}
+		return append(buf, 0), nil
+
+	case kindRecord:
+		m, ok := schemacodec.AsMap(v)
+		if !ok {
+			return buf, typeError(path, s, v)
+		}
+		for _, f := range s.fields {
+			var err error
+			if buf, err = appendField(buf, f, m, path); err != nil {
+				return buf, err
+			}
+		}
+		return buf, nil
+
+	case kindUnion:
+		return appendUnion(buf, s, v, path)
+	}
+
+	return buf, fmt.Errorf("%s: unsupported avro type %v", pathString(path), s.kind)
+}
+
+func appendField(buf []byte, f *field, m map[string]interface{}, path []string) ([]byte, error) {
+	path = append(path, f.key)
+	value, ok := m[f.key]
+	if ok && (value != nil || nullable(f.typ)) {
+		return appendValue(buf, f.typ, value, path)
+	}
+
+	switch {
+	case f.hasDef:
+		// Defaults of union fields always refer to the first branch.
+		s := f.typ
+		if s.kind == kindUnion {
+			buf = binary.AppendVarint(buf, 0)
+			s = s.branches[0]
+		}
+		return appendValue(buf, s, f.def, path)
+
+	case nullable(f.typ):
+		return appendValue(buf, f.typ, nil, path)
+	}
+	return buf, fmt.Errorf("%s: missing required field", pathString(path))
+}
+
+// appendUnion encodes v with the first branch that matches its type. If no
+// branch matches exactly, the branches are tried in order with conversions.
+func appendUnion(buf []byte, s *schema, v interface{}, path []string) ([]byte, error) {
+	start := len(buf)
+	for pass := 0; pass < 2; pass++ {
+		for i, branch := range s.branches {
+			if matches(branch, v) != (pass == 0) {
+				continue
+			}
+			out, err := appendValue(binary.AppendVarint(buf, int64(i)), branch, v, path)
+			if err == nil {
+				return out, nil
+			}
+			buf = out[:start]
+		}
+	}
+	return buf, fmt.Errorf("%s: value of type %T does not match any type of the union", pathString(path), v)
+}
+
+// matches reports whether v has the Go type that naturally maps to s.
+func matches(s *schema, v interface{}) bool {
+	switch s.kind {
+	case kindNull:
+		return v == nil
+	case kindBoolean:
+		_, ok := v.(bool)
+		return ok
+	case kindInt, kindLong:
+		if _, ok := v.(string); ok {
+			return false
+		}
+		if _, ok := schemacodec.AsTime(v); ok {
+			return isTimeLogical(s.logical)
+		}
+		_, ok := schemacodec.AsInt(v)
+		return ok
+	case kindFloat, kindDouble:
+		if _, ok := v.(string); ok {
+			return false
+		}
+		_, ok := schemacodec.AsFloat(v)
+		return ok
+	case kindString, kindEnum:
+		_, ok := v.(string)
+		return ok
+	case kindBytes, kindFixed:
+		_, ok := v.([]byte)
+		return ok
+	case kindRecord, kindMap:
+		_, ok := schemacodec.AsMap(v)
+		return ok
+	case kindArray:
+		_, ok := schemacodec.AsSlice(v)
+		return ok
+	}
+	return false
+}
+
+func nullable(s *schema) bool {
+	if s.kind == kindNull {
+		return true
+	}
+	for _, b := range s.branches {
+		if b.kind == kindNull {
+			return true
+		}
+	}
+	return false
+}
+
+func isTimeLogical(logical string) bool {
+	switch logical {
+	case logicalDate, logicalTimeMillis, logicalTimeMicros, logicalTimestampMillis, logicalTimestampMicros:
+		return true
+	}
+	return false
+}
+
+// asLong converts v to an int or long, applying the logical type of the
+// schema to timestamps.
+func asLong(s *schema, v interface{}) (int64, bool) {
+	if isTimeLogical(s.logical) {
+		if t, ok := schemacodec.AsTime(v); ok {
+			return timeValue(s.logical, t), true
+		}
+	}
+	return schemacodec.AsInt(v)
+}
+
+func timeValue(logical string, t time.Time) int64 {
+	t = t.UTC()
+	switch logical {
+	case logicalDate:
+		return int64(math.Floor(float64(t.Unix()) / (24 * 60 * 60)))
+	case logicalTimeMillis, logicalTimeMicros:
+		midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		if logical == logicalTimeMillis {
+			return t.Sub(midnight).Milliseconds()
+		}
+		return t.Sub(midnight).Microseconds()
+	case logicalTimestampMicros:
+		return t.UnixMicro()
+	default:
+		return t.UnixMilli()
+	}
+}
+
+func asBytes(v interface{}) ([]byte, bool) {
+	switch b := v.(type) {
+	case []byte:
+		return b, true
+	case string:
+		return []byte(b), true
+	}
+	return nil, false
+}
+
+// collectUnknown appends all fields of v that are not defined by s.
+func collectUnknown(s *schema, v interface{}, path []string, out *[]schemacodec.Field) {
+	switch s.kind {
+	case kindRecord:
+		m, ok := schemacodec.AsMap(v)
+		if !ok {
+			return
+		}
+		for key, value := range m {
+			if len(path) == 0 && schemacodec.Reserved(key) {
+				continue
+			}
+			fieldPath := append(path[:len(path):len(path)], key)
+			if f := s.lookupField(key); f != nil {
+				collectUnknown(f.typ, value, fieldPath, out)
+			} else {
+				*out = append(*out, schemacodec.Field{Path: fieldPath, Value: value})
+			}
+		}
+
+	case kindMap:
+		m, ok := schemacodec.AsMap(v)
+		if !ok {
+			return
+		}
+		for key, value := range m {
+			collectUnknown(s.values, value, append(path[:len(path):len(path)], key), out)
+		}
+
+	case kindArray:
+		items, _ := schemacodec.AsSlice(v)
+		for _, item := range items {
+			collectUnknown(s.items, item, path, out)
+		}
+
+	case kindUnion:
+		for _, branch := range s.branches {
+			if matches(branch, v) {
+				collectUnknown(branch, v, path, out)
+				return
+			}
+		}
+	}
+}
+
+func typeError(path []string, s *schema, v interface{}) error {
+	typ := s.kind.String()
+	if s.logical != "" {
+		typ += " (" + s.logical + ")"
+	}
+	return fmt.Errorf("%s: cannot encode value of type %T as avro %s", pathString(path), v, typ)
+}
+
+func pathString(path []string) string {
+	if len(path) == 0 {
+		return "event"
+	}
+	return strings.Join(path, ".")
+}
@@ -0,0 +1,358 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type kind int
+
+const (
+	kindNull kind = iota
+	kindBoolean
+	kindInt
+	kindLong
+	kindFloat
+	kindDouble
+	kindBytes
+	kindString
+	kindRecord
+	kindEnum
+	kindArray
+	kindMap
+	kindFixed
+	kindUnion
+)
+
+var primitives = map[string]kind{
+	"null":    kindNull,
+	"boolean": kindBoolean,
+	"int":     kindInt,
+	"long":    kindLong,
+	"float":   kindFloat,
+	"double":  kindDouble,
+	"bytes":   kindBytes,
+	"string":  kindString,
+}
+
+// Supported logical types.
+const (
+	logicalDate            = "date"
+	logicalTimeMillis      = "time-millis"
+	logicalTimeMicros      = "time-micros"
+	logicalTimestampMillis = "timestamp-millis"
+	logicalTimestampMicros = "timestamp-micros"
+)
+
+// fieldAttribute is the field attribute naming the event field a record
+// field is read from, if it differs from the field name. Avro names cannot
+// contain characters like '@' or '.'.
+const fieldAttribute = "event_field"
+
+// schema is a parsed Avro schema.
+type schema struct {
+	kind    kind
+	name    string
+	logical string
+
+	fields   []*field  // record
+	symbols  []string  // enum
+	size     int       // fixed
+	items    *schema   // array
+	values   *schema   // map
+	branches []*schema // union
+}
+
+type field struct {
+	name   string
+	key    string
+	typ    *schema
+	def    interface{}
+	hasDef bool
+}
+
+// parser resolves named types across a schema and its dependencies.
+type parser struct {
+	names map[string]*schema
+}
+
+func newParser() *parser {
+	return &parser{names: map[string]*schema{}}
+}
+
+// parseSchema parses an Avro schema in JSON format. Named types defined by
+// the dependencies can be referenced by the schema.
+func parseSchema(text string, deps ...string) (*schema, error) {
+	p := newParser()
+	for _, dep := range deps {
+		if _, err := p.parseJSON(dep); err != nil {
+			return nil, fmt.Errorf("invalid referenced schema: %w", err)
+		}
+	}
+	return p.parseJSON(text)
+}
+
+func (p *parser) parseJSON(text string) (*schema, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		// Plain type names like "string" are valid schemas, even without
+		// JSON quotes.
+		if name := strings.TrimSpace(text); name != "" && !strings.ContainsAny(name, "{[\"") {
+			return p.parse(name, "")
+		}
+		return nil, fmt.Errorf("invalid avro schema: %w", err)
+	}
+	return p.parse(raw, "")
+}
+
+func (p *parser) parse(raw interface{}, namespace string) (*schema, error) {
+	switch v := raw.(type) {
+	case string:
+		if k, ok := primitives[v]; ok {
+			return &schema{kind: k}, nil
+		}
+		if s, ok := p.names[fullName(v, namespace)]; ok {
+			return s, nil
+		}
+		if s, ok := p.names[v]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown avro type %q", v)
+
+	case []interface{}:
+		s := &schema{kind: kindUnion}
+		for _, b := range v {
+			branch, err := p.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			if branch.kind == kindUnion {
+				return nil, errors.New("unions must not contain other unions")
+			}
+			s.branches = append(s.branches, branch)
+		}
+		if len(s.branches) == 0 {
+			return nil, errors.New("unions must have at least one branch")
+		}
+		return s, nil
+
+	case map[string]interface{}:
+		return p.parseComplex(v, namespace)
+	}
+	return nil, fmt.Errorf("invalid avro schema definition %v", raw)
+}
+
+func (p *parser) parseComplex(def map[string]interface{}, namespace string) (*schema, error) {
+	typ, ok := def["type"].(string)
+	if !ok {
+		// The type is itself a schema, like {"type": {"type": "array", ...}}.
+		if nested, ok := def["type"]; ok {
+			return p.parse(nested, namespace)
+		}
+		return nil, errors.New("avro schema is missing the type")
+	}
+
+	switch typ {
+	case "record", "error":
+		return p.parseRecord(def, namespace)
+
+	case "enum":
+		s, err := p.define(def, kindEnum, namespace)
+		if err != nil {
+			return nil, err
+		}
+		symbols, _ := def["symbols"].([]interface{})
+		for _, sym := range symbols {
+			name, ok := sym.(string)
+			if !ok {
+				return nil, fmt.Errorf("enum %s contains invalid symbol %v", s.name, sym)
+			}
+			s.symbols = append(s.symbols, name)
+		}
+		if len(s.symbols) == 0 {
+			return nil, fmt.Errorf("enum %s has no symbols", s.name)
+		}
+		return s, nil
+
+	case "fixed":
+		s, err := p.define(def, kindFixed, namespace)
+		if err != nil {
+			return nil, err
+		}
+		size, ok := def["size"].(json.Number)
+		n, err := size.Int64()
+		if !ok || err != nil || n < 0 {
+			return nil, fmt.Errorf("fixed %s has invalid size %v", s.name, def["size"])
+		}
+		s.size = int(n)
+		s.logical, _ = def["logicalType"].(string)
+		return s, nil
+
+	case "array":
+		items, err := p.parse(def["items"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid array items: %w", err)
+		}
+		return &schema{kind: kindArray, items: items}, nil
+
+	case "map":
+		values, err := p.parse(def["values"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid map values: %w", err)
+		}
+		return &schema{kind: kindMap, values: values}, nil
+	}
+
+	s, err := p.parse(typ, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if logical, ok := def["logicalType"].(string); ok && s.kind != kindRecord && s.kind != kindEnum {
+		// Annotated primitives are copied so the shared named types
+		// are not modified.
+		annotated := *s
+		annotated.logical = logical
+		return &annotated, nil
+	}
+	return s, nil
+}
+
+func (p *parser) parseRecord(def map[string]interface{}, namespace string) (*schema, error) {
+	s, err := p.define(def, kindRecord, namespace)
+	if err != nil {
+		return nil, err
+	}
+	recordNamespace := namespaceOf(s.name)
+
+	fields, ok := def["fields"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("record %s has no fields", s.name)
+	}
+	keys := map[string]bool{}
+	for _, raw := range fields {
+		fdef, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("record %s contains an invalid field definition", s.name)
+		}
+		name, _ := fdef["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("record %s contains a field without name", s.name)
+		}
+
+		typ, err := p.parse(fdef["type"], recordNamespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid type of field %s.%s: %w", s.name, name, err)
+		}
+
+		f := &field{name: name, key: name, typ: typ}
+		if key, ok := fdef[fieldAttribute].(string); ok && key != "" {
+			f.key = key
+		}
+		if keys[f.key] {
+			return nil, fmt.Errorf("record %s reads event field %s more than once", s.name, f.key)
+		}
+		keys[f.key] = true
+		f.def, f.hasDef = fdef["default"]
+		s.fields = append(s.fields, f)
+	}
+	return s, nil
+}
+
+// define registers a new named type, so it can be referenced before its
+// definition is complete.
+func (p *parser) define(def map[string]interface{}, k kind, namespace string) (*schema, error) {
+	name, _ := def["name"].(string)
+	if name == "" {
+		return nil, errors.New("named avro type without name")
+	}
+	if ns, ok := def["namespace"].(string); ok && !strings.Contains(name, ".") {
+		namespace = ns
+	}
+
+	s := &schema{kind: k, name: fullName(name, namespace)}
+	if _, exists := p.names[s.name]; exists {
+		return nil, fmt.Errorf("avro type %s is defined more than once", s.name)
+	}
+	p.names[s.name] = s
+	return s, nil
+}
+
+func fullName(name, namespace string) string {
+	if namespace == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return namespace + "." + name
+}
+
+func namespaceOf(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// lookupField returns the field of a record that reads the event field key.
+func (s *schema) lookupField(key string) *field {
+	for _, f := range s.fields {
+		if f.key == key {
+			return f
+		}
+	}
+	return nil
+}
+
+// acceptsString reports whether a string can be encoded with the schema
+// without conversions.
+func (s *schema) acceptsString() bool {
+	if s.kind == kindString {
+		return true
+	}
+	for _, b := range s.branches {
+		if b.kind == kindString {
+			return true
+		}
+	}
+	return false
+}
+
+func (k kind) String() string {
+	for name, pk := range primitives {
+		if pk == k {
+			return name
+		}
+	}
+	names := [...]string{
+		kindRecord: "record",
+		kindEnum:   "enum",
+		kindArray:  "array",
+		kindMap:    "map",
+		kindFixed:  "fixed",
+		kindUnion:  "union",
+	}
+	if int(k) < len(names) && names[k] != "" {
+		return names[k]
+	}
+	return "unknown"
+}
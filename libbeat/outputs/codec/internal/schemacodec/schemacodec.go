@@ -0,0 +1,304 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package schemacodec contains helpers shared by the codecs that encode
+// events according to a user provided schema.
+package schemacodec
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Modes for handling event fields that are not part of the schema.
+const (
+	UnknownFieldsIgnore  = "ignore"
+	UnknownFieldsError   = "error"
+	UnknownFieldsCollect = "collect"
+)
+
+// UnknownFields configures how event fields that are not part of the
+// schema are handled.
+type UnknownFields struct {
+	Mode   string `config:"unknown_fields"`
+	Target string `config:"unknown_fields_target"`
+}
+
+// Field is an event field that is not part of the schema.
+type Field struct {
+	Path  []string
+	Value interface{}
+}
+
+func (f Field) String() string {
+	return strings.Join(f.Path, ".")
+}
+
+// DefaultUnknownFields ignores fields that are not part of the schema.
+func DefaultUnknownFields() UnknownFields {
+	return UnknownFields{Mode: UnknownFieldsIgnore}
+}
+
+func (u *UnknownFields) Validate() error {
+	switch u.Mode {
+	case UnknownFieldsIgnore, UnknownFieldsError:
+	case UnknownFieldsCollect:
+		if u.Target == "" {
+			return fmt.Errorf("unknown_fields_target must be set when unknown_fields is %q", UnknownFieldsCollect)
+		}
+	default:
+		return fmt.Errorf("unknown_fields must be one of %s, %s or %s, got %q",
+			UnknownFieldsIgnore, UnknownFieldsError, UnknownFieldsCollect, u.Mode)
+	}
+	return nil
+}
+
+// Enabled reports whether the codec needs to look for unknown fields.
+func (u UnknownFields) Enabled() bool {
+	return u.Mode == UnknownFieldsError || u.Mode == UnknownFieldsCollect
+}
+
+// Apply handles the fields of doc that are not part of the schema. In
+// collect mode the fields are JSON encoded into the top-level target field.
+func (u UnknownFields) Apply(doc map[string]interface{}, fields []Field) error {
+	if len(fields) == 0 || !u.Enabled() {
+		return nil
+	}
+
+	if u.Mode == UnknownFieldsError {
+		names := make([]string, len(fields))
+		for i, f := range fields {
+			names[i] = f.String()
+		}
+		sort.Strings(names)
+		return fmt.Errorf("event contains fields not defined in the schema: %s", strings.Join(names, ", "))
+	}
+
+	collected := map[string]interface{}{}
+	for _, f := range fields {
+		m := collected
+		for _, key := range f.Path[:len(f.Path)-1] {
+			next, ok := m[key].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				m[key] = next
+			}
+			m = next
+		}
+		m[f.Path[len(f.Path)-1]] = f.Value
+	}
+
+	encoded, err := json.Marshal(collected)
+	if err != nil {
+		return fmt.Errorf("failed to encode unknown fields: %w", err)
+	}
+	doc[u.Target] = string(encoded)
+	return nil
+}
+
+// Document returns the event in the layout used by the json codec, with the
+// event timestamp in `@timestamp` and the metadata in `@metadata`. The event
+// fields are not copied, the returned document must not be modified beyond
+// its top-level keys.
+func Document(index, version string, event *beat.Event) map[string]interface{} {
+	doc := make(map[string]interface{}, len(event.Fields)+2)
+	for k, v := range event.Fields {
+		doc[k] = v
+	}
+
+	meta := make(map[string]interface{}, len(event.Meta)+3)
+	for k, v := range event.Meta {
+		meta[k] = v
+	}
+	meta["beat"] = index
+	meta["type"] = "_doc"
+	meta["version"] = version
+
+	doc["@timestamp"] = event.Timestamp
+	doc["@metadata"] = meta
+	return doc
+}
+
+// Reserved reports whether key is one of the top-level fields added by
+// Document. They are encoded if the schema defines them, but never reported
+// as unknown fields.
+func Reserved(key string) bool {
+	return key == "@timestamp" || key == "@metadata"
+}
+
+// AsMap returns v as a map if it is an object.
+func AsMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case mapstr.M:
+		return m, true
+	case map[string]string:
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			out[k] = v
+		}
+		return out, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	out := make(map[string]interface{}, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		out[iter.Key().String()] = iter.Value().Interface()
+	}
+	return out, true
+}
+
+// AsSlice returns v as a slice if it is an array. Byte slices are not
+// considered arrays.
+func AsSlice(v interface{}) ([]interface{}, bool) {
+	switch s := v.(type) {
+	case []interface{}:
+		return s, true
+	case []byte:
+		return nil, false
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	out := make([]interface{}, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out, true
+}
+
+// AsInt returns v as an integer. Floats are only accepted if they do not
+// have a fractional part, strings must contain a base 10 integer.
+func AsInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true //nolint:gosec // overflow is accepted like in the json codec
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true //nolint:gosec // overflow is accepted like in the json codec
+	case float32:
+		if float32(int64(n)) == n {
+			return int64(n), true
+		}
+	case float64:
+		if float64(int64(n)) == n {
+			return int64(n), true
+		}
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// AsFloat returns v as a floating point number. Strings must contain a
+// valid number.
+func AsFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	if i, ok := AsInt(v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+// AsTime returns v as a timestamp. Strings must be formatted as RFC 3339.
+func AsTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t != nil {
+			return *t, true
+		}
+	case common.Time:
+		return time.Time(t), true
+	case string:
+		ts, err := time.Parse(time.RFC3339Nano, t)
+		return ts, err == nil
+	}
+	return time.Time{}, false
+}
+
+// AsString returns v as a string. Scalar values are formatted, timestamps
+// use RFC 3339 with nanosecond precision.
+func AsString(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case []byte:
+		return string(s), true
+	case bool:
+		return strconv.FormatBool(s), true
+	case json.Number:
+		return s.String(), true
+	}
+	if t, ok := AsTime(v); ok {
+		return t.UTC().Format(time.RFC3339Nano), true
+	}
+	if i, ok := AsInt(v); ok {
+		return strconv.FormatInt(i, 10), true
+	}
+	if f, ok := AsFloat(v); ok {
+		return strconv.FormatFloat(f, 'g', -1, 64), true
+	}
+	return "", false
+}
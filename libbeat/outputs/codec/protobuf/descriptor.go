@@ -0,0 +1,160 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	// Register the well-known types, so schemas can import them without
+	// shipping their descriptors.
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fallbackResolver resolves descriptors from the schema files first and
+// falls back to the well-known types linked into the binary.
+type fallbackResolver struct {
+	local *protoregistry.Files
+}
+
+func (r fallbackResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if fd, err := r.local.FindFileByPath(path); err == nil {
+		return fd, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (r fallbackResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if d, err := r.local.FindDescriptorByName(name); err == nil {
+		return d, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
+
+// buildFiles creates a registry from file descriptors given in any order.
+// Imports not contained in protos are resolved from the well-known types.
+func buildFiles(protos []*descriptorpb.FileDescriptorProto) (*protoregistry.Files, error) {
+	files := new(protoregistry.Files)
+	resolver := fallbackResolver{local: files}
+
+	pending := protos
+	for len(pending) > 0 {
+		var next []*descriptorpb.FileDescriptorProto
+		for _, fdp := range pending {
+			if !importsResolvable(fdp, resolver, pending) {
+				next = append(next, fdp)
+				continue
+			}
+			fd, err := protodesc.NewFile(fdp, resolver)
+			if err != nil {
+				return nil, fmt.Errorf("invalid descriptor of %s: %w", fdp.GetName(), err)
+			}
+			if err := files.RegisterFile(fd); err != nil {
+				return nil, err
+			}
+		}
+		if len(next) == len(pending) {
+			names := make([]string, len(next))
+			for i, fdp := range next {
+				names[i] = fdp.GetName()
+			}
+			return nil, fmt.Errorf("unresolved imports in %s", strings.Join(names, ", "))
+		}
+		pending = next
+	}
+	return files, nil
+}
+
+// importsResolvable reports whether all imports of fdp are available. An
+// import that is still pending must be registered first, even if a
+// well-known type with the same path exists.
+func importsResolvable(fdp *descriptorpb.FileDescriptorProto, resolver fallbackResolver, pending []*descriptorpb.FileDescriptorProto) bool {
+	for _, dep := range fdp.GetDependency() {
+		for _, p := range pending {
+			if p.GetName() == dep {
+				return false
+			}
+		}
+		if _, err := resolver.FindFileByPath(dep); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// findMessage returns the message with the given full name. If name is
+// empty, the first message of the file is used.
+func findMessage(files *protoregistry.Files, file, name string) (protoreflect.MessageDescriptor, error) {
+	if name == "" {
+		fd, err := files.FindFileByPath(file)
+		if err != nil {
+			return nil, err
+		}
+		if fd.Messages().Len() == 0 {
+			return nil, fmt.Errorf("%s does not define any message", file)
+		}
+		return fd.Messages().Get(0), nil
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("message %s not found: %w", name, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return md, nil
+}
+
+// appendMessageIndexes appends the Confluent message indexes identifying md
+// within its file. The common case of the first top-level message is
+// encoded as a single zero byte.
+func appendMessageIndexes(buf []byte, md protoreflect.MessageDescriptor) ([]byte, error) {
+	var indexes []int
+	var d protoreflect.Descriptor = md
+	for {
+		msg, ok := d.(protoreflect.MessageDescriptor)
+		if !ok {
+			break
+		}
+		indexes = append([]int{msg.Index()}, indexes...)
+		d = msg.Parent()
+	}
+	if len(indexes) == 0 {
+		return nil, errors.New("message is not part of a file")
+	}
+
+	if len(indexes) == 1 && indexes[0] == 0 {
+		return append(buf, 0), nil
+	}
+	buf = binary.AppendVarint(buf, int64(len(indexes)))
+	for _, i := range indexes {
+		buf = binary.AppendVarint(buf, int64(i))
+	}
+	return buf, nil
+}
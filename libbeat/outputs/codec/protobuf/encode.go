@@ -0,0 +1,379 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/internal/schemacodec"
+)
+
+const (
+	timestampMessage = "google.protobuf.Timestamp"
+	structMessage    = "google.protobuf.Struct"
+	valueMessage     = "google.protobuf.Value"
+	listValueMessage = "google.protobuf.ListValue"
+)
+
+// fieldKey returns the event field a protobuf field is read from. A custom
+// json_name takes precedence over the field name, so fields like
+// `@timestamp` can be mapped.
+func fieldKey(fd protoreflect.FieldDescriptor) string {
+	name := string(fd.Name())
+	if fd.HasJSONName() && fd.JSONName() != defaultJSONName(name) {
+		return fd.JSONName()
+	}
+	return name
+}
+
+// defaultJSONName returns the JSON name protoc derives from a field name.
+func defaultJSONName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// lookupField returns the field of md that reads the event field key.
+func lookupField(md protoreflect.MessageDescriptor, key string) protoreflect.FieldDescriptor {
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); fieldKey(fd) == key {
+			return fd
+		}
+	}
+	return nil
+}
+
+// setMessage populates msg from the object v. Fields missing from v are
+// left unset.
+func setMessage(msg protoreflect.Message, v interface{}, path []string) error {
+	md := msg.Descriptor()
+	if isWellKnown(md) {
+		return setWellKnown(msg, v, path)
+	}
+
+	m, ok := schemacodec.AsMap(v)
+	if !ok {
+		return typeError(path, string(md.FullName()), v)
+	}
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		key := fieldKey(fd)
+		value, ok := m[key]
+		if !ok || value == nil {
+			continue
+		}
+		if err := setField(msg, fd, value, append(path, key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setField(msg protoreflect.Message, fd protoreflect.FieldDescriptor, v interface{}, path []string) error {
+	switch {
+	case fd.IsList():
+		items, ok := schemacodec.AsSlice(v)
+		if !ok {
+			// A single value is accepted as a list with one element.
+			items = []interface{}{v}
+		}
+		list := msg.Mutable(fd).List()
+		for _, item := range items {
+			if fd.Message() != nil {
+				elem := list.NewElement()
+				if err := setMessage(elem.Message(), item, path); err != nil {
+					return err
+				}
+				list.Append(elem)
+				continue
+			}
+			value, err := scalarValue(fd, item, path)
+			if err != nil {
+				return err
+			}
+			list.Append(value)
+		}
+		return nil
+
+	case fd.IsMap():
+		m, ok := schemacodec.AsMap(v)
+		if !ok {
+			return typeError(path, "map", v)
+		}
+		mp := msg.Mutable(fd).Map()
+		for k, item := range m {
+			key, err := scalarValue(fd.MapKey(), k, path)
+			if err != nil {
+				return err
+			}
+			itemPath := append(path, k)
+			if fd.MapValue().Message() != nil {
+				value := mp.NewValue()
+				if err := setMessage(value.Message(), item, itemPath); err != nil {
+					return err
+				}
+				mp.Set(key.MapKey(), value)
+				continue
+			}
+			value, err := scalarValue(fd.MapValue(), item, itemPath)
+			if err != nil {
+				return err
+			}
+			mp.Set(key.MapKey(), value)
+		}
+		return nil
+
+	case fd.Message() != nil:
+		return setMessage(msg.Mutable(fd).Message(), v, path)
+	}
+
+	value, err := scalarValue(fd, v, path)
+	if err != nil {
+		return err
+	}
+	msg.Set(fd, value)
+	return nil
+}
+
+func scalarValue(fd protoreflect.FieldDescriptor, v interface{}, path []string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if b, ok := v.(bool); ok {
+			return protoreflect.ValueOfBool(b), nil
+		}
+
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if n, ok := schemacodec.AsInt(v); ok && n >= math.MinInt32 && n <= math.MaxInt32 {
+			return protoreflect.ValueOfInt32(int32(n)), nil
+		}
+
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if n, ok := schemacodec.AsInt(v); ok {
+			return protoreflect.ValueOfInt64(n), nil
+		}
+
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if n, ok := schemacodec.AsInt(v); ok && n >= 0 && n <= math.MaxUint32 {
+			return protoreflect.ValueOfUint32(uint32(n)), nil
+		}
+
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if n, ok := v.(uint64); ok {
+			return protoreflect.ValueOfUint64(n), nil
+		}
+		if n, ok := schemacodec.AsInt(v); ok && n >= 0 {
+			return protoreflect.ValueOfUint64(uint64(n)), nil
+		}
+
+	case protoreflect.FloatKind:
+		if f, ok := schemacodec.AsFloat(v); ok {
+			return protoreflect.ValueOfFloat32(float32(f)), nil
+		}
+
+	case protoreflect.DoubleKind:
+		if f, ok := schemacodec.AsFloat(v); ok {
+			return protoreflect.ValueOfFloat64(f), nil
+		}
+
+	case protoreflect.StringKind:
+		if s, ok := schemacodec.AsString(v); ok {
+			return protoreflect.ValueOfString(s), nil
+		}
+
+	case protoreflect.BytesKind:
+		switch b := v.(type) {
+		case []byte:
+			return protoreflect.ValueOfBytes(b), nil
+		case string:
+			return protoreflect.ValueOfBytes([]byte(b)), nil
+		}
+
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		if s, ok := v.(string); ok {
+			if ev := values.ByName(protoreflect.Name(s)); ev != nil {
+				return protoreflect.ValueOfEnum(ev.Number()), nil
+			}
+			return protoreflect.Value{}, fmt.Errorf("%s: %q is not a value of enum %s", pathString(path), s, fd.Enum().FullName())
+		}
+		if n, ok := schemacodec.AsInt(v); ok && values.ByNumber(protoreflect.EnumNumber(n)) != nil {
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+		}
+	}
+
+	return protoreflect.Value{}, typeError(path, fd.Kind().String(), v)
+}
+
+func isWellKnown(md protoreflect.MessageDescriptor) bool {
+	switch md.FullName() {
+	case timestampMessage, structMessage, valueMessage, listValueMessage:
+		return true
+	}
+	return isWrapper(md)
+}
+
+// isWrapper reports whether md is one of the wrapper types like
+// google.protobuf.StringValue.
+func isWrapper(md protoreflect.MessageDescriptor) bool {
+	return md.ParentFile().Package() == "google.protobuf" &&
+		strings.HasSuffix(string(md.Name()), "Value") &&
+		md.Fields().Len() == 1 && md.Fields().Get(0).Name() == "value"
+}
+
+func setWellKnown(msg protoreflect.Message, v interface{}, path []string) error {
+	md := msg.Descriptor()
+	switch md.FullName() {
+	case timestampMessage:
+		t, ok := schemacodec.AsTime(v)
+		if !ok {
+			return typeError(path, timestampMessage, v)
+		}
+		msg.Set(md.Fields().ByName("seconds"), protoreflect.ValueOfInt64(t.Unix()))
+		msg.Set(md.Fields().ByName("nanos"), protoreflect.ValueOfInt32(int32(t.Nanosecond()))) //nolint:gosec // nanoseconds are always below 1e9
+		return nil
+
+	case structMessage, valueMessage, listValueMessage:
+		value, err := structpb.NewValue(plain(v))
+		if err != nil {
+			return fmt.Errorf("%s: %w", pathString(path), err)
+		}
+		var src proto.Message = value
+		switch md.FullName() {
+		case structMessage:
+			if value.GetStructValue() == nil {
+				return typeError(path, structMessage, v)
+			}
+			src = value.GetStructValue()
+		case listValueMessage:
+			if value.GetListValue() == nil {
+				return typeError(path, listValueMessage, v)
+			}
+			src = value.GetListValue()
+		}
+		// The schema may carry its own copy of the descriptor, so the value
+		// is transferred in the wire format.
+		data, err := proto.Marshal(src)
+		if err != nil {
+			return err
+		}
+		return proto.UnmarshalOptions{Merge: true}.Unmarshal(data, msg.Interface())
+	}
+
+	fd := md.Fields().Get(0)
+	value, err := scalarValue(fd, v, path)
+	if err != nil {
+		return err
+	}
+	msg.Set(fd, value)
+	return nil
+}
+
+// plain converts v into the types supported by structpb.
+func plain(v interface{}) interface{} {
+	if m, ok := schemacodec.AsMap(v); ok {
+		out := make(map[string]interface{}, len(m))
+		for k, item := range m {
+			out[k] = plain(item)
+		}
+		return out
+	}
+	if items, ok := schemacodec.AsSlice(v); ok {
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			out[i] = plain(item)
+		}
+		return out
+	}
+	if _, ok := v.(string); !ok {
+		if t, ok := schemacodec.AsTime(v); ok {
+			return t.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return v
+}
+
+// collectUnknown appends all fields of v that are not defined by md.
+func collectUnknown(md protoreflect.MessageDescriptor, v interface{}, path []string, out *[]schemacodec.Field) {
+	if isWellKnown(md) {
+		return
+	}
+	m, ok := schemacodec.AsMap(v)
+	if !ok {
+		return
+	}
+
+	for key, value := range m {
+		if len(path) == 0 && schemacodec.Reserved(key) {
+			continue
+		}
+		fieldPath := append(path[:len(path):len(path)], key)
+		fd := lookupField(md, key)
+		switch {
+		case fd == nil:
+			*out = append(*out, schemacodec.Field{Path: fieldPath, Value: value})
+		case fd.IsMap():
+			if fd.MapValue().Message() == nil {
+				continue
+			}
+			values, _ := schemacodec.AsMap(value)
+			for k, item := range values {
+				collectUnknown(fd.MapValue().Message(), item, append(fieldPath[:len(fieldPath):len(fieldPath)], k), out)
+			}
+		case fd.Message() != nil && fd.IsList():
+			items, _ := schemacodec.AsSlice(value)
+			for _, item := range items {
+				collectUnknown(fd.Message(), item, fieldPath, out)
+			}
+		case fd.Message() != nil:
+			collectUnknown(fd.Message(), value, fieldPath, out)
+		}
+	}
+}
+
+func typeError(path []string, typ string, v interface{}) error {
+	return fmt.Errorf("%s: cannot encode value of type %T as protobuf %s", pathString(path), v, typ)
+}
+
+func pathString(path []string) string {
+	if len(path) == 0 {
+		return "event"
+	}
+	return strings.Join(path, ".")
+}
@@ -0,0 +1,312 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package protobuf provides a codec encoding events as Protobuf messages,
+// using a compiled descriptor set or the schema registered for a subject in
+// a Confluent-compatible schema registry.
+package protobuf
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/internal/schemacodec"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/schemaregistry"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// Config is used to pass encoding parameters to New.
+type Config struct {
+	DescriptorFile string    `config:"descriptor_file"`
+	Message        string    `config:"message"`
+	SchemaID       int       `config:"schema_id" validate:"min=0"`
+	SchemaRegistry *config.C `config:"schema_registry"`
+
+	UnknownFields schemacodec.UnknownFields `config:",inline"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		UnknownFields: schemacodec.DefaultUnknownFields(),
+	}
+}
+
+func (c *Config) Validate() error {
+	if (c.DescriptorFile == "") == (c.SchemaRegistry == nil) {
+		return errors.New("exactly one of descriptor_file or schema_registry must be configured")
+	}
+	if c.DescriptorFile != "" && c.Message == "" {
+		return errors.New("message must be set when using a descriptor_file")
+	}
+	if c.SchemaID != 0 && c.SchemaRegistry != nil {
+		return errors.New("schema_id can only be used with descriptor_file, the schema registry provides the ID")
+	}
+	return c.UnknownFields.Validate()
+}
+
+func init() {
+	codec.RegisterType("protobuf", func(info beat.Info, cfg *config.C) (codec.Codec, error) {
+		config := defaultConfig()
+		if cfg != nil {
+			if err := cfg.Unpack(&config); err != nil {
+				return nil, err
+			}
+		}
+
+		logger := info.Logger
+		if logger == nil {
+			logger = logp.NewLogger("")
+		}
+		return New(info.Version, config, logger.Named("protobuf"))
+	})
+}
+
+// Encoder serializes a beat.Event to a Protobuf message. If the schema has
+// an ID, the message is prefixed with the schema registry wire format header
+// and message indexes.
+type Encoder struct {
+	version  string
+	message  string
+	unknown  schemacodec.UnknownFields
+	registry *schemaregistry.Client
+	log      *logp.Logger
+
+	schema *compiledSchema
+	buf    []byte
+
+	// compiled is only used by the refresh goroutine, of which there is at
+	// most one at a time.
+	compiled map[int]*compiledSchema
+
+	mu         sync.Mutex
+	refreshing bool
+	latest     *compiledSchema
+}
+
+type compiledSchema struct {
+	id     int
+	desc   protoreflect.MessageDescriptor
+	header []byte
+}
+
+// New creates a new Protobuf Encoder. Schemas from a schema registry are
+// fetched on creation, so configuration errors are reported early, and
+// refreshed in the background afterwards.
+func New(version string, config Config, log *logp.Logger) (*Encoder, error) {
+	e := &Encoder{
+		version:  version,
+		message:  config.Message,
+		unknown:  config.UnknownFields,
+		log:      log,
+		compiled: map[int]*compiledSchema{},
+	}
+
+	if config.SchemaRegistry == nil {
+		data, err := os.ReadFile(config.DescriptorFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read protobuf descriptor set: %w", err)
+		}
+		var set descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &set); err != nil {
+			return nil, fmt.Errorf("invalid protobuf descriptor set %s: %w", config.DescriptorFile, err)
+		}
+		e.schema, err = e.compile(config.SchemaID, set.GetFile(), "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid protobuf descriptor set %s: %w", config.DescriptorFile, err)
+		}
+		return e, nil
+	}
+
+	regConfig := schemaregistry.DefaultConfig()
+	if err := config.SchemaRegistry.Unpack(&regConfig); err != nil {
+		return nil, err
+	}
+	client, err := schemaregistry.NewClient(regConfig, schemaregistry.FormatSerialized, log)
+	if err != nil {
+		return nil, err
+	}
+	e.registry = client
+
+	ctx, cancel := context.WithTimeout(context.Background(), schemaregistry.RefreshTimeout)
+	defer cancel()
+	e.schema, err = e.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Encode serializes a beat event to a Protobuf message.
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	e.update()
+
+	doc := schemacodec.Document(index, e.version, event)
+	if e.unknown.Enabled() {
+		var unknown []schemacodec.Field
+		collectUnknown(e.schema.desc, doc, nil, &unknown)
+		if err := e.unknown.Apply(doc, unknown); err != nil {
+			return nil, err
+		}
+	}
+
+	msg := dynamicpb.NewMessage(e.schema.desc)
+	if err := setMessage(msg, doc, nil); err != nil {
+		return nil, err
+	}
+
+	var err error
+	e.buf = append(e.buf[:0], e.schema.header...)
+	e.buf, err = proto.MarshalOptions{}.MarshalAppend(e.buf, msg)
+	if err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// update switches to the schema loaded by the last refresh, and starts a
+// new refresh once the cached schema of the registry is stale. It never
+// waits for the registry.
+func (e *Encoder) update() {
+	if e.registry == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.latest != nil {
+		e.schema = e.latest
+		e.latest = nil
+	}
+	if !e.refreshing && e.registry.Stale() {
+		e.refreshing = true
+		go e.refresh()
+	}
+}
+
+// refresh loads the current schema of the registry subject, for the next
+// call to update to switch to it.
+func (e *Encoder) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), schemaregistry.RefreshTimeout)
+	defer cancel()
+	s, err := e.load(ctx)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.refreshing = false
+	if err != nil {
+		e.log.Errorf("Failed to refresh the protobuf schema, keeping the current one: %v", err)
+		return
+	}
+	e.latest = s
+}
+
+// load returns the current schema of the registry subject. Compiled schemas
+// are kept by ID, so switching back and forth is cheap.
+func (e *Encoder) load(ctx context.Context) (*compiledSchema, error) {
+	rs, err := e.registry.Schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := e.compiled[rs.ID]
+	if !ok {
+		if rs.Type != schemaregistry.TypeProtobuf {
+			return nil, fmt.Errorf("schema %d of subject %s has type %s, expected %s",
+				rs.ID, rs.Subject, rs.Type, schemaregistry.TypeProtobuf)
+		}
+
+		var files []*descriptorpb.FileDescriptorProto
+		for _, dep := range rs.Dependencies {
+			fdp, err := decodeFile(dep.Schema, dep.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid schema reference %s: %w", dep.Name, err)
+			}
+			files = append(files, fdp)
+		}
+		mainFile, err := decodeFile(rs.Schema, rs.Subject+".proto")
+		if err != nil {
+			return nil, fmt.Errorf("invalid protobuf schema %d of subject %s: %w", rs.ID, rs.Subject, err)
+		}
+		files = append(files, mainFile)
+
+		s, err = e.compile(rs.ID, files, mainFile.GetName())
+		if err != nil {
+			return nil, fmt.Errorf("invalid protobuf schema %d of subject %s: %w", rs.ID, rs.Subject, err)
+		}
+		e.compiled[rs.ID] = s
+	}
+	return s, nil
+}
+
+// decodeFile decodes a file descriptor returned by the schema registry in
+// the serialized format. The file is named after the reference, so imports
+// of other registered schemas can be resolved.
+func decodeFile(serialized, name string) (*descriptorpb.FileDescriptorProto, error) {
+	data, err := base64.StdEncoding.DecodeString(serialized)
+	if err != nil {
+		return nil, err
+	}
+	var fdp descriptorpb.FileDescriptorProto
+	if err := proto.Unmarshal(data, &fdp); err != nil {
+		return nil, err
+	}
+	fdp.Name = proto.String(name)
+	return &fdp, nil
+}
+
+// compile resolves the message to encode and prepares the wire format
+// header. If the message is not configured, the first message of file is
+// used.
+func (e *Encoder) compile(id int, files []*descriptorpb.FileDescriptorProto, file string) (*compiledSchema, error) {
+	registry, err := buildFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := findMessage(registry, file, e.message)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.unknown.Mode == schemacodec.UnknownFieldsCollect {
+		fd := lookupField(desc, e.unknown.Target)
+		if fd == nil || fd.Kind() != protoreflect.StringKind || fd.IsList() {
+			return nil, fmt.Errorf("message %s must define the string field %s to collect unknown fields",
+				desc.FullName(), e.unknown.Target)
+		}
+	}
+
+	s := &compiledSchema{id: id, desc: desc}
+	if id > 0 {
+		s.header = schemaregistry.AppendHeader(nil, id)
+		if s.header, err = appendMessageIndexes(s.header, desc); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
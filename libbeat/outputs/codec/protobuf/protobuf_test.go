@@ -0,0 +1,296 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/internal/schemacodec"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/schemaregistry"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func testField(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, mod ...func(*descriptorpb.FieldDescriptorProto)) *descriptorpb.FieldDescriptorProto {
+	f := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		Number:   proto.Int32(number),
+		Type:     typ.Enum(),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		JsonName: proto.String(defaultJSONName(name)),
+	}
+	for _, m := range mod {
+		m(f)
+	}
+	return f
+}
+
+func typeName(name string) func(*descriptorpb.FieldDescriptorProto) {
+	return func(f *descriptorpb.FieldDescriptorProto) { f.TypeName = proto.String(name) }
+}
+
+func repeated(f *descriptorpb.FieldDescriptorProto) {
+	f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+}
+
+// testFile describes:
+//
+//	message Host { string name = 1; }
+//	message Event {
+//	  google.protobuf.Timestamp timestamp = 1 [json_name = "@timestamp"];
+//	  string message = 2;
+//	  int64 count = 3;
+//	  repeated string tags = 4;
+//	  Host host = 5;
+//	  map<string, string> labels = 6;
+//	  string unknown_fields = 7;
+//	}
+func testFile() *descriptorpb.FileDescriptorProto {
+	const (
+		typeString  = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		typeInt64   = descriptorpb.FieldDescriptorProto_TYPE_INT64
+		typeMessage = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	)
+
+	return &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("event.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name:  proto.String("Host"),
+				Field: []*descriptorpb.FieldDescriptorProto{testField("name", 1, typeString)},
+			},
+			{
+				Name: proto.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					testField("timestamp", 1, typeMessage, typeName(".google.protobuf.Timestamp"), func(f *descriptorpb.FieldDescriptorProto) {
+						f.JsonName = proto.String("@timestamp")
+					}),
+					testField("message", 2, typeString),
+					testField("count", 3, typeInt64),
+					testField("tags", 4, typeString, repeated),
+					testField("host", 5, typeMessage, typeName(".test.Host")),
+					testField("labels", 6, typeMessage, typeName(".test.Event.LabelsEntry"), repeated),
+					testField("unknown_fields", 7, typeString),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("LabelsEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						testField("key", 1, typeString),
+						testField("value", 2, typeString),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				}},
+			},
+		},
+	}
+}
+
+func writeDescriptorSet(t *testing.T) string {
+	t.Helper()
+	data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{testFile()},
+	})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "event.desc")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func newTestEncoder(t *testing.T, mod func(*Config)) *Encoder {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.DescriptorFile = writeDescriptorSet(t)
+	cfg.Message = "test.Event"
+	if mod != nil {
+		mod(&cfg)
+	}
+	enc, err := New("1.2.3", cfg, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	return enc
+}
+
+// decode parses an encoded event with the test schema.
+func decode(t *testing.T, data []byte) protoreflect.Message {
+	t.Helper()
+	files, err := buildFiles([]*descriptorpb.FileDescriptorProto{testFile()})
+	require.NoError(t, err)
+	md, err := findMessage(files, "", "test.Event")
+	require.NoError(t, err)
+
+	msg := dynamicpb.NewMessage(md)
+	require.NoError(t, proto.Unmarshal(data, msg))
+	return msg
+}
+
+func get(msg protoreflect.Message, name string) protoreflect.Value {
+	return msg.Get(msg.Descriptor().Fields().ByName(protoreflect.Name(name)))
+}
+
+func TestEncode(t *testing.T) {
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 6, time.UTC)
+	enc := newTestEncoder(t, nil)
+
+	data, err := enc.Encode("test", &beat.Event{
+		Timestamp: ts,
+		Fields: mapstr.M{
+			"message": "hello",
+			"count":   42,
+			"tags":    []string{"a", "b"},
+			"host":    mapstr.M{"name": "web-1"},
+			"labels":  mapstr.M{"env": "prod"},
+		},
+	})
+	require.NoError(t, err)
+
+	msg := decode(t, data)
+	assert.Equal(t, "hello", get(msg, "message").String())
+	assert.Equal(t, int64(42), get(msg, "count").Int())
+
+	tags := get(msg, "tags").List()
+	require.Equal(t, 2, tags.Len())
+	assert.Equal(t, "b", tags.Get(1).String())
+
+	assert.Equal(t, "web-1", get(get(msg, "host").Message(), "name").String())
+	assert.Equal(t, "prod", get(msg, "labels").Map().Get(protoreflect.ValueOfString("env").MapKey()).String())
+
+	timestamp := get(msg, "timestamp").Message()
+	assert.Equal(t, ts.Unix(), get(timestamp, "seconds").Int())
+	assert.Equal(t, int64(6), get(timestamp, "nanos").Int())
+}
+
+func TestEncodeErrors(t *testing.T) {
+	enc := newTestEncoder(t, nil)
+
+	tests := map[string]mapstr.M{
+		"wrong scalar type":  {"count": "many"},
+		"wrong message type": {"host": "web-1"},
+		"wrong map type":     {"labels": []string{"env"}},
+	}
+	for name, fields := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := enc.Encode("test", &beat.Event{Timestamp: time.Now(), Fields: fields})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	event := &beat.Event{
+		Timestamp: time.Now(),
+		Fields: mapstr.M{
+			"message": "hello",
+			"host":    mapstr.M{"name": "web-1", "ip": "10.0.0.1"},
+			"user":    "alice",
+		},
+	}
+
+	t.Run("error", func(t *testing.T) {
+		enc := newTestEncoder(t, func(c *Config) {
+			c.UnknownFields = schemacodec.UnknownFields{Mode: schemacodec.UnknownFieldsError}
+		})
+		_, err := enc.Encode("test", event)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "host.ip, user")
+	})
+
+	t.Run("collect", func(t *testing.T) {
+		enc := newTestEncoder(t, func(c *Config) {
+			c.UnknownFields = schemacodec.UnknownFields{Mode: schemacodec.UnknownFieldsCollect, Target: "unknown_fields"}
+		})
+		data, err := enc.Encode("test", event)
+		require.NoError(t, err)
+
+		var collected map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(get(decode(t, data), "unknown_fields").String()), &collected))
+		assert.Equal(t, map[string]interface{}{
+			"host": map[string]interface{}{"ip": "10.0.0.1"},
+			"user": "alice",
+		}, collected)
+	})
+}
+
+func TestSchemaRegistry(t *testing.T) {
+	serialized, err := proto.Marshal(testFile())
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/subjects/events-value/versions/latest" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, schemaregistry.FormatSerialized, r.URL.Query().Get("format"))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": 9, "version": 1, "subject": "events-value", "schemaType": "PROTOBUF",
+			"schema": base64.StdEncoding.EncodeToString(serialized),
+		})
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Message = "test.Event"
+	cfg.SchemaRegistry = config.MustNewConfigFrom(map[string]interface{}{
+		"url":     srv.URL,
+		"subject": "events-value",
+	})
+	enc, err := New("1.2.3", cfg, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+
+	data, err := enc.Encode("test", &beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": "hello"}})
+	require.NoError(t, err)
+
+	// Magic byte, schema ID 9, message indexes [1] for the second message.
+	require.Equal(t, []byte{0, 0, 0, 0, 9, 2, 2}, data[:7])
+	assert.Equal(t, "hello", get(decode(t, data[7:]), "message").String())
+}
+
+func TestMessageIndexes(t *testing.T) {
+	files, err := buildFiles([]*descriptorpb.FileDescriptorProto{testFile()})
+	require.NoError(t, err)
+
+	tests := map[string][]byte{
+		"test.Host":              {0},
+		"test.Event":             {2, 2},
+		"test.Event.LabelsEntry": {4, 2, 0},
+	}
+	for name, want := range tests {
+		md, err := findMessage(files, "", name)
+		require.NoError(t, err)
+		got, err := appendMessageIndexes(nil, md)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, name)
+	}
+}
@@ -0,0 +1,258 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+// Schema types reported by the registry.
+const (
+	TypeAvro     = "AVRO"
+	TypeProtobuf = "PROTOBUF"
+	TypeJSON     = "JSON"
+)
+
+// FormatSerialized asks the registry to return Protobuf schemas as base64
+// encoded FileDescriptorProto instead of .proto source.
+const FormatSerialized = "serialized"
+
+// RefreshTimeout bounds the lookup of a schema and its references when the
+// codecs refresh it in the background.
+const RefreshTimeout = 30 * time.Second
+
+// Reference points to another schema a schema depends on.
+type Reference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// Schema is a schema version registered for a subject.
+type Schema struct {
+	ID         int         `json:"id"`
+	Subject    string      `json:"subject"`
+	Version    int         `json:"version"`
+	Type       string      `json:"schemaType"`
+	Schema     string      `json:"schema"`
+	References []Reference `json:"references"`
+
+	// Name is the reference name if the schema was loaded as a dependency.
+	Name string `json:"-"`
+
+	// Dependencies holds all schemas referenced directly or transitively,
+	// ordered such that every schema comes after its own dependencies.
+	Dependencies []*Schema `json:"-"`
+}
+
+type apiError struct {
+	Code    int    `json:"error_code"`
+	Message string `json:"message"`
+}
+
+// Client fetches the schema of the configured subject from a schema
+// registry. Schemas of a fixed version are cached forever, the latest
+// version is looked up again once the cache TTL expired.
+type Client struct {
+	log      *logp.Logger
+	http     *http.Client
+	base     string
+	subject  string
+	version  string
+	username string
+	password string
+	format   string
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	current *Schema
+	expires time.Time
+	refs    map[string]*Schema
+}
+
+// NewClient creates a schema registry client. The format is passed to the
+// registry when fetching schemas, it can be empty or FormatSerialized.
+func NewClient(cfg Config, format string, log *logp.Logger) (*Client, error) {
+	httpClient, err := cfg.Transport.Client(
+		httpcommon.WithLogger(log),
+		httpcommon.WithKeepaliveSettings{Disable: false},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	version := cfg.Version
+	if version == "" {
+		version = VersionLatest
+	}
+
+	return &Client{
+		log:      log,
+		http:     httpClient,
+		base:     cfg.URL,
+		subject:  cfg.Subject,
+		version:  version,
+		username: cfg.Username,
+		password: cfg.Password,
+		format:   format,
+		ttl:      cfg.CacheTTL,
+		refs:     map[string]*Schema{},
+	}, nil
+}
+
+// Schema returns the configured schema including its dependencies. If
+// refreshing the latest version fails, the previously fetched schema is
+// returned and the lookup is retried after the cache TTL.
+func (c *Client) Schema(ctx context.Context) (*Schema, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.current != nil && (c.version != VersionLatest || time.Now().Before(c.expires)) {
+		return c.current, nil
+	}
+
+	schema, err := c.load(ctx, c.subject, c.version)
+	if err != nil {
+		if c.current == nil {
+			return nil, err
+		}
+		c.log.Warnf("Failed to refresh schema of subject %s, keeping schema version %d: %v",
+			c.subject, c.current.Version, err)
+		schema = c.current
+	} else if c.current != nil && c.current.ID != schema.ID {
+		c.log.Infof("Schema of subject %s changed to version %d (id %d)", c.subject, schema.Version, schema.ID)
+	}
+
+	c.current = schema
+	c.expires = time.Now().Add(c.ttl)
+	return schema, nil
+}
+
+// Stale reports whether Schema looks up the schema again instead of
+// returning the cached one, so callers can refresh it in the background
+// rather than block on the registry.
+func (c *Client) Stale() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current == nil || (c.version == VersionLatest && !time.Now().Before(c.expires))
+}
+
+// load fetches a schema and resolves its references.
+func (c *Client) load(ctx context.Context, subject, version string) (*Schema, error) {
+	schema, err := c.fetch(ctx, subject, version)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, ref := range schema.References {
+		deps, err := c.resolve(ctx, ref, seen)
+		if err != nil {
+			return nil, err
+		}
+		schema.Dependencies = append(schema.Dependencies, deps...)
+	}
+	return schema, nil
+}
+
+// resolve returns the referenced schema preceded by its own dependencies.
+// References always point to a fixed version and are cached forever.
+func (c *Client) resolve(ctx context.Context, ref Reference, seen map[string]bool) ([]*Schema, error) {
+	key := ref.Subject + "/" + strconv.Itoa(ref.Version)
+	if seen[key] {
+		return nil, nil
+	}
+	seen[key] = true
+
+	schema, ok := c.refs[key]
+	if !ok {
+		var err error
+		schema, err = c.fetch(ctx, ref.Subject, strconv.Itoa(ref.Version))
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve schema reference %s: %w", ref.Name, err)
+		}
+		schema.Name = ref.Name
+		c.refs[key] = schema
+	}
+
+	var deps []*Schema
+	for _, nested := range schema.References {
+		nestedDeps, err := c.resolve(ctx, nested, seen)
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, nestedDeps...)
+	}
+	return append(deps, schema), nil
+}
+
+func (c *Client) fetch(ctx context.Context, subject, version string) (*Schema, error) {
+	u := c.base + "/subjects/" + url.PathEscape(subject) + "/versions/" + url.PathEscape(version)
+	if c.format != "" {
+		u += "?format=" + url.QueryEscape(c.format)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json, application/json")
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("schema registry request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema registry response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr apiError
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("schema registry returned %s for subject %s version %s: %s (error code %d)",
+				resp.Status, subject, version, apiErr.Message, apiErr.Code)
+		}
+		return nil, fmt.Errorf("schema registry returned %s for subject %s version %s", resp.Status, subject, version)
+	}
+
+	var schema Schema
+	if err := json.Unmarshal(body, &schema); err != nil {
+		return nil, fmt.Errorf("failed to decode schema registry response: %w", err)
+	}
+	if schema.Type == "" {
+		schema.Type = TypeAvro
+	}
+	return &schema, nil
+}
@@ -0,0 +1,169 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+type testRegistry struct {
+	schemas  map[string]Schema
+	requests atomic.Int32
+	format   atomic.Value
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.requests.Add(1)
+	r.format.Store(req.URL.Query().Get("format"))
+
+	schema, ok := r.schemas[req.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error_code":40401,"message":"Subject not found."}`))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(schema)
+}
+
+func newTestClient(t *testing.T, reg *testRegistry, mod func(*Config)) *Client {
+	t.Helper()
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+
+	cfg := DefaultConfig()
+	cfg.URL = srv.URL
+	cfg.Subject = "events-value"
+	if mod != nil {
+		mod(&cfg)
+	}
+	client, err := NewClient(cfg, FormatSerialized, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	return client
+}
+
+func TestSchemaWithReferences(t *testing.T) {
+	reg := &testRegistry{schemas: map[string]Schema{
+		"/subjects/events-value/versions/latest": {
+			ID: 3, Subject: "events-value", Version: 2, Schema: "main",
+			References: []Reference{{Name: "b.proto", Subject: "b", Version: 1}},
+			Type:       TypeProtobuf,
+		},
+		"/subjects/b/versions/1": {
+			ID: 2, Subject: "b", Version: 1, Schema: "b",
+			References: []Reference{{Name: "a.proto", Subject: "a", Version: 1}},
+		},
+		"/subjects/a/versions/1": {ID: 1, Subject: "a", Version: 1, Schema: "a"},
+	}}
+	client := newTestClient(t, reg, nil)
+
+	schema, err := client.Schema(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, schema.ID)
+	assert.Equal(t, TypeProtobuf, schema.Type)
+	assert.Equal(t, FormatSerialized, reg.format.Load())
+
+	require.Len(t, schema.Dependencies, 2)
+	assert.Equal(t, "a.proto", schema.Dependencies[0].Name)
+	assert.Equal(t, TypeAvro, schema.Dependencies[0].Type, "registry omits the type of Avro schemas")
+	assert.Equal(t, "b.proto", schema.Dependencies[1].Name)
+}
+
+func TestSchemaCaching(t *testing.T) {
+	reg := &testRegistry{schemas: map[string]Schema{
+		"/subjects/events-value/versions/latest": {ID: 1, Version: 1, Schema: `"string"`},
+		"/subjects/events-value/versions/1":      {ID: 1, Version: 1, Schema: `"string"`},
+	}}
+
+	t.Run("fixed version is cached forever", func(t *testing.T) {
+		reg.requests.Store(0)
+		client := newTestClient(t, reg, func(c *Config) {
+			c.Version = "1"
+			c.CacheTTL = 0
+		})
+		assert.True(t, client.Stale(), "the schema must be fetched on first use")
+		for i := 0; i < 3; i++ {
+			_, err := client.Schema(context.Background())
+			require.NoError(t, err)
+		}
+		assert.Equal(t, int32(1), reg.requests.Load())
+		assert.False(t, client.Stale())
+	})
+
+	t.Run("latest version is refreshed after the TTL", func(t *testing.T) {
+		reg.requests.Store(0)
+		client := newTestClient(t, reg, func(c *Config) {
+			c.CacheTTL = time.Hour
+		})
+		_, err := client.Schema(context.Background())
+		require.NoError(t, err)
+		_, err = client.Schema(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), reg.requests.Load())
+
+		assert.False(t, client.Stale())
+
+		client.expires = time.Now().Add(-time.Second)
+		assert.True(t, client.Stale())
+		_, err = client.Schema(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), reg.requests.Load())
+	})
+
+	t.Run("cached schema is kept if the refresh fails", func(t *testing.T) {
+		client := newTestClient(t, reg, nil)
+		first, err := client.Schema(context.Background())
+		require.NoError(t, err)
+
+		client.subject = "unknown"
+		client.expires = time.Now().Add(-time.Second)
+		schema, err := client.Schema(context.Background())
+		require.NoError(t, err)
+		assert.Same(t, first, schema)
+	})
+}
+
+func TestSchemaNotFound(t *testing.T) {
+	client := newTestClient(t, &testRegistry{}, nil)
+	_, err := client.Schema(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Subject not found.")
+}
+
+func TestWireHeader(t *testing.T) {
+	msg := AppendHeader(nil, 258)
+	assert.Equal(t, []byte{0, 0, 0, 1, 2}, msg)
+
+	id, payload, err := ParseHeader(append(msg, 'x'))
+	require.NoError(t, err)
+	assert.Equal(t, 258, id)
+	assert.Equal(t, []byte("x"), payload)
+
+	_, _, err = ParseHeader([]byte{1, 0, 0, 0, 1})
+	assert.Error(t, err)
+}
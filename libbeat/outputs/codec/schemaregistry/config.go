@@ -0,0 +1,79 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package schemaregistry implements a client for Confluent-compatible schema
+// registries and the Confluent wire format used by schema based codecs.
+package schemaregistry
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+// VersionLatest selects the latest version registered for a subject.
+const VersionLatest = "latest"
+
+// Config configures the schema registry connection and the subject whose
+// schema is used for encoding.
+type Config struct {
+	URL      string        `config:"url" validate:"required"`
+	Subject  string        `config:"subject" validate:"required"`
+	Version  string        `config:"version"`
+	Username string        `config:"username"`
+	Password string        `config:"password"`
+	CacheTTL time.Duration `config:"cache_ttl" validate:"min=0"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+// DefaultConfig returns the default schema registry settings.
+func DefaultConfig() Config {
+	transport := httpcommon.DefaultHTTPTransportSettings()
+	transport.Timeout = 10 * time.Second
+
+	return Config{
+		Version:   VersionLatest,
+		CacheTTL:  5 * time.Minute,
+		Transport: transport,
+	}
+}
+
+func (c *Config) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("schema registry url must use the http or https scheme")
+	}
+
+	if c.Version != VersionLatest {
+		if v, err := strconv.Atoi(c.Version); err != nil || v < 1 {
+			return errors.New("schema registry version must be 'latest' or a positive number")
+		}
+	}
+
+	if c.Username != "" && c.Password == "" {
+		return errors.New("password must be set when username is configured")
+	}
+
+	return nil
+}
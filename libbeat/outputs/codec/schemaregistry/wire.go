@@ -0,0 +1,46 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// magicByte prefixes every message in the Confluent wire format.
+const magicByte = 0
+
+// headerLen is the length of the wire format header: the magic byte
+// followed by the 4 byte big endian schema ID.
+const headerLen = 5
+
+// AppendHeader appends the Confluent wire format header for the schema ID
+// to buf.
+func AppendHeader(buf []byte, id int) []byte {
+	buf = append(buf, magicByte)
+	return binary.BigEndian.AppendUint32(buf, uint32(id)) //nolint:gosec // registry IDs are positive 32 bit integers
+}
+
+// ParseHeader returns the schema ID and payload of a message in the
+// Confluent wire format.
+func ParseHeader(msg []byte) (int, []byte, error) {
+	if len(msg) < headerLen || msg[0] != magicByte {
+		return 0, nil, errors.New("message is not in the schema registry wire format")
+	}
+	return int(binary.BigEndian.Uint32(msg[1:headerLen])), msg[headerLen:], nil
+}
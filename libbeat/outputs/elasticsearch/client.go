@@ -59,6 +59,10 @@ type Client struct {
 	// forwarded to this index. Otherwise, they will be dropped.
 	deadLetterIndex string
 
+	// If deadLetterFile is set, events with bulk-ingest errors will be
+	// written to this file instead.
+	deadLetterFile *deadLetterFile
+
 	log                    *logp.Logger
 	pLogIndex              *periodic.Doer
 	pLogIndexTryDeadLetter *periodic.Doer
@@ -79,6 +83,10 @@ type clientSettings struct {
 	// If deadLetterIndex is set, events with bulk-ingest errors will be
 	// forwarded to this index. Otherwise, they will be dropped.
 	deadLetterIndex string
+
+	// If deadLetterFile is set, events with bulk-ingest errors will be
+	// written to this file instead.
+	deadLetterFile *deadLetterFile
 }
 
 type bulkResultStats struct {
@@ -192,6 +200,7 @@ func NewClient(
 		pipelineSelector: pipeline,
 		observer:         observer,
 		deadLetterIndex:  s.deadLetterIndex,
+		deadLetterFile:   s.deadLetterFile,
 
 		log:                    log,
 		pLogDeadLetter:         pLogDeadLetter,
@@ -235,6 +244,7 @@ func (client *Client) Clone() *Client {
 			indexSelector:    client.indexSelector,
 			pipelineSelector: client.pipelineSelector,
 			deadLetterIndex:  client.deadLetterIndex,
+			deadLetterFile:   client.deadLetterFile,
 		},
 		nil, // XXX: do not pass connection callback?
 		client.log,
@@ -513,6 +523,19 @@ func (client *Client) applyItemStatus(
 			stats.nonIndexable++
 			return false
 		}
+		if client.deadLetterFile != nil {
+			// Fatal error, keep the event in the dead letter file so it can
+			// be replayed later.
+			if err := client.deadLetterFile.write(encodedEvent, itemStatus, itemMessage); err != nil {
+				client.pLogDeadLetter.Add()
+				client.log.Errorw(fmt.Sprintf("Can't write event '%s' (status=%v) to dead letter file %s: %v", encodedEvent, itemStatus, client.deadLetterFile, err), logp.TypeKey, logp.EventType)
+				stats.nonIndexable++
+				return false
+			}
+			client.log.Debugw(fmt.Sprintf("Cannot index event '%s' (status=%v): %s, written to dead letter file", encodedEvent, itemStatus, itemMessage), logp.TypeKey, logp.EventType)
+			stats.deadLetter++
+			return false
+		}
 		if client.deadLetterIndex == "" {
 			// Fatal error and no dead letter index, drop.
 			client.pLogIndex.Add()
@@ -539,6 +562,11 @@ func (client *Client) Connect(ctx context.Context) error {
 }
 
 func (client *Client) Close() error {
+	if client.deadLetterFile != nil {
+		if err := client.deadLetterFile.Close(); err != nil {
+			client.log.Warnf("Failed to close dead letter file: %v", err)
+		}
+	}
 	return client.conn.Close()
 }
 
@@ -18,11 +18,15 @@
 package elasticsearch
 
 import (
+	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/elastic/beats/v7/libbeat/beat"
 	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
 )
 
 func TestValidDropPolicyConfig(t *testing.T) {
@@ -58,6 +62,47 @@ non_indexable_policy.dead_letter_index:
 	assert.Equal(t, "my-dead-letter-index", index, "index should match config")
 }
 
+func TestDeadLetterFilePolicyConfig(t *testing.T) {
+	config := fmt.Sprintf(`
+non_indexable_policy.dead_letter_file:
+    path: %q
+    filename: "rejected"
+    number_of_files: 3
+`, t.TempDir())
+	c := conf.MustNewConfigFrom(config)
+	elasticsearchOutputConfig, err := readConfig(c)
+	if err != nil {
+		t.Fatalf("Can't create test configuration from valid input")
+	}
+	index, err := deadLetterIndexForPolicy(elasticsearchOutputConfig.NonIndexablePolicy)
+	if err != nil {
+		t.Fatalf("Can't read non-indexable policy: %v", err.Error())
+	}
+	assert.Equal(t, "", index, "dead letter index should be empty string")
+
+	deadLetterFile, err := deadLetterFileForPolicy(elasticsearchOutputConfig.NonIndexablePolicy, beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")})
+	if err != nil {
+		t.Fatalf("Can't read non-indexable policy: %v", err.Error())
+	}
+	assert.NotNil(t, deadLetterFile)
+	assert.Equal(t, "rejected", filepath.Base(deadLetterFile.String()))
+	assert.NoError(t, deadLetterFile.Close())
+}
+
+func TestInvalidDeadLetterFilePolicyConfig(t *testing.T) {
+	config := `
+non_indexable_policy.dead_letter_file:
+    number_of_files: 1
+`
+	c := conf.MustNewConfigFrom(config)
+	elasticsearchOutputConfig, err := readConfig(c)
+	if err != nil {
+		t.Fatalf("Can't create test configuration from valid input")
+	}
+	_, err = deadLetterFileForPolicy(elasticsearchOutputConfig.NonIndexablePolicy, beat.Info{Beat: "testbeat"})
+	assert.ErrorContains(t, err, "number_of_files")
+}
+
 func TestInvalidNonIndexablePolicyConfig(t *testing.T) {
 	tests := map[string]string{
 		"non_indexable_policy with invalid policy": `
@@ -0,0 +1,268 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/beat/events"
+	"github.com/elastic/beats/v7/libbeat/common/cfgwarn"
+	"github.com/elastic/beats/v7/libbeat/common/jsontransform"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/file"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+const dead_letter_file = "dead_letter_file"
+
+type deadLetterFileConfig struct {
+	Path          string `config:"path"`
+	Filename      string `config:"filename"`
+	RotateEveryKb uint   `config:"rotate_every_kb" validate:"min=1"`
+	NumberOfFiles uint   `config:"number_of_files"`
+	Permissions   uint32 `config:"permissions"`
+}
+
+func defaultDeadLetterFileConfig() deadLetterFileConfig {
+	return deadLetterFileConfig{
+		RotateEveryKb: 10 * 1024,
+		NumberOfFiles: 7,
+		Permissions:   0600,
+	}
+}
+
+func (c *deadLetterFileConfig) Validate() error {
+	if c.NumberOfFiles < 2 || c.NumberOfFiles > file.MaxBackupsLimit {
+		return fmt.Errorf("the number_of_files to keep should be between 2 and %v",
+			file.MaxBackupsLimit)
+	}
+	return nil
+}
+
+// deadLetterFile stores events that Elasticsearch rejected with a
+// non-retryable error in rotating NDJSON files, one DeadLetterRecord per
+// line. It is shared by all clients of an output.
+type deadLetterFile struct {
+	path    string
+	rotator *file.Rotator
+}
+
+// DeadLetterRecord is a line of a dead letter file.
+type DeadLetterRecord struct {
+	// Timestamp is the time the event was rejected.
+	Timestamp time.Time `json:"@timestamp"`
+
+	// Index and Pipeline are the index and ingest pipeline the event was
+	// sent to.
+	Index    string `json:"index"`
+	Pipeline string `json:"pipeline,omitempty"`
+
+	Error DeadLetterError `json:"error"`
+
+	// Meta holds the event metadata, Event the event as it was sent.
+	Meta  mapstr.M        `json:"meta,omitempty"`
+	Event json.RawMessage `json:"event"`
+}
+
+// DeadLetterError describes why Elasticsearch rejected an event.
+type DeadLetterError struct {
+	Status int    `json:"status"`
+	Type   string `json:"type,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func deadLetterFileForPolicy(configNamespace *config.Namespace, beatInfo beat.Info) (*deadLetterFile, error) {
+	if configNamespace == nil || configNamespace.Name() != dead_letter_file {
+		return nil, nil
+	}
+	cfgwarn.Beta("The non_indexable_policy dead_letter_file is beta.")
+
+	cfg := defaultDeadLetterFileConfig()
+	if err := configNamespace.Config().Unpack(&cfg); err != nil {
+		return nil, err
+	}
+	return newDeadLetterFile(cfg, beatInfo)
+}
+
+func newDeadLetterFile(cfg deadLetterFileConfig, beatInfo beat.Info) (*deadLetterFile, error) {
+	dir := cfg.Path
+	if dir == "" {
+		dir = paths.Resolve(paths.Data, "dead_letter")
+	}
+	filename := cfg.Filename
+	if filename == "" {
+		filename = beatInfo.Beat
+	}
+	path := filepath.Join(dir, filename)
+
+	// Records are appended to existing files on startup, they are only
+	// removed once the files are rotated out.
+	rotator, err := file.NewFileRotator(
+		path,
+		file.MaxSizeBytes(cfg.RotateEveryKb*1024),
+		file.MaxBackups(cfg.NumberOfFiles),
+		file.Permissions(os.FileMode(cfg.Permissions)),
+		file.RotateOnStartup(false),
+		file.WithLogger(beatInfo.Logger.Named("dead_letter").With(logp.Namespace("rotator"))),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dead letter file: %w", err)
+	}
+	return &deadLetterFile{path: path, rotator: rotator}, nil
+}
+
+// write appends a record for an event rejected with the given status and
+// error.
+func (f *deadLetterFile) write(event *encodedEvent, status int, errMsg []byte) error {
+	record := DeadLetterRecord{
+		Timestamp: time.Now().UTC(),
+		Index:     event.index,
+		Pipeline:  event.pipeline,
+		Error:     newDeadLetterError(status, errMsg),
+		Meta:      event.meta,
+		Event:     json.RawMessage(bytes.TrimSpace(event.encoding)),
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	// The record is written with a single call so concurrent clients never
+	// interleave lines.
+	_, err = f.rotator.Write(append(data, '\n'))
+	return err
+}
+
+func (f *deadLetterFile) Close() error {
+	return f.rotator.Close()
+}
+
+func (f *deadLetterFile) String() string {
+	return f.path
+}
+
+func newDeadLetterError(status int, errMsg []byte) DeadLetterError {
+	var esErr struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(errMsg, &esErr); err != nil || esErr.Reason == "" {
+		return DeadLetterError{Status: status, Reason: string(errMsg)}
+	}
+	return DeadLetterError{Status: status, Type: esErr.Type, Reason: esErr.Reason}
+}
+
+// ToEvent converts the record back to the event that was rejected. The event
+// is sent to the same index and pipeline again.
+func (r *DeadLetterRecord) ToEvent() (beat.Event, error) {
+	dec := json.NewDecoder(bytes.NewReader(r.Event))
+	dec.UseNumber()
+
+	var fields mapstr.M
+	if err := dec.Decode(&fields); err != nil {
+		return beat.Event{}, fmt.Errorf("failed to decode event: %w", err)
+	}
+	jsontransform.TransformNumbers(fields)
+
+	var ts time.Time
+	if raw, ok := fields["@timestamp"].(string); ok {
+		var err error
+		if ts, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+			return beat.Event{}, fmt.Errorf("failed to parse event timestamp: %w", err)
+		}
+		delete(fields, "@timestamp")
+	}
+
+	meta := r.Meta.Clone()
+	if meta == nil {
+		meta = mapstr.M{}
+	}
+	jsontransform.TransformNumbers(meta)
+	if r.Index != "" {
+		meta[events.FieldMetaRawIndex] = r.Index
+	}
+	if r.Pipeline != "" {
+		meta[events.FieldMetaPipeline] = r.Pipeline
+	}
+
+	return beat.Event{Timestamp: ts, Meta: meta, Fields: fields}, nil
+}
+
+// ReadDeadLetterFile calls fn with the event of every record in the dead
+// letter file at path and returns the number of events read. Only the
+// records present when the file is opened are read, so rejected events
+// written to the same file while replaying are not replayed again.
+func ReadDeadLetterFile(path string, fn func(beat.Event) error) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReader(io.LimitReader(f, info.Size()))
+	count := 0
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			event, decodeErr := decodeDeadLetterRecord(data)
+			if decodeErr != nil {
+				return count, fmt.Errorf("invalid record on line %d of %s: %w", line, path, decodeErr)
+			}
+			if err := fn(event); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+func decodeDeadLetterRecord(data []byte) (beat.Event, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var record DeadLetterRecord
+	if err := dec.Decode(&record); err != nil {
+		return beat.Event{}, err
+	}
+	if len(record.Event) == 0 {
+		return beat.Event{}, errors.New("record has no event")
+	}
+	return record.ToEvent()
+}
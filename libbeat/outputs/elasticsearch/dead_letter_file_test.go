@@ -0,0 +1,164 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package elasticsearch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/outil"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newTestDeadLetterFile(t *testing.T) (*deadLetterFile, string) {
+	t.Helper()
+
+	cfg := defaultDeadLetterFileConfig()
+	cfg.Path = t.TempDir()
+	f, err := newDeadLetterFile(cfg, beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	files, err := filepath.Glob(filepath.Join(cfg.Path, "testbeat-*.ndjson"))
+	require.NoError(t, err)
+	require.Empty(t, files)
+	return f, cfg.Path
+}
+
+// activeDeadLetterFile returns the path of the single dead letter file in dir.
+func activeDeadLetterFile(t *testing.T, dir string) string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "testbeat-*.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	return files[0]
+}
+
+func TestCollectPublishFailDeadLetterFile(t *testing.T) {
+	deadLetterFile, dir := newTestDeadLetterFile(t)
+	indexSelector := outil.MakeSelector(outil.ConstSelectorExpr("logs-app-default", outil.SelectorKeepCase))
+	client, err := NewClient(
+		clientSettings{
+			observer:       outputs.NewNilObserver(),
+			indexSelector:  indexSelector,
+			deadLetterFile: deadLetterFile,
+		},
+		nil,
+		logptest.NewTestingLogger(t, ""),
+	)
+	require.NoError(t, err)
+
+	response := []byte(`
+{
+	"items": [
+		{"create": {"status": 200}},
+		{"create": {
+			"status": 400,
+			"error": {"type": "document_parsing_exception", "reason": "failed to parse field [count] of type [long]"}
+		}},
+		{"create": {"status": 429, "error": "ups"}}
+	]
+}
+`)
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 123000000, time.UTC)
+	event1 := encodeEvent(client, publisher.Event{Content: beat.Event{Fields: mapstr.M{"count": 1}}})
+	eventFail := encodeEvent(client, publisher.Event{Content: beat.Event{
+		Timestamp: ts,
+		Meta:      mapstr.M{"_id": "abc", "pipeline": "app"},
+		Fields:    mapstr.M{"count": "many", "nested": mapstr.M{"value": 42}},
+	}})
+	eventRetry := encodeEvent(client, publisher.Event{Content: beat.Event{Fields: mapstr.M{"count": 3}}})
+
+	res, stats := client.bulkCollectPublishFails(bulkResult{
+		events:   []publisher.Event{event1, eventFail, eventRetry},
+		status:   200,
+		response: response,
+	})
+	assert.Equal(t, []publisher.Event{eventRetry}, res)
+	assert.Equal(t, bulkResultStats{acked: 1, deadLetter: 1, fails: 1, tooMany: 1}, stats)
+
+	var replayed []beat.Event
+	n, err := ReadDeadLetterFile(activeDeadLetterFile(t, dir), func(event beat.Event) error {
+		replayed = append(replayed, event)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	event := replayed[0]
+	assert.True(t, ts.Equal(event.Timestamp), "timestamp %v", event.Timestamp)
+	assert.Equal(t, mapstr.M{
+		"count":  "many",
+		"nested": map[string]interface{}{"value": int64(42)},
+	}, event.Fields)
+	assert.Equal(t, mapstr.M{
+		"_id":       "abc",
+		"pipeline":  "app",
+		"raw_index": "logs-app-default",
+	}, event.Meta)
+}
+
+func TestDeadLetterRecordError(t *testing.T) {
+	deadLetterFile, dir := newTestDeadLetterFile(t)
+
+	event := &encodedEvent{index: "test", encoding: []byte(`{"@timestamp":"2024-05-06T07:08:09.000Z","message":"hello"}` + "\n")}
+	require.NoError(t, deadLetterFile.write(event, 400, []byte(`{"type":"mapper_parsing_exception","reason":"bad field"}`)))
+	require.NoError(t, deadLetterFile.write(event, 400, []byte(`not json`)))
+
+	data, err := os.ReadFile(activeDeadLetterFile(t, dir))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"error":{"status":400,"type":"mapper_parsing_exception","reason":"bad field"}`)
+	assert.Contains(t, string(data), `"error":{"status":400,"reason":"not json"}`)
+	assert.Contains(t, string(data), `"event":{"@timestamp":"2024-05-06T07:08:09.000Z","message":"hello"}`)
+}
+
+func TestReadDeadLetterFileIgnoresAppendedRecords(t *testing.T) {
+	deadLetterFile, dir := newTestDeadLetterFile(t)
+
+	event := &encodedEvent{index: "test", encoding: []byte(`{"message":"hello"}`)}
+	require.NoError(t, deadLetterFile.write(event, 400, nil))
+	require.NoError(t, deadLetterFile.write(event, 400, nil))
+
+	n, err := ReadDeadLetterFile(activeDeadLetterFile(t, dir), func(beat.Event) error {
+		// Events rejected again while replaying are appended to the file.
+		return deadLetterFile.write(event, 400, nil)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestReadDeadLetterFileInvalidRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invalid.ndjson")
+	require.NoError(t, os.WriteFile(path, []byte("{\"event\":{\"a\":1}}\n{oops\n"), 0600))
+
+	n, err := ReadDeadLetterFile(path, func(beat.Event) error { return nil })
+	assert.Equal(t, 1, n)
+	assert.ErrorContains(t, err, "line 2")
+}
@@ -47,6 +47,9 @@ func deadLetterIndexForPolicy(configNamespace *config.Namespace) (string, error)
 	if configNamespace == nil || configNamespace.Name() == drop {
 		return "", nil
 	}
+	if configNamespace.Name() == dead_letter_file {
+		return "", nil
+	}
 	if configNamespace.Name() == dead_letter_index {
 		cfgwarn.Beta("The non_indexable_policy dead_letter_index is beta.")
 		return deadLetterIndexForConfig(configNamespace.Config())
@@ -72,6 +72,12 @@ func makeES(
 		return outputs.Fail(err)
 	}
 
+	deadLetterFile, err := deadLetterFileForPolicy(esConfig.NonIndexablePolicy, beatInfo)
+	if err != nil {
+		log.Errorf("error in non_indexable_policy: %v", err)
+		return outputs.Fail(err)
+	}
+
 	hosts, err := outputs.ReadHostList(cfg)
 	if err != nil {
 		return outputs.Fail(err)
@@ -120,6 +126,7 @@ func makeES(
 			pipelineSelector: pipelineSelector,
 			observer:         observer,
 			deadLetterIndex:  deadLetterIndex,
+			deadLetterFile:   deadLetterFile,
 		}, &connectCallbackRegistry, log)
 		if err != nil {
 			return outputs.Fail(err)
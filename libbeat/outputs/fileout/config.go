@@ -19,6 +19,7 @@ package fileout
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
 	"github.com/elastic/elastic-agent-libs/config"
@@ -33,9 +34,25 @@ type fileOutConfig struct {
 	Codec           codec.Config      `config:"codec"`
 	Permissions     uint32            `config:"permissions"`
 	RotateOnStartup bool              `config:"rotate_on_startup"`
+	Parquet         parquetConfig     `config:"parquet"`
 	Queue           config.Namespace  `config:"queue"`
 }
 
+// parquetConfig configures writing events as Parquet files instead of
+// encoding them with the codec.
+type parquetConfig struct {
+	Enabled       bool                  `config:"enabled"`
+	Compression   string                `config:"compression"`
+	RowGroupSize  int                   `config:"row_group_size" validate:"min=1"`
+	FlushInterval time.Duration         `config:"flush_interval" validate:"positive,nonzero"`
+	Schema        []parquetColumnConfig `config:"schema"`
+}
+
+type parquetColumnConfig struct {
+	Name string `config:"name" validate:"required"`
+	Type string `config:"type" validate:"required"`
+}
+
 func defaultConfig() fileOutConfig {
 	return fileOutConfig{
 		Path:            &PathFormatString{},
@@ -43,6 +60,11 @@ func defaultConfig() fileOutConfig {
 		RotateEveryKb:   10 * 1024,
 		Permissions:     0600,
 		RotateOnStartup: true,
+		Parquet: parquetConfig{
+			Compression:   "snappy",
+			RowGroupSize:  10000,
+			FlushInterval: 10 * time.Second,
+		},
 	}
 }
 
@@ -66,3 +88,21 @@ func (c *fileOutConfig) Validate() error {
 
 	return nil
 }
+
+func (c *parquetConfig) Validate() error {
+	if _, ok := parquetCompressions[c.Compression]; !ok {
+		return fmt.Errorf("unsupported parquet compression %q", c.Compression)
+	}
+
+	seen := map[string]bool{}
+	for _, col := range c.Schema {
+		if _, ok := parquetColumnTypes[col.Type]; !ok {
+			return fmt.Errorf("unsupported type %q of parquet column %s", col.Type, col.Name)
+		}
+		if seen[col.Name] {
+			return fmt.Errorf("parquet column %s is defined more than once", col.Name)
+		}
+		seen[col.Name] = true
+	}
+	return nil
+}
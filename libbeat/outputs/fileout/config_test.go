@@ -42,6 +42,11 @@ func TestConfig(t *testing.T) {
 					RotateEveryKb:   10 * 1024,
 					Permissions:     0600,
 					RotateOnStartup: true,
+					Parquet: parquetConfig{
+						Compression:   "snappy",
+						RowGroupSize:  10000,
+						FlushInterval: 10 * time.Second,
+					},
 				}
 
 				assert.Equal(t, expectedConfig, actual)
@@ -91,6 +96,54 @@ func TestConfig(t *testing.T) {
 				assert.Nil(t, err)
 			},
 		},
+		"parquet config": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"parquet.enabled":        true,
+				"parquet.compression":    "zstd",
+				"parquet.row_group_size": 500,
+				"parquet.schema": []mapstr.M{
+					{"name": "@timestamp", "type": "timestamp"},
+					{"name": "message", "type": "string"},
+				},
+			}),
+			assertion: func(t *testing.T, actual *fileOutConfig, err error) {
+				assert.Nil(t, err)
+				assert.True(t, actual.Parquet.Enabled)
+				assert.Equal(t, "zstd", actual.Parquet.Compression)
+				assert.Equal(t, 500, actual.Parquet.RowGroupSize)
+				assert.Equal(t, []parquetColumnConfig{
+					{Name: "@timestamp", Type: "timestamp"},
+					{Name: "message", Type: "string"},
+				}, actual.Parquet.Schema)
+			},
+		},
+		"parquet config with unsupported compression": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"parquet.compression": "brotli",
+			}),
+			assertion: func(t *testing.T, _ *fileOutConfig, err error) {
+				assert.ErrorContains(t, err, "unsupported parquet compression")
+			},
+		},
+		"parquet config with unsupported column type": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"parquet.schema": []mapstr.M{{"name": "message", "type": "text"}},
+			}),
+			assertion: func(t *testing.T, _ *fileOutConfig, err error) {
+				assert.ErrorContains(t, err, "unsupported type")
+			},
+		},
+		"parquet config with duplicate column": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"parquet.schema": []mapstr.M{
+					{"name": "message", "type": "string"},
+					{"name": "message", "type": "long"},
+				},
+			}),
+			assertion: func(t *testing.T, _ *fileOutConfig, err error) {
+				assert.ErrorContains(t, err, "defined more than once")
+			},
+		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			isWindowsPath = test.useWindowsPath
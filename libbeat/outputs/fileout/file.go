@@ -20,8 +20,10 @@ package fileout
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
@@ -44,6 +46,17 @@ type fileOutput struct {
 	observer outputs.Observer
 	rotator  *file.Rotator
 	codec    codec.Codec
+
+	parquet       *parquetWriter
+	flushInterval time.Duration
+
+	// mu protects the parquet writer and the batches whose events are
+	// buffered in the current row group. These batches are acknowledged
+	// once the row group has been written.
+	mu            sync.Mutex
+	pending       []publisher.Batch
+	pendingEvents int
+	flushTimer    *time.Timer
 }
 
 // makeFileout instantiates a new file output instance.
@@ -84,24 +97,43 @@ func (out *fileOutput) init(beat beat.Info, c fileOutConfig) error {
 
 	out.filePath = path
 
-	var err error
-	out.rotator, err = file.NewFileRotator(
-		path,
-		file.MaxSizeBytes(c.RotateEveryKb*1024),
+	opts := []file.RotatorOption{
 		file.MaxBackups(c.NumberOfFiles),
 		file.Permissions(os.FileMode(c.Permissions)),
-		file.RotateOnStartup(c.RotateOnStartup),
 		file.WithLogger(beat.Logger.Named("rotator").With(logp.Namespace("rotator"))),
-	)
-	if err != nil {
-		return err
+	}
+	if c.Parquet.Enabled {
+		// Parquet files are only valid once their footer has been written,
+		// so the parquet writer decides when to rotate and existing files
+		// are never appended to.
+		opts = append(opts,
+			file.Extension("parquet"),
+			file.MaxSizeBytes(math.MaxUint),
+			file.RotateOnStartup(true),
+		)
+	} else {
+		opts = append(opts,
+			file.MaxSizeBytes(c.RotateEveryKb*1024),
+			file.RotateOnStartup(c.RotateOnStartup),
+		)
 	}
 
-	out.codec, err = codec.CreateEncoder(beat, c.Codec)
+	var err error
+	out.rotator, err = file.NewFileRotator(path, opts...)
 	if err != nil {
 		return err
 	}
 
+	if c.Parquet.Enabled {
+		out.parquet = newParquetWriter(out.log, out.rotator, uint64(c.RotateEveryKb)*1024, c.Parquet)
+		out.flushInterval = c.Parquet.FlushInterval
+	} else {
+		out.codec, err = codec.CreateEncoder(beat, c.Codec)
+		if err != nil {
+			return err
+		}
+	}
+
 	out.log.Infof("Initialized file output. "+
 		"path=%v max_size_bytes=%v max_backups=%v permissions=%v",
 		path, c.RotateEveryKb*1024, c.NumberOfFiles, os.FileMode(c.Permissions))
@@ -111,10 +143,21 @@ func (out *fileOutput) init(beat beat.Info, c fileOutConfig) error {
 
 // Implement Outputer
 func (out *fileOutput) Close() error {
+	if out.parquet != nil {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+		out.flushParquetLocked()
+		return out.parquet.Close()
+	}
 	return out.rotator.Close()
 }
 
 func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
+	if out.parquet != nil {
+		out.publishParquet(batch)
+		return nil
+	}
+
 	defer batch.ACK()
 
 	st := out.observer
@@ -166,6 +209,85 @@ func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 	return nil
 }
 
+// publishParquet adds the events of batch to the current row group. The
+// batch is acknowledged once the row group holding its events has been
+// written, which happens when the row group is complete or after
+// flush_interval.
+func (out *fileOutput) publishParquet(batch publisher.Batch) {
+	st := out.observer
+	events := batch.Events()
+	st.NewBatch(len(events))
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	dropped := 0
+	for i := range events {
+		event := &events[i]
+		if err := out.parquet.add(&event.Content); err != nil {
+			if event.Guaranteed() {
+				out.log.Errorf("Failed to convert the event to a parquet row: %+v", err)
+			} else {
+				out.log.Warnf("Failed to convert the event to a parquet row: %+v", err)
+			}
+			out.log.Debugw(fmt.Sprintf("Failed event: %v", event), logp.TypeKey, logp.EventType)
+			dropped++
+		}
+	}
+	st.PermanentErrors(dropped)
+	out.pending = append(out.pending, batch)
+	out.pendingEvents += len(events) - dropped
+
+	if out.parquet.full() {
+		out.flushParquetLocked()
+		return
+	}
+	if out.flushTimer == nil {
+		out.flushTimer = time.AfterFunc(out.flushInterval, out.flushParquetExpired)
+	}
+}
+
+// flushParquetExpired writes the current row group once flush_interval
+// has passed since its first batch.
+func (out *fileOutput) flushParquetExpired() {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	out.flushParquetLocked()
+}
+
+// flushParquetLocked writes the buffered rows and acknowledges the pending
+// batches. If writing fails, the batches are returned to the pipeline to be
+// retried. The caller must hold out.mu.
+func (out *fileOutput) flushParquetLocked() {
+	if out.flushTimer != nil {
+		out.flushTimer.Stop()
+		out.flushTimer = nil
+	}
+	if len(out.pending) == 0 {
+		return
+	}
+	batches, events := out.pending, out.pendingEvents
+	out.pending, out.pendingEvents = nil, 0
+
+	st := out.observer
+	begin := time.Now()
+	if err := out.parquet.flush(); err != nil {
+		st.WriteError(err)
+		st.RetryableErrors(events)
+		out.log.Errorf("Writing parquet row group failed with: %+v", err)
+		for _, batch := range batches {
+			batch.Retry()
+		}
+		return
+	}
+
+	st.ReportLatency(time.Since(begin))
+	st.AckedEvents(events)
+	for _, batch := range batches {
+		batch.ACK()
+	}
+}
+
 func (out *fileOutput) String() string {
 	return "file(" + out.filePath + ")"
 }
@@ -0,0 +1,499 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fileout
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/apache/arrow/go/v17/parquet"
+	"github.com/apache/arrow/go/v17/parquet/compress"
+	"github.com/apache/arrow/go/v17/parquet/pqarrow"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/elastic-agent-libs/file"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// columnType is the type of a Parquet column.
+type columnType int
+
+const (
+	columnString columnType = iota
+	columnBoolean
+	columnLong
+	columnDouble
+	columnTimestamp
+)
+
+var parquetColumnTypes = map[string]columnType{
+	"string":    columnString,
+	"boolean":   columnBoolean,
+	"long":      columnLong,
+	"double":    columnDouble,
+	"timestamp": columnTimestamp,
+}
+
+var parquetCompressions = map[string]compress.Compression{
+	"none":   compress.Codecs.Uncompressed,
+	"snappy": compress.Codecs.Snappy,
+	"gzip":   compress.Codecs.Gzip,
+	"zstd":   compress.Codecs.Zstd,
+	"lz4":    compress.Codecs.Lz4,
+}
+
+const timestampColumn = "@timestamp"
+
+type column struct {
+	name string
+	typ  columnType
+}
+
+// jsonText is a value that cannot be represented as a Parquet column, like
+// an array, encoded as JSON.
+type jsonText string
+
+// parquetWriter writes events as Parquet files. Events are buffered until a
+// row group is complete. The columns are either configured or inferred from
+// the buffered events. If a row group contains new columns or values not
+// matching the column types, a new file with the merged columns is started.
+//
+// Files are rotated once they reach the maximum size. A file only becomes
+// readable after it has been closed on rotation or shutdown.
+type parquetWriter struct {
+	log          *logp.Logger
+	rotator      *file.Rotator
+	sink         *countingWriter
+	maxBytes     uint64
+	rowGroupSize int
+	props        *parquet.WriterProperties
+	mem          memory.Allocator
+
+	explicit        bool
+	columns         []column
+	rows            []map[string]interface{}
+	fw              *pqarrow.FileWriter
+	lastColumnBytes uint64
+}
+
+// countingWriter counts the bytes written to the current file. It does not
+// implement io.Closer, so closing the Parquet writer leaves the rotator open.
+type countingWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += uint64(n) //nolint:gosec // n is never negative
+	return n, err
+}
+
+func newParquetWriter(log *logp.Logger, rotator *file.Rotator, maxBytes uint64, cfg parquetConfig) *parquetWriter {
+	mem := memory.NewGoAllocator()
+	w := &parquetWriter{
+		log:          log,
+		rotator:      rotator,
+		sink:         &countingWriter{w: rotator},
+		maxBytes:     maxBytes,
+		rowGroupSize: cfg.RowGroupSize,
+		mem:          mem,
+		props: parquet.NewWriterProperties(
+			parquet.WithCompression(parquetCompressions[cfg.Compression]),
+			parquet.WithMaxRowGroupLength(int64(cfg.RowGroupSize)),
+			parquet.WithAllocator(mem),
+		),
+	}
+
+	for _, col := range cfg.Schema {
+		w.columns = append(w.columns, column{name: col.Name, typ: parquetColumnTypes[col.Type]})
+	}
+	w.explicit = len(w.columns) > 0
+	return w
+}
+
+// add buffers the event as a row. Events with values that cannot be
+// converted to a column value are not added.
+func (w *parquetWriter) add(event *beat.Event) error {
+	row := map[string]interface{}{timestampColumn: event.Timestamp}
+	for key, value := range event.Fields.Flatten() {
+		v, err := normalizeValue(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert field %s: %w", key, err)
+		}
+		row[key] = v
+	}
+	w.rows = append(w.rows, row)
+	return nil
+}
+
+// full reports whether the buffered rows complete a row group.
+func (w *parquetWriter) full() bool {
+	return len(w.rows) >= w.rowGroupSize
+}
+
+// flush writes the buffered rows as a row group and rotates the file if it
+// reached the maximum size. If writing fails, the buffered rows are
+// discarded and the current file is abandoned, the caller is expected to
+// retry the events.
+func (w *parquetWriter) flush() error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	rows := w.rows
+	w.rows = nil
+
+	if err := w.write(rows); err != nil {
+		if w.fw != nil {
+			if closeErr := w.closeFile(true); closeErr != nil {
+				w.log.Warnf("Failed to close parquet file after a write error: %v", closeErr)
+			}
+		}
+		return err
+	}
+
+	// The last column of a row group is only written to the file by the
+	// next row group or the footer, so its estimated size is added.
+	if w.sink.n+w.lastColumnBytes >= w.maxBytes {
+		return w.closeFile(true)
+	}
+	return nil
+}
+
+func (w *parquetWriter) write(rows []map[string]interface{}) (err error) {
+	// The parquet writer panics if it fails to write the file header.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to write parquet file: %v", r)
+		}
+	}()
+
+	if !w.explicit {
+		if merged, changed := mergeColumns(w.columns, inferColumns(rows)); changed {
+			w.log.Debugf("Parquet columns changed to %d columns, starting a new file", len(merged))
+			if err := w.closeFile(true); err != nil {
+				return err
+			}
+			w.columns = merged
+		}
+	}
+
+	if w.fw == nil {
+		fw, err := pqarrow.NewFileWriter(w.arrowSchema(), w.sink, w.props,
+			pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+		if err != nil {
+			return fmt.Errorf("failed to create parquet writer: %w", err)
+		}
+		w.fw = fw
+	}
+
+	rec := w.buildRecord(rows)
+	defer rec.Release()
+	if err := w.fw.Write(rec); err != nil {
+		return fmt.Errorf("failed to write parquet row group: %w", err)
+	}
+
+	w.lastColumnBytes = 0
+	if n := rec.NumCols(); n > 0 {
+		for _, buf := range rec.Column(int(n) - 1).Data().Buffers() {
+			if buf != nil {
+				w.lastColumnBytes += uint64(buf.Len()) //nolint:gosec // buffer sizes are never negative
+			}
+		}
+	}
+	return nil
+}
+
+// closeFile writes the footer of the current file and rotates it if
+// requested.
+func (w *parquetWriter) closeFile(rotate bool) error {
+	if w.fw == nil {
+		return nil
+	}
+	err := w.fw.Close()
+	w.fw = nil
+	w.sink.n = 0
+	w.lastColumnBytes = 0
+	if err != nil {
+		return fmt.Errorf("failed to close parquet file: %w", err)
+	}
+
+	if rotate {
+		if err := w.rotator.Rotate(); err != nil {
+			return fmt.Errorf("failed to rotate parquet file: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close writes the buffered rows and closes the current file.
+func (w *parquetWriter) Close() error {
+	err := w.flush()
+	if closeErr := w.closeFile(false); err == nil {
+		err = closeErr
+	}
+	if closeErr := w.rotator.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (w *parquetWriter) arrowSchema() *arrow.Schema {
+	fields := make([]arrow.Field, len(w.columns))
+	for i, col := range w.columns {
+		fields[i] = arrow.Field{Name: col.name, Type: col.typ.arrowType(), Nullable: true}
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+func (w *parquetWriter) buildRecord(rows []map[string]interface{}) arrow.Record {
+	b := array.NewRecordBuilder(w.mem, w.arrowSchema())
+	defer b.Release()
+
+	for i, col := range w.columns {
+		fb := b.Field(i)
+		fb.Reserve(len(rows))
+		for _, row := range rows {
+			appendColumnValue(fb, col.typ, row[col.name])
+		}
+	}
+	return b.NewRecord()
+}
+
+func (t columnType) arrowType() arrow.DataType {
+	switch t {
+	case columnBoolean:
+		return arrow.FixedWidthTypes.Boolean
+	case columnLong:
+		return arrow.PrimitiveTypes.Int64
+	case columnDouble:
+		return arrow.PrimitiveTypes.Float64
+	case columnTimestamp:
+		return arrow.FixedWidthTypes.Timestamp_us
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// inferColumns returns the columns needed to store rows. The timestamp is
+// always the first column, the others are sorted by name.
+func inferColumns(rows []map[string]interface{}) []column {
+	types := map[string]columnType{}
+	for _, row := range rows {
+		for name, value := range row {
+			if value == nil {
+				continue
+			}
+			typ := valueType(value)
+			if prev, ok := types[name]; ok {
+				typ = mergeTypes(prev, typ)
+			}
+			types[name] = typ
+		}
+	}
+
+	names := make([]string, 0, len(types))
+	for name := range types {
+		if name != timestampColumn {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	columns := []column{{name: timestampColumn, typ: columnTimestamp}}
+	for _, name := range names {
+		columns = append(columns, column{name: name, typ: types[name]})
+	}
+	return columns
+}
+
+// mergeColumns extends current with the inferred columns. Existing columns
+// keep their position, their type is widened if needed.
+func mergeColumns(current, inferred []column) ([]column, bool) {
+	merged := append([]column(nil), current...)
+	index := make(map[string]int, len(current))
+	for i, col := range current {
+		index[col.name] = i
+	}
+
+	changed := false
+	for _, col := range inferred {
+		i, ok := index[col.name]
+		if !ok {
+			merged = append(merged, col)
+			changed = true
+			continue
+		}
+		if typ := mergeTypes(merged[i].typ, col.typ); typ != merged[i].typ {
+			merged[i].typ = typ
+			changed = true
+		}
+	}
+	return merged, changed
+}
+
+func mergeTypes(a, b columnType) columnType {
+	switch {
+	case a == b:
+		return a
+	case (a == columnLong && b == columnDouble) || (a == columnDouble && b == columnLong):
+		return columnDouble
+	default:
+		return columnString
+	}
+}
+
+func valueType(v interface{}) columnType {
+	switch v.(type) {
+	case bool:
+		return columnBoolean
+	case int64:
+		return columnLong
+	case float64:
+		return columnDouble
+	case time.Time:
+		return columnTimestamp
+	default:
+		return columnString
+	}
+}
+
+// normalizeValue converts a flattened event value to one of the types
+// supported by the Parquet columns.
+func normalizeValue(v interface{}) (interface{}, error) {
+	switch n := v.(type) {
+	case nil, bool, string, time.Time:
+		return n, nil
+	case int:
+		return int64(n), nil
+	case int8:
+		return int64(n), nil
+	case int16:
+		return int64(n), nil
+	case int32:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case uint:
+		return int64(n), nil //nolint:gosec // values beyond int64 are not supported by parquet longs
+	case uint8:
+		return int64(n), nil
+	case uint16:
+		return int64(n), nil
+	case uint32:
+		return int64(n), nil
+	case uint64:
+		return int64(n), nil //nolint:gosec // values beyond int64 are not supported by parquet longs
+	case float32:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case common.Time:
+		return time.Time(n), nil
+	case *time.Time:
+		if n == nil {
+			return nil, nil
+		}
+		return *n, nil
+	case []byte:
+		return string(n), nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return jsonText(data), nil
+}
+
+func appendColumnValue(b array.Builder, typ columnType, v interface{}) {
+	if v == nil {
+		b.AppendNull()
+		return
+	}
+
+	switch typ {
+	case columnBoolean:
+		if value, ok := v.(bool); ok {
+			b.(*array.BooleanBuilder).Append(value)
+			return
+		}
+
+	case columnLong:
+		switch value := v.(type) {
+		case int64:
+			b.(*array.Int64Builder).Append(value)
+			return
+		case float64:
+			if value == math.Trunc(value) {
+				b.(*array.Int64Builder).Append(int64(value))
+				return
+			}
+		}
+
+	case columnDouble:
+		switch value := v.(type) {
+		case float64:
+			b.(*array.Float64Builder).Append(value)
+			return
+		case int64:
+			b.(*array.Float64Builder).Append(float64(value))
+			return
+		}
+
+	case columnTimestamp:
+		if value, ok := v.(time.Time); ok {
+			b.(*array.TimestampBuilder).Append(arrow.Timestamp(value.UnixMicro()))
+			return
+		}
+
+	default:
+		b.(*array.StringBuilder).Append(stringValue(v))
+		return
+	}
+
+	// The value does not match the configured column type.
+	b.AppendNull()
+}
+
+func stringValue(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case jsonText:
+		return string(value)
+	case bool:
+		return strconv.FormatBool(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,296 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package fileout
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	pqfile "github.com/apache/arrow/go/v17/parquet/file"
+	"github.com/apache/arrow/go/v17/parquet/pqarrow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newParquetOutput(t *testing.T, settings mapstr.M) (*fileOutput, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	base := mapstr.M{
+		"path":            dir,
+		"filename":        "test",
+		"parquet.enabled": true,
+	}
+	base.DeepUpdate(settings)
+	cfg, err := readConfig(config.MustNewConfigFrom(base))
+	require.NoError(t, err)
+
+	info := beat.Info{Beat: "test", Logger: logptest.NewTestingLogger(t, "")}
+	out := &fileOutput{log: info.Logger, beat: info, observer: outputs.NewNilObserver()}
+	require.NoError(t, out.init(info, *cfg))
+	return out, dir
+}
+
+// readParquetFiles returns the tables stored in the parquet files in dir,
+// oldest file first.
+func readParquetFiles(t *testing.T, dir string) []arrow.Table {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "test-*.parquet"))
+	require.NoError(t, err)
+	// Files are named test-<date>[-<index>].parquet, the first file of a
+	// day has no index.
+	sort.Slice(files, func(i, j int) bool {
+		a, b := filepath.Base(files[i]), filepath.Base(files[j])
+		if a[:13] != b[:13] {
+			return a < b
+		}
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+
+	var tables []arrow.Table
+	for _, name := range files {
+		rdr, err := pqfile.OpenParquetFile(name, false)
+		require.NoError(t, err)
+		t.Cleanup(func() { rdr.Close() })
+
+		fr, err := pqarrow.NewFileReader(rdr, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+		require.NoError(t, err)
+		table, err := fr.ReadTable(context.Background())
+		require.NoError(t, err)
+		t.Cleanup(table.Release)
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+func columnNames(table arrow.Table) []string {
+	var names []string
+	for _, f := range table.Schema().Fields() {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func publishEvents(t *testing.T, out *fileOutput, fields ...mapstr.M) *outest.Batch {
+	t.Helper()
+
+	events := make([]beat.Event, len(fields))
+	for i, f := range fields {
+		events[i] = beat.Event{Timestamp: time.Now(), Fields: f}
+	}
+	batch := outest.NewBatch(events...)
+	require.NoError(t, out.Publish(context.Background(), batch))
+	return batch
+}
+
+func requireSignal(t *testing.T, tag outest.BatchSignalTag, batches ...*outest.Batch) {
+	t.Helper()
+
+	for _, batch := range batches {
+		require.Len(t, batch.Signals, 1)
+		assert.Equal(t, tag, batch.Signals[0].Tag)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestParquetExplicitSchema(t *testing.T) {
+	out, dir := newParquetOutput(t, mapstr.M{
+		"parquet.schema": []mapstr.M{
+			{"name": "@timestamp", "type": "timestamp"},
+			{"name": "message", "type": "string"},
+			{"name": "http.status", "type": "long"},
+		},
+	})
+
+	batch := publishEvents(t, out,
+		mapstr.M{"message": "a", "http": mapstr.M{"status": 200}, "ignored": true},
+		mapstr.M{"message": "b"},
+		mapstr.M{"message": "c", "http": mapstr.M{"status": "not a number"}},
+	)
+	require.Empty(t, batch.Signals, "batch must not be acknowledged before its row group is written")
+	require.NoError(t, out.Close())
+	requireSignal(t, outest.BatchACK, batch)
+
+	tables := readParquetFiles(t, dir)
+	require.Len(t, tables, 1)
+	table := tables[0]
+	assert.Equal(t, []string{"@timestamp", "message", "http.status"}, columnNames(table))
+	require.Equal(t, int64(3), table.NumRows())
+
+	messages := table.Column(1).Data().Chunk(0).(*array.String)
+	assert.Equal(t, "c", messages.Value(2))
+
+	status := table.Column(2).Data().Chunk(0).(*array.Int64)
+	assert.Equal(t, int64(200), status.Value(0))
+	assert.True(t, status.IsNull(1))
+	assert.True(t, status.IsNull(2))
+}
+
+func TestParquetSchemaInference(t *testing.T) {
+	out, dir := newParquetOutput(t, mapstr.M{
+		"parquet.row_group_size": 2,
+	})
+
+	first := publishEvents(t, out,
+		mapstr.M{"message": "a", "count": 1},
+		mapstr.M{"message": "b", "count": 2.5, "tags": []string{"x", "y"}},
+	)
+	requireSignal(t, outest.BatchACK, first)
+	// Rows with the same columns are added to the current file.
+	publishEvents(t, out,
+		mapstr.M{"message": "c", "count": 3},
+		mapstr.M{"message": "d"},
+	)
+	// A new column starts a new file.
+	publishEvents(t, out,
+		mapstr.M{"message": "e", "enabled": true},
+		mapstr.M{"message": "f"},
+	)
+	require.NoError(t, out.Close())
+
+	tables := readParquetFiles(t, dir)
+	require.Len(t, tables, 2)
+
+	firstTable := tables[0]
+	assert.Equal(t, []string{"@timestamp", "count", "message", "tags"}, columnNames(firstTable))
+	assert.Equal(t, int64(4), firstTable.NumRows())
+	assert.Equal(t, arrow.PrimitiveTypes.Float64, firstTable.Schema().Field(1).Type)
+	tags := firstTable.Column(3).Data().Chunk(0).(*array.String)
+	assert.Equal(t, `["x","y"]`, tags.Value(1))
+
+	second := tables[1]
+	assert.Equal(t, []string{"@timestamp", "count", "message", "tags", "enabled"}, columnNames(second))
+	assert.Equal(t, int64(2), second.NumRows())
+}
+
+func TestParquetRotateBySize(t *testing.T) {
+	out, dir := newParquetOutput(t, mapstr.M{
+		"rotate_every_kb":        1,
+		"number_of_files":        3,
+		"parquet.row_group_size": 1,
+		"parquet.compression":    "none",
+	})
+
+	for i := 0; i < 5; i++ {
+		batch := publishEvents(t, out, mapstr.M{"message": strings.Repeat("x", 2048)})
+		requireSignal(t, outest.BatchACK, batch)
+	}
+	require.NoError(t, out.Close())
+
+	tables := readParquetFiles(t, dir)
+	require.Len(t, tables, 3, "older files must be removed")
+	for _, table := range tables {
+		assert.Equal(t, int64(1), table.NumRows())
+	}
+}
+
+func TestParquetAckAfterRowGroup(t *testing.T) {
+	out, dir := newParquetOutput(t, mapstr.M{
+		"parquet.row_group_size": 3,
+	})
+
+	first := publishEvents(t, out, mapstr.M{"message": "a"}, mapstr.M{"message": "b"})
+	assert.Empty(t, first.Signals)
+
+	second := publishEvents(t, out, mapstr.M{"message": "c"}, mapstr.M{"message": "d"})
+	requireSignal(t, outest.BatchACK, first, second)
+	require.NoError(t, out.Close())
+
+	tables := readParquetFiles(t, dir)
+	require.Len(t, tables, 1)
+	assert.Equal(t, int64(4), tables[0].NumRows())
+}
+
+func TestParquetFlushInterval(t *testing.T) {
+	out, _ := newParquetOutput(t, mapstr.M{
+		"parquet.flush_interval": "10ms",
+	})
+	t.Cleanup(func() { _ = out.Close() })
+
+	batch := publishEvents(t, out, mapstr.M{"message": "a"})
+	require.Eventually(t, func() bool {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+		return len(batch.Signals) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+}
+
+func TestParquetRetryOnWriteError(t *testing.T) {
+	out, dir := newParquetOutput(t, mapstr.M{
+		"parquet.row_group_size": 2,
+	})
+	out.parquet.sink.w = failingWriter{}
+
+	first := publishEvents(t, out, mapstr.M{"message": "a"})
+	second := publishEvents(t, out, mapstr.M{"message": "b"})
+	requireSignal(t, outest.BatchRetry, first, second)
+
+	// The retried events are written once the file is writable again.
+	out.parquet.sink.w = out.rotator
+	retried := publishEvents(t, out, mapstr.M{"message": "a"}, mapstr.M{"message": "b"})
+	requireSignal(t, outest.BatchACK, retried)
+	require.NoError(t, out.Close())
+
+	var rows int64
+	for _, table := range readParquetFiles(t, dir) {
+		rows += table.NumRows()
+	}
+	assert.Equal(t, int64(2), rows)
+}
+
+func TestParquetDropUnconvertibleEvents(t *testing.T) {
+	out, dir := newParquetOutput(t, nil)
+
+	batch := publishEvents(t, out,
+		mapstr.M{"message": "a"},
+		mapstr.M{"message": "b", "invalid": make(chan int)},
+	)
+	require.NoError(t, out.Close())
+	requireSignal(t, outest.BatchACK, batch)
+
+	tables := readParquetFiles(t, dir)
+	require.Len(t, tables, 1)
+	assert.Equal(t, int64(1), tables[0].NumRows())
+}
@@ -0,0 +1,401 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/testing"
+	"github.com/elastic/elastic-agent-libs/transport"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+// maxErrorBodySize limits how much of a failed response body is logged.
+const maxErrorBodySize = 1024
+
+type statusAction uint8
+
+const (
+	statusACK statusAction = iota
+	statusRetry
+	statusDrop
+	statusSplit
+)
+
+// statusPolicy decides how a batch is handled based on the response
+// status code. Explicitly configured codes take precedence over the
+// defaults: 2xx is acknowledged, 413 splits the batch, 408, 429 and 5xx
+// are retried and every other code drops the batch.
+type statusPolicy struct {
+	retry map[int]bool
+	drop  map[int]bool
+}
+
+func newStatusPolicy(retry, drop []int) statusPolicy {
+	p := statusPolicy{retry: map[int]bool{}, drop: map[int]bool{}}
+	for _, code := range retry {
+		p.retry[code] = true
+	}
+	for _, code := range drop {
+		p.drop[code] = true
+	}
+	return p
+}
+
+func (p statusPolicy) action(code int) statusAction {
+	switch {
+	case code >= 200 && code < 300:
+		return statusACK
+	case p.drop[code]:
+		return statusDrop
+	case p.retry[code]:
+		return statusRetry
+	case code == http.StatusRequestEntityTooLarge:
+		return statusSplit
+	case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests, code >= 500:
+		return statusRetry
+	default:
+		return statusDrop
+	}
+}
+
+type clientSettings struct {
+	url              string
+	method           string
+	headers          map[string]string
+	username         string
+	password         string
+	format           string
+	compressionLevel int
+	signer           *signer
+	policy           statusPolicy
+	maxRetryAfter    time.Duration
+	transport        httpcommon.HTTPTransportSettings
+	userAgent        string
+	index            string
+	codec            codec.Codec
+	observer         outputs.Observer
+}
+
+type client struct {
+	clientSettings
+
+	log  *logp.Logger
+	http *http.Client
+
+	// retryAfter is the earliest time at which the next request may be
+	// sent, as requested by the server through a Retry-After header.
+	retryAfter time.Time
+}
+
+func newClient(s clientSettings, log *logp.Logger) (*client, error) {
+	headers := map[string]string{}
+	if s.userAgent != "" {
+		headers["User-Agent"] = s.userAgent
+	}
+	httpClient, err := s.transport.Client(
+		httpcommon.WithLogger(log),
+		httpcommon.WithIOStats(s.observer),
+		httpcommon.WithKeepaliveSettings{IdleConnTimeout: s.transport.IdleConnTimeout},
+		httpcommon.WithHeaderRoundTripper(headers),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		clientSettings: s,
+		log:            log,
+		http:           httpClient,
+	}, nil
+}
+
+// Connect is a no-op, connections are established per request by the
+// underlying HTTP transport.
+func (c *client) Connect(_ context.Context) error {
+	return nil
+}
+
+func (c *client) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	if err := c.waitRetryAfter(ctx); err != nil {
+		batch.Cancelled()
+		return err
+	}
+
+	body, okEvents := c.encodeBatch(events)
+	c.observer.PermanentErrors(len(events) - len(okEvents))
+	if len(okEvents) == 0 {
+		batch.ACK()
+		return nil
+	}
+
+	begin := time.Now()
+	status, retryAfter, err := c.send(ctx, body)
+	if err != nil {
+		c.observer.RetryableErrors(len(okEvents))
+		batch.RetryEvents(okEvents)
+		return fmt.Errorf("failed to send events to %s: %w", c.url, err)
+	}
+	c.observer.ReportLatency(time.Since(begin))
+
+	switch c.policy.action(status) {
+	case statusACK:
+		c.observer.AckedEvents(len(okEvents))
+		batch.ACK()
+		return nil
+
+	case statusSplit:
+		if batch.SplitRetry() {
+			c.observer.BatchSplit()
+			c.observer.RetryableErrors(len(okEvents))
+		} else {
+			c.log.Errorf("Dropping %d events: request body too large for %s", len(okEvents), c.url)
+			batch.Drop()
+			c.observer.PermanentErrors(len(okEvents))
+		}
+		return nil
+
+	case statusRetry:
+		if status == http.StatusTooManyRequests {
+			c.observer.ErrTooMany(len(okEvents))
+		} else {
+			c.observer.RetryableErrors(len(okEvents))
+		}
+		c.setRetryAfter(retryAfter, time.Now())
+		batch.RetryEvents(okEvents)
+		return fmt.Errorf("%s responded with retryable status %d", c.url, status)
+
+	default:
+		c.log.Errorf("Dropping %d events: %s responded with status %d", len(okEvents), c.url, status)
+		c.observer.PermanentErrors(len(okEvents))
+		batch.Drop()
+		return nil
+	}
+}
+
+// encodeBatch serializes all events into a single request body using the
+// configured codec, dropping events that fail to encode.
+func (c *client) encodeBatch(events []publisher.Event) ([]byte, []publisher.Event) {
+	var buf bytes.Buffer
+	okEvents := events[:0]
+
+	if c.format == formatJSONArray {
+		buf.WriteByte('[')
+	}
+	for i := range events {
+		serialized, err := c.codec.Encode(c.index, &events[i].Content)
+		if err != nil {
+			if events[i].Guaranteed() {
+				c.log.Errorf("Failed to serialize the event: %+v", err)
+			} else {
+				c.log.Warnf("Failed to serialize the event: %+v", err)
+			}
+			continue
+		}
+
+		if c.format == formatJSONArray {
+			if len(okEvents) > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(serialized)
+		} else {
+			buf.Write(serialized)
+			buf.WriteByte('\n')
+		}
+		okEvents = append(okEvents, events[i])
+	}
+	if c.format == formatJSONArray {
+		buf.WriteByte(']')
+	}
+
+	return buf.Bytes(), okEvents
+}
+
+// send issues the request and returns the response status code and the
+// value of the Retry-After header, if any.
+func (c *client) send(ctx context.Context, body []byte) (int, string, error) {
+	var err error
+	contentEncoding := ""
+	if c.compressionLevel > 0 {
+		body, err = compress(body, c.compressionLevel)
+		if err != nil {
+			return 0, "", err
+		}
+		contentEncoding = "gzip"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, c.method, c.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	if c.format == formatJSONArray {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	if c.signer != nil {
+		c.signer.sign(req, body, time.Now())
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		c.log.Debugf("%s responded with status %d: %s", c.url, resp.StatusCode, msg)
+	}
+	// Drain the body so the connection can be reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode, resp.Header.Get("Retry-After"), nil
+}
+
+func compress(body []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// setRetryAfter records the delay requested by the server. The value may be
+// either a number of seconds or an HTTP date and is capped at maxRetryAfter.
+func (c *client) setRetryAfter(value string, now time.Time) {
+	if value == "" {
+		return
+	}
+
+	var wait time.Duration
+	if secs, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		wait = t.Sub(now)
+	} else {
+		c.log.Debugf("Ignoring invalid Retry-After header %q", value)
+		return
+	}
+
+	if wait <= 0 {
+		return
+	}
+	if c.maxRetryAfter > 0 && wait > c.maxRetryAfter {
+		wait = c.maxRetryAfter
+	}
+	c.retryAfter = now.Add(wait)
+}
+
+func (c *client) waitRetryAfter(ctx context.Context) error {
+	wait := time.Until(c.retryAfter)
+	if wait <= 0 {
+		return nil
+	}
+
+	c.log.Debugf("Waiting %v before sending to %s as requested by Retry-After", wait, c.url)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *client) String() string {
+	return "http(" + c.url + ")"
+}
+
+func (c *client) Test(d testing.Driver) {
+	d.Run("http: "+c.url, func(d testing.Driver) {
+		u, err := url.Parse(c.url)
+		d.Fatal("parse url", err)
+
+		address := u.Host
+		if u.Port() == "" {
+			port := "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+			address = net.JoinHostPort(u.Hostname(), port)
+		}
+
+		d.Run("connection", func(d testing.Driver) {
+			netDialer := transport.TestNetDialer(d, c.transport.Timeout)
+			_, err = netDialer.Dial("tcp", address)
+			d.Fatal("dial up", err)
+		})
+
+		if u.Scheme != "https" {
+			d.Warn("TLS", "secure connection disabled")
+			return
+		}
+		d.Run("TLS", func(d testing.Driver) {
+			tls, err := tlscommon.LoadTLSConfig(c.transport.TLS)
+			if err != nil {
+				d.Fatal("load tls config", err)
+			}
+
+			netDialer := transport.NetDialer(c.transport.Timeout)
+			tlsDialer := transport.TestTLSDialer(d, netDialer, tls, c.transport.Timeout)
+			_, err = tlsDialer.Dial("tcp", address)
+			d.Fatal("dial up", err)
+		})
+	})
+}
@@ -0,0 +1,233 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package httpout
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newTestClient(t *testing.T, url string, mod func(*clientSettings)) *client {
+	t.Helper()
+	s := clientSettings{
+		url:       url,
+		method:    http.MethodPost,
+		format:    formatNDJSON,
+		policy:    newStatusPolicy(nil, nil),
+		transport: defaultConfig().Transport,
+		index:     "testbeat",
+		codec:     json.New("1.2.3", json.Config{}),
+		observer:  outputs.NewNilObserver(),
+	}
+	if mod != nil {
+		mod(&s)
+	}
+	c, err := newClient(s, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	return c
+}
+
+func testEvents() []beat.Event {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []beat.Event{
+		{Timestamp: ts, Fields: mapstr.M{"message": "first"}},
+		{Timestamp: ts, Fields: mapstr.M{"message": "second"}},
+	}
+}
+
+func lastSignal(b *outest.Batch) outest.BatchSignalTag {
+	return b.Signals[len(b.Signals)-1].Tag
+}
+
+func TestPublishNDJSON(t *testing.T) {
+	var lines []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		assert.Equal(t, "value", r.Header.Get("X-Custom"))
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv.URL, func(s *clientSettings) {
+		s.headers = map[string]string{"X-Custom": "value"}
+	})
+	batch := outest.NewBatch(testEvents()...)
+	require.NoError(t, c.Publish(context.Background(), batch))
+
+	assert.Equal(t, outest.BatchACK, lastSignal(batch))
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"message":"first"`)
+	assert.Contains(t, lines[1], `"message":"second"`)
+}
+
+func TestPublishJSONArrayGzip(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err = io.ReadAll(gz)
+		require.NoError(t, err)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv.URL, func(s *clientSettings) {
+		s.format = formatJSONArray
+		s.compressionLevel = 5
+	})
+	batch := outest.NewBatch(testEvents()...)
+	require.NoError(t, c.Publish(context.Background(), batch))
+
+	assert.Equal(t, outest.BatchACK, lastSignal(batch))
+	assert.Equal(t, byte('['), body[0])
+	assert.Equal(t, byte(']'), body[len(body)-1])
+	assert.Contains(t, string(body), `"message":"first"},{`)
+}
+
+func TestPublishSigning(t *testing.T) {
+	const key = "secret"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		ts := r.Header.Get("X-Timestamp")
+		require.NotEmpty(t, ts)
+
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(ts + "."))
+		mac.Write(body)
+		assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), r.Header.Get("X-Hub-Signature"))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv.URL, func(s *clientSettings) {
+		s.signer = newSigner(&signingConfig{Key: key, Header: "X-Hub-Signature", TimestampHeader: "X-Timestamp"})
+	})
+	batch := outest.NewBatch(testEvents()...)
+	require.NoError(t, c.Publish(context.Background(), batch))
+	assert.Equal(t, outest.BatchACK, lastSignal(batch))
+}
+
+func TestPublishStatusPolicy(t *testing.T) {
+	tests := map[string]struct {
+		status  int
+		retry   []int
+		drop    []int
+		wantErr bool
+		want    outest.BatchSignalTag
+	}{
+		"server error is retried":        {status: 503, wantErr: true, want: outest.BatchRetryEvents},
+		"client error is dropped":        {status: 400, want: outest.BatchDrop},
+		"too large splits the batch":     {status: 413, want: outest.BatchSplitRetry},
+		"configured retry overrides":     {status: 409, retry: []int{409}, wantErr: true, want: outest.BatchRetryEvents},
+		"configured drop overrides":      {status: 500, drop: []int{500}, want: outest.BatchDrop},
+		"too many requests is retried":   {status: 429, wantErr: true, want: outest.BatchRetryEvents},
+		"redirect without target drops":  {status: 304, want: outest.BatchDrop},
+		"created is treated as accepted": {status: 201, want: outest.BatchACK},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			c := newTestClient(t, srv.URL, func(s *clientSettings) {
+				s.policy = newStatusPolicy(tc.retry, tc.drop)
+			})
+			batch := outest.NewBatch(testEvents()...)
+			err := c.Publish(context.Background(), batch)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.want, lastSignal(batch))
+		})
+	}
+}
+
+func TestSetRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := newTestClient(t, "http://localhost", func(s *clientSettings) {
+		s.maxRetryAfter = time.Minute
+	})
+
+	c.setRetryAfter("10", now)
+	assert.Equal(t, now.Add(10*time.Second), c.retryAfter)
+
+	c.setRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now)
+	assert.Equal(t, now.Add(30*time.Second), c.retryAfter)
+
+	c.setRetryAfter("3600", now)
+	assert.Equal(t, now.Add(time.Minute), c.retryAfter, "wait must be capped at max_retry_after")
+
+	c.retryAfter = time.Time{}
+	c.setRetryAfter("soon", now)
+	assert.True(t, c.retryAfter.IsZero())
+}
+
+func TestPublishHonorsRetryAfter(t *testing.T) {
+	var requests []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, time.Now())
+		if len(requests) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, srv.URL, nil)
+	batch := outest.NewBatch(testEvents()...)
+	require.Error(t, c.Publish(context.Background(), batch))
+	assert.Equal(t, outest.BatchRetryEvents, lastSignal(batch))
+
+	batch = outest.NewBatch(testEvents()...)
+	require.NoError(t, c.Publish(context.Background(), batch))
+	assert.Equal(t, outest.BatchACK, lastSignal(batch))
+
+	require.Len(t, requests, 2)
+	assert.GreaterOrEqual(t, requests[1].Sub(requests[0]), 900*time.Millisecond)
+}
@@ -0,0 +1,151 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+const (
+	formatNDJSON    = "ndjson"
+	formatJSONArray = "json_array"
+)
+
+type httpOutConfig struct {
+	Protocol         string            `config:"protocol"`
+	Path             string            `config:"path"`
+	Method           string            `config:"method"`
+	Params           map[string]string `config:"parameters"`
+	Headers          map[string]string `config:"headers"`
+	Username         string            `config:"username"`
+	Password         string            `config:"password"`
+	Format           string            `config:"format"`
+	Codec            codec.Config      `config:"codec"`
+	CompressionLevel int               `config:"compression_level" validate:"min=0, max=9"`
+	Signing          *signingConfig    `config:"signing"`
+	RetryOnStatus    []int             `config:"retry_on_status"`
+	DropOnStatus     []int             `config:"drop_on_status"`
+	MaxRetryAfter    time.Duration     `config:"max_retry_after" validate:"min=0"`
+	LoadBalance      bool              `config:"loadbalance"`
+	BulkMaxSize      int               `config:"bulk_max_size"`
+	MaxRetries       int               `config:"max_retries"`
+	Backoff          backoff           `config:"backoff"`
+	Queue            config.Namespace  `config:"queue"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+// signingConfig configures HMAC signing of the request body.
+type signingConfig struct {
+	Key             string `config:"key"`
+	Algorithm       string `config:"algorithm"`
+	Header          string `config:"header"`
+	TimestampHeader string `config:"timestamp_header"`
+}
+
+func defaultConfig() httpOutConfig {
+	return httpOutConfig{
+		Method:           http.MethodPost,
+		Format:           formatNDJSON,
+		CompressionLevel: 0,
+		MaxRetryAfter:    5 * time.Minute,
+		LoadBalance:      true,
+		BulkMaxSize:      1600,
+		MaxRetries:       3,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+		Transport: httpcommon.DefaultHTTPTransportSettings(),
+	}
+}
+
+func (c *httpOutConfig) Validate() error {
+	switch c.Method {
+	case http.MethodPost, http.MethodPut:
+	default:
+		return fmt.Errorf("unsupported HTTP method %q, must be one of POST or PUT", c.Method)
+	}
+
+	switch c.Format {
+	case formatNDJSON:
+	case formatJSONArray:
+		if name := c.Codec.Namespace.Name(); name != "" && name != "json" {
+			return fmt.Errorf("format %q requires the json codec, got %q", c.Format, name)
+		}
+	default:
+		return fmt.Errorf("unsupported format %q, must be one of %s or %s", c.Format, formatNDJSON, formatJSONArray)
+	}
+
+	if c.Username != "" && c.Headers["Authorization"] != "" {
+		return errors.New("cannot set both username/password and an Authorization header")
+	}
+
+	retry := map[int]bool{}
+	for _, code := range c.RetryOnStatus {
+		if err := validateStatus(code); err != nil {
+			return fmt.Errorf("invalid retry_on_status: %w", err)
+		}
+		retry[code] = true
+	}
+	for _, code := range c.DropOnStatus {
+		if err := validateStatus(code); err != nil {
+			return fmt.Errorf("invalid drop_on_status: %w", err)
+		}
+		if retry[code] {
+			return fmt.Errorf("status code %d is configured in both retry_on_status and drop_on_status", code)
+		}
+	}
+
+	return nil
+}
+
+func validateStatus(code int) error {
+	if code < 100 || code > 599 {
+		return fmt.Errorf("%d is not a valid HTTP status code", code)
+	}
+	if code >= 200 && code < 300 {
+		return fmt.Errorf("%d is a successful HTTP status code", code)
+	}
+	return nil
+}
+
+func (c *signingConfig) Validate() error {
+	if c.Key == "" {
+		return errors.New("signing.key is required when signing is enabled")
+	}
+	switch strings.ToLower(c.Algorithm) {
+	case "", "sha256", "sha512":
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q, must be one of sha256 or sha512", c.Algorithm)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package httpout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		config  mapstr.M
+		wantErr string
+	}{
+		"default config": {
+			config: mapstr.M{},
+		},
+		"json array with json codec": {
+			config: mapstr.M{"format": "json_array", "codec.json.pretty": false},
+		},
+		"json array with format codec": {
+			config:  mapstr.M{"format": "json_array", "codec.format.string": "%{[message]}"},
+			wantErr: "requires the json codec",
+		},
+		"unknown format": {
+			config:  mapstr.M{"format": "xml"},
+			wantErr: "unsupported format",
+		},
+		"unsupported method": {
+			config:  mapstr.M{"method": "GET"},
+			wantErr: "unsupported HTTP method",
+		},
+		"success status in policy": {
+			config:  mapstr.M{"retry_on_status": []int{200}},
+			wantErr: "successful HTTP status code",
+		},
+		"status in both lists": {
+			config:  mapstr.M{"retry_on_status": []int{500}, "drop_on_status": []int{500}},
+			wantErr: "both retry_on_status and drop_on_status",
+		},
+		"signing without key": {
+			config:  mapstr.M{"signing.algorithm": "sha256"},
+			wantErr: "signing.key is required when signing is enabled",
+		},
+		"signing with unknown algorithm": {
+			config:  mapstr.M{"signing.key": "secret", "signing.algorithm": "md5"},
+			wantErr: "unsupported signing algorithm",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := defaultConfig()
+			err := config.MustNewConfigFrom(tc.config).Unpack(&c)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"net/url"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func init() {
+	outputs.RegisterType("http", makeHTTP)
+}
+
+const logSelector = "http"
+
+func makeHTTP(
+	_ outputs.IndexManager,
+	beatInfo beat.Info,
+	observer outputs.Observer,
+	cfg *config.C,
+) (outputs.Group, error) {
+	log := beatInfo.Logger.Named(logSelector)
+
+	httpConfig := defaultConfig()
+	if err := cfg.Unpack(&httpConfig); err != nil {
+		return outputs.Fail(err)
+	}
+
+	hosts, err := outputs.ReadHostList(cfg)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	if proxyURL := httpConfig.Transport.Proxy.URL; proxyURL != nil && !httpConfig.Transport.Proxy.Disable {
+		log.Infof("Using proxy URL: %s", proxyURL)
+	}
+
+	var sign *signer
+	if httpConfig.Signing != nil {
+		sign = newSigner(httpConfig.Signing)
+	}
+	policy := newStatusPolicy(httpConfig.RetryOnStatus, httpConfig.DropOnStatus)
+
+	params := url.Values{}
+	for k, v := range httpConfig.Params {
+		params.Add(k, v)
+	}
+
+	clients := make([]outputs.NetworkClient, len(hosts))
+	for i, host := range hosts {
+		hostURL, err := common.MakeURL(httpConfig.Protocol, httpConfig.Path, host, 0)
+		if err != nil {
+			log.Errorf("Invalid host param set: %s, Error: %+v", host, err)
+			return outputs.Fail(err)
+		}
+
+		enc, err := codec.CreateEncoder(beatInfo, httpConfig.Codec)
+		if err != nil {
+			return outputs.Fail(err)
+		}
+
+		var client outputs.NetworkClient
+		client, err = newClient(clientSettings{
+			url:              common.EncodeURLParams(hostURL, params),
+			method:           httpConfig.Method,
+			headers:          httpConfig.Headers,
+			username:         httpConfig.Username,
+			password:         httpConfig.Password,
+			format:           httpConfig.Format,
+			compressionLevel: httpConfig.CompressionLevel,
+			signer:           sign,
+			policy:           policy,
+			maxRetryAfter:    httpConfig.MaxRetryAfter,
+			transport:        httpConfig.Transport,
+			userAgent:        beatInfo.UserAgent,
+			index:            beatInfo.Beat,
+			codec:            enc,
+			observer:         observer,
+		}, log)
+		if err != nil {
+			return outputs.Fail(err)
+		}
+
+		client = outputs.WithBackoff(client, httpConfig.Backoff.Init, httpConfig.Backoff.Max)
+		clients[i] = client
+	}
+
+	return outputs.SuccessNet(httpConfig.Queue, httpConfig.LoadBalance, httpConfig.BulkMaxSize, httpConfig.MaxRetries, nil, clients)
+}
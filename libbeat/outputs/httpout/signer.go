@@ -0,0 +1,81 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSignatureHeader = "X-Signature"
+)
+
+// signer adds an HMAC signature of the request body to outgoing requests.
+// If a timestamp header is configured, the signed message is
+// "<unix timestamp>.<body>" so receivers can reject replayed requests.
+type signer struct {
+	key             []byte
+	algorithm       string
+	newHash         func() hash.Hash
+	header          string
+	timestampHeader string
+}
+
+func newSigner(c *signingConfig) *signer {
+	s := &signer{
+		key:             []byte(c.Key),
+		algorithm:       strings.ToLower(c.Algorithm),
+		header:          c.Header,
+		timestampHeader: c.TimestampHeader,
+	}
+	if s.algorithm == "" {
+		s.algorithm = "sha256"
+	}
+	if s.header == "" {
+		s.header = defaultSignatureHeader
+	}
+
+	switch s.algorithm {
+	case "sha512":
+		s.newHash = sha512.New
+	default:
+		s.newHash = sha256.New
+	}
+	return s
+}
+
+// sign computes the signature of body and sets the signature headers on req.
+func (s *signer) sign(req *http.Request, body []byte, now time.Time) {
+	mac := hmac.New(s.newHash, s.key)
+	if s.timestampHeader != "" {
+		ts := strconv.FormatInt(now.Unix(), 10)
+		req.Header.Set(s.timestampHeader, ts)
+		mac.Write([]byte(ts))
+		mac.Write([]byte{'.'})
+	}
+	mac.Write(body)
+	req.Header.Set(s.header, s.algorithm+"="+hex.EncodeToString(mac.Sum(nil)))
+}
@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/eapache/go-resiliency/breaker"
+	"github.com/rcrowley/go-metrics"
 
 	"github.com/elastic/sarama"
 
@@ -56,6 +57,12 @@ type client struct {
 
 	recordHeaders []sarama.RecordHeader
 
+	// transactional producer state
+	transactional bool
+	txnFailures   int
+	txnCommitted  metrics.Counter
+	txnAborted    metrics.Counter
+
 	wg sync.WaitGroup
 }
 
@@ -66,9 +73,19 @@ type msgRef struct {
 	failed []publisher.Event
 	batch  publisher.Batch
 
+	// txnDone is closed once all messages of a transactional batch have
+	// been handled by the producer. The batch itself is finished by
+	// publishTransaction after committing or aborting the transaction.
+	txnDone chan struct{}
+
 	err error
 }
 
+const (
+	metricTransactionsCommitted = "kafka-transactions-committed"
+	metricTransactionsAborted   = "kafka-transactions-aborted"
+)
+
 var (
 	errNoTopicsSelected = errors.New("no topic could be selected")
 
@@ -108,6 +125,10 @@ func newKafkaClient(
 		codec:    writer,
 		config:   *cfg,
 		done:     make(chan struct{}),
+
+		transactional: cfg.Producer.Transaction.ID != "",
+		txnCommitted:  metrics.GetOrRegisterCounter(metricTransactionsCommitted, cfg.MetricRegistry),
+		txnAborted:    metrics.GetOrRegisterCounter(metricTransactionsAborted, cfg.MetricRegistry),
 	}
 
 	if len(headers) != 0 {
@@ -169,6 +190,11 @@ func (c *client) Close() error {
 }
 
 func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
+	if c.transactional {
+		c.publishTransaction(batch)
+		return nil
+	}
+
 	events := batch.Events()
 	c.observer.NewBatch(len(events))
 
@@ -199,6 +225,107 @@ func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
 	return nil
 }
 
+// publishTransaction writes all events of the batch in a single Kafka
+// transaction and waits for the producer to handle every message. The
+// transaction is only committed if all messages were written, otherwise it is
+// aborted and the batch is retried as a whole.
+func (c *client) publishTransaction(batch publisher.Batch) {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	if err := c.producer.BeginTxn(); err != nil {
+		c.log.Errorf("Kafka failed to begin transaction: %+v", err)
+		c.observer.RetryableErrors(len(events))
+		batch.Retry()
+		c.waitTxnBackoff()
+		return
+	}
+
+	// The extra count is released once all messages have been sent, so an
+	// empty or fully dropped batch does not block.
+	ref := &msgRef{
+		client:  c,
+		count:   int32(len(events)) + 1, //nolint:gosec // batch sizes are bounded by bulk_max_size
+		total:   len(events),
+		batch:   batch,
+		txnDone: make(chan struct{}),
+	}
+
+	sent := make([]*message, 0, len(events))
+	ch := c.producer.Input()
+	for i := range events {
+		d := &events[i]
+		msg, err := c.getEventMessage(d)
+		if err != nil {
+			c.log.Errorf("Dropping event: %+v", err)
+			ref.done()
+			c.observer.PermanentErrors(1)
+			continue
+		}
+
+		msg.ref = ref
+		msg.initProducerMessage()
+		sent = append(sent, msg)
+		ch <- &msg.msg
+	}
+	ref.dec()
+	<-ref.txnDone
+
+	err := ref.err
+	if err == nil && len(ref.failed) == 0 && !anyRejected(sent) {
+		if err = c.producer.CommitTxn(); err == nil {
+			c.txnFailures = 0
+			c.txnCommitted.Inc(1)
+			batch.ACK()
+			c.observer.AckedEvents(len(sent))
+			return
+		}
+	}
+	if err == nil {
+		err = errors.New("messages were rejected")
+	}
+	c.abortTransaction(batch, sent, err)
+}
+
+// abortTransaction aborts the open transaction and returns all messages of
+// the batch to the pipeline, except the ones Kafka rejected permanently.
+func (c *client) abortTransaction(batch publisher.Batch, sent []*message, cause error) {
+	c.txnAborted.Inc(1)
+	c.log.Errorf("Kafka aborting transaction: %+v", cause)
+	if err := c.producer.AbortTxn(); err != nil {
+		c.log.Errorf("Kafka failed to abort transaction: %+v", err)
+	}
+
+	retry := make([]publisher.Event, 0, len(sent))
+	for _, msg := range sent {
+		if !msg.rejected {
+			retry = append(retry, msg.data)
+		}
+	}
+	c.observer.RetryableErrors(len(retry))
+	batch.RetryEvents(retry)
+	c.waitTxnBackoff()
+}
+
+// waitTxnBackoff delays the next transaction after consecutive failures, as
+// the pipeline hands retried batches back to the output immediately.
+func (c *client) waitTxnBackoff() {
+	c.txnFailures++
+	select {
+	case <-time.After(c.config.Producer.Retry.BackoffFunc(c.txnFailures, c.config.Producer.Retry.Max)):
+	case <-c.done:
+	}
+}
+
+func anyRejected(msgs []*message) bool {
+	for _, msg := range msgs {
+		if msg.rejected {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *client) String() string {
 	return "kafka(" + strings.Join(c.hosts, ",") + ")"
 }
@@ -385,16 +512,19 @@ func (r *msgRef) fail(msg *message, err error) {
 	case errors.Is(err, sarama.ErrInvalidMessage):
 		r.client.log.Errorf("Kafka (topic=%v): dropping invalid message", msg.topic)
 		r.client.observer.PermanentErrors(1)
+		msg.rejected = true
 
 	case errors.Is(err, sarama.ErrMessageSizeTooLarge) || errors.Is(err, sarama.ErrInvalidMessageSize):
 		r.client.log.Errorf("Kafka (topic=%v): dropping too large message of size %v.",
 			msg.topic,
 			len(msg.key)+len(msg.value))
 		r.client.observer.PermanentErrors(1)
+		msg.rejected = true
 
 	case isAuthError(err):
 		r.client.log.Errorf("Kafka (topic=%v): authorisation error: %s", msg.topic, err)
 		r.client.observer.PermanentErrors(1)
+		msg.rejected = true
 
 	case errors.Is(err, breaker.ErrBreakerOpen):
 		// Add this message to the failed list, but don't overwrite r.err since
@@ -419,6 +549,10 @@ func (r *msgRef) dec() {
 	}
 
 	r.client.log.Debug("finished kafka batch")
+	if r.txnDone != nil {
+		close(r.txnDone)
+		return
+	}
 	stats := r.client.observer
 
 	err := r.err
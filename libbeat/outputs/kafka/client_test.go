@@ -0,0 +1,343 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/format"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/outputs/outil"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/sarama"
+)
+
+// mockProducer is a transactional sarama.AsyncProducer that handles each
+// input message as set by the expectations, like the producer of the sarama
+// mocks package, and counts the committed and aborted transactions.
+type mockProducer struct {
+	t *testing.T
+
+	mu           sync.Mutex
+	expectations []producerExpectation
+	txnStatus    sarama.ProducerTxnStatusFlag
+	commits      int
+	aborts       int
+
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+	closed    chan struct{}
+}
+
+type producerExpectation struct {
+	check  func(val []byte) error
+	result error
+}
+
+var _ sarama.AsyncProducer = (*mockProducer)(nil)
+
+func newMockProducer(t *testing.T) *mockProducer {
+	p := &mockProducer{
+		t:         t,
+		txnStatus: sarama.ProducerTxnFlagReady,
+		input:     make(chan *sarama.ProducerMessage),
+		successes: make(chan *sarama.ProducerMessage),
+		errors:    make(chan *sarama.ProducerError),
+		closed:    make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *mockProducer) run() {
+	defer func() {
+		close(p.successes)
+		close(p.errors)
+		close(p.closed)
+	}()
+
+	for msg := range p.input {
+		p.mu.Lock()
+		inTxn := p.txnStatus&sarama.ProducerTxnFlagInTransaction != 0
+		var exp producerExpectation
+		ok := len(p.expectations) != 0
+		if ok {
+			exp, p.expectations = p.expectations[0], p.expectations[1:]
+		}
+		p.mu.Unlock()
+
+		if !inTxn {
+			p.t.Errorf("message sent outside of a transaction")
+		}
+		if !ok {
+			p.t.Errorf("no expectation set for the input message")
+			p.errors <- &sarama.ProducerError{Msg: msg, Err: sarama.ErrOutOfBrokers}
+			continue
+		}
+		if exp.check != nil {
+			val, err := msg.Value.Encode()
+			if err == nil {
+				err = exp.check(val)
+			}
+			if err != nil {
+				p.t.Errorf("check of the input message failed: %v", err)
+			}
+		}
+		if exp.result != nil {
+			p.errors <- &sarama.ProducerError{Msg: msg, Err: exp.result}
+			continue
+		}
+		p.successes <- msg
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.expectations) != 0 {
+		p.t.Errorf("expected to exhaust all expectations, but %d are left", len(p.expectations))
+	}
+}
+
+// ExpectInputAndSucceed sets an expectation that the next message is written.
+func (p *mockProducer) ExpectInputAndSucceed() {
+	p.expect(producerExpectation{})
+}
+
+// ExpectInputAndFail sets an expectation that the next message fails with err.
+func (p *mockProducer) ExpectInputAndFail(err error) {
+	p.expect(producerExpectation{result: err})
+}
+
+// ExpectInputWithCheckerFunctionAndSucceed sets an expectation that the next
+// message is written, and checks its value with check.
+func (p *mockProducer) ExpectInputWithCheckerFunctionAndSucceed(check func(val []byte) error) {
+	p.expect(producerExpectation{check: check})
+}
+
+func (p *mockProducer) expect(e producerExpectation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expectations = append(p.expectations, e)
+}
+
+func (p *mockProducer) AsyncClose() { close(p.input) }
+
+func (p *mockProducer) Close() error {
+	p.AsyncClose()
+	<-p.closed
+	return nil
+}
+
+func (p *mockProducer) Input() chan<- *sarama.ProducerMessage     { return p.input }
+func (p *mockProducer) Successes() <-chan *sarama.ProducerMessage { return p.successes }
+func (p *mockProducer) Errors() <-chan *sarama.ProducerError      { return p.errors }
+func (p *mockProducer) IsTransactional() bool                     { return true }
+
+func (p *mockProducer) TxnStatus() sarama.ProducerTxnStatusFlag {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.txnStatus
+}
+
+func (p *mockProducer) BeginTxn() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.txnStatus = sarama.ProducerTxnFlagInTransaction
+	return nil
+}
+
+func (p *mockProducer) CommitTxn() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.commits++
+	p.txnStatus = sarama.ProducerTxnFlagReady
+	return nil
+}
+
+func (p *mockProducer) AbortTxn() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.aborts++
+	p.txnStatus = sarama.ProducerTxnFlagReady
+	return nil
+}
+
+func (p *mockProducer) AddOffsetsToTxn(map[string][]*sarama.PartitionOffsetMetadata, string) error {
+	return nil
+}
+
+func (p *mockProducer) AddMessageToTxn(*sarama.ConsumerMessage, string, *string) error {
+	return nil
+}
+
+// newTransactionalTestClient returns a transactional client that writes the
+// message field of the events to a mock producer.
+func newTransactionalTestClient(t *testing.T) (*client, *mockProducer) {
+	t.Helper()
+	logger := logptest.NewTestingLogger(t, "")
+	cfg, err := readConfig(config.MustNewConfigFrom(mapstr.M{
+		"hosts": []string{"localhost:9092"},
+		"topic": "foo",
+		"transaction": mapstr.M{
+			"enabled": true,
+			"id":      "beats-txn",
+		},
+		// Keep the delay after an aborted transaction short.
+		"backoff": mapstr.M{"init": "1ms", "max": "1ms"},
+	}))
+	require.NoError(t, err)
+	libCfg, err := newSaramaConfig(logger, cfg)
+	require.NoError(t, err)
+
+	c, err := newKafkaClient(
+		outputs.NewNilObserver(),
+		cfg.Hosts,
+		"testbeat",
+		nil,
+		outil.MakeSelector(outil.ConstSelectorExpr("foo", outil.SelectorKeepCase)),
+		nil,
+		format.New(fmtstr.MustCompileEvent("%{[message]}")),
+		libCfg,
+		logger,
+	)
+	require.NoError(t, err)
+
+	// Connect with the mock producer instead of dialing the hosts.
+	producer := newMockProducer(t)
+	c.producer = producer
+	c.wg.Add(2)
+	go c.successWorker(producer.Successes())
+	go c.errorWorker(producer.Errors())
+	t.Cleanup(func() { c.Close() })
+
+	return c, producer
+}
+
+func newTestBatch(messages ...string) *outest.Batch {
+	events := make([]beat.Event, len(messages))
+	for i, msg := range messages {
+		events[i] = beat.Event{Fields: mapstr.M{"message": msg}}
+	}
+	return outest.NewBatch(events...)
+}
+
+// expectValue returns a mock producer checker for the encoded message value.
+func expectValue(want string) func(val []byte) error {
+	return func(val []byte) error {
+		if string(val) != want {
+			return fmt.Errorf("expected message %q, got %q", want, val)
+		}
+		return nil
+	}
+}
+
+func eventMessages(t *testing.T, events []publisher.Event) []string {
+	t.Helper()
+	messages := make([]string, len(events))
+	for i, e := range events {
+		msg, err := e.Content.Fields.GetValue("message")
+		require.NoError(t, err)
+		messages[i] = msg.(string)
+	}
+	return messages
+}
+
+func TestPublishTransactionCommit(t *testing.T) {
+	c, producer := newTransactionalTestClient(t)
+	for _, msg := range []string{"a", "b", "c"} {
+		producer.ExpectInputWithCheckerFunctionAndSucceed(expectValue(msg))
+	}
+
+	batch := newTestBatch("a", "b", "c")
+	require.NoError(t, c.Publish(context.Background(), batch))
+
+	assert.Equal(t, 1, producer.commits)
+	assert.Equal(t, 0, producer.aborts)
+	assert.Equal(t, sarama.ProducerTxnFlagReady, producer.TxnStatus())
+	assert.Equal(t, []outest.BatchSignal{{Tag: outest.BatchACK}}, batch.Signals)
+}
+
+func TestPublishTransactionAbort(t *testing.T) {
+	tests := map[string]struct {
+		err       error
+		wantRetry []string
+	}{
+		"retryable error": {
+			err:       sarama.ErrNotLeaderForPartition,
+			wantRetry: []string{"a", "b", "c"},
+		},
+		"rejected message": {
+			err:       sarama.ErrMessageSizeTooLarge,
+			wantRetry: []string{"a", "c"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, producer := newTransactionalTestClient(t)
+			producer.ExpectInputAndSucceed()
+			producer.ExpectInputAndFail(tc.err)
+			producer.ExpectInputAndSucceed()
+
+			batch := newTestBatch("a", "b", "c")
+			require.NoError(t, c.Publish(context.Background(), batch))
+
+			assert.Equal(t, 0, producer.commits, "a partially failed transaction must not be committed")
+			assert.Equal(t, 1, producer.aborts)
+			assert.Equal(t, sarama.ProducerTxnFlagReady, producer.TxnStatus())
+			require.Len(t, batch.Signals, 1)
+			assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+			assert.Equal(t, tc.wantRetry, eventMessages(t, batch.Signals[0].Events))
+		})
+	}
+}
+
+func TestPublishTransactionRetryAfterAbort(t *testing.T) {
+	c, producer := newTransactionalTestClient(t)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+
+	batch := newTestBatch("a", "b")
+	require.NoError(t, c.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	require.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Equal(t, 1, c.txnFailures)
+
+	// The pipeline hands the retried events back to the output as a new
+	// batch, which is written as a whole in a new transaction.
+	retry := newTestBatch(eventMessages(t, batch.Signals[0].Events)...)
+	producer.ExpectInputWithCheckerFunctionAndSucceed(expectValue("a"))
+	producer.ExpectInputWithCheckerFunctionAndSucceed(expectValue("b"))
+	require.NoError(t, c.Publish(context.Background(), retry))
+
+	assert.Equal(t, 1, producer.aborts)
+	assert.Equal(t, 1, producer.commits)
+	assert.Equal(t, 0, c.txnFailures, "a committed transaction must reset the backoff")
+	assert.Equal(t, []outest.BatchSignal{{Tag: outest.BatchACK}}, retry.Signals)
+}
@@ -76,6 +76,8 @@ type kafkaConfig struct {
 	Codec              codec.Config              `config:"codec"`
 	Sasl               kafka.SaslConfig          `config:"sasl"`
 	EnableFAST         bool                      `config:"enable_krb5_fast"`
+	Idempotent         bool                      `config:"idempotent"`
+	Transaction        transactionConfig         `config:"transaction"`
 	Queue              config.Namespace          `config:"queue"`
 
 	// Currently only used for validation. Those values are later
@@ -84,6 +86,14 @@ type kafkaConfig struct {
 	Topics []any  `config:"topics"`
 }
 
+// transactionConfig configures Kafka transactions. When enabled, each batch
+// is written in its own transaction.
+type transactionConfig struct {
+	Enabled bool          `config:"enabled"`
+	ID      string        `config:"id"`
+	Timeout time.Duration `config:"timeout" validate:"min=1"`
+}
+
 type metaConfig struct {
 	Retry       metaRetryConfig `config:"retry"`
 	RefreshFreq time.Duration   `config:"refresh_frequency" validate:"min=0"`
@@ -146,6 +156,9 @@ func defaultConfig() kafkaConfig {
 		ChanBufferSize: 256,
 		Username:       "",
 		Password:       "",
+		Transaction: transactionConfig{
+			Timeout: 60 * time.Second,
+		},
 	}
 }
 
@@ -181,6 +194,20 @@ func (c *kafkaConfig) Validate() error {
 		}
 	}
 
+	if c.Transaction.Enabled && c.Transaction.ID == "" {
+		return errors.New("transaction.id must be set when transactions are enabled")
+	}
+
+	if c.idempotent() {
+		version, _ := c.Version.Get()
+		if !version.IsAtLeast(sarama.V0_11_0_0) {
+			return fmt.Errorf("idempotent and transactional producers require kafka version 0.11 or newer, got %v", c.Version)
+		}
+		if c.RequiredACKs != nil && *c.RequiredACKs != int(sarama.WaitForAll) {
+			return errors.New("required_acks must be -1 when the idempotent or transactional producer is enabled")
+		}
+	}
+
 	if c.Topic == "" && len(c.Topics) == 0 {
 		return errors.New("either 'topic' or 'topics' must be defined")
 	}
@@ -197,6 +224,12 @@ func (c *kafkaConfig) Validate() error {
 	return nil
 }
 
+// idempotent reports whether the idempotent producer must be used. It is
+// required by transactions and implicitly enabled with them.
+func (c *kafkaConfig) idempotent() bool {
+	return c.Idempotent || c.Transaction.Enabled
+}
+
 func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, error) {
 	partitioner, err := makePartitioner(log, config.Partition)
 	if err != nil {
@@ -286,6 +319,20 @@ func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, err
 	k.Producer.Retry.Max = retryMax
 	k.Producer.Retry.BackoffFunc = makeBackoffFunc(config.Backoff)
 
+	// The idempotent producer lets the brokers discard duplicates caused by
+	// retries. Sarama requires acknowledgements from all in-sync replicas
+	// and a single in-flight request per broker connection to keep the
+	// sequence numbers ordered.
+	if config.idempotent() {
+		k.Producer.Idempotent = true
+		k.Producer.RequiredAcks = sarama.WaitForAll
+		k.Net.MaxOpenRequests = 1
+	}
+	if config.Transaction.Enabled {
+		k.Producer.Transaction.ID = config.Transaction.ID
+		k.Producer.Transaction.Timeout = config.Transaction.Timeout
+	}
+
 	// configure per broker go channel buffering
 	k.ChannelBufferSize = config.ChanBufferSize
 
@@ -313,6 +360,8 @@ func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, err
 		adapter.Rename("outgoing-byte-rate", "write.bytes"),
 		adapter.Rename("request-latency-in-ms", "write.latency"),
 		adapter.Rename("requests-in-flight", "kafka.requests-in-flight"),
+		adapter.Rename(metricTransactionsCommitted, "kafka.transactions.committed"),
+		adapter.Rename(metricTransactionsAborted, "kafka.transactions.aborted"),
 		adapter.GoMetricsNilify,
 	)
 
@@ -29,6 +29,7 @@ import (
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp/logptest"
 	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/sarama"
 )
 
 func TestConfigAcceptValid(t *testing.T) {
@@ -43,6 +44,18 @@ func TestConfigAcceptValid(t *testing.T) {
 			"version":     "1.0.0",
 			"topic":       "foo",
 		},
+		"idempotent producer": mapstr.M{
+			"idempotent": true,
+			"topic":      "foo",
+		},
+		"transactional producer": mapstr.M{
+			"transaction": mapstr.M{
+				"enabled": true,
+				"id":      "beats-txn",
+			},
+			"required_acks": -1,
+			"topic":         "foo",
+		},
 	}
 
 	for name, test := range tests {
@@ -76,6 +89,20 @@ func TestConfigInvalid(t *testing.T) {
 		},
 		// The default config does not set `topic` nor `topics`.
 		"No topics or topic provided": mapstr.M{},
+		"transaction without id": mapstr.M{
+			"transaction": mapstr.M{"enabled": true},
+			"topic":       "foo",
+		},
+		"idempotent with old kafka version": mapstr.M{
+			"idempotent": true,
+			"version":    "0.10.2",
+			"topic":      "foo",
+		},
+		"idempotent without acks from all replicas": mapstr.M{
+			"idempotent":    true,
+			"required_acks": 1,
+			"topic":         "foo",
+		},
 	}
 
 	for name, test := range tests {
@@ -93,6 +120,41 @@ func TestConfigInvalid(t *testing.T) {
 	}
 }
 
+func TestTransactionalSaramaConfig(t *testing.T) {
+	c := config.MustNewConfigFrom(mapstr.M{
+		"hosts": []string{"localhost"},
+		"topic": "foo",
+		"transaction": mapstr.M{
+			"enabled": true,
+			"id":      "beats-txn",
+		},
+	})
+	cfg, err := readConfig(c)
+	if err != nil {
+		t.Fatalf("Can not create test configuration: %v", err)
+	}
+	libCfg, err := newSaramaConfig(logptest.NewTestingLogger(t, ""), cfg)
+	if err != nil {
+		t.Fatalf("Failure creating sarama config: %v", err)
+	}
+
+	if !libCfg.Producer.Idempotent {
+		t.Error("transactions must enable the idempotent producer")
+	}
+	if libCfg.Producer.RequiredAcks != sarama.WaitForAll {
+		t.Errorf("expected required acks %v, got %v", sarama.WaitForAll, libCfg.Producer.RequiredAcks)
+	}
+	if libCfg.Net.MaxOpenRequests != 1 {
+		t.Errorf("expected a single open request per broker, got %v", libCfg.Net.MaxOpenRequests)
+	}
+	if libCfg.Producer.Transaction.ID != "beats-txn" {
+		t.Errorf("expected transaction id beats-txn, got %q", libCfg.Producer.Transaction.ID)
+	}
+	if libCfg.Producer.Transaction.Timeout != 60*time.Second {
+		t.Errorf("expected transaction timeout of 60s, got %v", libCfg.Producer.Transaction.Timeout)
+	}
+}
+
 func TestConfigUnderElasticAgent(t *testing.T) {
 	oldUnderAgent := management.UnderAgent()
 	t.Cleanup(func() {
@@ -36,6 +36,10 @@ type message struct {
 	hash      uint32
 	partition int32
 
+	// rejected is set if Kafka permanently rejected the message, so it
+	// must not be retried if its transaction is aborted.
+	rejected bool
+
 	data publisher.Event
 }
 
@@ -20,28 +20,19 @@ package otelconsumer
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
-	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/otelbeat/otelmap"
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
-	"github.com/elastic/elastic-agent-libs/mapstr"
 
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/consumer/consumererror"
-	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/plog"
 )
 
-const (
-	// esDocumentIDAttribute is the attribute key used to store the document ID in the log record.
-	esDocumentIDAttribute = "elasticsearch.document_id"
-)
-
 func init() {
 	outputs.RegisterType("otelconsumer", makeOtelConsumer)
 }
@@ -91,71 +82,10 @@ func (out *otelConsumer) logsPublish(ctx context.Context, batch publisher.Batch)
 	sourceLogs := resourceLogs.ScopeLogs().AppendEmpty()
 	logRecords := sourceLogs.LogRecords()
 
-	// Convert the batch of events to Otel plog.Logs. The encoding we
-	// choose here is to set all fields in a Map in the Body of the log
-	// record. Each log record encodes a single beats event.
-	// This way we have full control over the final structure of the log in the
-	// destination, as long as the exporter allows it.
-	// For example, the elasticsearchexporter has an encoding specifically for this.
-	// See https://github.com/open-telemetry/opentelemetry-collector-contrib/issues/35444.
+	// Convert the batch of events to Otel plog.Logs.
 	events := batch.Events()
-	for _, event := range events {
-		logRecord := logRecords.AppendEmpty()
-
-		if id, ok := event.Content.Meta["_id"]; ok {
-			// Specify the id as an attribute used by the elasticsearchexporter
-			// to set the final document ID in Elasticsearch.
-			// When using the bodymap encoding in the exporter all attributes
-			// are stripped out of the final Elasticsearch document.
-			//
-			// See https://github.com/open-telemetry/opentelemetry-collector-contrib/issues/36882.
-			switch id := id.(type) {
-			case string:
-				logRecord.Attributes().PutStr(esDocumentIDAttribute, id)
-			}
-		}
-
-		beatEvent := event.Content.Fields
-		if beatEvent == nil {
-			beatEvent = mapstr.M{}
-		}
-		beatEvent["@timestamp"] = event.Content.Timestamp
-		logRecord.SetTimestamp(pcommon.NewTimestampFromTime(event.Content.Timestamp))
-
-		// Set the timestamp for when the event was first seen by the pipeline.
-		observedTimestamp := logRecord.Timestamp()
-		if created, err := beatEvent.GetValue("event.created"); err == nil {
-			switch created := created.(type) {
-			case time.Time:
-				observedTimestamp = pcommon.NewTimestampFromTime(created)
-			case common.Time:
-				observedTimestamp = pcommon.NewTimestampFromTime(time.Time(created))
-			default:
-				out.log.Warnf("Invalid 'event.created' type (%T); using log timestamp as observed timestamp.", created)
-			}
-		}
-		logRecord.SetObservedTimestamp(observedTimestamp)
-
-		otelmap.ConvertNonPrimitive(beatEvent)
-
-		// if data_stream field is set on beatEvent. Add it to logrecord.Attributes to support dynamic indexing
-		if val, _ := beatEvent.GetValue("data_stream"); val != nil {
-			// If the below sub fields do not exist, it will return empty string.
-			var subFields = []string{"dataset", "namespace", "type"}
-
-			for _, subField := range subFields {
-				// value, ok := data.Map().Get(subField)
-				value, err := beatEvent.GetValue("data_stream." + subField)
-				if vStr, ok := value.(string); ok && err == nil {
-					// set log record attribute only if value is non empty
-					logRecord.Attributes().PutStr("data_stream."+subField, vStr)
-				}
-			}
-
-		}
-		if err := logRecord.Body().SetEmptyMap().FromRaw(map[string]any(beatEvent)); err != nil {
-			out.log.Errorf("received an error while converting map to plog.Log, some fields might be missing: %v", err)
-		}
+	for i := range events {
+		otelmap.ToLogRecord(out.log, &events[i].Content, logRecords.AppendEmpty())
 	}
 
 	err := out.logsConsumer.ConsumeLogs(ctx, pLogs)
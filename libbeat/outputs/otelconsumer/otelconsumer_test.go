@@ -32,6 +32,7 @@ import (
 	"go.opentelemetry.io/collector/pdata/plog"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/otelbeat/otelmap"
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/outputs/outest"
 	"github.com/elastic/elastic-agent-libs/logp/logptest"
@@ -167,7 +168,7 @@ func TestPublish(t *testing.T) {
 		var docID string
 		otelConsumer := makeOtelConsumer(t, func(ctx context.Context, ld plog.Logs) error {
 			record := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
-			attr, ok := record.Attributes().Get(esDocumentIDAttribute)
+			attr, ok := record.Attributes().Get(otelmap.ESDocumentIDAttribute)
 			assert.True(t, ok, "document ID attribute should be set")
 			docID = attr.AsString()
 
@@ -0,0 +1,160 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/otelbeat/otelmap"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/testing"
+)
+
+const scopeName = "github.com/elastic/beats/v7/libbeat/outputs/otlp"
+
+// exporter sends OTLP export requests to a single endpoint. Errors wrapped
+// with consumererror.NewPermanent must not be retried.
+type exporter interface {
+	Connect(context.Context) error
+	Close() error
+	Export(context.Context, plogotlp.ExportRequest) (plogotlp.ExportResponse, error)
+	String() string
+}
+
+type client struct {
+	log      *logp.Logger
+	observer outputs.Observer
+	beatInfo beat.Info
+	exporter exporter
+}
+
+func newClient(log *logp.Logger, observer outputs.Observer, beatInfo beat.Info, exp exporter) *client {
+	return &client{
+		log:      log,
+		observer: observer,
+		beatInfo: beatInfo,
+		exporter: exp,
+	}
+}
+
+func (c *client) Connect(ctx context.Context) error {
+	return c.exporter.Connect(ctx)
+}
+
+func (c *client) Close() error {
+	return c.exporter.Close()
+}
+
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	req := plogotlp.NewExportRequestFromLogs(c.toLogs(events))
+
+	begin := time.Now()
+	resp, err := c.exporter.Export(ctx, req)
+	if err != nil {
+		if consumererror.IsPermanent(err) {
+			// The endpoint refused the request and retrying it is useless,
+			// but the connection itself is fine.
+			c.log.Errorf("Dropping %d events rejected by %s: %v", len(events), c.exporter, err)
+			c.observer.PermanentErrors(len(events))
+			batch.Drop()
+			return nil
+		}
+
+		c.observer.RetryableErrors(len(events))
+		batch.Retry()
+		return fmt.Errorf("failed to export logs to %s: %w", c.exporter, err)
+	}
+	c.observer.ReportLatency(time.Since(begin))
+
+	// On partial success the endpoint has accepted the request but rejected
+	// some records. The OTLP specification forbids retrying those and does not
+	// say which ones they were, so the batch is acknowledged and the rejected
+	// records are reported as permanent errors.
+	acked := len(events)
+	partial := resp.PartialSuccess()
+	if rejected := int(partial.RejectedLogRecords()); rejected > 0 {
+		rejected = min(rejected, len(events))
+		c.log.Warnf("%s rejected %d of %d log records: %s", c.exporter, rejected, len(events), partial.ErrorMessage())
+		c.observer.PermanentErrors(rejected)
+		acked -= rejected
+	} else if msg := partial.ErrorMessage(); msg != "" {
+		c.log.Warnf("%s accepted all log records with a warning: %s", c.exporter, msg)
+	}
+
+	c.observer.AckedEvents(acked)
+	batch.ACK()
+	return nil
+}
+
+// toLogs converts the events of a batch into a single resource and scope.
+func (c *client) toLogs(events []publisher.Event) plog.Logs {
+	logs := plog.NewLogs()
+	resourceLogs := logs.ResourceLogs().AppendEmpty()
+	attrs := resourceLogs.Resource().Attributes()
+	if c.beatInfo.Beat != "" {
+		attrs.PutStr("service.name", c.beatInfo.Beat)
+	}
+	if c.beatInfo.Version != "" {
+		attrs.PutStr("service.version", c.beatInfo.Version)
+	}
+	if c.beatInfo.Hostname != "" {
+		attrs.PutStr("host.name", c.beatInfo.Hostname)
+	}
+
+	scopeLogs := resourceLogs.ScopeLogs().AppendEmpty()
+	scopeLogs.Scope().SetName(scopeName)
+	scopeLogs.Scope().SetVersion(c.beatInfo.Version)
+
+	logRecords := scopeLogs.LogRecords()
+	logRecords.EnsureCapacity(len(events))
+	for i := range events {
+		otelmap.ToLogRecord(c.log, &events[i].Content, logRecords.AppendEmpty())
+	}
+	return logs
+}
+
+func (c *client) String() string {
+	return "otlp(" + c.exporter.String() + ")"
+}
+
+func (c *client) Test(d testing.Driver) {
+	d.Run("otlp: "+c.exporter.String(), func(d testing.Driver) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d.Fatal("connect", c.exporter.Connect(ctx))
+		defer c.exporter.Close()
+
+		// An empty export request is valid and checks that the endpoint
+		// speaks OTLP without sending any data.
+		_, err := c.exporter.Export(ctx, plogotlp.NewExportRequest())
+		d.Fatal("talk to server", err)
+	})
+}
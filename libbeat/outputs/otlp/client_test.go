@@ -0,0 +1,233 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package otlp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type fakeExporter struct {
+	logs   []plog.Logs
+	export func(plogotlp.ExportRequest) (plogotlp.ExportResponse, error)
+}
+
+func (e *fakeExporter) Connect(context.Context) error { return nil }
+func (e *fakeExporter) Close() error                  { return nil }
+func (e *fakeExporter) String() string                { return "fake" }
+
+func (e *fakeExporter) Export(_ context.Context, req plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	e.logs = append(e.logs, req.Logs())
+	if e.export != nil {
+		return e.export(req)
+	}
+	return plogotlp.NewExportResponse(), nil
+}
+
+func testBatch() *outest.Batch {
+	return outest.NewBatch(
+		beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": "one"}},
+		beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": "two"}},
+	)
+}
+
+func TestPublish(t *testing.T) {
+	info := beat.Info{Beat: "testbeat", Version: "9.9.9"}
+	partial := func(rejected int64) plogotlp.ExportResponse {
+		resp := plogotlp.NewExportResponse()
+		resp.PartialSuccess().SetRejectedLogRecords(rejected)
+		resp.PartialSuccess().SetErrorMessage("bad record")
+		return resp
+	}
+
+	tests := map[string]struct {
+		export  func(plogotlp.ExportRequest) (plogotlp.ExportResponse, error)
+		wantErr bool
+		want    outest.BatchSignalTag
+	}{
+		"success": {
+			want: outest.BatchACK,
+		},
+		"partial success is acknowledged": {
+			export: func(plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+				return partial(1), nil
+			},
+			want: outest.BatchACK,
+		},
+		"retryable error": {
+			export: func(plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+				return plogotlp.NewExportResponse(), errors.New("unavailable")
+			},
+			wantErr: true,
+			want:    outest.BatchRetry,
+		},
+		"permanent error": {
+			export: func(plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+				return plogotlp.NewExportResponse(), consumererror.NewPermanent(errors.New("bad request"))
+			},
+			want: outest.BatchDrop,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			exp := &fakeExporter{export: tc.export}
+			c := newClient(logptest.NewTestingLogger(t, ""), outputs.NewNilObserver(), info, exp)
+
+			batch := testBatch()
+			err := c.Publish(context.Background(), batch)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			require.Len(t, batch.Signals, 1)
+			assert.Equal(t, tc.want, batch.Signals[0].Tag)
+
+			require.Len(t, exp.logs, 1)
+			rl := exp.logs[0].ResourceLogs().At(0)
+			name, _ := rl.Resource().Attributes().Get("service.name")
+			assert.Equal(t, "testbeat", name.Str())
+			records := rl.ScopeLogs().At(0).LogRecords()
+			require.Equal(t, 2, records.Len())
+			msg, ok := records.At(1).Body().Map().Get("message")
+			require.True(t, ok)
+			assert.Equal(t, "two", msg.Str())
+		})
+	}
+}
+
+func TestHTTPExporter(t *testing.T) {
+	tests := map[string]struct {
+		status      int
+		compression string
+		wantErr     bool
+		permanent   bool
+	}{
+		"ok":                  {status: http.StatusOK, compression: compressionNone},
+		"ok with compression": {status: http.StatusOK, compression: compressionGzip},
+		"unavailable":         {status: http.StatusServiceUnavailable, wantErr: true},
+		"bad request":         {status: http.StatusBadRequest, wantErr: true, permanent: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/v1/logs", r.URL.Path)
+				assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+				if tc.compression == compressionGzip {
+					assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+				}
+				w.WriteHeader(tc.status)
+				if tc.status == http.StatusOK {
+					resp := plogotlp.NewExportResponse()
+					resp.PartialSuccess().SetRejectedLogRecords(1)
+					data, err := resp.MarshalProto()
+					require.NoError(t, err)
+					_, _ = w.Write(data)
+				}
+			}))
+			defer srv.Close()
+
+			exp := &httpExporter{
+				url:         srv.URL + defaultHTTPPath,
+				compression: tc.compression,
+				client:      srv.Client(),
+			}
+			resp, err := exp.Export(context.Background(), plogotlp.NewExportRequest())
+			if !tc.wantErr {
+				require.NoError(t, err)
+				assert.Equal(t, int64(1), resp.PartialSuccess().RejectedLogRecords())
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tc.permanent, consumererror.IsPermanent(err))
+		})
+	}
+}
+
+type testGRPCServer struct {
+	plogotlp.UnimplementedGRPCServer
+	err      error
+	received int
+}
+
+func (s *testGRPCServer) Export(_ context.Context, req plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	s.received += req.Logs().LogRecordCount()
+	return plogotlp.NewExportResponse(), s.err
+}
+
+func TestGRPCExporter(t *testing.T) {
+	tests := map[string]struct {
+		err       error
+		permanent bool
+	}{
+		"ok":          {},
+		"unavailable": {err: status.Error(codes.Unavailable, "try later")},
+		"invalid":     {err: status.Error(codes.InvalidArgument, "bad data"), permanent: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			impl := &testGRPCServer{err: tc.err}
+			srv := grpc.NewServer()
+			plogotlp.RegisterGRPCServer(srv, impl)
+			go func() { _ = srv.Serve(lis) }()
+			defer srv.Stop()
+
+			exp := newGRPCExporter(lis.Addr().String(), nil, map[string]string{"x-test": "1"}, compressionGzip, 5*time.Second)
+			require.NoError(t, exp.Connect(context.Background()))
+			defer exp.Close()
+
+			logs := plog.NewLogs()
+			logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+			_, err = exp.Export(context.Background(), plogotlp.NewExportRequestFromLogs(logs))
+			if tc.err == nil {
+				require.NoError(t, err)
+				assert.Equal(t, 1, impl.received)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tc.permanent, consumererror.IsPermanent(err))
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+const (
+	protocolGRPC = "grpc"
+	protocolHTTP = "http"
+
+	compressionNone = "none"
+	compressionGzip = "gzip"
+
+	defaultGRPCPort = 4317
+	defaultHTTPPort = 4318
+	defaultHTTPPath = "/v1/logs"
+)
+
+type otlpConfig struct {
+	Protocol    string            `config:"protocol"`
+	Path        string            `config:"path"`
+	Headers     map[string]string `config:"headers"`
+	Compression string            `config:"compression"`
+	LoadBalance bool              `config:"loadbalance"`
+	BulkMaxSize int               `config:"bulk_max_size"`
+	MaxRetries  int               `config:"max_retries"`
+	Backoff     backoff           `config:"backoff"`
+	Queue       config.Namespace  `config:"queue"`
+
+	// Transport holds the TLS, proxy and timeout settings. The gRPC exporter
+	// only uses the TLS and timeout settings.
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+func defaultConfig() otlpConfig {
+	transport := httpcommon.DefaultHTTPTransportSettings()
+	transport.Timeout = 30 * time.Second
+	return otlpConfig{
+		Protocol:    protocolGRPC,
+		Path:        defaultHTTPPath,
+		Compression: compressionGzip,
+		LoadBalance: true,
+		BulkMaxSize: 1600,
+		MaxRetries:  3,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+		Transport: transport,
+	}
+}
+
+func (c *otlpConfig) Validate() error {
+	switch c.Protocol {
+	case protocolGRPC, protocolHTTP:
+	default:
+		return fmt.Errorf("unsupported protocol %q, must be one of %s or %s", c.Protocol, protocolGRPC, protocolHTTP)
+	}
+
+	switch c.Compression {
+	case compressionNone, compressionGzip:
+	default:
+		return fmt.Errorf("unsupported compression %q, must be one of %s or %s", c.Compression, compressionNone, compressionGzip)
+	}
+
+	return nil
+}
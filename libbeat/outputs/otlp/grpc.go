@@ -0,0 +1,130 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+// grpcExporter sends export requests using OTLP/gRPC.
+type grpcExporter struct {
+	endpoint    string
+	tls         *tlscommon.TLSConfig
+	headers     metadata.MD
+	compression string
+	timeout     time.Duration
+
+	conn   *grpc.ClientConn
+	client plogotlp.GRPCClient
+}
+
+func newGRPCExporter(endpoint string, tls *tlscommon.TLSConfig, headers map[string]string, compression string, timeout time.Duration) *grpcExporter {
+	return &grpcExporter{
+		endpoint:    endpoint,
+		tls:         tls,
+		headers:     metadata.New(headers),
+		compression: compression,
+		timeout:     timeout,
+	}
+}
+
+func (e *grpcExporter) Connect(_ context.Context) error {
+	creds := insecure.NewCredentials()
+	if e.tls != nil {
+		host, _, err := net.SplitHostPort(e.endpoint)
+		if err != nil {
+			return err
+		}
+		creds = credentials.NewTLS(e.tls.BuildModuleClientConfig(host))
+	}
+
+	conn, err := grpc.NewClient(e.endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	e.conn = conn
+	e.client = plogotlp.NewGRPCClient(conn)
+	return nil
+}
+
+func (e *grpcExporter) Close() error {
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn, e.client = nil, nil
+	return err
+}
+
+func (e *grpcExporter) Export(ctx context.Context, req plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+	if len(e.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, e.headers)
+	}
+
+	var opts []grpc.CallOption
+	if e.compression == compressionGzip {
+		opts = append(opts, grpc.UseCompressor(gzip.Name))
+	}
+
+	resp, err := e.client.Export(ctx, req, opts...)
+	if err != nil && !retryableGRPCCode(status.Code(err)) {
+		return resp, consumererror.NewPermanent(err)
+	}
+	return resp, err
+}
+
+func (e *grpcExporter) String() string {
+	return "grpc://" + e.endpoint
+}
+
+// retryableGRPCCode reports whether a failed export may be retried, following
+// the OTLP specification. ResourceExhausted is treated as retryable since the
+// pipeline backoff already throttles further requests.
+func retryableGRPCCode(code codes.Code) bool {
+	switch code {
+	case codes.Canceled,
+		codes.DeadlineExceeded,
+		codes.Aborted,
+		codes.OutOfRange,
+		codes.Unavailable,
+		codes.DataLoss,
+		codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,133 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/klauspost/compress/gzip"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+)
+
+// maxResponseSize limits how much of a response body is read.
+const maxResponseSize = 64 * 1024
+
+// httpExporter sends export requests using OTLP/HTTP with binary protobuf
+// encoding.
+type httpExporter struct {
+	url         string
+	headers     map[string]string
+	compression string
+	client      *http.Client
+}
+
+func (e *httpExporter) Connect(_ context.Context) error {
+	return nil
+}
+
+func (e *httpExporter) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+func (e *httpExporter) Export(ctx context.Context, req plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	resp := plogotlp.NewExportResponse()
+
+	body, err := req.MarshalProto()
+	if err != nil {
+		return resp, consumererror.NewPermanent(fmt.Errorf("failed to marshal export request: %w", err))
+	}
+	if e.compression == compressionGzip {
+		if body, err = gzipBody(body); err != nil {
+			return resp, err
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return resp, consumererror.NewPermanent(err)
+	}
+	for k, v := range e.headers {
+		httpReq.Header.Set(k, v)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	if e.compression == compressionGzip {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+
+	httpResp, err := e.client.Do(httpReq)
+	if err != nil {
+		return resp, err
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(httpResp.Body, maxResponseSize))
+	if err != nil {
+		return resp, err
+	}
+
+	if httpResp.StatusCode >= 200 && httpResp.StatusCode < 300 {
+		if len(data) > 0 {
+			if err := resp.UnmarshalProto(data); err != nil {
+				return resp, fmt.Errorf("failed to unmarshal export response: %w", err)
+			}
+		}
+		return resp, nil
+	}
+
+	err = fmt.Errorf("%s responded with status %d", e.url, httpResp.StatusCode)
+	if retryableHTTPStatus(httpResp.StatusCode) {
+		return resp, err
+	}
+	return resp, consumererror.NewPermanent(err)
+}
+
+func (e *httpExporter) String() string {
+	return e.url
+}
+
+// retryableHTTPStatus reports whether a failed export may be retried,
+// following the OTLP specification.
+func retryableHTTPStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
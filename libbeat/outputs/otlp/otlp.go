@@ -0,0 +1,141 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+func init() {
+	outputs.RegisterType("otlp", makeOTLP)
+}
+
+const logSelector = "otlp"
+
+func makeOTLP(
+	_ outputs.IndexManager,
+	beatInfo beat.Info,
+	observer outputs.Observer,
+	cfg *config.C,
+) (outputs.Group, error) {
+	log := beatInfo.Logger.Named(logSelector)
+
+	otlpConfig := defaultConfig()
+	if err := cfg.Unpack(&otlpConfig); err != nil {
+		return outputs.Fail(err)
+	}
+
+	hosts, err := outputs.ReadHostList(cfg)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	tls, err := tlscommon.LoadTLSConfig(otlpConfig.Transport.TLS)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	clients := make([]outputs.NetworkClient, len(hosts))
+	for i, host := range hosts {
+		var exp exporter
+		switch otlpConfig.Protocol {
+		case protocolGRPC:
+			exp, err = makeGRPCExporter(host, tls, otlpConfig)
+		case protocolHTTP:
+			exp, err = makeHTTPExporter(host, tls, otlpConfig, observer, beatInfo)
+		}
+		if err != nil {
+			log.Errorf("Invalid host param set: %s, Error: %+v", host, err)
+			return outputs.Fail(err)
+		}
+
+		var client outputs.NetworkClient = newClient(log, observer, beatInfo, exp)
+		client = outputs.WithBackoff(client, otlpConfig.Backoff.Init, otlpConfig.Backoff.Max)
+		clients[i] = client
+	}
+
+	return outputs.SuccessNet(otlpConfig.Queue, otlpConfig.LoadBalance, otlpConfig.BulkMaxSize, otlpConfig.MaxRetries, nil, clients)
+}
+
+func makeGRPCExporter(host string, tls *tlscommon.TLSConfig, c otlpConfig) (exporter, error) {
+	scheme := "http"
+	if tls != nil {
+		scheme = "https"
+	}
+	rawURL, err := common.MakeURL(scheme, "", host, defaultGRPCPort)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http":
+		tls = nil // disable TLS if the user explicitly set the `http` scheme
+	case "https":
+		if tls == nil {
+			tls = &tlscommon.TLSConfig{} // enable with system defaults if TLS was not configured
+		}
+	default:
+		return nil, fmt.Errorf("invalid otlp url scheme %s", u.Scheme)
+	}
+
+	return newGRPCExporter(u.Host, tls, c.Headers, c.Compression, c.Transport.Timeout), nil
+}
+
+func makeHTTPExporter(host string, tls *tlscommon.TLSConfig, c otlpConfig, observer outputs.Observer, beatInfo beat.Info) (exporter, error) {
+	scheme := "http"
+	if tls != nil {
+		scheme = "https"
+	}
+	rawURL, err := common.MakeURL(scheme, c.Path, host, defaultHTTPPort)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{}
+	if beatInfo.UserAgent != "" {
+		headers["User-Agent"] = beatInfo.UserAgent
+	}
+	httpClient, err := c.Transport.Client(
+		httpcommon.WithLogger(beatInfo.Logger.Named(logSelector)),
+		httpcommon.WithIOStats(observer),
+		httpcommon.WithKeepaliveSettings{IdleConnTimeout: c.Transport.IdleConnTimeout},
+		httpcommon.WithHeaderRoundTripper(headers),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpExporter{
+		url:         rawURL,
+		headers:     c.Headers,
+		compression: c.Compression,
+		client:      httpClient,
+	}, nil
+}
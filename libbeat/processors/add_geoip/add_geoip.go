@@ -0,0 +1,258 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package add_geoip
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const (
+	procName = "add_geoip"
+	logName  = "processor." + procName
+)
+
+func init() {
+	processors.RegisterPlugin(procName, New)
+	jsprocessor.RegisterPlugin("AddGeoIP", New)
+}
+
+type processor struct {
+	config
+	log       *logp.Logger
+	databases []*databaseFile
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// New constructs a new add_geoip processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v processor configuration: %w", procName, err)
+	}
+
+	return newAddGeoIP(c, logp.NewLogger(logName))
+}
+
+func newAddGeoIP(c config, log *logp.Logger) (*processor, error) {
+	p := &processor{config: c, log: log}
+	for _, path := range c.Databases {
+		f, err := loadDatabaseFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load GeoIP database: %w", err)
+		}
+		p.databases = append(p.databases, f)
+	}
+
+	if c.ReloadInterval > 0 {
+		p.done = make(chan struct{})
+		p.wg.Add(1)
+		go p.reloadLoop()
+	}
+	return p, nil
+}
+
+func (p *processor) String() string {
+	json, _ := json.Marshal(p.config)
+	return procName + "=" + string(json)
+}
+
+// Run adds the geo and as fields of the configured IP addresses.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	var errs []error
+	for _, field := range p.Fields {
+		if err := p.enrich(event, field); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 && !p.IgnoreFailure {
+		return event, errors.Join(errs...)
+	}
+	return event, nil
+}
+
+func (p *processor) enrich(event *beat.Event, field fieldConfig) error {
+	v, err := event.GetValue(field.From)
+	if err != nil {
+		if p.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return nil
+		}
+		return fmt.Errorf("%v source field [%v] not found: %w", procName, field.From, err)
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("%v source field [%v] is not a string", procName, field.From)
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return fmt.Errorf("%v source field [%v] is not an IP address: %q", procName, field.From, s)
+	}
+
+	target := field.target()
+	for _, f := range p.databases {
+		record, err := f.database().lookup(ip)
+		if err != nil {
+			return fmt.Errorf("failed to look up %v in GeoIP database %v: %w", s, f.path, err)
+		}
+		if record == nil {
+			continue
+		}
+		if err := putFields(event, target+".geo", geoFields(record, p.Language)); err != nil {
+			return err
+		}
+		if err := putFields(event, target+".as", asFields(record)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putFields adds the fields under prefix, keeping the other fields already
+// under prefix.
+func putFields(event *beat.Event, prefix string, fields mapstr.M) error {
+	for k, v := range fields {
+		if _, err := event.PutValue(prefix+"."+k, v); err != nil {
+			return fmt.Errorf("failed to write to target field [%v]: %w", prefix, err)
+		}
+	}
+	return nil
+}
+
+// geoFields returns the ECS geo fields of a City or Country database
+// record.
+func geoFields(record map[string]interface{}, language string) mapstr.M {
+	geo := mapstr.M{}
+	if city := asMap(record["city"]); city != nil {
+		putName(geo, "city_name", city, language)
+	}
+	if continent := asMap(record["continent"]); continent != nil {
+		putString(geo, "continent_code", continent["code"])
+		putName(geo, "continent_name", continent, language)
+	}
+	country := asMap(record["country"])
+	if country != nil {
+		putString(geo, "country_iso_code", country["iso_code"])
+		putName(geo, "country_name", country, language)
+	}
+	if subdivisions, ok := record["subdivisions"].([]interface{}); ok && len(subdivisions) > 0 {
+		if region := asMap(subdivisions[0]); region != nil {
+			countryCode, _ := country["iso_code"].(string)
+			if regionCode, ok := region["iso_code"].(string); ok && countryCode != "" {
+				geo["region_iso_code"] = countryCode + "-" + regionCode
+			}
+			putName(geo, "region_name", region, language)
+		}
+	}
+	if location := asMap(record["location"]); location != nil {
+		lat, latOK := location["latitude"].(float64)
+		lon, lonOK := location["longitude"].(float64)
+		if latOK && lonOK {
+			geo["location"] = mapstr.M{"lat": lat, "lon": lon}
+		}
+		putString(geo, "timezone", location["time_zone"])
+	}
+	if postal := asMap(record["postal"]); postal != nil {
+		putString(geo, "postal_code", postal["code"])
+	}
+	return geo
+}
+
+// asFields returns the ECS as fields of an ASN or ISP database record.
+func asFields(record map[string]interface{}) mapstr.M {
+	as := mapstr.M{}
+	if number, ok := record["autonomous_system_number"].(uint32); ok {
+		as["number"] = int64(number)
+	}
+	if org, ok := record["autonomous_system_organization"].(string); ok {
+		as["organization.name"] = org
+	}
+	return as
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func putString(m mapstr.M, key string, v interface{}) {
+	if s, ok := v.(string); ok && s != "" {
+		m[key] = s
+	}
+}
+
+// putName adds the name of a place in the given language.
+func putName(m mapstr.M, key string, place map[string]interface{}, language string) {
+	if names := asMap(place["names"]); names != nil {
+		putString(m, key, names[language])
+	}
+}
+
+func (p *processor) reloadLoop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.reloadDatabases()
+		}
+	}
+}
+
+func (p *processor) reloadDatabases() {
+	for _, f := range p.databases {
+		reloaded, err := f.reload()
+		if err != nil {
+			p.log.Errorf("Failed to reload GeoIP database %v, keeping the previous version: %v", f.path, err)
+			continue
+		}
+		if reloaded {
+			db := f.database()
+			p.log.Infof("Reloaded GeoIP database %v (type: %v, build: %v)",
+				f.path, db.databaseType, time.Unix(int64(db.buildEpoch), 0).UTC())
+		}
+	}
+}
+
+// Close stops reloading the databases.
+func (p *processor) Close() error {
+	p.closeOnce.Do(func() {
+		if p.done != nil {
+			close(p.done)
+		}
+	})
+	p.wg.Wait()
+	return nil
+}
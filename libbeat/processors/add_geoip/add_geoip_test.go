@@ -0,0 +1,250 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package add_geoip
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newTestProcessor(t *testing.T, cfg mapstr.M) beat.Processor {
+	t.Helper()
+	p, err := New(conf.MustNewConfigFrom(cfg))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, p.(*processor).Close())
+	})
+	return p
+}
+
+func TestProcessorRun(t *testing.T) {
+	london := mapstr.M{
+		"city_name":        "London",
+		"continent_code":   "EU",
+		"continent_name":   "Europe",
+		"country_iso_code": "GB",
+		"country_name":     "United Kingdom",
+		"region_iso_code":  "GB-ENG",
+		"region_name":      "England",
+		"location":         mapstr.M{"lat": 51.5142, "lon": -0.0931},
+		"timezone":         "Europe/London",
+	}
+
+	tests := map[string]struct {
+		config  mapstr.M
+		fields  mapstr.M
+		want    mapstr.M
+		wantErr string
+	}{
+		"city and asn": {
+			fields: mapstr.M{"source": mapstr.M{"ip": "81.2.69.142"}},
+			want: mapstr.M{"source": mapstr.M{
+				"ip":  "81.2.69.142",
+				"geo": london,
+				"as":  mapstr.M{"number": int64(20712), "organization": mapstr.M{"name": "Andrews & Arnold Ltd"}},
+			}},
+		},
+		"city with postal code": {
+			fields: mapstr.M{"source": mapstr.M{"ip": "216.160.83.58"}},
+			want: mapstr.M{"source": mapstr.M{
+				"ip": "216.160.83.58",
+				"geo": mapstr.M{
+					"city_name":        "Milton",
+					"continent_code":   "NA",
+					"continent_name":   "North America",
+					"country_iso_code": "US",
+					"country_name":     "United States",
+					"region_iso_code":  "US-WA",
+					"region_name":      "Washington",
+					"location":         mapstr.M{"lat": 47.2513, "lon": -122.3149},
+					"timezone":         "America/Los_Angeles",
+					"postal_code":      "98354",
+				},
+			}},
+		},
+		"ipv6 asn only": {
+			fields: mapstr.M{"source": mapstr.M{"ip": "2600:6000::1"}},
+			want: mapstr.M{"source": mapstr.M{
+				"ip": "2600:6000::1",
+				"as": mapstr.M{"number": int64(237), "organization": mapstr.M{"name": "Merit Network Inc."}},
+			}},
+		},
+		"not found": {
+			fields: mapstr.M{"source": mapstr.M{"ip": "10.1.2.3"}},
+			want:   mapstr.M{"source": mapstr.M{"ip": "10.1.2.3"}},
+		},
+		"language": {
+			config: mapstr.M{"language": "de"},
+			fields: mapstr.M{"source": mapstr.M{"ip": "2001:480::1"}},
+			want: mapstr.M{"source": mapstr.M{
+				"ip": "2001:480::1",
+				"geo": mapstr.M{
+					"continent_code":   "NA",
+					"continent_name":   "Nordamerika",
+					"country_iso_code": "US",
+					"country_name":     "Vereinigte Staaten",
+					"location":         mapstr.M{"lat": 37.751, "lon": -97.822},
+					"timezone":         "America/Chicago",
+				},
+			}},
+		},
+		"existing geo fields are kept": {
+			fields: mapstr.M{"source": mapstr.M{"ip": "1.128.0.1", "geo": mapstr.M{"name": "office"}}},
+			want: mapstr.M{"source": mapstr.M{
+				"ip":  "1.128.0.1",
+				"geo": mapstr.M{"name": "office"},
+				"as":  mapstr.M{"number": int64(1221), "organization": mapstr.M{"name": "Telstra Pty Ltd"}},
+			}},
+		},
+		"target field": {
+			config: mapstr.M{"fields": []mapstr.M{{"from": "client_ip", "to": "client"}}},
+			fields: mapstr.M{"client_ip": "1.128.0.1"},
+			want: mapstr.M{
+				"client_ip": "1.128.0.1",
+				"client":    mapstr.M{"as": mapstr.M{"number": int64(1221), "organization": mapstr.M{"name": "Telstra Pty Ltd"}}},
+			},
+		},
+		"missing field": {
+			fields:  mapstr.M{},
+			want:    mapstr.M{},
+			wantErr: "add_geoip source field [source.ip] not found",
+		},
+		"ignore missing": {
+			config: mapstr.M{"ignore_missing": true},
+			fields: mapstr.M{},
+			want:   mapstr.M{},
+		},
+		"invalid ip": {
+			fields:  mapstr.M{"source": mapstr.M{"ip": "not an ip"}},
+			want:    mapstr.M{"source": mapstr.M{"ip": "not an ip"}},
+			wantErr: `add_geoip source field [source.ip] is not an IP address: "not an ip"`,
+		},
+		"ignore failure": {
+			config: mapstr.M{"ignore_failure": true},
+			fields: mapstr.M{"source": mapstr.M{"ip": 42}},
+			want:   mapstr.M{"source": mapstr.M{"ip": 42}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := mapstr.M{
+				"databases":       []string{cityTestdata, asnTestdata},
+				"fields":          []mapstr.M{{"from": "source.ip"}},
+				"reload_interval": 0,
+			}
+			cfg.DeepUpdate(tc.config)
+			p := newTestProcessor(t, cfg)
+
+			event, err := p.Run(&beat.Event{Fields: tc.fields})
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.want, event.Fields)
+		})
+	}
+}
+
+func TestProcessorConfig(t *testing.T) {
+	tests := map[string]mapstr.M{
+		"missing databases": {
+			"fields": []mapstr.M{{"from": "source.ip"}},
+		},
+		"missing fields": {
+			"databases": []string{cityTestdata},
+		},
+		"missing target": {
+			"databases": []string{cityTestdata},
+			"fields":    []mapstr.M{{"from": "ip"}},
+		},
+		"missing database file": {
+			"databases": []string{"testdata/missing.mmdb"},
+			"fields":    []mapstr.M{{"from": "source.ip"}},
+		},
+	}
+	for name, cfg := range tests {
+		_, err := New(conf.MustNewConfigFrom(cfg))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestProcessorReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.mmdb")
+	writeASN := func(t *testing.T, org string) {
+		data, err := writeDatabase(testDatabase{
+			databaseType: "GeoLite2-ASN",
+			recordSize:   24,
+			ipVersion:    6,
+			networks: []testNetwork{{"1.128.0.0/11", map[string]interface{}{
+				"autonomous_system_number":       uint32(1221),
+				"autonomous_system_organization": org,
+			}}},
+		})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+	}
+	writeASN(t, "Telstra")
+
+	c := defaultConfig()
+	c.Databases = []string{path}
+	c.Fields = []fieldConfig{{From: "source.ip"}}
+	c.ReloadInterval = 0
+	p, err := newAddGeoIP(c, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	defer p.Close()
+
+	org := func() interface{} {
+		event, _ := p.Run(&beat.Event{Fields: mapstr.M{"source": mapstr.M{"ip": "1.128.0.1"}}})
+		v, _ := event.GetValue("source.as.organization.name")
+		return v
+	}
+	assert.Equal(t, "Telstra", org())
+
+	// The file is replaced by a new version.
+	writeASN(t, "Telstra Pty Ltd")
+	p.reloadDatabases()
+	assert.Equal(t, "Telstra Pty Ltd", org())
+
+	// The previous version is kept while the file is invalid.
+	require.NoError(t, os.WriteFile(path, []byte("partially written"), 0o644))
+	p.reloadDatabases()
+	assert.Equal(t, "Telstra Pty Ltd", org())
+
+	// The new version is loaded once the file is valid again, even when
+	// reloading is triggered by the timer.
+	p.ReloadInterval = 10 * time.Millisecond
+	p.done = make(chan struct{})
+	p.wg.Add(1)
+	go p.reloadLoop()
+	writeASN(t, "Telstra Corporation")
+	assert.Eventually(t, func() bool {
+		return org() == "Telstra Corporation"
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,74 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package add_geoip
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type config struct {
+	Databases      []string      `config:"databases" validate:"required"`
+	Fields         []fieldConfig `config:"fields" validate:"required"`
+	Language       string        `config:"language"`
+	ReloadInterval time.Duration `config:"reload_interval" validate:"min=0"`
+	IgnoreMissing  bool          `config:"ignore_missing"`
+	IgnoreFailure  bool          `config:"ignore_failure"`
+}
+
+// fieldConfig maps a field holding an IP address to the field that gets
+// its geo and as fields.
+type fieldConfig struct {
+	From string `config:"from" validate:"required"`
+	To   string `config:"to"`
+}
+
+func defaultConfig() config {
+	return config{
+		Language:       "en",
+		ReloadInterval: time.Minute,
+	}
+}
+
+func (c *fieldConfig) Validate() error {
+	if c.target() == "" {
+		return fmt.Errorf("field %s requires a target field in 'to'", c.From)
+	}
+	return nil
+}
+
+// target returns the field that gets the geo and as fields. By default they
+// are added next to the IP address, like source.geo for source.ip.
+func (c *fieldConfig) target() string {
+	if c.To != "" {
+		return c.To
+	}
+	if i := strings.LastIndex(c.From, "."); i > 0 {
+		return c.From[:i]
+	}
+	return ""
+}
+
+func (c *config) Validate() error {
+	if c.Language == "" {
+		return errors.New("language can't be empty")
+	}
+	return nil
+}
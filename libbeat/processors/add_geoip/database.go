@@ -0,0 +1,176 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package add_geoip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// metadataMarker precedes the metadata section at the end of the file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSectionSeparator is the number of zero bytes between the search tree
+// and the data section.
+const dataSectionSeparator = 16
+
+// database is a MaxMind DB (MMDB) file loaded in memory.
+//
+// The file starts with a binary search tree over the bits of IP addresses
+// whose leaves point into the data section, and ends with a metadata map.
+// See https://maxmind.github.io/MaxMind-DB/ for the format specification.
+type database struct {
+	databaseType string
+	buildEpoch   uint64
+
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+
+	tree []byte
+	data decoder
+
+	// ipv4Start is the node where IPv4 lookups start in an IPv6 tree, IPv4
+	// addresses are stored in the ::/96 subnet.
+	ipv4Start uint
+}
+
+func openDatabase(path string) (*database, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := newDatabase(buf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MaxMind database %s: %w", path, err)
+	}
+	return db, nil
+}
+
+func newDatabase(buf []byte) (*database, error) {
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start < 0 {
+		return nil, errors.New("metadata section not found")
+	}
+	value, _, err := decoder{buf: buf[start+len(metadataMarker):]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("metadata is not a map")
+	}
+
+	db := &database{}
+	db.databaseType, _ = metadata["database_type"].(string)
+	db.buildEpoch, _ = metadata["build_epoch"].(uint64)
+	if major, _ := metadata["binary_format_major_version"].(uint16); major != 2 {
+		return nil, fmt.Errorf("unsupported binary format version %d", major)
+	}
+	nodeCount, ok := metadata["node_count"].(uint32)
+	if !ok {
+		return nil, errors.New("missing node_count in metadata")
+	}
+	recordSize, _ := metadata["record_size"].(uint16)
+	ipVersion, _ := metadata["ip_version"].(uint16)
+	db.nodeCount, db.recordSize, db.ipVersion = uint(nodeCount), uint(recordSize), uint(ipVersion)
+
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version %d", db.ipVersion)
+	}
+
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(start) {
+		return nil, errors.New("search tree is larger than the file")
+	}
+	db.tree = buf[:treeSize]
+	db.data = decoder{buf: buf[treeSize+dataSectionSeparator : start]}
+
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node.
+func (db *database) record(node uint, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		b := db.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		b := db.tree[node*8+bit*4:]
+		return uint(b[0])<<24 | uint(b[1])<<16 | uint(b[2])<<8 | uint(b[3])
+	}
+}
+
+// lookup returns the record of the network containing ip, or nil if the
+// database has no record for it.
+func (db *database) lookup(ip net.IP) (map[string]interface{}, error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		node = db.ipv4Start
+	} else if db.ipVersion == 4 {
+		return nil, nil
+	}
+
+	bits := uint(len(ip) * 8)
+	for i := uint(0); i < bits && node < db.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-i%8)) & 1
+		node = db.record(node, bit)
+	}
+
+	switch {
+	case node == db.nodeCount:
+		return nil, nil
+	case node < db.nodeCount:
+		return nil, errors.New("invalid search tree, lookup ended on a node")
+	case node < db.nodeCount+dataSectionSeparator:
+		return nil, errors.New("invalid search tree, record points into the data section separator")
+	}
+
+	offset := node - db.nodeCount - dataSectionSeparator
+	value, _, err := db.data.decode(offset, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode record: %w", err)
+	}
+	record, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("record is a %T, not a map", value)
+	}
+	return record, nil
+}
@@ -0,0 +1,70 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package add_geoip
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// databaseFile is a database loaded from a file, that can be reloaded when
+// the file changes.
+type databaseFile struct {
+	path string
+	db   atomic.Pointer[database]
+
+	// The modification time and size of the file when it was loaded.
+	modTime time.Time
+	size    int64
+}
+
+func loadDatabaseFile(path string) (*databaseFile, error) {
+	f := &databaseFile{path: path}
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *databaseFile) database() *database {
+	return f.db.Load()
+}
+
+// reload loads the file if it changed since it was last loaded, and
+// returns whether it did. If the file can't be loaded, for example because
+// it is being replaced, the previous database is kept and the file is
+// loaded again on the next call.
+func (f *databaseFile) reload() (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
+	}
+	if f.db.Load() != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, nil
+	}
+
+	db, err := openDatabase(f.path)
+	if err != nil {
+		return false, err
+	}
+	f.db.Store(db)
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return true, nil
+}
@@ -0,0 +1,285 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package add_geoip
+
+import (
+	"bytes"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "updates the test databases in testdata")
+
+const (
+	cityTestdata = "testdata/GeoLite2-City-Test.mmdb"
+	asnTestdata  = "testdata/GeoLite2-ASN-Test.mmdb"
+)
+
+func names(en, de string) map[string]interface{} {
+	return map[string]interface{}{"en": en, "de": de}
+}
+
+var cityNetworks = []testNetwork{
+	{"81.2.69.0/24", map[string]interface{}{
+		"city":      map[string]interface{}{"geoname_id": uint32(2643743), "names": names("London", "London")},
+		"continent": map[string]interface{}{"code": "EU", "geoname_id": uint32(6255148), "names": names("Europe", "Europa")},
+		"country":   map[string]interface{}{"iso_code": "GB", "geoname_id": uint32(2635167), "names": names("United Kingdom", "Vereinigtes Königreich")},
+		"location": map[string]interface{}{
+			"accuracy_radius": uint16(10),
+			"latitude":        51.5142,
+			"longitude":       -0.0931,
+			"time_zone":       "Europe/London",
+		},
+		"subdivisions": []interface{}{
+			map[string]interface{}{"iso_code": "ENG", "geoname_id": uint32(6269131), "names": names("England", "England")},
+		},
+	}},
+	{"216.160.83.56/29", map[string]interface{}{
+		"city":      map[string]interface{}{"geoname_id": uint32(5803556), "names": names("Milton", "Milton")},
+		"continent": map[string]interface{}{"code": "NA", "geoname_id": uint32(6255149), "names": names("North America", "Nordamerika")},
+		"country":   map[string]interface{}{"iso_code": "US", "geoname_id": uint32(6252001), "names": names("United States", "Vereinigte Staaten")},
+		"location": map[string]interface{}{
+			"accuracy_radius": uint16(22),
+			"latitude":        47.2513,
+			"longitude":       -122.3149,
+			"time_zone":       "America/Los_Angeles",
+		},
+		"postal": map[string]interface{}{"code": "98354"},
+		"subdivisions": []interface{}{
+			map[string]interface{}{"iso_code": "WA", "geoname_id": uint32(5815135), "names": names("Washington", "Washington")},
+		},
+	}},
+	{"2001:480::/32", map[string]interface{}{
+		"continent": map[string]interface{}{"code": "NA", "geoname_id": uint32(6255149), "names": names("North America", "Nordamerika")},
+		"country":   map[string]interface{}{"iso_code": "US", "geoname_id": uint32(6252001), "names": names("United States", "Vereinigte Staaten")},
+		"location": map[string]interface{}{
+			"accuracy_radius": uint16(1000),
+			"latitude":        37.751,
+			"longitude":       -97.822,
+			"time_zone":       "America/Chicago",
+		},
+	}},
+}
+
+var asnNetworks = []testNetwork{
+	{"81.2.69.0/24", map[string]interface{}{
+		"autonomous_system_number":       uint32(20712),
+		"autonomous_system_organization": "Andrews & Arnold Ltd",
+	}},
+	{"1.128.0.0/11", map[string]interface{}{
+		"autonomous_system_number":       uint32(1221),
+		"autonomous_system_organization": "Telstra Pty Ltd",
+	}},
+	{"2600:6000::/20", map[string]interface{}{
+		"autonomous_system_number":       uint32(237),
+		"autonomous_system_organization": "Merit Network Inc.",
+	}},
+}
+
+// TestTestdata checks that the databases in testdata match the networks
+// above, run it with -update to write them.
+func TestTestdata(t *testing.T) {
+	for path, db := range map[string]testDatabase{
+		cityTestdata: {databaseType: "GeoLite2-City", recordSize: 28, ipVersion: 6, networks: cityNetworks},
+		asnTestdata:  {databaseType: "GeoLite2-ASN", recordSize: 24, ipVersion: 6, networks: asnNetworks},
+	} {
+		data, err := writeDatabase(db)
+		require.NoError(t, err)
+
+		if *update {
+			require.NoError(t, os.WriteFile(path, data, 0o644))
+			continue
+		}
+		want, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.True(t, bytes.Equal(want, data), "%s is outdated, run the tests with -update", path)
+	}
+}
+
+func TestDatabaseLookup(t *testing.T) {
+	for _, recordSize := range []int{24, 28, 32} {
+		data, err := writeDatabase(testDatabase{
+			databaseType: "GeoLite2-City",
+			recordSize:   recordSize,
+			ipVersion:    6,
+			networks:     cityNetworks,
+		})
+		require.NoError(t, err)
+		db, err := newDatabase(data)
+		require.NoError(t, err)
+
+		assert.Equal(t, "GeoLite2-City", db.databaseType)
+		assert.Equal(t, uint64(1700000000), db.buildEpoch)
+		assert.Equal(t, uint(recordSize), db.recordSize)
+
+		tests := map[string]string{
+			"81.2.69.142":        "GB",
+			"81.2.69.0":          "GB",
+			"81.2.69.255":        "GB",
+			"216.160.83.57":      "US",
+			"::ffff:81.2.69.142": "GB",
+			"2001:480::1":        "US",
+			"81.2.70.1":          "",
+			"216.160.83.64":      "",
+			"2001:481::1":        "",
+			"10.0.0.1":           "",
+		}
+		for ip, want := range tests {
+			record, err := db.lookup(net.ParseIP(ip))
+			require.NoError(t, err, "record size %d, ip %s", recordSize, ip)
+			if want == "" {
+				assert.Nil(t, record, "record size %d, ip %s", recordSize, ip)
+				continue
+			}
+			require.NotNil(t, record, "record size %d, ip %s", recordSize, ip)
+			country := record["country"].(map[string]interface{})
+			assert.Equal(t, want, country["iso_code"], "record size %d, ip %s", recordSize, ip)
+		}
+	}
+}
+
+func TestDatabaseIPv4Only(t *testing.T) {
+	data, err := writeDatabase(testDatabase{
+		databaseType: "GeoLite2-ASN",
+		recordSize:   24,
+		ipVersion:    4,
+		networks:     asnNetworks[:2],
+	})
+	require.NoError(t, err)
+	db, err := newDatabase(data)
+	require.NoError(t, err)
+
+	record, err := db.lookup(net.ParseIP("1.130.0.1"))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1221), record["autonomous_system_number"])
+
+	record, err = db.lookup(net.ParseIP("2600:6000::1"))
+	require.NoError(t, err)
+	assert.Nil(t, record)
+}
+
+func TestOpenDatabase(t *testing.T) {
+	db, err := openDatabase(asnTestdata)
+	require.NoError(t, err)
+	record, err := db.lookup(net.ParseIP("2600:6000::1"))
+	require.NoError(t, err)
+	assert.Equal(t, "Merit Network Inc.", record["autonomous_system_organization"])
+
+	path := filepath.Join(t.TempDir(), "invalid.mmdb")
+	require.NoError(t, os.WriteFile(path, []byte("not a database"), 0o644))
+	_, err = openDatabase(path)
+	assert.ErrorContains(t, err, "metadata section not found")
+
+	_, err = openDatabase(filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDecodePointer(t *testing.T) {
+	// A map with a string key and a pointer to the string at offset 0.
+	buf := []byte{
+		0x43, 'f', 'o', 'o', // "foo"
+		0xe1,                // map with 1 entry
+		0x43, 'b', 'a', 'r', // "bar"
+		0x20, 0x00, // pointer to 0
+	}
+	value, next, err := decoder{buf: buf}.decode(4, 0)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"bar": "foo"}, value)
+	assert.Equal(t, uint(len(buf)), next)
+
+	tests := []struct {
+		bytes []byte
+		want  uint
+	}{
+		{[]byte{0x20, 0x00}, 0},
+		{[]byte{0x27, 0xff}, 2047},
+		{[]byte{0x28, 0x00, 0x00}, 2048},
+		{[]byte{0x2f, 0xff, 0xff}, 526335},
+		{[]byte{0x30, 0x00, 0x00, 0x00}, 526336},
+		{[]byte{0x37, 0xff, 0xff, 0xff}, 134744063},
+		{[]byte{0x38, 0x12, 0x34, 0x56, 0x78}, 0x12345678},
+	}
+	for _, tc := range tests {
+		d := decoder{buf: tc.bytes}
+		pointer, next, err := d.decodePointer(uint(tc.bytes[0]&0x1f), 1)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, pointer, "%x", tc.bytes)
+		assert.Equal(t, uint(len(tc.bytes)), next)
+	}
+}
+
+func TestDecodeSizes(t *testing.T) {
+	for _, size := range []int{0, 28, 29, 284, 285, 65820, 65821, 70000} {
+		var buf bytes.Buffer
+		s := strings.Repeat("x", size)
+		require.NoError(t, encodeValue(&buf, s))
+
+		value, next, err := decoder{buf: buf.Bytes()}.decode(0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, s, value, "size %d", size)
+		assert.Equal(t, uint(buf.Len()), next)
+	}
+}
+
+func TestDecodeTypes(t *testing.T) {
+	tests := map[string]struct {
+		bytes []byte
+		want  interface{}
+	}{
+		"uint16":    {[]byte{0xa2, 0x01, 0x02}, uint16(0x0102)},
+		"uint32":    {[]byte{0xc0}, uint32(0)},
+		"uint64":    {[]byte{0x03, 0x02, 0x01, 0x00, 0x00}, uint64(0x10000)},
+		"int32":     {[]byte{0x04, 0x01, 0xff, 0xff, 0xff, 0xff}, int32(-1)},
+		"bytes":     {[]byte{0x82, 0x01, 0x02}, []byte{0x01, 0x02}},
+		"true":      {[]byte{0x01, 0x07}, true},
+		"false":     {[]byte{0x00, 0x07}, false},
+		"float":     {[]byte{0x04, 0x08, 0x3f, 0x80, 0x00, 0x00}, float32(1)},
+		"double":    {[]byte{0x68, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0}, float64(1)},
+		"array":     {[]byte{0x02, 0x04, 0x41, 'a', 0xa0}, []interface{}{"a", uint16(0)}},
+		"empty map": {[]byte{0xe0}, map[string]interface{}{}},
+	}
+	for name, tc := range tests {
+		value, next, err := decoder{buf: tc.bytes}.decode(0, 0)
+		require.NoError(t, err, name)
+		assert.Equal(t, tc.want, value, name)
+		assert.Equal(t, uint(len(tc.bytes)), next, name)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := map[string][]byte{
+		"empty":            {},
+		"truncated string": {0x45, 'a'},
+		"truncated size":   {0x5d},
+		"pointer loop":     {0x20, 0x00},
+		"invalid double":   {0x64, 0, 0, 0, 0},
+		"non-string key":   {0xe1, 0xa0, 0xa0},
+		"unknown type":     {0x00, 0x0a},
+	}
+	for name, buf := range tests {
+		_, _, err := decoder{buf: buf}.decode(0, 0)
+		assert.Error(t, err, name)
+	}
+}
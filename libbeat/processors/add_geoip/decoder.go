@@ -0,0 +1,247 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package add_geoip
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Data types of the MaxMind DB data section.
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEndMarker = 13
+	typeBoolean   = 14
+	typeFloat     = 15
+)
+
+// maxDecodeDepth limits the nesting of maps, arrays and pointers, so a
+// corrupt database can't recurse forever.
+const maxDecodeDepth = 64
+
+var errTruncated = errors.New("unexpected end of data")
+
+// decoder decodes values of a MaxMind DB data section. Pointers are
+// offsets relative to the start of buf.
+type decoder struct {
+	buf []byte
+}
+
+// decode decodes the value at offset and returns it along with the offset
+// of the next value.
+func (d decoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errors.New("maximum data structure depth exceeded")
+	}
+
+	typeNum, size, offset, err := d.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typeNum == typePointer {
+		pointer, next, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	switch typeNum {
+	case typeMap:
+		m := make(map[string]interface{}, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			var key, value interface{}
+			key, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			s, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key is a %T, not a string", key)
+			}
+			value, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[s] = value
+		}
+		return m, offset, nil
+
+	case typeArray:
+		a := make([]interface{}, 0, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			var value interface{}
+			value, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+
+	case typeBoolean:
+		return size != 0, offset, nil
+	}
+
+	end := offset + size
+	if end > uint(len(d.buf)) || end < offset {
+		return nil, 0, errTruncated
+	}
+	data := d.buf[offset:end]
+
+	switch typeNum {
+	case typeString:
+		return string(data), end, nil
+	case typeBytes:
+		return append([]byte(nil), data...), end, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid size %d for a double", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), end, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid size %d for a float", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(data)), end, nil
+	case typeUint16, typeUint32, typeUint64:
+		maxSize := uint(8)
+		switch typeNum {
+		case typeUint16:
+			maxSize = 2
+		case typeUint32:
+			maxSize = 4
+		}
+		if size > maxSize {
+			return nil, 0, fmt.Errorf("invalid size %d for an unsigned integer of type %d", size, typeNum)
+		}
+		v := uint64(0)
+		for _, b := range data {
+			v = v<<8 | uint64(b)
+		}
+		switch typeNum {
+		case typeUint16:
+			return uint16(v), end, nil
+		case typeUint32:
+			return uint32(v), end, nil
+		default:
+			return v, end, nil
+		}
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid size %d for an int32", size)
+		}
+		v := uint32(0)
+		for _, b := range data {
+			v = v<<8 | uint32(b)
+		}
+		return int32(v), end, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("invalid size %d for an uint128", size)
+		}
+		return new(big.Int).SetBytes(data), end, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typeNum)
+	}
+}
+
+// decodeControl decodes the control byte, and the extended type and size
+// bytes that may follow it.
+func (d decoder) decodeControl(offset uint) (typeNum int, size uint, next uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, errTruncated
+	}
+	ctrl := d.buf[offset]
+	offset++
+
+	typeNum = int(ctrl >> 5)
+	if typeNum == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, errTruncated
+		}
+		typeNum = int(d.buf[offset]) + 7
+		offset++
+		if typeNum < typeInt32 || typeNum > typeFloat {
+			return 0, 0, 0, fmt.Errorf("invalid extended type %d", typeNum)
+		}
+	}
+
+	size = uint(ctrl & 0x1f)
+	if typeNum == typePointer || size < 29 {
+		return typeNum, size, offset, nil
+	}
+
+	n := size - 28
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, 0, errTruncated
+	}
+	extra := uint(0)
+	for _, b := range d.buf[offset : offset+n] {
+		extra = extra<<8 | uint(b)
+	}
+	switch size {
+	case 29:
+		size = 29 + extra
+	case 30:
+		size = 285 + extra
+	default:
+		size = 65821 + extra
+	}
+	return typeNum, size, offset + n, nil
+}
+
+// decodePointer decodes a pointer, ctrl holds the 5 lower bits of its
+// control byte.
+func (d decoder) decodePointer(ctrl uint, offset uint) (pointer uint, next uint, err error) {
+	n := (ctrl>>3)&0x3 + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errTruncated
+	}
+	v := uint(0)
+	if n < 4 {
+		v = ctrl & 0x7
+	}
+	for _, b := range d.buf[offset : offset+n] {
+		v = v<<8 | uint(b)
+	}
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+	return v, offset + n, nil
+}
@@ -0,0 +1,238 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package add_geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+)
+
+// testDatabase describes a MaxMind DB to be written by writeDatabase. It is
+// only meant for building the small databases used by the tests.
+type testDatabase struct {
+	databaseType string
+	recordSize   int
+	ipVersion    int
+	networks     []testNetwork
+}
+
+type testNetwork struct {
+	cidr   string
+	record map[string]interface{}
+}
+
+// trieNode is a node of the search tree being built, a child is either
+// another node, the offset of a record in the data section, or empty.
+type trieNode struct {
+	children [2]*trieNode
+	data     [2]int
+	index    int
+}
+
+// writeDatabase encodes a database in the MaxMind DB format.
+func writeDatabase(db testDatabase) ([]byte, error) {
+	var data bytes.Buffer
+	root := &trieNode{data: [2]int{-1, -1}}
+	for _, network := range db.networks {
+		_, ipNet, err := net.ParseCIDR(network.cidr)
+		if err != nil {
+			return nil, err
+		}
+		ip := ipNet.IP
+		ones, _ := ipNet.Mask.Size()
+		if ip4 := ip.To4(); ip4 != nil && db.ipVersion == 6 {
+			ip = append(make(net.IP, 12), ip4...)
+			ones += 96
+		} else if ip4 != nil {
+			ip = ip4
+		}
+
+		offset := data.Len()
+		if err := encodeValue(&data, network.record); err != nil {
+			return nil, err
+		}
+
+		node := root
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-i%8)) & 1
+			if i == ones-1 {
+				node.data[bit] = offset
+				break
+			}
+			if node.children[bit] == nil {
+				node.children[bit] = &trieNode{data: [2]int{-1, -1}}
+			}
+			node = node.children[bit]
+		}
+	}
+
+	var nodes []*trieNode
+	queue := []*trieNode{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		node.index = len(nodes)
+		nodes = append(nodes, node)
+		for _, child := range node.children {
+			if child != nil {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	var tree bytes.Buffer
+	nodeCount := len(nodes)
+	for _, node := range nodes {
+		var records [2]uint32
+		for bit := range 2 {
+			switch {
+			case node.children[bit] != nil:
+				records[bit] = uint32(node.children[bit].index)
+			case node.data[bit] >= 0:
+				records[bit] = uint32(nodeCount + dataSectionSeparator + node.data[bit])
+			default:
+				records[bit] = uint32(nodeCount)
+			}
+		}
+		left, right := records[0], records[1]
+		switch db.recordSize {
+		case 24:
+			tree.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			tree.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(left>>24)<<4 | byte(right>>24)&0x0f, byte(right >> 16), byte(right >> 8), byte(right)})
+		case 32:
+			tree.Write(binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, left), right))
+		default:
+			return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(tree.Bytes())
+	buf.Write(make([]byte, dataSectionSeparator))
+	buf.Write(data.Bytes())
+	buf.Write(metadataMarker)
+	err := encodeValue(&buf, map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"database_type":               db.databaseType,
+		"description":                 map[string]interface{}{"en": "Test database"},
+		"ip_version":                  uint16(db.ipVersion),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(db.recordSize),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeValue encodes a value of the data section.
+func encodeValue(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		encodeControl(buf, typeString, len(v))
+		buf.WriteString(v)
+	case float64:
+		encodeControl(buf, typeDouble, 8)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(v)))
+	case uint16:
+		encodeUint(buf, typeUint16, uint64(v))
+	case uint32:
+		encodeUint(buf, typeUint32, uint64(v))
+	case uint64:
+		encodeUint(buf, typeUint64, v)
+	case bool:
+		n := 0
+		if v {
+			n = 1
+		}
+		encodeControl(buf, typeBoolean, n)
+	case []interface{}:
+		encodeControl(buf, typeArray, len(v))
+		for _, elem := range v {
+			if err := encodeValue(buf, elem); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		encodeControl(buf, typeMap, len(v))
+		for _, k := range keys {
+			if err := encodeValue(buf, k); err != nil {
+				return err
+			}
+			if err := encodeValue(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %T", value)
+	}
+	return nil
+}
+
+func encodeUint(buf *bytes.Buffer, typeNum int, v uint64) {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	encodeControl(buf, typeNum, len(b))
+	buf.Write(b)
+}
+
+func encodeControl(buf *bytes.Buffer, typeNum int, size int) {
+	var ctrl byte
+	if typeNum > typeMap {
+		ctrl = typeExtended << 5
+	} else {
+		ctrl = byte(typeNum) << 5
+	}
+
+	var extra []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		extra = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrl |= 30
+		extra = binary.BigEndian.AppendUint16(nil, uint16(size-285))
+	default:
+		ctrl |= 31
+		size -= 65821
+		extra = []byte{byte(size >> 16), byte(size >> 8), byte(size)}
+	}
+
+	buf.WriteByte(ctrl)
+	if typeNum > typeMap {
+		buf.WriteByte(byte(typeNum - 7))
+	}
+	buf.Write(extra)
+}
@@ -0,0 +1,354 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const (
+	procName = "aggregate"
+	logName  = "processor." + procName
+)
+
+func init() {
+	// We cannot use this as a JS plugin as it is stateful and includes a Close method.
+	processors.RegisterPlugin(procName, New)
+}
+
+// summary marks the summary events in beat.Event.Private. They are published
+// through the pipeline, so they may reach an aggregate processor again, which
+// must let them through.
+type summary struct{}
+
+// pipeline is the publisher pipeline the summaries are published to. It is
+// shared by all the aggregate processors of the process.
+var pipeline struct {
+	sync.Mutex
+	connector beat.PipelineConnector
+}
+
+// SetPipeline sets the publisher pipeline the aggregate processors publish
+// their summaries to. The Beat calls it once its publisher pipeline is
+// created; if several Beats run in the process, the last call wins.
+//
+// Each processor connects its own client with the default
+// beat.ClientConfig: the summaries go through the global processors, but
+// not through the processors of the input whose events were aggregated, and
+// they are not acknowledged to that input.
+func SetPipeline(p beat.PipelineConnector) {
+	pipeline.Lock()
+	defer pipeline.Unlock()
+	pipeline.connector = p
+}
+
+// connectPipeline connects a client to the pipeline set by SetPipeline.
+func connectPipeline() (beat.Client, error) {
+	pipeline.Lock()
+	defer pipeline.Unlock()
+	if pipeline.connector == nil {
+		return nil, errors.New("the publisher pipeline is not available")
+	}
+	return pipeline.connector.Connect()
+}
+
+type processor struct {
+	config
+	log *logp.Logger
+
+	now func() time.Time
+	rnd *rand.Rand
+
+	mu     sync.Mutex
+	window window
+
+	// connect and client are only used by the loop goroutine, and by Close
+	// once the loop is over.
+	connect func() (beat.Client, error)
+	client  beat.Client
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// window holds the groups of the current tumbling window.
+type window struct {
+	start, end time.Time
+	groups     map[string]*group
+	order      []*group
+	overflow   int
+}
+
+// group holds the statistics of the events sharing the same dimensions.
+type group struct {
+	dimensions []interface{}
+	present    []bool
+	count      int64
+	metrics    []stats
+}
+
+// New constructs a new aggregate processor. It publishes the summaries
+// through the publisher pipeline passed to SetPipeline when their window is
+// over, and those of the current window when it is closed.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c, err := unpackConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v processor configuration: %w", procName, err)
+	}
+
+	p := newAggregate(c, logp.NewLogger(logName), time.Now, connectPipeline)
+	p.wg.Add(1)
+	go p.loop()
+	return p, nil
+}
+
+func newAggregate(c config, log *logp.Logger, now func() time.Time, connect func() (beat.Client, error)) *processor {
+	p := &processor{
+		config:  c,
+		log:     log,
+		now:     now,
+		connect: connect,
+		rnd:     rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())), //nolint:gosec // Sampling does not need a secure source.
+		done:    make(chan struct{}),
+	}
+	p.window = p.newWindow(now())
+	return p
+}
+
+func (p *processor) String() string {
+	json, _ := json.Marshal(p.config)
+	return procName + "=" + string(json)
+}
+
+// Run adds the event to the statistics of its group. The event is dropped
+// if drop_originals is set. Run never publishes: the summaries are published
+// by the loop goroutine, so a slow pipeline doesn't block the input.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	if _, ok := event.Private.(summary); ok {
+		return event, nil
+	}
+
+	p.mu.Lock()
+	aggregated := p.add(event)
+	p.mu.Unlock()
+
+	if aggregated && p.DropOriginals {
+		return nil, nil
+	}
+	return event, nil
+}
+
+// Close stops the loop, publishes the summaries of the current window, even
+// though it is not over, and closes the connection to the pipeline.
+func (p *processor) Close() error {
+	close(p.done)
+	p.wg.Wait()
+
+	p.emit(true)
+	if p.client == nil {
+		return nil
+	}
+	return p.client.Close()
+}
+
+// loop publishes the summaries as soon as their window is over.
+func (p *processor) loop() {
+	defer p.wg.Done()
+
+	p.mu.Lock()
+	end := p.window.end
+	p.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(end))
+	defer timer.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-timer.C:
+		}
+		end = p.emit(false)
+		timer.Reset(time.Until(end))
+	}
+}
+
+// emit starts a new window if the current one is over, or if force is set,
+// and publishes the summaries of the current one. It returns the end of the
+// window that is open afterwards.
+func (p *processor) emit(force bool) time.Time {
+	p.mu.Lock()
+	summaries := p.rotate(p.now(), force)
+	end := p.window.end
+	p.mu.Unlock()
+
+	p.publish(summaries)
+	return end
+}
+
+func (p *processor) newWindow(now time.Time) window {
+	start := now.Truncate(p.Period)
+	return window{
+		start:  start,
+		end:    start.Add(p.Period),
+		groups: map[string]*group{},
+	}
+}
+
+// rotate starts a new window if the current one is over, or if force is
+// set, and returns the summaries of the current one. The caller must hold
+// p.mu.
+func (p *processor) rotate(now time.Time, force bool) []beat.Event {
+	if !force && now.Before(p.window.end) {
+		return nil
+	}
+	w := p.window
+	p.window = p.newWindow(now)
+
+	if w.overflow > 0 {
+		p.log.Warnf("%d events were not aggregated, max_groups (%d) was reached", w.overflow, p.MaxGroups)
+	}
+	summaries := make([]beat.Event, 0, len(w.order))
+	for _, g := range w.order {
+		summaries = append(summaries, p.summarize(w, g))
+	}
+	return summaries
+}
+
+// add adds the event to its group and reports whether it was aggregated.
+// The caller must hold p.mu.
+func (p *processor) add(event *beat.Event) bool {
+	dimensions := make([]interface{}, len(p.Dimensions))
+	present := make([]bool, len(p.Dimensions))
+	var key strings.Builder
+	for i, field := range p.Dimensions {
+		v, err := event.GetValue(field)
+		if err != nil {
+			key.WriteString("-|")
+			continue
+		}
+		dimensions[i], present[i] = v, true
+		s := fmt.Sprintf("%T:%v", v, v)
+		fmt.Fprintf(&key, "%d:%s|", len(s), s)
+	}
+
+	g, ok := p.window.groups[key.String()]
+	if !ok {
+		if len(p.window.groups) >= p.MaxGroups {
+			p.window.overflow++
+			return false
+		}
+		g = &group{
+			dimensions: dimensions,
+			present:    present,
+			metrics:    make([]stats, len(p.Metrics)),
+		}
+		p.window.groups[key.String()] = g
+		p.window.order = append(p.window.order, g)
+	}
+
+	g.count++
+	for i, field := range p.Metrics {
+		v, err := event.GetValue(field)
+		if err != nil {
+			continue
+		}
+		f, ok := toFloat(v)
+		if !ok {
+			p.log.Debugf("Ignoring the non-numeric value of field %v: %v", field, v)
+			continue
+		}
+		g.metrics[i].add(f, p.rnd)
+	}
+	return true
+}
+
+// summarize builds the summary event of a group.
+func (p *processor) summarize(w window, g *group) beat.Event {
+	fields := mapstr.M{}
+	for i, field := range p.Dimensions {
+		if g.present[i] {
+			_, _ = fields.Put(field, g.dimensions[i])
+		}
+	}
+
+	metrics := mapstr.M{}
+	for i, field := range p.Metrics {
+		s := &g.metrics[i]
+		if s.count == 0 {
+			continue
+		}
+		values := mapstr.M{
+			"count": s.count,
+			"sum":   s.sum,
+			"min":   s.min,
+			"max":   s.max,
+		}
+		for j, v := range s.percentiles(p.Percentiles) {
+			values[percentileKey(p.Percentiles[j])] = v
+		}
+		_, _ = metrics.Put(field, values)
+	}
+
+	target := mapstr.M{
+		"count": g.count,
+		"window": mapstr.M{
+			"start": w.start,
+			"end":   w.end,
+		},
+	}
+	if len(metrics) > 0 {
+		target["metrics"] = metrics
+	}
+	_, _ = fields.Put(p.TargetField, target)
+
+	return beat.Event{
+		Timestamp: w.start,
+		Fields:    fields,
+		Private:   summary{},
+	}
+}
+
+// publish publishes the summary events, connecting to the pipeline on first
+// use.
+func (p *processor) publish(events []beat.Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	if p.client == nil {
+		client, err := p.connect()
+		if err != nil {
+			p.log.Errorf("Dropping %d summary events: %v", len(events), err)
+			return
+		}
+		p.client = client
+	}
+	p.client.PublishAll(events)
+}
@@ -0,0 +1,348 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type testClient struct {
+	mu     sync.Mutex
+	events []beat.Event
+	closed bool
+}
+
+func (c *testClient) Publish(e beat.Event) { c.PublishAll([]beat.Event{e}) }
+
+func (c *testClient) PublishAll(events []beat.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, events...)
+}
+
+func (c *testClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *testClient) published() []beat.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]beat.Event(nil), c.events...)
+}
+
+// testPipeline connects the processor to a testClient.
+type testPipeline struct {
+	client *testClient
+	err    error
+}
+
+func (p *testPipeline) Connect() (beat.Client, error) {
+	return p.ConnectWith(beat.ClientConfig{})
+}
+
+func (p *testPipeline) ConnectWith(beat.ClientConfig) (beat.Client, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.client, nil
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+var windowStart = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+func newTestProcessor(t *testing.T, settings mapstr.M) (*processor, *testClient, *testClock) {
+	t.Helper()
+	c, err := unpackConfig(conf.MustNewConfigFrom(settings))
+	require.NoError(t, err)
+
+	client := &testClient{}
+	clock := &testClock{now: windowStart.Add(10 * time.Second)}
+	p := newAggregate(c, logptest.NewTestingLogger(t, ""), clock.Now, (&testPipeline{client: client}).Connect)
+	return p, client, clock
+}
+
+func accessLog(path string, status int, bytes interface{}) *beat.Event {
+	return &beat.Event{
+		Timestamp: time.Now(),
+		Fields: mapstr.M{
+			"url":  mapstr.M{"path": path},
+			"http": mapstr.M{"response": mapstr.M{"status_code": status, "bytes": bytes}},
+		},
+	}
+}
+
+func TestProcessorRun(t *testing.T) {
+	p, client, clock := newTestProcessor(t, mapstr.M{
+		"dimensions":  []string{"url.path", "http.response.status_code"},
+		"metrics":     []string{"http.response.bytes"},
+		"percentiles": []float64{50, 100},
+	})
+
+	for _, event := range []*beat.Event{
+		accessLog("/", 200, 100),
+		accessLog("/", 200, "300"),
+		accessLog("/login", 401, 10),
+		accessLog("/", 200, 200),
+		accessLog("/", 200, "-"),
+	} {
+		out, err := p.Run(event)
+		require.NoError(t, err)
+		assert.Equal(t, event, out)
+	}
+	assert.Empty(t, client.published(), "summaries must not be published before the window is over")
+
+	clock.now = windowStart.Add(time.Minute)
+	// The loop publishes the summaries when the timer of the window fires.
+	p.emit(false)
+	_, err := p.Run(accessLog("/", 200, 1))
+	require.NoError(t, err)
+
+	window := mapstr.M{"start": windowStart, "end": windowStart.Add(time.Minute)}
+	summaries := client.published()
+	require.Len(t, summaries, 2)
+	assert.Equal(t, windowStart, summaries[0].Timestamp)
+	assert.Equal(t, mapstr.M{
+		"url":  mapstr.M{"path": "/"},
+		"http": mapstr.M{"response": mapstr.M{"status_code": 200}},
+		"aggregate": mapstr.M{
+			"count":  int64(4),
+			"window": window,
+			"metrics": mapstr.M{
+				"http": mapstr.M{"response": mapstr.M{"bytes": mapstr.M{
+					"count": int64(3),
+					"sum":   600.0,
+					"min":   100.0,
+					"max":   300.0,
+					"p50":   200.0,
+					"p100":  300.0,
+				}}},
+			},
+		},
+	}, summaries[0].Fields)
+	assert.Equal(t, mapstr.M{
+		"url":  mapstr.M{"path": "/login"},
+		"http": mapstr.M{"response": mapstr.M{"status_code": 401}},
+		"aggregate": mapstr.M{
+			"count":  int64(1),
+			"window": window,
+			"metrics": mapstr.M{
+				"http": mapstr.M{"response": mapstr.M{"bytes": mapstr.M{
+					"count": int64(1),
+					"sum":   10.0,
+					"min":   10.0,
+					"max":   10.0,
+					"p50":   10.0,
+					"p100":  10.0,
+				}}},
+			},
+		},
+	}, summaries[1].Fields)
+
+	// The summaries published through the pipeline are not aggregated again.
+	for _, summary := range summaries {
+		out, err := p.Run(&summary)
+		require.NoError(t, err)
+		assert.Equal(t, &summary, out)
+	}
+
+	require.NoError(t, p.Close())
+	summaries = client.published()
+	require.Len(t, summaries, 3, "the last window must be published on close")
+	assert.Equal(t, windowStart.Add(time.Minute), summaries[2].Timestamp)
+	assert.Equal(t, int64(1), summaries[2].Fields["aggregate"].(mapstr.M)["count"])
+	assert.True(t, client.closed)
+}
+
+func TestProcessorDropOriginals(t *testing.T) {
+	p, client, _ := newTestProcessor(t, mapstr.M{
+		"dimensions":     []string{"url.path"},
+		"drop_originals": true,
+		"target_field":   "summary",
+	})
+
+	for range 3 {
+		out, err := p.Run(accessLog("/", 200, 1))
+		require.NoError(t, err)
+		assert.Nil(t, out)
+	}
+	out, err := p.Run(&beat.Event{Fields: mapstr.M{"message": "no path"}})
+	require.NoError(t, err)
+	assert.Nil(t, out)
+
+	require.NoError(t, p.Close())
+	summaries := client.published()
+	require.Len(t, summaries, 2)
+	assert.Equal(t, mapstr.M{
+		"url": mapstr.M{"path": "/"},
+		"summary": mapstr.M{
+			"count":  int64(3),
+			"window": mapstr.M{"start": windowStart, "end": windowStart.Add(time.Minute)},
+		},
+	}, summaries[0].Fields)
+	assert.Equal(t, mapstr.M{
+		"summary": mapstr.M{
+			"count":  int64(1),
+			"window": mapstr.M{"start": windowStart, "end": windowStart.Add(time.Minute)},
+		},
+	}, summaries[1].Fields)
+}
+
+func TestProcessorMaxGroups(t *testing.T) {
+	p, client, _ := newTestProcessor(t, mapstr.M{
+		"dimensions":     []string{"url.path"},
+		"drop_originals": true,
+		"max_groups":     1,
+	})
+
+	out, err := p.Run(accessLog("/", 200, 1))
+	require.NoError(t, err)
+	assert.Nil(t, out)
+
+	// Events of new groups are kept once the limit is reached, so they are
+	// not lost.
+	event := accessLog("/other", 200, 1)
+	out, err = p.Run(event)
+	require.NoError(t, err)
+	assert.Equal(t, event, out)
+
+	require.NoError(t, p.Close())
+	assert.Len(t, client.published(), 1)
+}
+
+func TestProcessorPublishesWhenWindowIsOver(t *testing.T) {
+	c := defaultConfig()
+	c.Period = 50 * time.Millisecond
+	client := &testClient{}
+	p := newAggregate(c, logptest.NewTestingLogger(t, ""), time.Now, (&testPipeline{client: client}).Connect)
+	p.wg.Add(1)
+	go p.loop()
+	defer p.Close()
+
+	_, err := p.Run(accessLog("/", 200, 1))
+	require.NoError(t, err)
+
+	// The summary is published without waiting for another event.
+	assert.Eventually(t, func() bool {
+		return len(client.published()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestProcessorPipelineUnavailable(t *testing.T) {
+	for name, pipeline := range map[string]beat.PipelineConnector{
+		"not set":           nil,
+		"connection failed": &testPipeline{err: errors.New("no pipeline")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			SetPipeline(pipeline)
+			t.Cleanup(func() { SetPipeline(nil) })
+
+			c := defaultConfig()
+			c.Dimensions = []string{"url.path"}
+			p := newAggregate(c, logptest.NewTestingLogger(t, ""), time.Now, connectPipeline)
+
+			_, err := p.Run(accessLog("/", 200, 1))
+			require.NoError(t, err)
+			assert.NoError(t, p.Close())
+		})
+	}
+}
+
+func TestSetPipeline(t *testing.T) {
+	client := &testClient{}
+	SetPipeline(&testPipeline{client: client})
+	t.Cleanup(func() { SetPipeline(nil) })
+
+	c := defaultConfig()
+	c.Dimensions = []string{"url.path"}
+	p := newAggregate(c, logptest.NewTestingLogger(t, ""), time.Now, connectPipeline)
+
+	_, err := p.Run(accessLog("/", 200, 1))
+	require.NoError(t, err)
+	require.NoError(t, p.Close())
+	assert.Len(t, client.published(), 1, "the summaries must be published to the pipeline set by SetPipeline")
+	assert.True(t, client.closed)
+}
+
+func TestProcessorConfig(t *testing.T) {
+	tests := map[string]struct {
+		settings mapstr.M
+		want     []float64
+		err      string
+	}{
+		"defaults": {
+			settings: mapstr.M{},
+			want:     []float64{50, 95, 99},
+		},
+		"fewer percentiles than the defaults": {
+			settings: mapstr.M{"percentiles": []float64{50, 100}},
+			want:     []float64{50, 100},
+		},
+		"no percentiles": {
+			settings: mapstr.M{"percentiles": []float64{}},
+			want:     []float64{},
+		},
+		"invalid period": {
+			settings: mapstr.M{"period": "0s"},
+			err:      "period must be greater than 0",
+		},
+		"invalid percentile": {
+			settings: mapstr.M{"percentiles": []float64{50, 101}},
+			err:      "invalid percentile 101",
+		},
+		"empty target": {
+			settings: mapstr.M{"target_field": ""},
+			err:      "target_field cannot be empty",
+		},
+		"invalid max_groups": {
+			settings: mapstr.M{"max_groups": 0},
+			err:      "requires value >= 1",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(conf.MustNewConfigFrom(tc.settings))
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, p.(*processor).Percentiles)
+			assert.NoError(t, p.(*processor).Close())
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+)
+
+type config struct {
+	Dimensions    []string      `config:"dimensions"`
+	Metrics       []string      `config:"metrics"`
+	Percentiles   []float64     `config:"percentiles"`
+	Period        time.Duration `config:"period"`
+	TargetField   string        `config:"target_field"`
+	DropOriginals bool          `config:"drop_originals"`
+	MaxGroups     int           `config:"max_groups" validate:"min=1"`
+}
+
+// defaultPercentiles are used if percentiles is not set. They can't be part
+// of defaultConfig, go-ucfg merges lists by index, so a shorter list set by
+// the user would keep the trailing defaults.
+var defaultPercentiles = []float64{50, 95, 99}
+
+func defaultConfig() config {
+	return config{
+		Period:      time.Minute,
+		TargetField: "aggregate",
+		MaxGroups:   10000,
+	}
+}
+
+func unpackConfig(cfg *conf.C) (config, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return c, err
+	}
+	if !cfg.HasField("percentiles") {
+		c.Percentiles = defaultPercentiles
+	}
+	return c, nil
+}
+
+func (c *config) Validate() error {
+	if c.Period <= 0 {
+		return errors.New("period must be greater than 0")
+	}
+	if c.TargetField == "" {
+		return errors.New("target_field cannot be empty")
+	}
+	for _, p := range c.Percentiles {
+		if p <= 0 || p > 100 {
+			return fmt.Errorf("invalid percentile %v, it must be greater than 0 and at most 100", p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sampleSize is the maximum number of values kept per metric and group to
+// compute the percentiles. Past it, the values are sampled, so the
+// percentiles are estimates.
+const sampleSize = 10000
+
+// stats holds the statistics of a numeric field within a window.
+type stats struct {
+	count    int64
+	sum      float64
+	min, max float64
+	samples  []float64
+}
+
+// add adds v to the statistics. Once the sample is full, v replaces a random
+// value of the sample, so every value has the same chance to be part of it.
+func (s *stats) add(v float64, rnd *rand.Rand) {
+	if s.count == 0 {
+		s.min, s.max = v, v
+	} else {
+		s.min = math.Min(s.min, v)
+		s.max = math.Max(s.max, v)
+	}
+	s.count++
+	s.sum += v
+
+	if len(s.samples) < sampleSize {
+		s.samples = append(s.samples, v)
+		return
+	}
+	if i := rnd.Int64N(s.count); i < sampleSize {
+		s.samples[i] = v
+	}
+}
+
+// percentiles returns the nearest-rank percentiles of the sample.
+func (s *stats) percentiles(ps []float64) []float64 {
+	if len(s.samples) == 0 {
+		return nil
+	}
+	sorted := slices.Clone(s.samples)
+	slices.Sort(sorted)
+
+	values := make([]float64, len(ps))
+	for i, p := range ps {
+		rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+		values[i] = sorted[max(rank-1, 0)]
+	}
+	return values
+}
+
+// percentileKey returns the name of the field holding the percentile p, for
+// example p95 or p99_9.
+func percentileKey(p float64) string {
+	return "p" + strings.ReplaceAll(strconv.FormatFloat(p, 'f', -1, 64), ".", "_")
+}
+
+// toFloat converts a field value to a finite float64. Strings are parsed, as
+// numbers extracted from log lines are often kept as strings.
+func toFloat(v interface{}) (float64, bool) {
+	f, ok := number(v)
+	return f, ok && !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,90 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	var s stats
+	for _, v := range []float64{7, 3, 10, 1, 4, 2, 8, 6, 9, 5} {
+		s.add(v, rnd)
+	}
+
+	assert.Equal(t, int64(10), s.count)
+	assert.Equal(t, 55.0, s.sum)
+	assert.Equal(t, 1.0, s.min)
+	assert.Equal(t, 10.0, s.max)
+	assert.Equal(t, []float64{1, 5, 9, 10}, s.percentiles([]float64{1, 50, 90, 100}))
+}
+
+func TestStatsSampling(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	var s stats
+	n := 3 * sampleSize
+	for i := range n {
+		s.add(float64(i), rnd)
+	}
+
+	assert.Equal(t, int64(n), s.count)
+	assert.Equal(t, 0.0, s.min)
+	assert.Equal(t, float64(n-1), s.max)
+	assert.Len(t, s.samples, sampleSize)
+
+	// The median of the sample must be close to the median of the values.
+	median := s.percentiles([]float64{50})[0]
+	assert.InDelta(t, float64(n)/2, median, float64(n)/20)
+}
+
+func TestPercentileKey(t *testing.T) {
+	assert.Equal(t, "p50", percentileKey(50))
+	assert.Equal(t, "p99_9", percentileKey(99.9))
+	assert.Equal(t, "p100", percentileKey(100))
+}
+
+func TestToFloat(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  float64
+		ok    bool
+	}{
+		{value: 3, want: 3, ok: true},
+		{value: int64(-3), want: -3, ok: true},
+		{value: uint16(3), want: 3, ok: true},
+		{value: float32(1.5), want: 1.5, ok: true},
+		{value: 1.25, want: 1.25, ok: true},
+		{value: " 42.5 ", want: 42.5, ok: true},
+		{value: "forty-two", ok: false},
+		{value: "NaN", ok: false},
+		{value: "+Inf", ok: false},
+		{value: true, ok: false},
+		{value: nil, ok: false},
+	}
+	for _, tc := range tests {
+		got, ok := toFloat(tc.value)
+		assert.Equal(t, tc.ok, ok, "value: %#v", tc.value)
+		if tc.ok {
+			assert.Equal(t, tc.want, got, "value: %#v", tc.value)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_kv
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type config struct {
+	Field         string          `config:"field" validate:"required"`
+	Target        *string         `config:"target_field"`
+	FieldSplit    string          `config:"field_split"`
+	ValueSplit    string          `config:"value_split"`
+	QuoteChars    string          `config:"quote_chars"`
+	IncludeKeys   []string        `config:"include_keys"`
+	ExcludeKeys   []string        `config:"exclude_keys"`
+	Prefix        string          `config:"prefix"`
+	TrimKey       string          `config:"trim_key"`
+	TrimValue     string          `config:"trim_value"`
+	Convert       []convertConfig `config:"convert"`
+	OverwriteKeys bool            `config:"overwrite_keys"`
+	IgnoreMissing bool            `config:"ignore_missing"`
+	IgnoreFailure bool            `config:"ignore_failure"`
+}
+
+// convertConfig converts the values of a key to a type.
+type convertConfig struct {
+	Key  string   `config:"key" validate:"required"`
+	Type dataType `config:"type"`
+}
+
+func (c *convertConfig) Validate() error {
+	if c.Type == unset {
+		return fmt.Errorf("convert of key %q requires a type", c.Key)
+	}
+	return nil
+}
+
+func defaultConfig() config {
+	return config{
+		Field:      "message",
+		FieldSplit: " ",
+		ValueSplit: "=",
+		QuoteChars: `"'`,
+	}
+}
+
+func (c *config) Validate() error {
+	if c.FieldSplit == "" {
+		return errors.New("field_split can't be empty")
+	}
+	if c.ValueSplit == "" {
+		return errors.New("value_split can't be empty")
+	}
+	if c.FieldSplit == c.ValueSplit {
+		return errors.New("field_split and value_split must be different")
+	}
+	if len(c.IncludeKeys) > 0 && len(c.ExcludeKeys) > 0 {
+		return errors.New("include_keys and exclude_keys can't be used together")
+	}
+	return nil
+}
+
+type dataType uint8
+
+// List of dataTypes.
+const (
+	unset dataType = iota
+	String
+	Integer
+	Long
+	Float
+	Double
+	Boolean
+)
+
+var dataTypeNames = map[dataType]string{
+	unset:   "[unset]",
+	String:  "string",
+	Integer: "integer",
+	Long:    "long",
+	Float:   "float",
+	Double:  "double",
+	Boolean: "boolean",
+}
+
+func (dt dataType) String() string {
+	return dataTypeNames[dt]
+}
+
+func (dt dataType) MarshalText() ([]byte, error) {
+	return []byte(dt.String()), nil
+}
+
+func (dt *dataType) Unpack(s string) error {
+	s = strings.ToLower(s)
+	for typ, name := range dataTypeNames {
+		if typ != unset && s == name {
+			*dt = typ
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid data type: %v", s)
+}
+
+// convert converts a string value to the type.
+func (dt dataType) convert(s string) (interface{}, error) {
+	switch dt {
+	case Integer:
+		i, err := strconv.ParseInt(s, 10, 32)
+		return int32(i), err
+	case Long:
+		return strconv.ParseInt(s, 10, 64)
+	case Float:
+		f, err := strconv.ParseFloat(s, 32)
+		return float32(f), err
+	case Double:
+		return strconv.ParseFloat(s, 64)
+	case Boolean:
+		return strconv.ParseBool(s)
+	default:
+		return s, nil
+	}
+}
@@ -0,0 +1,187 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_kv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/jsontransform"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type decodeKV struct {
+	config
+	splitter
+
+	include map[string]bool
+	exclude map[string]bool
+	types   map[string]dataType
+
+	log *logp.Logger
+}
+
+var errFieldIsNotString = errors.New("field value is not a string")
+
+const (
+	procName = "decode_kv"
+	logName  = "processor." + procName
+)
+
+func init() {
+	processors.RegisterPlugin(procName,
+		checks.ConfigChecked(New,
+			checks.AllowedFields(
+				"field", "target_field",
+				"field_split", "value_split", "quote_chars",
+				"include_keys", "exclude_keys", "prefix",
+				"trim_key", "trim_value", "convert",
+				"overwrite_keys", "ignore_missing",
+				"ignore_failure", "when",
+			)))
+	jsprocessor.RegisterPlugin("DecodeKV", New)
+}
+
+// New constructs a new decode_kv processor.
+func New(c *conf.C) (beat.Processor, error) {
+	config := defaultConfig()
+
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the "+procName+" processor configuration: %w", err)
+	}
+
+	return newDecodeKV(config), nil
+}
+
+func newDecodeKV(config config) *decodeKV {
+	// Default target to overwriting field.
+	if config.Target == nil {
+		config.Target = &config.Field
+	}
+
+	p := &decodeKV{
+		config: config,
+		splitter: splitter{
+			fieldSplit: config.FieldSplit,
+			valueSplit: config.ValueSplit,
+			quoteChars: config.QuoteChars,
+			trimKey:    config.TrimKey,
+			trimValue:  config.TrimValue,
+		},
+		include: toSet(config.IncludeKeys),
+		exclude: toSet(config.ExcludeKeys),
+		types:   make(map[string]dataType, len(config.Convert)),
+		log:     logp.NewLogger(logName),
+	}
+	for _, c := range config.Convert {
+		p.types[c.Key] = c.Type
+	}
+	return p
+}
+
+func toSet(keys []string) map[string]bool {
+	if len(keys) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
+
+func (p *decodeKV) Run(event *beat.Event) (*beat.Event, error) {
+	if err := p.run(event); err != nil && !p.IgnoreFailure {
+		err = fmt.Errorf("failed in decode_kv on the %q field: %w", p.Field, err)
+		_, _ = event.PutValue("error.message", err.Error())
+		return event, err
+	}
+	return event, nil
+}
+
+func (p *decodeKV) run(event *beat.Event) error {
+	data, err := event.GetValue(p.Field)
+	if err != nil {
+		if p.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	text, ok := data.(string)
+	if !ok {
+		return errFieldIsNotString
+	}
+
+	fields, err := p.decode(text)
+	if err != nil {
+		return err
+	}
+
+	if *p.Target != "" {
+		if _, err = event.PutValue(*p.Target, fields); err != nil {
+			return fmt.Errorf("failed to put value %v into field %q: %w", fields, *p.Target, err)
+		}
+	} else {
+		jsontransform.WriteJSONKeys(event, fields, false, p.OverwriteKeys, !p.IgnoreFailure)
+	}
+	return nil
+}
+
+// decode returns the key-value pairs of text. The values of keys that
+// appear more than once are collected in an array.
+func (p *decodeKV) decode(text string) (mapstr.M, error) {
+	fields := mapstr.M{}
+	for _, pair := range p.split(text) {
+		if (p.include != nil && !p.include[pair.key]) || p.exclude[pair.key] {
+			continue
+		}
+
+		var value interface{} = pair.value
+		if typ, ok := p.types[pair.key]; ok {
+			v, err := typ.convert(pair.value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert the value of key %q to %v: %w", pair.key, typ, err)
+			}
+			value = v
+		}
+
+		key := p.Prefix + pair.key
+		switch prev := fields[key].(type) {
+		case nil:
+			fields[key] = value
+		case []interface{}:
+			fields[key] = append(prev, value)
+		default:
+			fields[key] = []interface{}{prev, value}
+		}
+	}
+	return fields, nil
+}
+
+func (p *decodeKV) String() string {
+	json, _ := json.Marshal(p.config)
+	return procName + "=" + string(json)
+}
@@ -0,0 +1,252 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_kv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		description string
+		splitter    splitter
+		text        string
+		want        []pair
+	}{
+		{
+			description: "logfmt",
+			splitter:    splitter{fieldSplit: " ", valueSplit: "=", quoteChars: `"'`},
+			text:        `level=info msg="request done" duration=12ms path=/a?b=c`,
+			want: []pair{
+				{"level", "info"},
+				{"msg", "request done"},
+				{"duration", "12ms"},
+				{"path", "/a?b=c"},
+			},
+		},
+		{
+			description: "escaped quotes and empty values",
+			splitter:    splitter{fieldSplit: " ", valueSplit: "=", quoteChars: `"'`},
+			text:        `a="say \"hi\"" b= c='it''s' d=`,
+			want: []pair{
+				{"a", `say "hi"`},
+				{"b", ""},
+				{"c", "it"},
+				{"d", ""},
+			},
+		},
+		{
+			description: "tokens without a value are skipped",
+			splitter:    splitter{fieldSplit: " ", valueSplit: "=", quoteChars: `"'`},
+			text:        `  CEF:0 src=10.0.0.1   flag =x dst=10.0.0.2 `,
+			want: []pair{
+				{"src", "10.0.0.1"},
+				{"dst", "10.0.0.2"},
+			},
+		},
+		{
+			description: "quoted keys and unterminated quotes",
+			splitter:    splitter{fieldSplit: " ", valueSplit: "=", quoteChars: `"`},
+			text:        `"user name"=bob note="never closed`,
+			want: []pair{
+				{"user name", "bob"},
+				{"note", "never closed"},
+			},
+		},
+		{
+			description: "multi-character separators and trimming",
+			splitter:    splitter{fieldSplit: ", ", valueSplit: ": ", trimKey: "[]", trimValue: "<>"},
+			text:        `[action]: <allow>, [proto]: tcp, : empty key`,
+			want: []pair{
+				{"action", "allow"},
+				{"proto", "tcp"},
+			},
+		},
+		{
+			description: "no quote handling",
+			splitter:    splitter{fieldSplit: "|", valueSplit: ":"},
+			text:        `a:"x|y"|b:2`,
+			want: []pair{
+				{"a", `"x`},
+				{"b", "2"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.splitter.split(tc.text))
+		})
+	}
+}
+
+func TestDecodeKV(t *testing.T) {
+	const message = `date=2024-05-01 srcip=10.1.1.1 srcport=52311 dstport=443 action="accept" sentbyte=1024 policyid=7 tag=a tag=b`
+
+	tests := []struct {
+		description string
+		config      mapstr.M
+		input       mapstr.M
+		output      mapstr.M
+		error       string
+	}{
+		{
+			description: "target field",
+			config:      mapstr.M{"target_field": "fw"},
+			input:       mapstr.M{"message": message},
+			output: mapstr.M{
+				"message": message,
+				"fw": mapstr.M{
+					"date":     "2024-05-01",
+					"srcip":    "10.1.1.1",
+					"srcport":  "52311",
+					"dstport":  "443",
+					"action":   "accept",
+					"sentbyte": "1024",
+					"policyid": "7",
+					"tag":      []interface{}{"a", "b"},
+				},
+			},
+		},
+		{
+			description: "default target overwrites the field",
+			config:      mapstr.M{"field": "kv", "include_keys": []string{"action"}},
+			input:       mapstr.M{"kv": message},
+			output:      mapstr.M{"kv": mapstr.M{"action": "accept"}},
+		},
+		{
+			description: "root target with prefix, exclude keys and conversion",
+			config: mapstr.M{
+				"target_field": "",
+				"prefix":       "fw_",
+				"exclude_keys": []string{"date", "tag", "srcip", "dstport"},
+				"convert": []mapstr.M{
+					{"key": "srcport", "type": "integer"},
+					{"key": "sentbyte", "type": "long"},
+					{"key": "policyid", "type": "string"},
+				},
+			},
+			input: mapstr.M{"message": message},
+			output: mapstr.M{
+				"message":     message,
+				"fw_srcport":  int32(52311),
+				"fw_action":   "accept",
+				"fw_sentbyte": int64(1024),
+				"fw_policyid": "7",
+			},
+		},
+		{
+			description: "root target does not overwrite keys",
+			config:      mapstr.M{"target_field": "", "include_keys": []string{"action"}},
+			input:       mapstr.M{"message": message, "action": "deny"},
+			output:      mapstr.M{"message": message, "action": "deny"},
+		},
+		{
+			description: "root target with overwrite keys",
+			config:      mapstr.M{"target_field": "", "include_keys": []string{"action"}, "overwrite_keys": true},
+			input:       mapstr.M{"message": message, "action": "deny"},
+			output:      mapstr.M{"message": message, "action": "accept"},
+		},
+		{
+			description: "conversion error",
+			config: mapstr.M{
+				"target_field": "fw",
+				"convert":      []mapstr.M{{"key": "action", "type": "boolean"}},
+			},
+			input: mapstr.M{"message": message},
+			output: mapstr.M{
+				"message": message,
+				"error":   mapstr.M{"message": `failed in decode_kv on the "message" field: failed to convert the value of key "action" to boolean: strconv.ParseBool: parsing "accept": invalid syntax`},
+			},
+			error: `failed to convert the value of key "action" to boolean`,
+		},
+		{
+			description: "conversion error with ignore failure",
+			config: mapstr.M{
+				"target_field":   "fw",
+				"convert":        []mapstr.M{{"key": "action", "type": "boolean"}},
+				"ignore_failure": true,
+			},
+			input:  mapstr.M{"message": message},
+			output: mapstr.M{"message": message},
+		},
+		{
+			description: "missing field",
+			input:       mapstr.M{},
+			output: mapstr.M{
+				"error": mapstr.M{"message": `failed in decode_kv on the "message" field: key not found`},
+			},
+			error: "key not found",
+		},
+		{
+			description: "ignore missing",
+			config:      mapstr.M{"ignore_missing": true},
+			input:       mapstr.M{},
+			output:      mapstr.M{},
+		},
+		{
+			description: "field is not a string",
+			input:       mapstr.M{"message": 1},
+			output: mapstr.M{
+				"message": 1,
+				"error":   mapstr.M{"message": `failed in decode_kv on the "message" field: field value is not a string`},
+			},
+			error: "field value is not a string",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			cfg := mapstr.M{}
+			cfg.DeepUpdate(tc.config)
+			p, err := New(conf.MustNewConfigFrom(cfg))
+			require.NoError(t, err)
+
+			event, err := p.Run(&beat.Event{Fields: tc.input})
+			if tc.error != "" {
+				assert.ErrorContains(t, err, tc.error)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.output, event.Fields)
+		})
+	}
+}
+
+func TestConfig(t *testing.T) {
+	tests := map[string]mapstr.M{
+		"empty field split":        {"field_split": ""},
+		"same separators":          {"field_split": ":", "value_split": ":"},
+		"include and exclude keys": {"include_keys": []string{"a"}, "exclude_keys": []string{"b"}},
+		"invalid type":             {"convert": []mapstr.M{{"key": "a", "type": "date"}}},
+		"conversion without type":  {"convert": []mapstr.M{{"key": "a"}}},
+		"conversion without key":   {"convert": []mapstr.M{{"type": "long"}}},
+		"empty value split":        {"value_split": ""},
+	}
+	for name, cfg := range tests {
+		_, err := New(conf.MustNewConfigFrom(cfg))
+		assert.Error(t, err, name)
+	}
+}
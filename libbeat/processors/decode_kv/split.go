@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_kv
+
+import "strings"
+
+// splitter splits a text into key-value pairs.
+type splitter struct {
+	fieldSplit string
+	valueSplit string
+	quoteChars string
+	trimKey    string
+	trimValue  string
+}
+
+type pair struct {
+	key   string
+	value string
+}
+
+// split returns the key-value pairs of text in order. Tokens without a
+// value separator and pairs with an empty key are skipped.
+func (s *splitter) split(text string) []pair {
+	var pairs []pair
+	for pos := 0; pos < len(text); {
+		if strings.HasPrefix(text[pos:], s.fieldSplit) {
+			pos += len(s.fieldSplit)
+			continue
+		}
+
+		var key, value string
+		key, pos = s.token(text, pos, true)
+		if !strings.HasPrefix(text[pos:], s.valueSplit) {
+			continue
+		}
+		pos += len(s.valueSplit)
+		value, pos = s.token(text, pos, false)
+
+		if s.trimKey != "" {
+			key = strings.Trim(key, s.trimKey)
+		}
+		if s.trimValue != "" {
+			value = strings.Trim(value, s.trimValue)
+		}
+		if key == "" {
+			continue
+		}
+		pairs = append(pairs, pair{key: key, value: value})
+	}
+	return pairs
+}
+
+// token returns the key or value starting at pos and the position after it.
+// Unquoted keys end at the value or field separator, and unquoted values at
+// the field separator. Quoted tokens end at the closing quote, which can be
+// escaped with a backslash.
+func (s *splitter) token(text string, pos int, key bool) (string, int) {
+	if pos < len(text) && strings.IndexByte(s.quoteChars, text[pos]) >= 0 {
+		quote := text[pos]
+		var b strings.Builder
+		for i := pos + 1; i < len(text); i++ {
+			switch {
+			case text[i] == '\\' && i+1 < len(text) && text[i+1] == quote:
+				b.WriteByte(quote)
+				i++
+			case text[i] == quote:
+				return b.String(), i + 1
+			default:
+				b.WriteByte(text[i])
+			}
+		}
+		// The quote is not closed, the token runs to the end of the text.
+		return b.String(), len(text)
+	}
+
+	end := len(text)
+	if i := strings.Index(text[pos:], s.fieldSplit); i >= 0 {
+		end = pos + i
+	}
+	if key {
+		if i := strings.Index(text[pos:end], s.valueSplit); i >= 0 {
+			end = pos + i
+		}
+	}
+	return text[pos:end], end
+}
@@ -0,0 +1,63 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+type config struct {
+	Fields        []string      `config:"fields" validate:"required"`
+	Method        string        `config:"method"`
+	IgnoreMissing bool          `config:"ignore_missing"`
+	Window        time.Duration `config:"window"`
+	MaxEntries    int           `config:"max_entries" validate:"min=1"`
+	Store         *storeConfig  `config:"store"`
+}
+
+// storeConfig enables persisting the window, so it survives restarts.
+type storeConfig struct {
+	ID string `config:"id" validate:"required"`
+}
+
+var storeIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+func defaultConfig() config {
+	return config{
+		Method:     "xxhash",
+		Window:     10 * time.Minute,
+		MaxEntries: 100000,
+	}
+}
+
+func (c *config) Validate() error {
+	if c.Window <= 0 {
+		return errors.New("window must be greater than 0")
+	}
+	return nil
+}
+
+func (c *storeConfig) Validate() error {
+	if !storeIDRegexp.MatchString(c.ID) {
+		return fmt.Errorf("invalid store id %q, it can only contain letters, digits, '_' and '-'", c.ID)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/fingerprint"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+const (
+	procName = "deduplicate"
+	logName  = "processor." + procName
+)
+
+func init() {
+	// We cannot use this as a JS plugin as it is stateful and includes a Close method.
+	processors.RegisterPlugin(procName, New)
+}
+
+// stores is the registry of the persisted windows. It is opened on first
+// use and shared by all deduplicate processors.
+var stores struct {
+	once     sync.Once
+	registry *statestore.Registry
+	err      error
+}
+
+func openStore(id string, log *logp.Logger) (*statestore.Store, error) {
+	stores.once.Do(func() {
+		reg, err := memlog.New(log, memlog.Settings{
+			Root: paths.Resolve(paths.Data, "deduplicate_processor"),
+		})
+		if err != nil {
+			stores.err = err
+			return
+		}
+		stores.registry = statestore.NewRegistry(reg)
+	})
+	if stores.err != nil {
+		return nil, stores.err
+	}
+	return stores.registry.Get(id)
+}
+
+type processor struct {
+	config
+	hasher *fingerprint.Hasher
+	window *window
+	log    *logp.Logger
+}
+
+// New constructs a new deduplicate processor. It implements Close to
+// release the store of the window.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v processor configuration: %w", procName, err)
+	}
+
+	log := logp.NewLogger(logName)
+	var store *statestore.Store
+	if c.Store != nil {
+		log = log.With("store_id", c.Store.ID)
+		var err error
+		store, err = openStore(c.Store.ID, log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the store of the %v processor: %w", procName, err)
+		}
+	}
+
+	p, err := newDeduplicate(c, store, log)
+	if err != nil && store != nil {
+		store.Close()
+	}
+	return p, err
+}
+
+func newDeduplicate(c config, store *statestore.Store, log *logp.Logger) (*processor, error) {
+	hasher, err := fingerprint.NewHasher(c.Fields, c.Method, c.IgnoreMissing)
+	if err != nil {
+		return nil, err
+	}
+	window, err := newWindow(c.Window, c.MaxEntries, store, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the persisted keys: %w", err)
+	}
+	return &processor{
+		config: c,
+		hasher: hasher,
+		window: window,
+		log:    log,
+	}, nil
+}
+
+func (p *processor) String() string {
+	json, _ := json.Marshal(p.config)
+	return procName + "=" + string(json)
+}
+
+// Run drops the event if an event with the same key was seen in the window.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	sum, err := p.hasher.Sum(event)
+	if err != nil {
+		return event, fmt.Errorf("failed to compute the deduplication key: %w", err)
+	}
+	if p.window.seen(hex.EncodeToString(sum), time.Now()) {
+		p.log.Debug("Dropping duplicate event")
+		return nil, nil
+	}
+	return event, nil
+}
+
+// Close releases the store, the persisted keys are kept for the next run.
+func (p *processor) Close() error {
+	return p.window.close()
+}
@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestProcessorRun(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"fields": []string{"message", "event.id"},
+		"window": "1m",
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	events := []mapstr.M{
+		{"message": "a", "event": mapstr.M{"id": 1}},
+		{"message": "a", "event": mapstr.M{"id": 2}},
+		{"message": "a", "event": mapstr.M{"id": 1}, "other": "ignored"},
+		{"message": "b", "event": mapstr.M{"id": 1}},
+		{"message": "b", "event": mapstr.M{"id": 1}},
+	}
+	var kept []mapstr.M
+	for _, fields := range events {
+		event, err := p.Run(&beat.Event{Timestamp: time.Now(), Fields: fields})
+		require.NoError(t, err)
+		if event != nil {
+			kept = append(kept, event.Fields)
+		}
+	}
+	assert.Equal(t, []mapstr.M{events[0], events[1], events[3]}, kept)
+}
+
+func TestProcessorMissingField(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{"fields": []string{"message", "event.id"}}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{"message": "a"}})
+	assert.ErrorContains(t, err, "failed to compute the deduplication key")
+	assert.NotNil(t, event)
+
+	p, err = New(conf.MustNewConfigFrom(mapstr.M{
+		"fields":         []string{"message", "event.id"},
+		"ignore_missing": true,
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"message": "a"}})
+	assert.NoError(t, err)
+	assert.NotNil(t, event)
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"message": "a"}})
+	assert.NoError(t, err)
+	assert.Nil(t, event)
+}
+
+func TestProcessorConfig(t *testing.T) {
+	tests := map[string]mapstr.M{
+		"missing fields":   {},
+		"unknown method":   {"fields": []string{"message"}, "method": "crc"},
+		"zero window":      {"fields": []string{"message"}, "window": 0},
+		"zero max entries": {"fields": []string{"message"}, "max_entries": 0},
+		"invalid store id": {"fields": []string{"message"}, "store.id": "../data"},
+	}
+	for name, cfg := range tests {
+		_, err := New(conf.MustNewConfigFrom(cfg))
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,178 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// window holds the keys of the events seen in the last ttl. It holds at
+// most cap keys, the oldest keys are evicted first when it is full. Keys
+// are optionally persisted to a store, so the window survives restarts.
+type window struct {
+	mu       sync.Mutex
+	entries  map[string]*entry
+	expiries expiryHeap
+	ttl      time.Duration
+	cap      int
+
+	store *statestore.Store
+	log   *logp.Logger
+}
+
+type entry struct {
+	key     string
+	expires time.Time
+	index   int
+}
+
+// persistedEntry is the value of a key in the store.
+type persistedEntry struct {
+	Expires time.Time `struct:"expires"`
+}
+
+// newWindow returns a window with the keys of store that have not expired.
+// store can be nil.
+func newWindow(ttl time.Duration, cap int, store *statestore.Store, log *logp.Logger) (*window, error) {
+	w := &window{
+		entries: make(map[string]*entry),
+		ttl:     ttl,
+		cap:     cap,
+		store:   store,
+		log:     log,
+	}
+	if store == nil {
+		return w, nil
+	}
+
+	now := time.Now()
+	var expired []string
+	err := store.Each(func(key string, dec statestore.ValueDecoder) (bool, error) {
+		var st persistedEntry
+		if err := dec.Decode(&st); err != nil || !st.Expires.After(now) {
+			expired = append(expired, key)
+			return true, nil
+		}
+		e := &entry{key: key, expires: st.Expires}
+		w.entries[key] = e
+		heap.Push(&w.expiries, e)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range expired {
+		if err := store.Remove(key); err != nil {
+			return nil, err
+		}
+	}
+	// The window may have been persisted with a larger capacity.
+	for len(w.entries) > w.cap {
+		w.evict()
+	}
+	return w, nil
+}
+
+// seen reports whether key was seen in the window. If it was not, it is
+// added to the window. seen is safe for concurrent use.
+func (w *window) seen(key string, now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.evictExpired(now)
+	if _, found := w.entries[key]; found {
+		return true
+	}
+
+	for len(w.entries) >= w.cap {
+		w.evict()
+	}
+	e := &entry{key: key, expires: now.Add(w.ttl)}
+	w.entries[key] = e
+	heap.Push(&w.expiries, e)
+	if w.store != nil {
+		if err := w.store.Set(key, persistedEntry{Expires: e.expires}); err != nil {
+			w.log.Errorf("Failed to persist deduplication key: %v", err)
+		}
+	}
+	return false
+}
+
+// evictExpired removes the keys that expired at now.
+func (w *window) evictExpired(now time.Time) {
+	for len(w.expiries) != 0 && !w.expiries[0].expires.After(now) {
+		w.evict()
+	}
+}
+
+// evict removes the key that expires first.
+func (w *window) evict() {
+	e := heap.Pop(&w.expiries).(*entry)
+	e.index = -1
+	delete(w.entries, e.key)
+	if w.store != nil {
+		if err := w.store.Remove(e.key); err != nil {
+			w.log.Errorf("Failed to remove deduplication key from the store: %v", err)
+		}
+	}
+}
+
+// close closes the store, the keys remain in the store.
+func (w *window) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.store == nil {
+		return nil
+	}
+	err := w.store.Close()
+	w.store = nil
+	return err
+}
+
+var _ heap.Interface = (*expiryHeap)(nil)
+
+// expiryHeap is a min-date heap.
+type expiryHeap []*entry
+
+func (h expiryHeap) Len() int {
+	return len(h)
+}
+func (h expiryHeap) Less(i, j int) bool {
+	return h[i].expires.Before(h[j].expires)
+}
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *expiryHeap) Push(v any) {
+	e := v.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *expiryHeap) Pop() any {
+	v := (*h)[len(*h)-1]
+	(*h)[len(*h)-1] = nil // Help GC.
+	*h = (*h)[:len(*h)-1]
+	return v
+}
@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestWindowExpiry(t *testing.T) {
+	w, err := newWindow(time.Minute, 10, nil, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+
+	now := time.Now()
+	assert.False(t, w.seen("a", now))
+	assert.True(t, w.seen("a", now.Add(30*time.Second)))
+	assert.False(t, w.seen("b", now.Add(30*time.Second)))
+
+	// The window starts when a key is first seen, duplicates don't extend it.
+	assert.False(t, w.seen("a", now.Add(time.Minute)))
+	assert.True(t, w.seen("b", now.Add(time.Minute)))
+	assert.False(t, w.seen("b", now.Add(90*time.Second)))
+	assert.Len(t, w.entries, 2)
+}
+
+func TestWindowCapacity(t *testing.T) {
+	w, err := newWindow(time.Hour, 2, nil, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+
+	now := time.Now()
+	assert.False(t, w.seen("a", now))
+	assert.False(t, w.seen("b", now.Add(time.Second)))
+	assert.False(t, w.seen("c", now.Add(2*time.Second)))
+	assert.Len(t, w.entries, 2)
+
+	// The oldest key was evicted.
+	assert.True(t, w.seen("c", now.Add(3*time.Second)))
+	assert.True(t, w.seen("b", now.Add(3*time.Second)))
+	assert.False(t, w.seen("a", now.Add(3*time.Second)))
+}
+
+func TestWindowPersistence(t *testing.T) {
+	root := t.TempDir()
+	log := logptest.NewTestingLogger(t, "")
+	open := func(t *testing.T, cap int) (*window, *statestore.Registry) {
+		backend, err := memlog.New(log, memlog.Settings{Root: root})
+		require.NoError(t, err)
+		registry := statestore.NewRegistry(backend)
+		store, err := registry.Get("test")
+		require.NoError(t, err)
+		w, err := newWindow(time.Hour, cap, store, log)
+		require.NoError(t, err)
+		return w, registry
+	}
+
+	w, registry := open(t, 10)
+	now := time.Now()
+	assert.False(t, w.seen("a", now))
+	assert.False(t, w.seen("b", now))
+	// c expires before the window is reopened.
+	assert.False(t, w.seen("c", now.Add(-2*time.Hour)))
+	require.NoError(t, w.close())
+	require.NoError(t, registry.Close())
+
+	w, registry = open(t, 10)
+	assert.Len(t, w.entries, 2)
+	assert.True(t, w.seen("a", now))
+	assert.True(t, w.seen("b", now))
+	assert.False(t, w.seen("c", now.Add(time.Second)))
+	require.NoError(t, w.close())
+	require.NoError(t, registry.Close())
+
+	// Reopening with a smaller capacity keeps the newest keys.
+	w, registry = open(t, 1)
+	defer registry.Close()
+	defer w.close()
+	assert.Len(t, w.entries, 1)
+	assert.Contains(t, w.entries, "c")
+}
@@ -473,6 +473,30 @@ func TestProcessorStringer(t *testing.T) {
 	require.Equal(t, `fingerprint={"Method":"sha256","Encoding":"hex","Fields":["field1"],"TargetField":"fingerprint","IgnoreMissing":false}`, fmt.Sprint(p))
 }
 
+func TestHasher(t *testing.T) {
+	testConfig, err := config.NewConfigFrom(mapstr.M{
+		"fields": []string{"field2", "field1"},
+		"method": "xxhash",
+	})
+	require.NoError(t, err)
+	p, err := New(testConfig)
+	require.NoError(t, err)
+
+	event := &beat.Event{Fields: mapstr.M{"field1": "foo", "field2": 42}}
+	h, err := NewHasher([]string{"field1", "field2"}, "XXHASH", false)
+	require.NoError(t, err)
+	sum, err := h.Sum(event)
+	require.NoError(t, err)
+
+	// The hasher hashes the fields like the processor does.
+	event, err = p.Run(event)
+	require.NoError(t, err)
+	assert.Equal(t, event.Fields["fingerprint"], encodings["hex"].Encode(sum))
+
+	_, err = NewHasher([]string{"field1"}, "crc32", false)
+	assert.ErrorContains(t, err, "invalid fingerprinting method [crc32]")
+}
+
 func BenchmarkHashMethods(b *testing.B) {
 	events := nRandomEvents(100000)
 
@@ -0,0 +1,104 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fingerprint
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Hasher hashes the values of a set of event fields like the fingerprint
+// processor does. It lets other processors identify events by their
+// content.
+type Hasher struct {
+	fields        []string
+	hash          hashMethod
+	ignoreMissing bool
+}
+
+// NewHasher returns a Hasher of the given fields using a hash method
+// supported by the method setting of the fingerprint processor.
+func NewHasher(fields []string, method string, ignoreMissing bool) (*Hasher, error) {
+	var m namedHashMethod
+	if err := m.Unpack(method); err != nil {
+		return nil, err
+	}
+	return newHasher(fields, m.Hash, ignoreMissing), nil
+}
+
+// HashMethod returns the constructor of a hash supported by the method
+// setting of the fingerprint processor. Hashes that are not FIPS approved
+// are not available in FIPS builds.
+func HashMethod(method string) (func() hash.Hash, error) {
+	var m namedHashMethod
+	if err := m.Unpack(method); err != nil {
+		return nil, err
+	}
+	return m.Hash, nil
+}
+
+func newHasher(fields []string, hash hashMethod, ignoreMissing bool) *Hasher {
+	// The fields array must be sorted, to guarantee that we always
+	// get the same hash for a similar set of configured keys.
+	// The call `ToSlice` always returns a sorted slice.
+	return &Hasher{
+		fields:        common.MakeStringSet(fields...).ToSlice(),
+		hash:          hash,
+		ignoreMissing: ignoreMissing,
+	}
+}
+
+// Sum returns the hash of the event fields.
+func (h *Hasher) Sum(event *beat.Event) ([]byte, error) {
+	hashFn := h.hash()
+	if err := h.writeFields(hashFn, event); err != nil {
+		return nil, err
+	}
+	return hashFn.Sum(nil), nil
+}
+
+func (h *Hasher) writeFields(to io.Writer, event *beat.Event) error {
+	for _, k := range h.fields {
+		v, err := event.GetValue(k)
+		if err != nil {
+			if h.ignoreMissing {
+				continue
+			}
+			return makeErrMissingField(k, err)
+		}
+
+		switch vv := v.(type) {
+		case map[string]interface{}, []interface{}, mapstr.M:
+			return makeErrNonScalarField(k)
+		case time.Time:
+			// Ensure we consistently hash times in UTC.
+			v = vv.UTC()
+		}
+
+		fmt.Fprintf(to, "|%v|%v", k, v)
+	}
+
+	_, _ = io.WriteString(to, "|")
+	return nil
+}
@@ -0,0 +1,45 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"fmt"
+)
+
+type config struct {
+	Patterns           []string          `config:"patterns" validate:"required"`
+	PatternDefinitions map[string]string `config:"pattern_definitions"`
+	Field              string            `config:"field"`
+	TargetPrefix       string            `config:"target_prefix"`
+	IgnoreFailure      bool              `config:"ignore_failure"`
+	OverwriteKeys      bool              `config:"overwrite_keys"`
+}
+
+var defaultConfig = config{
+	Field:        "message",
+	TargetPrefix: "grok",
+}
+
+func (c *config) Validate() error {
+	for name := range c.PatternDefinitions {
+		if !patternNameRE.MatchString(name) {
+			return fmt.Errorf("invalid pattern name `%s`, only letters, digits and '_' are allowed", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// referenceRE matches a pattern reference: %{NAME}, %{NAME:field} or
+// %{NAME:field:type}.
+var referenceRE = regexp.MustCompile(`%\{(\w+)(?::([^:}]+)(?::(\w+))?)?\}`)
+
+// patternNameRE matches valid pattern names.
+var patternNameRE = regexp.MustCompile(`^\w+$`)
+
+// groupPrefix prefixes the names of the regular expression groups generated
+// for captures, field names can't be used as group names.
+const groupPrefix = "_grok"
+
+// maxDepth limits the nesting of pattern references, to detect cycles.
+const maxDepth = 64
+
+var errNoMatch = errors.New("no pattern matched")
+
+type dataType string
+
+const (
+	typeString  dataType = ""
+	typeInt     dataType = "int"
+	typeLong    dataType = "long"
+	typeFloat   dataType = "float"
+	typeDouble  dataType = "double"
+	typeBoolean dataType = "boolean"
+)
+
+// Grok matches strings against a list of grok expressions. A grok
+// expression is a regular expression that can reference named patterns
+// using %{NAME}, and capture the text they match into a field using
+// %{NAME:field} or %{NAME:field:type}.
+type Grok struct {
+	expressions []*expression
+}
+
+type expression struct {
+	raw      string
+	re       *regexp.Regexp
+	captures []capture
+}
+
+// capture is a field captured by a regular expression group.
+type capture struct {
+	group    int
+	field    string
+	dataType dataType
+}
+
+// New compiles the grok expressions. References are resolved against
+// definitions first, and then against the default pattern library.
+func New(expressions []string, definitions map[string]string) (*Grok, error) {
+	if len(expressions) == 0 {
+		return nil, errors.New("no grok expression provided")
+	}
+
+	patterns := make(map[string]string, len(defaultPatterns)+len(definitions))
+	for name, pattern := range defaultPatterns {
+		patterns[name] = pattern
+	}
+	for name, pattern := range definitions {
+		patterns[name] = pattern
+	}
+
+	g := &Grok{}
+	for _, raw := range expressions {
+		expr, err := compile(raw, patterns)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile grok expression `%s`: %w", raw, err)
+		}
+		g.expressions = append(g.expressions, expr)
+	}
+	return g, nil
+}
+
+func compile(raw string, patterns map[string]string) (*expression, error) {
+	c := compiler{patterns: patterns}
+	source, err := c.expand(raw, nil)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	expr := &expression{raw: raw, re: re}
+	generated := make([]bool, len(c.captures))
+	for group, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		// Named groups of the regular expression itself, like (?<field>...),
+		// are captured as strings.
+		field, typ := name, typeString
+		if strings.HasPrefix(name, groupPrefix) {
+			// Each generated group appears once, any other group using the
+			// prefix comes from the expression or a pattern definition.
+			i, err := strconv.Atoi(strings.TrimPrefix(name, groupPrefix))
+			if err != nil || i < 0 || i >= len(c.captures) || generated[i] {
+				return nil, fmt.Errorf("group name `%s` uses the reserved prefix `%s`", name, groupPrefix)
+			}
+			generated[i] = true
+			field, typ = c.captures[i].field, c.captures[i].dataType
+		}
+		expr.captures = append(expr.captures, capture{group: group, field: field, dataType: typ})
+	}
+	return expr, nil
+}
+
+type compiler struct {
+	patterns map[string]string
+
+	// captures holds the field and type of each generated group, indexed
+	// by the number in the group name.
+	captures []capture
+}
+
+// expand replaces the pattern references in expr by the regular expressions
+// they stand for. stack holds the names of the patterns being expanded.
+func (c *compiler) expand(expr string, stack []string) (string, error) {
+	if len(stack) > maxDepth {
+		return "", fmt.Errorf("pattern references nested too deeply: %s", strings.Join(stack, " -> "))
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range referenceRE.FindAllStringSubmatchIndex(expr, -1) {
+		b.WriteString(expr[last:m[0]])
+		last = m[1]
+
+		name := expr[m[2]:m[3]]
+		pattern, ok := c.patterns[name]
+		if !ok {
+			return "", fmt.Errorf("unknown pattern `%s`", name)
+		}
+		for _, parent := range stack {
+			if parent == name {
+				return "", fmt.Errorf("recursive pattern reference: %s -> %s", strings.Join(stack, " -> "), name)
+			}
+		}
+
+		expanded, err := c.expand(pattern, append(stack, name))
+		if err != nil {
+			return "", err
+		}
+
+		if m[4] < 0 {
+			b.WriteString("(?:" + expanded + ")")
+			continue
+		}
+		field := expr[m[4]:m[5]]
+		typ := typeString
+		if m[6] >= 0 {
+			typ = dataType(expr[m[6]:m[7]])
+			if err := typ.validate(); err != nil {
+				return "", err
+			}
+		}
+		fmt.Fprintf(&b, "(?P<%s%d>%s)", groupPrefix, len(c.captures), expanded)
+		c.captures = append(c.captures, capture{field: field, dataType: typ})
+	}
+	b.WriteString(expr[last:])
+	return b.String(), nil
+}
+
+// Match matches s against the expressions in order, and returns the fields
+// captured by the first one that matches.
+func (g *Grok) Match(s string) (map[string]interface{}, error) {
+	for _, expr := range g.expressions {
+		loc := expr.re.FindStringSubmatchIndex(s)
+		if loc == nil {
+			continue
+		}
+		return expr.fields(s, loc)
+	}
+	return nil, errNoMatch
+}
+
+func (e *expression) fields(s string, loc []int) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(e.captures))
+	for _, c := range e.captures {
+		start, end := loc[2*c.group], loc[2*c.group+1]
+		if start < 0 {
+			// The group didn't participate in the match.
+			continue
+		}
+		if _, exists := fields[c.field]; exists {
+			// The same field can be captured in several alternatives, the
+			// first one that matched wins.
+			continue
+		}
+		value, err := c.dataType.convert(s[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert field `%s`: %w", c.field, err)
+		}
+		fields[c.field] = value
+	}
+	return fields, nil
+}
+
+func (t dataType) validate() error {
+	switch t {
+	case typeString, typeInt, typeLong, typeFloat, typeDouble, typeBoolean:
+		return nil
+	default:
+		return fmt.Errorf("unsupported data type `%s`, must be one of int, long, float, double or boolean", string(t))
+	}
+}
+
+func (t dataType) convert(s string) (interface{}, error) {
+	switch t {
+	case typeInt:
+		v, err := strconv.ParseInt(s, 10, 32)
+		return int32(v), err
+	case typeLong:
+		return strconv.ParseInt(s, 10, 64)
+	case typeFloat:
+		v, err := strconv.ParseFloat(s, 32)
+		return float32(v), err
+	case typeDouble:
+		return strconv.ParseFloat(s, 64)
+	case typeBoolean:
+		return strconv.ParseBool(s)
+	default:
+		return s, nil
+	}
+}
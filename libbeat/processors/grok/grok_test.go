@@ -0,0 +1,215 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrok(t *testing.T) {
+	tests := map[string]struct {
+		patterns    []string
+		definitions map[string]string
+		input       string
+		want        map[string]interface{}
+	}{
+		"typed captures": {
+			patterns: []string{`%{IP:client} %{WORD:method} %{URIPATHPARAM:request} %{NUMBER:bytes:int} %{NUMBER:duration:double}`},
+			input:    "55.3.244.1 GET /index.html 15824 0.043",
+			want: map[string]interface{}{
+				"client":   "55.3.244.1",
+				"method":   "GET",
+				"request":  "/index.html",
+				"bytes":    int32(15824),
+				"duration": 0.043,
+			},
+		},
+		"all types": {
+			patterns: []string{`%{NUMBER:a:int} %{NUMBER:b:long} %{NUMBER:c:float} %{NUMBER:d:double} %{WORD:e:boolean}`},
+			input:    "1 2 3.5 4.25 true",
+			want: map[string]interface{}{
+				"a": int32(1),
+				"b": int64(2),
+				"c": float32(3.5),
+				"d": 4.25,
+				"e": true,
+			},
+		},
+		"first matching pattern wins": {
+			patterns: []string{
+				`^%{WORD:verb} %{NUMBER:status:int}$`,
+				`^%{WORD:verb} %{GREEDYDATA:rest}$`,
+				`^%{GREEDYDATA:all}$`,
+			},
+			input: "GET not-a-number",
+			want:  map[string]interface{}{"verb": "GET", "rest": "not-a-number"},
+		},
+		"optional section": {
+			patterns: []string{`^%{WORD:verb}(?: %{NUMBER:status:int})?$`},
+			input:    "GET",
+			want:     map[string]interface{}{"verb": "GET"},
+		},
+		"same field in alternatives": {
+			patterns: []string{`(?:%{IPV4:address}|%{HOSTNAME:address})$`},
+			input:    "example.com",
+			want:     map[string]interface{}{"address": "example.com"},
+		},
+		"custom patterns": {
+			patterns:    []string{`%{QUEUEID:queue_id}: %{GREEDYDATA:message}`},
+			definitions: map[string]string{"QUEUEID": `[0-9A-F]{10,11}`, "GREEDYDATA": `.+`},
+			input:       "BEF25A72965: message-id=<20130101142543.5828399CCAF@example.com>",
+			want: map[string]interface{}{
+				"queue_id": "BEF25A72965",
+				"message":  "message-id=<20130101142543.5828399CCAF@example.com>",
+			},
+		},
+		"named groups": {
+			patterns: []string{`(?<user>\w+)@%{HOSTNAME:domain}`},
+			input:    "alice@example.com",
+			want:     map[string]interface{}{"user": "alice", "domain": "example.com"},
+		},
+		"dotted field names": {
+			patterns: []string{`%{IP:source.ip}:%{POSINT:source.port:int}`},
+			input:    "10.0.0.1:8080",
+			want:     map[string]interface{}{"source.ip": "10.0.0.1", "source.port": int32(8080)},
+		},
+		"combined apache log": {
+			patterns: []string{`^%{COMBINEDAPACHELOG}$`},
+			input:    `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`,
+			want: map[string]interface{}{
+				"clientip":    "127.0.0.1",
+				"ident":       "-",
+				"auth":        "frank",
+				"timestamp":   "10/Oct/2000:13:55:36 -0700",
+				"verb":        "GET",
+				"request":     "/apache_pb.gif",
+				"httpversion": "1.0",
+				"response":    "200",
+				"bytes":       "2326",
+				"referrer":    `"http://www.example.com/start.html"`,
+				"agent":       `"Mozilla/4.08"`,
+			},
+		},
+		"syslog": {
+			patterns: []string{`^%{SYSLOGBASE} %{GREEDYDATA:message}$`},
+			input:    "Jan  5 09:12:01 web-01 sshd[4242]: Accepted publickey for admin",
+			want: map[string]interface{}{
+				"timestamp": "Jan  5 09:12:01",
+				"logsource": "web-01",
+				"program":   "sshd",
+				"pid":       "4242",
+				"message":   "Accepted publickey for admin",
+			},
+		},
+		"ipv6": {
+			patterns: []string{`^%{IP:ip}$`},
+			input:    "2001:db8::8a2e:370:7334",
+			want:     map[string]interface{}{"ip": "2001:db8::8a2e:370:7334"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			g, err := New(tc.patterns, tc.definitions)
+			require.NoError(t, err)
+
+			got, err := g.Match(tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestGrokNoMatch(t *testing.T) {
+	g, err := New([]string{`^%{NUMBER:a}$`, `^%{IP:b}$`}, nil)
+	require.NoError(t, err)
+
+	_, err = g.Match("hello")
+	assert.ErrorIs(t, err, errNoMatch)
+}
+
+func TestGrokConversionError(t *testing.T) {
+	g, err := New([]string{`%{WORD:a:int}`}, nil)
+	require.NoError(t, err)
+
+	_, err = g.Match("hello")
+	assert.ErrorContains(t, err, "failed to convert field `a`")
+}
+
+func TestGrokInvalid(t *testing.T) {
+	tests := map[string]struct {
+		patterns    []string
+		definitions map[string]string
+		wantErr     string
+	}{
+		"no pattern": {
+			wantErr: "no grok expression",
+		},
+		"unknown pattern": {
+			patterns: []string{`%{UNKNOWN:a}`},
+			wantErr:  "unknown pattern `UNKNOWN`",
+		},
+		"recursive pattern": {
+			patterns:    []string{`%{A}`},
+			definitions: map[string]string{"A": `a%{B}`, "B": `b%{A}`},
+			wantErr:     "recursive pattern reference: A -> B -> A",
+		},
+		"unsupported type": {
+			patterns: []string{`%{NUMBER:a:decimal}`},
+			wantErr:  "unsupported data type `decimal`",
+		},
+		"invalid regular expression": {
+			patterns: []string{`%{WORD:a}(`},
+			wantErr:  "missing closing )",
+		},
+		"reserved group name": {
+			patterns: []string{`(?P<_grok_x>\w+)`},
+			wantErr:  "group name `_grok_x` uses the reserved prefix `_grok`",
+		},
+		"reserved group name out of range": {
+			patterns: []string{`%{WORD:a} (?P<_grok99>\w+)`},
+			wantErr:  "group name `_grok99` uses the reserved prefix `_grok`",
+		},
+		"reserved group name of a capture": {
+			patterns: []string{`(?P<_grok0>\w+) %{WORD:a}`},
+			wantErr:  "group name `_grok0` uses the reserved prefix `_grok`",
+		},
+		"reserved group name in a definition": {
+			patterns:    []string{`%{CUSTOM:a}`},
+			definitions: map[string]string{"CUSTOM": `(?P<_grok1>\w+)`},
+			wantErr:     "group name `_grok1` uses the reserved prefix `_grok`",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(tc.patterns, tc.definitions)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestDefaultPatternsCompile(t *testing.T) {
+	for name := range defaultPatterns {
+		_, err := New([]string{"%{" + name + ":value}"}, nil)
+		assert.NoError(t, err, name)
+	}
+}
@@ -0,0 +1,122 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	cfg "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const flagParsingError = "grok_parsing_error"
+
+type processor struct {
+	config config
+	grok   *Grok
+}
+
+func init() {
+	processors.RegisterPlugin("grok", NewProcessor)
+	jsprocessor.RegisterPlugin("Grok", NewProcessor)
+}
+
+// NewProcessor constructs a new grok processor.
+func NewProcessor(c *cfg.C) (beat.Processor, error) {
+	config := defaultConfig
+	err := c.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := New(config.Patterns, config.PatternDefinitions)
+	if err != nil {
+		return nil, err
+	}
+	return &processor{config: config, grok: g}, nil
+}
+
+// Run matches the configured field against the patterns and adds the
+// captured values to the event.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	v, err := event.GetValue(p.config.Field)
+	if err != nil {
+		return event, err
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return event, fmt.Errorf("field is not a string, value: `%v`, field: `%s`", v, p.config.Field)
+	}
+
+	m, err := p.grok.Match(s)
+	if err != nil {
+		if err := mapstr.AddTagsWithKey(
+			event.Fields,
+			beat.FlagField,
+			[]string{flagParsingError},
+		); err != nil {
+			return event, fmt.Errorf("cannot add new flag the event: %w", err)
+		}
+		if p.config.IgnoreFailure {
+			return event, nil
+		}
+		return event, err
+	}
+
+	backup := event.Clone()
+	event, err = p.mapper(event, m)
+	if err != nil {
+		return backup, err
+	}
+
+	return event, nil
+}
+
+func (p *processor) mapper(event *beat.Event, m map[string]interface{}) (*beat.Event, error) {
+	prefix := ""
+	if p.config.TargetPrefix != "" {
+		prefix = p.config.TargetPrefix + "."
+	}
+	var prefixKey string
+	for k, v := range m {
+		prefixKey = prefix + k
+		if _, err := event.GetValue(prefixKey); errors.Is(err, mapstr.ErrKeyNotFound) || p.config.OverwriteKeys {
+			_, _ = event.PutValue(prefixKey, v)
+		} else {
+			// When the target key exists but is a string instead of a map.
+			if err != nil {
+				return event, fmt.Errorf("cannot override existing key with `%s`: %w", prefixKey, err)
+			}
+			return event, fmt.Errorf("cannot override existing key with `%s`", prefixKey)
+		}
+	}
+
+	return event, nil
+}
+
+func (p *processor) String() string {
+	return "grok=[" + strings.Join(p.config.Patterns, ", ") + "]" +
+		",field=" + p.config.Field +
+		",target_prefix=" + p.config.TargetPrefix
+}
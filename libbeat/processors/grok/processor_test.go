@@ -0,0 +1,233 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors/dissect"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestProcessor(t *testing.T) {
+	tests := []struct {
+		name   string
+		c      map[string]interface{}
+		fields mapstr.M
+		values map[string]interface{}
+	}{
+		{
+			name:   "default field/default target",
+			c:      map[string]interface{}{"patterns": []string{"hello %{WORD:key}"}},
+			fields: mapstr.M{"message": "hello world"},
+			values: map[string]interface{}{"grok.key": "world"},
+		},
+		{
+			name:   "default field/target root",
+			c:      map[string]interface{}{"patterns": []string{"hello %{WORD:key}"}, "target_prefix": ""},
+			fields: mapstr.M{"message": "hello world"},
+			values: map[string]interface{}{"key": "world"},
+		},
+		{
+			name: "specific field/typed captures",
+			c: map[string]interface{}{
+				"patterns":      []string{"%{IP:source.ip}:%{POSINT:source.port:int}"},
+				"target_prefix": "",
+				"field":         "address",
+			},
+			fields: mapstr.M{"address": "10.0.0.1:8080"},
+			values: map[string]interface{}{"source.ip": "10.0.0.1", "source.port": int32(8080)},
+		},
+		{
+			name: "custom pattern definitions",
+			c: map[string]interface{}{
+				"patterns":            []string{"^%{ID:id} %{GREEDYDATA:msg}$"},
+				"pattern_definitions": map[string]interface{}{"ID": "[A-Z]{3}-[0-9]+"},
+			},
+			fields: mapstr.M{"message": "ABC-123 something happened"},
+			values: map[string]interface{}{"grok.id": "ABC-123", "grok.msg": "something happened"},
+		},
+		{
+			name:   "overwrite keys",
+			c:      map[string]interface{}{"patterns": []string{"%{WORD:key}"}, "target_prefix": "", "overwrite_keys": true},
+			fields: mapstr.M{"message": "world", "key": "old"},
+			values: map[string]interface{}{"key": "world"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := conf.NewConfigFrom(test.c)
+			require.NoError(t, err)
+
+			processor, err := NewProcessor(c)
+			require.NoError(t, err)
+
+			e := beat.Event{Fields: test.fields}
+			event, err := processor.Run(&e)
+			require.NoError(t, err)
+
+			for field, value := range test.values {
+				v, err := event.GetValue(field)
+				require.NoError(t, err)
+				assert.Equal(t, value, v)
+			}
+		})
+	}
+}
+
+func TestProcessorFailures(t *testing.T) {
+	tests := map[string]struct {
+		c       map[string]interface{}
+		fields  mapstr.M
+		wantErr bool
+		flagged bool
+	}{
+		"no match": {
+			c:       map[string]interface{}{"patterns": []string{"^%{NUMBER:n}$"}},
+			fields:  mapstr.M{"message": "hello"},
+			wantErr: true,
+			flagged: true,
+		},
+		"no match with ignore_failure": {
+			c:       map[string]interface{}{"patterns": []string{"^%{NUMBER:n}$"}, "ignore_failure": true},
+			fields:  mapstr.M{"message": "hello"},
+			flagged: true,
+		},
+		"existing key": {
+			c:       map[string]interface{}{"patterns": []string{"%{WORD:key}"}, "target_prefix": ""},
+			fields:  mapstr.M{"message": "hello", "key": "old"},
+			wantErr: true,
+		},
+		"field is not a string": {
+			c:       map[string]interface{}{"patterns": []string{"%{WORD:key}"}},
+			fields:  mapstr.M{"message": 42},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, err := conf.NewConfigFrom(tc.c)
+			require.NoError(t, err)
+
+			processor, err := NewProcessor(c)
+			require.NoError(t, err)
+
+			original := tc.fields.Clone()
+			event, err := processor.Run(&beat.Event{Fields: tc.fields})
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			flags, _ := event.GetValue(beat.FlagField)
+			if tc.flagged {
+				assert.Equal(t, []string{flagParsingError}, flags)
+				return
+			}
+			assert.Nil(t, flags)
+			assert.Equal(t, original, event.Fields, "the event must not be modified")
+		})
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"missing patterns":    {"field": "message"},
+		"unknown pattern":     {"patterns": []string{"%{UNKNOWN:a}"}},
+		"invalid custom name": {"patterns": []string{"%{WORD:a}"}, "pattern_definitions": map[string]interface{}{"MY-PATTERN": "a+"}},
+	}
+
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, err := conf.NewConfigFrom(config)
+			require.NoError(t, err)
+
+			_, err = NewProcessor(c)
+			assert.Error(t, err)
+		})
+	}
+}
+
+const benchmarkMessage = "2025-01-13T10:00:00.000Z INFO [checkout] 10.42.0.17 GET /api/v1/items?page=2 200 1532"
+
+// The grok and dissect benchmarks extract the same fields from the same
+// message, to compare the cost of both processors.
+func BenchmarkProcessor(b *testing.B) {
+	benchmarks := map[string]struct {
+		newProcessor func(*conf.C) (beat.Processor, error)
+		config       map[string]interface{}
+	}{
+		"grok": {
+			newProcessor: NewProcessor,
+			config: map[string]interface{}{"patterns": []string{
+				`%{TIMESTAMP_ISO8601:timestamp} %{LOGLEVEL:level} \[%{DATA:service}\] %{IP:client} %{WORD:method} %{URIPATHPARAM:path} %{NUMBER:status:int} %{NUMBER:bytes:int}`,
+			}},
+		},
+		"grok anchored": {
+			newProcessor: NewProcessor,
+			config: map[string]interface{}{"patterns": []string{
+				`^%{TIMESTAMP_ISO8601:timestamp} %{LOGLEVEL:level} \[%{DATA:service}\] %{IP:client} %{WORD:method} %{URIPATHPARAM:path} %{NUMBER:status:int} %{NUMBER:bytes:int}$`,
+			}},
+		},
+		"grok simple": {
+			newProcessor: NewProcessor,
+			config: map[string]interface{}{"patterns": []string{
+				`^%{NOTSPACE:timestamp} %{NOTSPACE:level} \[%{DATA:service}\] %{NOTSPACE:client} %{NOTSPACE:method} %{NOTSPACE:path} %{NOTSPACE:status:int} %{NOTSPACE:bytes:int}$`,
+			}},
+		},
+		"grok second pattern": {
+			newProcessor: NewProcessor,
+			config: map[string]interface{}{"patterns": []string{
+				`^%{IP:client} %{GREEDYDATA:rest}$`,
+				`^%{NOTSPACE:timestamp} %{NOTSPACE:level} \[%{DATA:service}\] %{NOTSPACE:client} %{NOTSPACE:method} %{NOTSPACE:path} %{NOTSPACE:status:int} %{NOTSPACE:bytes:int}$`,
+			}},
+		},
+		"dissect": {
+			newProcessor: dissect.NewProcessor,
+			config: map[string]interface{}{
+				"tokenizer": "%{timestamp} %{level} [%{service}] %{client} %{method} %{path} %{status|integer} %{bytes|integer}",
+			},
+		},
+	}
+
+	for name, bm := range benchmarks {
+		b.Run(name, func(b *testing.B) {
+			c, err := conf.NewConfigFrom(bm.config)
+			require.NoError(b, err)
+			processor, err := bm.newProcessor(c)
+			require.NoError(b, err)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				event := &beat.Event{Fields: mapstr.M{"message": benchmarkMessage}}
+				if _, err := processor.Run(event); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
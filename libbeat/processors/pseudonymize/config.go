@@ -0,0 +1,62 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pseudonymize
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+type config struct {
+	Key           string        `config:"key" validate:"required"`
+	Hash          string        `config:"hash"`
+	Fields        []fieldConfig `config:"fields" validate:"required"`
+	IgnoreMissing bool          `config:"ignore_missing"`
+	FailOnError   bool          `config:"fail_on_error"`
+}
+
+// fieldConfig sets the method used to pseudonymize a field.
+type fieldConfig struct {
+	From   string `config:"from" validate:"required"`
+	To     string `config:"to"`
+	Method string `config:"method" validate:"required"`
+}
+
+func defaultConfig() config {
+	return config{
+		Hash:        "sha256",
+		FailOnError: true,
+	}
+}
+
+func (c *config) Validate() error {
+	if strings.EqualFold(c.Hash, "xxhash") {
+		return errors.New("xxhash is not a cryptographic hash and can't be used with hmac")
+	}
+	return nil
+}
+
+func (c *fieldConfig) Validate() error {
+	if _, found := methods[c.Method]; !found {
+		return fmt.Errorf("unknown method %q, must be one of %v", c.Method, slices.Sorted(maps.Keys(methods)))
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !requirefips
+
+package pseudonymize
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/netip"
+)
+
+// The IP cipher is a format preserving cipher built as a Feistel network,
+// which is not a FIPS approved mode.
+func init() {
+	methods["encrypt_ip"] = newIPCipher
+}
+
+// feistelRounds is the number of rounds of the Feistel network.
+const feistelRounds = 10
+
+// ipCipher encrypts IPv4 addresses into IPv4 addresses and IPv6 addresses
+// into IPv6 addresses, using a balanced Feistel network with AES as round
+// function. Prefixes are not preserved.
+type ipCipher struct {
+	block cipher.Block
+}
+
+func newIPCipher(key []byte, _ func() hash.Hash) (transform, error) {
+	k, err := deriveKey(key, "encrypt_ip")
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return ipCipher{block: block}, nil
+}
+
+func (c ipCipher) apply(value string) (string, error) {
+	return c.crypt(value, true)
+}
+
+func (c ipCipher) revert(value string) (string, error) {
+	return c.crypt(value, false)
+}
+
+func (c ipCipher) crypt(value string, encrypt bool) (string, error) {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid IP address: %w", err)
+	}
+
+	if addr.Is4() {
+		ip := addr.As4()
+		v := uint64(binary.BigEndian.Uint32(ip[:]))
+		l, r := c.feistel(v>>16, v&0xffff, 16, encrypt)
+		binary.BigEndian.PutUint32(ip[:], uint32(l<<16|r))
+		return netip.AddrFrom4(ip).String(), nil
+	}
+
+	ip := addr.As16()
+	l, r := c.feistel(binary.BigEndian.Uint64(ip[:8]), binary.BigEndian.Uint64(ip[8:]), 64, encrypt)
+	binary.BigEndian.PutUint64(ip[:8], l)
+	binary.BigEndian.PutUint64(ip[8:], r)
+	return netip.AddrFrom16(ip).WithZone(addr.Zone()).String(), nil
+}
+
+// feistel runs the network on the halves l and r of the given bit width.
+func (c ipCipher) feistel(l, r uint64, width int, encrypt bool) (uint64, uint64) {
+	if encrypt {
+		for i := range feistelRounds {
+			l, r = r, l^c.round(i, width, r)
+		}
+		return l, r
+	}
+	for i := feistelRounds - 1; i >= 0; i-- {
+		l, r = r^c.round(i, width, l), l
+	}
+	return l, r
+}
+
+// round is the round function, it encrypts the round number, the width and
+// the half block and truncates the result to the width.
+func (c ipCipher) round(i, width int, half uint64) uint64 {
+	var in, out [aes.BlockSize]byte
+	in[0] = byte(i)
+	in[1] = byte(width)
+	binary.BigEndian.PutUint64(in[8:], half)
+	c.block.Encrypt(out[:], in[:])
+
+	v := binary.BigEndian.Uint64(out[:8])
+	if width < 64 {
+		v &= 1<<width - 1
+	}
+	return v
+}
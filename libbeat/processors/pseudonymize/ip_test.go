@@ -0,0 +1,83 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !requirefips
+
+package pseudonymize
+
+import (
+	"crypto/sha256"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMethodsNoFIPS(t *testing.T) {
+	assert.Len(t, methods, 3)
+	assert.Contains(t, methods, "encrypt_ip")
+}
+
+func TestEncryptIP(t *testing.T) {
+	tr, err := newTransform("encrypt_ip", testKey, sha256.New)
+	require.NoError(t, err)
+
+	for _, ip := range []string{
+		"192.168.1.1",
+		"0.0.0.0",
+		"255.255.255.255",
+		"2001:db8::1",
+		"::ffff:10.0.0.1",
+		"fe80::1%eth0",
+	} {
+		t.Run(ip, func(t *testing.T) {
+			encrypted, err := tr.apply(ip)
+			require.NoError(t, err)
+			assert.NotEqual(t, ip, encrypted)
+
+			in, out := netip.MustParseAddr(ip), netip.MustParseAddr(encrypted)
+			assert.Equal(t, in.Is4(), out.Is4(), "address family must be preserved")
+			assert.Equal(t, in.Zone(), out.Zone())
+
+			again, err := tr.apply(ip)
+			require.NoError(t, err)
+			assert.Equal(t, encrypted, again, "encryption must be deterministic")
+
+			plain, err := Decrypt("encrypt_ip", testKey, encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, ip, plain)
+		})
+	}
+
+	_, err = tr.apply("not an ip")
+	assert.ErrorContains(t, err, "invalid IP address")
+}
+
+func TestEncryptIPIsAPermutation(t *testing.T) {
+	tr, err := newTransform("encrypt_ip", testKey, sha256.New)
+	require.NoError(t, err)
+
+	seen := map[string]bool{}
+	for i := range 1024 {
+		ip := netip.AddrFrom4([4]byte{10, 0, byte(i >> 8), byte(i)}).String()
+		encrypted, err := tr.apply(ip)
+		require.NoError(t, err)
+		require.False(t, seen[encrypted], "duplicate ciphertext %s", encrypted)
+		seen[encrypted] = true
+	}
+}
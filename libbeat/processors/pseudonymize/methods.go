@@ -0,0 +1,142 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pseudonymize
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// minKeyLength is the minimum length of the key in bytes. Shorter HMAC keys
+// are not allowed by FIPS 140-3.
+const minKeyLength = 16
+
+// transform pseudonymizes a value with a key.
+type transform interface {
+	apply(value string) (string, error)
+}
+
+// reversible is a transform whose values can be restored with the key.
+type reversible interface {
+	transform
+	revert(value string) (string, error)
+}
+
+type methodFactory func(key []byte, hash func() hash.Hash) (transform, error)
+
+// methods holds the supported methods by name. Methods that are not FIPS
+// approved are only registered in non FIPS builds.
+var methods = map[string]methodFactory{
+	"hmac":    newHMAC,
+	"encrypt": newAESGCM,
+}
+
+func newTransform(method string, key []byte, hash func() hash.Hash) (transform, error) {
+	factory, found := methods[method]
+	if !found {
+		return nil, fmt.Errorf("unknown method %q", method)
+	}
+	if len(key) < minKeyLength {
+		return nil, fmt.Errorf("the key must be at least %d bytes long", minKeyLength)
+	}
+	return factory(key, hash)
+}
+
+// Decrypt restores a value encrypted by the given method of the
+// pseudonymize processor.
+func Decrypt(method string, key []byte, value string) (string, error) {
+	t, err := newTransform(method, key, sha256.New)
+	if err != nil {
+		return "", err
+	}
+	r, ok := t.(reversible)
+	if !ok {
+		return "", fmt.Errorf("values pseudonymized by the %s method can't be decrypted", method)
+	}
+	return r.revert(value)
+}
+
+// deriveKey derives the key of a cipher from the configured key, so the
+// ciphers never share a key.
+func deriveKey(key []byte, method string) ([]byte, error) {
+	return hkdf.Key(sha256.New, key, nil, "pseudonymize "+method, 32)
+}
+
+// hmacTransform replaces values by their hex encoded HMAC. The configured
+// key is used as is, so pseudonyms can be computed with common tools to
+// look up events.
+type hmacTransform struct {
+	key  []byte
+	hash func() hash.Hash
+}
+
+func newHMAC(key []byte, hash func() hash.Hash) (transform, error) {
+	return hmacTransform{key: key, hash: hash}, nil
+}
+
+func (t hmacTransform) apply(value string) (string, error) {
+	mac := hmac.New(t.hash, t.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// aesGCM encrypts values with AES-256-GCM. The random nonce is prepended
+// to the ciphertext and the result is base64 encoded.
+type aesGCM struct {
+	aead cipher.AEAD
+}
+
+func newAESGCM(key []byte, _ func() hash.Hash) (transform, error) {
+	k, err := deriveKey(key, "encrypt")
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCMWithRandomNonce(block)
+	if err != nil {
+		return nil, err
+	}
+	return aesGCM{aead: aead}, nil
+}
+
+func (t aesGCM) apply(value string) (string, error) {
+	return base64.StdEncoding.EncodeToString(t.aead.Seal(nil, nil, []byte(value), nil)), nil
+}
+
+func (t aesGCM) revert(value string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	plain, err := t.aead.Open(nil, nil, data, nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt the value, it was not encrypted with this key")
+	}
+	return string(plain), nil
+}
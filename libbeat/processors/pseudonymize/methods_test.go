@@ -0,0 +1,76 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pseudonymize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestHMAC(t *testing.T) {
+	tr, err := newTransform("hmac", testKey, sha256.New)
+	require.NoError(t, err)
+
+	got, err := tr.apply("alice")
+	require.NoError(t, err)
+
+	mac := hmac.New(sha256.New, testKey)
+	mac.Write([]byte("alice"))
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), got)
+
+	_, err = Decrypt("hmac", testKey, got)
+	assert.ErrorContains(t, err, "can't be decrypted")
+}
+
+func TestEncrypt(t *testing.T) {
+	tr, err := newTransform("encrypt", testKey, sha256.New)
+	require.NoError(t, err)
+
+	first, err := tr.apply("alice@example.com")
+	require.NoError(t, err)
+	second, err := tr.apply("alice@example.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second, "ciphertexts must use a random nonce")
+
+	for _, encrypted := range []string{first, second} {
+		plain, err := Decrypt("encrypt", testKey, encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, "alice@example.com", plain)
+	}
+
+	_, err = Decrypt("encrypt", []byte("another key of 32 bytes long...."), first)
+	assert.ErrorContains(t, err, "not encrypted with this key")
+
+	_, err = Decrypt("encrypt", testKey, "not base64!")
+	assert.ErrorContains(t, err, "invalid encrypted value")
+}
+
+func TestNewTransformErrors(t *testing.T) {
+	_, err := newTransform("rot13", testKey, sha256.New)
+	assert.ErrorContains(t, err, `unknown method "rot13"`)
+
+	_, err = newTransform("encrypt", []byte("short"), sha256.New)
+	assert.ErrorContains(t, err, "at least 16 bytes")
+}
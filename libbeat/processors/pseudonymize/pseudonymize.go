@@ -0,0 +1,174 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pseudonymize
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	"github.com/elastic/beats/v7/libbeat/processors/fingerprint"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const procName = "pseudonymize"
+
+func init() {
+	processors.RegisterPlugin(procName,
+		checks.ConfigChecked(New,
+			checks.RequireFields("key", "fields"),
+			checks.AllowedFields("key", "hash", "fields", "ignore_missing", "fail_on_error", "when")))
+	jsprocessor.RegisterPlugin("Pseudonymize", New)
+}
+
+type processor struct {
+	config config
+	fields []field
+	log    *logp.Logger
+}
+
+// field is a field to pseudonymize along with its transform.
+type field struct {
+	fieldConfig
+	transform transform
+}
+
+// New constructs a new pseudonymize processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("failed to unpack the %v configuration: %w", procName, err)
+	}
+
+	hash, err := fingerprint.HashMethod(c.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure the %v processor: %w", procName, err)
+	}
+
+	p := &processor{
+		config: c,
+		log:    logp.NewLogger(procName),
+	}
+	for _, fc := range c.Fields {
+		t, err := newTransform(fc.Method, []byte(c.Key), hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure the %v processor for field %s: %w", procName, fc.From, err)
+		}
+		p.fields = append(p.fields, field{fieldConfig: fc, transform: t})
+	}
+	return p, nil
+}
+
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	var backup *beat.Event
+	if p.config.FailOnError {
+		backup = event.Clone()
+	}
+
+	for _, f := range p.fields {
+		err := p.pseudonymizeField(f, event)
+		if err != nil {
+			errMsg := fmt.Errorf("failed to pseudonymize fields in %v processor: %w", procName, err)
+			p.log.Debugw(errMsg.Error(), logp.TypeKey, logp.EventType)
+
+			if p.config.FailOnError {
+				event = backup
+				_, _ = event.PutValue("error.message", errMsg.Error())
+				return event, err
+			}
+		}
+	}
+
+	return event, nil
+}
+
+func (p *processor) pseudonymizeField(f field, event *beat.Event) error {
+	value, err := event.GetValue(f.From)
+	if err != nil {
+		if p.config.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return nil
+		}
+		return fmt.Errorf("could not fetch value for key: %s, Error: %w", f.From, err)
+	}
+
+	result, err := transformValue(f.transform, value)
+	if err != nil {
+		return fmt.Errorf("could not pseudonymize %s with %s: %w", f.From, f.Method, err)
+	}
+
+	target := f.To
+	if target == "" {
+		target = f.From
+	}
+	if _, err := event.PutValue(target, result); err != nil {
+		return fmt.Errorf("could not put value: %v, %w", target, err)
+	}
+	return nil
+}
+
+// transformValue pseudonymizes a scalar value, or each element of an array.
+// Values that are not strings are pseudonymized as their string form.
+func transformValue(t transform, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return t.apply(v)
+	case []string:
+		out := make([]string, len(v))
+		for i, s := range v {
+			r, err := t.apply(s)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, elem := range v {
+			if _, isArray := elem.([]interface{}); isArray {
+				return nil, errors.New("nested arrays are not supported")
+			}
+			r, err := transformValue(t, elem)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	case mapstr.M, map[string]interface{}:
+		return nil, errors.New("objects are not supported")
+	case nil:
+		return nil, errors.New("the value is null")
+	default:
+		return t.apply(fmt.Sprint(v))
+	}
+}
+
+func (p *processor) String() string {
+	fields := make([]string, len(p.config.Fields))
+	for i, f := range p.config.Fields {
+		fields[i] = f.From + ":" + f.Method
+	}
+	return procName + "=[fields=" + strings.Join(fields, ",") + " hash=" + p.config.Hash + "]"
+}
@@ -0,0 +1,140 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pseudonymize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newPseudonymize(t *testing.T, settings mapstr.M) beat.Processor {
+	t.Helper()
+	settings.Put("key", string(testKey))
+	p, err := New(conf.MustNewConfigFrom(settings))
+	require.NoError(t, err)
+	return p
+}
+
+func TestPseudonymize(t *testing.T) {
+	p := newPseudonymize(t, mapstr.M{
+		"fields": []mapstr.M{
+			{"from": "user.name", "method": "hmac"},
+			{"from": "user.email", "to": "user.email_encrypted", "method": "encrypt"},
+			{"from": "related.user", "method": "hmac"},
+			{"from": "process.pid", "method": "hmac"},
+		},
+	})
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{
+		"user":    mapstr.M{"name": "alice", "email": "alice@example.com"},
+		"related": mapstr.M{"user": []interface{}{"alice", "bob"}},
+		"process": mapstr.M{"pid": 42},
+	}})
+	require.NoError(t, err)
+
+	alice, _ := hmacTransform{key: testKey, hash: sha256.New}.apply("alice")
+	bob, _ := hmacTransform{key: testKey, hash: sha256.New}.apply("bob")
+	pid, _ := hmacTransform{key: testKey, hash: sha256.New}.apply("42")
+
+	assert.Equal(t, alice, mustGet(t, event, "user.name"))
+	assert.Equal(t, []interface{}{alice, bob}, mustGet(t, event, "related.user"))
+	assert.Equal(t, pid, mustGet(t, event, "process.pid"))
+	assert.Equal(t, "alice@example.com", mustGet(t, event, "user.email"))
+
+	encrypted, ok := mustGet(t, event, "user.email_encrypted").(string)
+	require.True(t, ok)
+	plain, err := Decrypt("encrypt", testKey, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", plain)
+}
+
+func TestPseudonymizeHash(t *testing.T) {
+	p := newPseudonymize(t, mapstr.M{
+		"hash":   "sha512",
+		"fields": []mapstr.M{{"from": "user.name", "method": "hmac"}},
+	})
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{"user": mapstr.M{"name": "alice"}}})
+	require.NoError(t, err)
+
+	mac := hmac.New(sha512.New, testKey)
+	mac.Write([]byte("alice"))
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), mustGet(t, event, "user.name"))
+}
+
+func TestPseudonymizeErrors(t *testing.T) {
+	fields := []mapstr.M{
+		{"from": "user.name", "method": "hmac"},
+		{"from": "user.email", "method": "hmac"},
+	}
+
+	t.Run("missing field", func(t *testing.T) {
+		p := newPseudonymize(t, mapstr.M{"fields": fields})
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"user": mapstr.M{"name": "alice"}}})
+		require.Error(t, err)
+		assert.Equal(t, "alice", mustGet(t, event, "user.name"), "event must be restored on failure")
+		assert.Contains(t, mustGet(t, event, "error.message"), "user.email")
+	})
+
+	t.Run("ignore missing", func(t *testing.T) {
+		p := newPseudonymize(t, mapstr.M{"fields": fields, "ignore_missing": true})
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"user": mapstr.M{"name": "alice"}}})
+		require.NoError(t, err)
+		assert.NotEqual(t, "alice", mustGet(t, event, "user.name"))
+	})
+
+	t.Run("object", func(t *testing.T) {
+		p := newPseudonymize(t, mapstr.M{"fields": fields[:1], "fail_on_error": false})
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"user": mapstr.M{"name": mapstr.M{"first": "alice"}}}})
+		require.NoError(t, err)
+		assert.Equal(t, mapstr.M{"first": "alice"}, mustGet(t, event, "user.name"))
+	})
+}
+
+func TestPseudonymizeConfig(t *testing.T) {
+	for name, settings := range map[string]mapstr.M{
+		"unknown method": {"key": string(testKey), "fields": []mapstr.M{{"from": "a", "method": "rot13"}}},
+		"short key":      {"key": "secret", "fields": []mapstr.M{{"from": "a", "method": "hmac"}}},
+		"xxhash":         {"key": string(testKey), "hash": "xxhash", "fields": []mapstr.M{{"from": "a", "method": "hmac"}}},
+		"unknown hash":   {"key": string(testKey), "hash": "crc32", "fields": []mapstr.M{{"from": "a", "method": "hmac"}}},
+		"missing key":    {"fields": []mapstr.M{{"from": "a", "method": "hmac"}}},
+		"missing fields": {"key": string(testKey)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(conf.MustNewConfigFrom(settings))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func mustGet(t *testing.T, event *beat.Event, key string) interface{} {
+	t.Helper()
+	v, err := event.GetValue(key)
+	require.NoError(t, err)
+	return v
+}
@@ -0,0 +1,104 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+func init() {
+	register("gcra", newGCRA)
+}
+
+// gcra implements the generic cell rate algorithm. It behaves like a token
+// bucket, but only keeps the theoretical arrival time of the next event per
+// key instead of a number of tokens, and doesn't need to replenish buckets.
+type gcra struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	tolerance time.Duration
+	arrivals  *keyStore[*time.Time]
+	clock     clockwork.Clock
+}
+
+type gcraConfig struct {
+	// Burst is the number of events allowed at once. It defaults to the
+	// limit value, like the default depth of token_bucket.
+	Burst int `config:"burst" validate:"min=0"`
+
+	// MaxKeys is the maximum number of keys whose arrival time is kept.
+	MaxKeys int `config:"max_keys" validate:"min=1"`
+}
+
+func newGCRA(config algoConfig) (algorithm, error) {
+	cfg := gcraConfig{
+		MaxKeys: 10000,
+	}
+	if err := config.config.Unpack(&cfg); err != nil {
+		return nil, fmt.Errorf("could not unpack gcra algorithm configuration: %w", err)
+	}
+
+	perSecond := config.limit.valuePerSecond()
+	if perSecond <= 0 {
+		return nil, errors.New("gcra requires a positive limit")
+	}
+	burst := cfg.Burst
+	if burst == 0 {
+		burst = max(int(math.Ceil(config.limit.value)), 1)
+	}
+
+	interval := time.Duration(float64(time.Second) / perSecond)
+	return &gcra{
+		interval:  interval,
+		tolerance: time.Duration(burst-1) * interval,
+		arrivals:  newKeyStore[*time.Time](cfg.MaxKeys),
+		clock:     clockwork.NewRealClock(),
+	}, nil
+}
+
+func (g *gcra) IsAllowed(key uint64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.clock.Now()
+	tat := g.arrivals.get(key, func() *time.Time {
+		t := now
+		return &t
+	})
+
+	next := *tat
+	if next.Before(now) {
+		next = now
+	}
+	if next.Sub(now) > g.tolerance {
+		return false
+	}
+	*tat = next.Add(g.interval)
+	return true
+}
+
+// setClock allows test code to inject a fake clock
+func (g *gcra) setClock(c clockwork.Clock) {
+	g.clock = c
+}
@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestGCRA(t *testing.T) {
+	algo, clock := newTestAlgorithm(t, "gcra", "2/s", mapstr.M{})
+
+	// The default burst is the limit value.
+	assert.True(t, algo.IsAllowed(1))
+	assert.True(t, algo.IsAllowed(1))
+	assert.False(t, algo.IsAllowed(1))
+	assert.True(t, algo.IsAllowed(2))
+
+	// One event is allowed every 500ms.
+	clock.Advance(400 * time.Millisecond)
+	assert.False(t, algo.IsAllowed(1))
+	clock.Advance(100 * time.Millisecond)
+	assert.True(t, algo.IsAllowed(1))
+	assert.False(t, algo.IsAllowed(1))
+
+	// The burst builds up again over time.
+	clock.Advance(10 * time.Second)
+	assert.True(t, algo.IsAllowed(1))
+	assert.True(t, algo.IsAllowed(1))
+	assert.False(t, algo.IsAllowed(1))
+}
+
+func TestGCRABurst(t *testing.T) {
+	algo, clock := newTestAlgorithm(t, "gcra", "10/m", mapstr.M{"burst": 1})
+
+	assert.True(t, algo.IsAllowed(1))
+	assert.False(t, algo.IsAllowed(1))
+	clock.Advance(6 * time.Second)
+	assert.True(t, algo.IsAllowed(1))
+	assert.False(t, algo.IsAllowed(1))
+}
+
+func TestGCRAMaxKeys(t *testing.T) {
+	algo, _ := newTestAlgorithm(t, "gcra", "1/m", mapstr.M{"max_keys": 2})
+
+	for key := range uint64(10) {
+		assert.True(t, algo.IsAllowed(key))
+	}
+	assert.Equal(t, 2, algo.(*gcra).arrivals.len())
+}
+
+func TestGCRAConfig(t *testing.T) {
+	_, err := factory("gcra", algoConfig{config: *conf.NewConfig()})
+	assert.ErrorContains(t, err, "gcra requires a positive limit")
+
+	var r rate
+	require.NoError(t, r.Unpack("1/s"))
+	_, err = factory("gcra", algoConfig{
+		limit:  r,
+		config: *conf.MustNewConfigFrom(mapstr.M{"burst": -1}),
+	})
+	assert.ErrorContains(t, err, "requires value >= 0")
+}
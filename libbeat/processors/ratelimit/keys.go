@@ -0,0 +1,67 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ratelimit
+
+import "container/list"
+
+// keyStore holds the state of the most recently used keys, so the memory
+// used by an algorithm is bounded whatever the cardinality of the keys. When
+// the store is full, the state of the least recently used key is dropped, and
+// that key starts over with a fresh state. It is not safe for concurrent use.
+type keyStore[T any] struct {
+	maxKeys int
+	keys    map[uint64]*list.Element
+	lru     list.List
+}
+
+type keyEntry[T any] struct {
+	key   uint64
+	state T
+}
+
+func newKeyStore[T any](maxKeys int) *keyStore[T] {
+	return &keyStore[T]{
+		maxKeys: maxKeys,
+		keys:    make(map[uint64]*list.Element),
+	}
+}
+
+// get returns the state of key, creating it with newState if the key isn't
+// in the store.
+func (s *keyStore[T]) get(key uint64, newState func() T) T {
+	if elem, ok := s.keys[key]; ok {
+		s.lru.MoveToFront(elem)
+		//nolint:errcheck // The store only holds entries of this type.
+		return elem.Value.(*keyEntry[T]).state
+	}
+
+	if s.lru.Len() >= s.maxKeys {
+		oldest := s.lru.Back()
+		//nolint:errcheck // The store only holds entries of this type.
+		delete(s.keys, oldest.Value.(*keyEntry[T]).key)
+		s.lru.Remove(oldest)
+	}
+
+	entry := &keyEntry[T]{key: key, state: newState()}
+	s.keys[key] = s.lru.PushFront(entry)
+	return entry.state
+}
+
+func (s *keyStore[T]) len() int {
+	return s.lru.Len()
+}
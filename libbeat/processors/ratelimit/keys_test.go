@@ -0,0 +1,45 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyStore(t *testing.T) {
+	created := 0
+	newState := func() *int {
+		created++
+		n := created
+		return &n
+	}
+
+	s := newKeyStore[*int](2)
+	assert.Equal(t, 1, *s.get(1, newState))
+	assert.Equal(t, 2, *s.get(2, newState))
+	assert.Equal(t, 1, *s.get(1, newState))
+	assert.Equal(t, 2, s.len())
+
+	// Key 2 is the least recently used one, so it's dropped.
+	assert.Equal(t, 3, *s.get(3, newState))
+	assert.Equal(t, 2, s.len())
+	assert.Equal(t, 1, *s.get(1, newState))
+	assert.Equal(t, 4, *s.get(2, newState))
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type unit string
@@ -81,6 +82,20 @@ func (l *rate) valuePerSecond() float64 {
 	return 0
 }
 
+// window returns the duration of the time unit of the rate.
+func (l *rate) window() time.Duration {
+	switch l.unit {
+	case unitPerSecond:
+		return time.Second
+	case unitPerMinute:
+		return time.Minute
+	case unitPerHour:
+		return time.Hour
+	}
+
+	return 0
+}
+
 func contains(allowed []unit, candidate string) bool {
 	for _, a := range allowed {
 		if candidate == string(a) {
@@ -0,0 +1,64 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ratelimit
+
+import (
+	"sync"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+const (
+	// maxDroppedKeys is the maximum number of keys whose dropped events
+	// are counted separately, to bound the cardinality of the metrics.
+	maxDroppedKeys = 1000
+
+	// otherKeys counts the dropped events of the keys past maxDroppedKeys.
+	otherKeys = "_other"
+)
+
+// droppedKeys counts the dropped events per key.
+type droppedKeys struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (d *droppedKeys) inc(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.counts == nil {
+		d.counts = make(map[string]int64)
+	}
+	if _, ok := d.counts[key]; !ok && len(d.counts) >= maxDroppedKeys {
+		key = otherKeys
+	}
+	d.counts[key]++
+}
+
+// report reports the counts as a monitoring namespace keyed by key.
+func (d *droppedKeys) report(_ monitoring.Mode, V monitoring.Visitor) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	V.OnRegistryStart()
+	defer V.OnRegistryFinished()
+	for key, n := range d.counts {
+		monitoring.ReportInt(V, key, n)
+	}
+}
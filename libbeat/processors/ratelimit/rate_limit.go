@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 	"sync/atomic"
 
 	"github.com/jonboulle/clockwork"
@@ -46,7 +47,8 @@ func init() {
 }
 
 type metrics struct {
-	Dropped *monitoring.Int
+	Dropped      *monitoring.Int
+	DroppedByKey *droppedKeys
 }
 
 type rateLimit struct {
@@ -92,6 +94,10 @@ func new(cfg *c.C) (beat.Processor, error) {
 			Dropped: monitoring.NewInt(reg, "dropped"),
 		},
 	}
+	if len(config.Fields) > 0 {
+		p.metrics.DroppedByKey = &droppedKeys{}
+		monitoring.NewFunc(reg, "dropped_by_key", p.metrics.DroppedByKey.report)
+	}
 
 	p.setClock(clockwork.NewRealClock())
 
@@ -112,6 +118,9 @@ func (p *rateLimit) Run(event *beat.Event) (*beat.Event, error) {
 
 	p.logger.Debugf("event [%v] dropped by rate_limit processor", event)
 	p.metrics.Dropped.Inc()
+	if p.metrics.DroppedByKey != nil {
+		p.metrics.DroppedByKey.inc(p.keyLabel(event))
+	}
 	return nil, nil
 }
 
@@ -145,6 +154,23 @@ func (p *rateLimit) makeKey(event *beat.Event) (uint64, error) {
 	return hashstructure.Hash(values, nil)
 }
 
+// keyLabel returns a readable form of the key of the event, made of the
+// field values, for the per-key metrics.
+func (p *rateLimit) keyLabel(event *beat.Event) string {
+	var b strings.Builder
+	for i, field := range p.config.Fields {
+		value, err := event.GetValue(field)
+		if err != nil {
+			value = ""
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%v", field, value)
+	}
+	return b.String()
+}
+
 // setClock allows test code to inject a fake clock
 // TODO: remove this method and move tests that use it to algorithm level.
 func (p *rateLimit) setClock(c clockwork.Clock) {
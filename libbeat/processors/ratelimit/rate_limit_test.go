@@ -18,6 +18,7 @@
 package ratelimit
 
 import (
+	"strconv"
 	"testing"
 	"time"
 
@@ -27,6 +28,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/beat"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
 )
 
 func TestNew(t *testing.T) {
@@ -139,6 +141,28 @@ func TestRateLimit(t *testing.T) {
 				withField(inEvents[3], "foo", "seger"),
 			},
 		},
+		"sliding_window": {
+			config: mapstr.M{
+				"limit": "2/s",
+				"algorithm": mapstr.M{
+					"sliding_window": mapstr.M{},
+				},
+			},
+			delay:     200 * time.Millisecond,
+			inEvents:  inEvents,
+			outEvents: []beat.Event{inEvents[0], inEvents[1], inEvents[5]},
+		},
+		"gcra": {
+			config: mapstr.M{
+				"limit": "2/s",
+				"algorithm": mapstr.M{
+					"gcra": mapstr.M{},
+				},
+			},
+			delay:     200 * time.Millisecond,
+			inEvents:  inEvents,
+			outEvents: []beat.Event{inEvents[0], inEvents[1], inEvents[3], inEvents[5]},
+		},
 		"with_burst": {
 			config: mapstr.M{
 				"limit":            "2/s",
@@ -177,6 +201,46 @@ func TestRateLimit(t *testing.T) {
 	}
 }
 
+func TestDroppedByKey(t *testing.T) {
+	p, err := new(conf.MustNewConfigFrom(mapstr.M{
+		"limit":  "1/m",
+		"fields": []string{"service.name", "host.name"},
+	}))
+	require.NoError(t, err)
+
+	for _, event := range []mapstr.M{
+		{"service": mapstr.M{"name": "a"}, "host": mapstr.M{"name": "h1"}},
+		{"service": mapstr.M{"name": "a"}, "host": mapstr.M{"name": "h1"}},
+		{"service": mapstr.M{"name": "a"}, "host": mapstr.M{"name": "h1"}},
+		{"service": mapstr.M{"name": "b"}},
+		{"service": mapstr.M{"name": "b"}},
+	} {
+		_, err := p.Run(&beat.Event{Fields: event})
+		require.NoError(t, err)
+	}
+
+	reg := monitoring.NewRegistry()
+	monitoring.NewFunc(reg, "dropped_by_key", p.(*rateLimit).metrics.DroppedByKey.report)
+	require.Equal(t, map[string]interface{}{
+		"dropped_by_key": map[string]interface{}{
+			"host.name=h1,service.name=a": int64(2),
+			"host.name=,service.name=b":   int64(1),
+		},
+	}, monitoring.CollectStructSnapshot(reg, monitoring.Full, false))
+}
+
+func TestDroppedKeysBounded(t *testing.T) {
+	var d droppedKeys
+	for i := range maxDroppedKeys + 10 {
+		d.inc(strconv.Itoa(i))
+	}
+	d.inc("0")
+
+	require.Len(t, d.counts, maxDroppedKeys+1)
+	require.Equal(t, int64(2), d.counts["0"])
+	require.Equal(t, int64(10), d.counts[otherKeys])
+}
+
 func TestAllocs(t *testing.T) {
 	p, err := new(conf.MustNewConfigFrom(mapstr.M{
 		"limit": "100/s",
@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+func init() {
+	register("sliding_window", newSlidingWindow)
+}
+
+// slidingWindow allows at most limit events per key within any window of
+// time. It logs the time of the allowed events, so unlike token_bucket it
+// never allows more than limit events in a burst.
+type slidingWindow struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	logs   *keyStore[*eventLog]
+	clock  clockwork.Clock
+}
+
+type slidingWindowConfig struct {
+	// MaxKeys is the maximum number of keys whose events are logged.
+	MaxKeys int `config:"max_keys" validate:"min=1"`
+}
+
+// eventLog is a ring of the times of the last allowed events of a key.
+type eventLog struct {
+	times  []time.Time
+	oldest int
+}
+
+func newSlidingWindow(config algoConfig) (algorithm, error) {
+	cfg := slidingWindowConfig{
+		MaxKeys: 10000,
+	}
+	if err := config.config.Unpack(&cfg); err != nil {
+		return nil, fmt.Errorf("could not unpack sliding_window algorithm configuration: %w", err)
+	}
+
+	limit := math.Floor(config.limit.value)
+	if limit < 1 {
+		return nil, errors.New("sliding_window requires a limit of at least 1 event per time unit")
+	}
+
+	return &slidingWindow{
+		limit:  int(limit),
+		window: config.limit.window(),
+		logs:   newKeyStore[*eventLog](cfg.MaxKeys),
+		clock:  clockwork.NewRealClock(),
+	}, nil
+}
+
+func (s *slidingWindow) IsAllowed(key uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	log := s.logs.get(key, func() *eventLog { return &eventLog{} })
+	if len(log.times) < s.limit {
+		log.times = append(log.times, now)
+		return true
+	}
+	if now.Sub(log.times[log.oldest]) < s.window {
+		return false
+	}
+	log.times[log.oldest] = now
+	log.oldest = (log.oldest + 1) % s.limit
+	return true
+}
+
+// setClock allows test code to inject a fake clock
+func (s *slidingWindow) setClock(c clockwork.Clock) {
+	s.clock = c
+}
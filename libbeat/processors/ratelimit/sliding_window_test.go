@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newTestAlgorithm(t *testing.T, id string, limit string, settings mapstr.M) (algorithm, clockwork.FakeClock) {
+	t.Helper()
+	var r rate
+	require.NoError(t, r.Unpack(limit))
+	algo, err := factory(id, algoConfig{
+		limit:  r,
+		config: *conf.MustNewConfigFrom(settings),
+	})
+	require.NoError(t, err)
+
+	clock := clockwork.NewFakeClockAt(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	algo.(interface{ setClock(clockwork.Clock) }).setClock(clock)
+	return algo, clock
+}
+
+func TestSlidingWindow(t *testing.T) {
+	algo, clock := newTestAlgorithm(t, "sliding_window", "3/s", mapstr.M{})
+
+	assert.True(t, algo.IsAllowed(1))
+	clock.Advance(900 * time.Millisecond)
+	assert.True(t, algo.IsAllowed(1))
+	assert.True(t, algo.IsAllowed(1))
+	assert.False(t, algo.IsAllowed(1))
+
+	// Only the first event left the window, the others still count.
+	clock.Advance(100 * time.Millisecond)
+	assert.True(t, algo.IsAllowed(1))
+	assert.False(t, algo.IsAllowed(1))
+
+	// Keys are limited independently.
+	assert.True(t, algo.IsAllowed(2))
+
+	clock.Advance(900 * time.Millisecond)
+	assert.True(t, algo.IsAllowed(1))
+	assert.True(t, algo.IsAllowed(1))
+	assert.False(t, algo.IsAllowed(1))
+}
+
+func TestSlidingWindowMaxKeys(t *testing.T) {
+	algo, _ := newTestAlgorithm(t, "sliding_window", "1/m", mapstr.M{"max_keys": 1})
+
+	assert.True(t, algo.IsAllowed(1))
+	assert.False(t, algo.IsAllowed(1))
+
+	// Key 2 evicts key 1, which starts over.
+	assert.True(t, algo.IsAllowed(2))
+	assert.True(t, algo.IsAllowed(1))
+	assert.Equal(t, 1, algo.(*slidingWindow).logs.len())
+}
+
+func TestSlidingWindowConfig(t *testing.T) {
+	var r rate
+	require.NoError(t, r.Unpack("0.5/s"))
+	_, err := factory("sliding_window", algoConfig{limit: r, config: *conf.NewConfig()})
+	assert.ErrorContains(t, err, "at least 1 event per time unit")
+
+	require.NoError(t, r.Unpack("1/s"))
+	_, err = factory("sliding_window", algoConfig{
+		limit:  r,
+		config: *conf.MustNewConfigFrom(mapstr.M{"max_keys": 0}),
+	})
+	assert.ErrorContains(t, err, "requires value >= 1")
+}
@@ -0,0 +1,69 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Masking styles.
+const (
+	maskFull    = "full"
+	maskPartial = "partial"
+	maskHash    = "hash"
+)
+
+type config struct {
+	Fields        []string `config:"fields"`
+	Detectors     []string `config:"detectors"`
+	Mask          string   `config:"mask"`
+	Key           string   `config:"key"`
+	TargetField   string   `config:"target_field"`
+	IgnoreMissing bool     `config:"ignore_missing"`
+}
+
+func defaultConfig() config {
+	return config{
+		Detectors:   detectorNames(),
+		Mask:        maskFull,
+		TargetField: "redact",
+	}
+}
+
+func (c *config) Validate() error {
+	if len(c.Detectors) == 0 {
+		return fmt.Errorf("at least one detector is required, supported detectors are %v", detectorNames())
+	}
+	for _, name := range c.Detectors {
+		if !slices.Contains(detectorNames(), name) {
+			return fmt.Errorf("unknown detector %q, supported detectors are %v", name, detectorNames())
+		}
+	}
+	switch c.Mask {
+	case maskFull, maskPartial, maskHash:
+	default:
+		return fmt.Errorf("unknown mask %q, must be one of %s, %s or %s", c.Mask, maskFull, maskPartial, maskHash)
+	}
+	if c.Mask == maskHash && c.Key == "" {
+		// Values with few possibilities, like card numbers, could be found
+		// back from an unkeyed hash.
+		return fmt.Errorf("key is required when mask is %s", maskHash)
+	}
+	return nil
+}
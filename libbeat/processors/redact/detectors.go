@@ -0,0 +1,236 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"regexp"
+	"strings"
+)
+
+// detector finds a kind of sensitive value in strings.
+type detector struct {
+	name string
+	re   *regexp.Regexp
+	// validate returns the bounds of the valid part of a match, which are
+	// equal if the match is a false positive. Nil if all matches are valid.
+	validate func(match string) (start, end int)
+	// partial masks a value, keeping the parts that help identifying it.
+	partial func(value string) string
+}
+
+// detectors holds the built-in detectors. When matches of several detectors
+// start at the same position, the longest wins, then the first detector.
+// If a pattern has a capturing group, only the group is redacted.
+var detectors = []detector{
+	{
+		name:    "jwt",
+		re:      regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+		partial: keepPrefix(4),
+	},
+	{
+		name:    "bearer_token",
+		re:      regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+		partial: keepPrefix(4),
+	},
+	{
+		name:    "aws_access_key",
+		re:      regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|AROA)[A-Z0-9]{16}\b`),
+		partial: keepPrefix(4),
+	},
+	{
+		name:    "aws_secret_key",
+		re:      regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})`),
+		partial: keepPrefix(4),
+	},
+	{
+		name:     "credit_card",
+		re:       regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		validate: validCreditCard,
+		partial:  maskCreditCard,
+	},
+	{
+		name:     "iban",
+		re:       regexp.MustCompile(`\b[A-Z]{2}\d{2}(?:[A-Z0-9]{11,30}|(?: [A-Z0-9]{4}){2,7}(?: [A-Z0-9]{1,4})?)\b`),
+		validate: validIBAN,
+		partial:  maskIBAN,
+	},
+	{
+		name:    "email",
+		re:      regexp.MustCompile(`\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}\b`),
+		partial: maskEmail,
+	},
+}
+
+func detectorNames() []string {
+	names := make([]string, len(detectors))
+	for i, d := range detectors {
+		names[i] = d.name
+	}
+	return names
+}
+
+// validCreditCard returns the longest card number in a match. A match may
+// include digit groups around the card number, like an expiry date or a
+// security code, so card numbers starting and ending at the separators of
+// the match are checked too.
+func validCreditCard(s string) (start, end int) {
+	var starts, ends []int
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			continue
+		}
+		if i == 0 || !isDigit(s[i-1]) {
+			starts = append(starts, i)
+		}
+		if i == len(s)-1 || !isDigit(s[i+1]) {
+			ends = append(ends, i+1)
+		}
+	}
+	for _, i := range starts {
+		for j := len(ends) - 1; j >= 0 && ends[j] > i; j-- {
+			if ends[j]-i <= end-start {
+				break
+			}
+			if luhnCardNumber(s[i:ends[j]]) {
+				start, end = i, ends[j]
+				break
+			}
+		}
+	}
+	return start, end
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// luhnCardNumber checks the length and the Luhn checksum of a card number.
+func luhnCardNumber(s string) bool {
+	var sum, n int
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// validIBAN checks the mod 97 checksum of an IBAN. A match written in
+// groups of four may include the next word, so trailing groups are dropped
+// until the checksum is valid.
+func validIBAN(s string) (start, end int) {
+	for {
+		if ibanChecksum(strings.ReplaceAll(s, " ", "")) {
+			return 0, len(s)
+		}
+		i := strings.LastIndexByte(s, ' ')
+		if i < 0 {
+			return 0, 0
+		}
+		s = s[:i]
+	}
+}
+
+func ibanChecksum(iban string) bool {
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	rearranged := iban[4:] + iban[:4]
+	rem := 0
+	for i := 0; i < len(rearranged); i++ {
+		c := rearranged[i]
+		switch {
+		case c >= '0' && c <= '9':
+			rem = (rem*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			rem = (rem*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
+
+// maskCreditCard masks all the digits of a card number but the last 4.
+func maskCreditCard(s string) string {
+	digits := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			digits++
+		}
+	}
+	b := []byte(s)
+	for i := range b {
+		if b[i] >= '0' && b[i] <= '9' {
+			if digits > 4 {
+				b[i] = '*'
+			}
+			digits--
+		}
+	}
+	return string(b)
+}
+
+// maskIBAN masks an IBAN but its country code, its check digits and its
+// last 4 characters.
+func maskIBAN(s string) string {
+	b := []byte(s)
+	var seen int
+	total := len(strings.ReplaceAll(s, " ", ""))
+	for i := range b {
+		if b[i] == ' ' {
+			continue
+		}
+		if seen >= 4 && seen < total-4 {
+			b[i] = '*'
+		}
+		seen++
+	}
+	return string(b)
+}
+
+// maskEmail masks the local part of an email address but its first
+// character.
+func maskEmail(s string) string {
+	at := strings.LastIndexByte(s, '@')
+	if at < 1 {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:1] + strings.Repeat("*", at-1) + s[at:]
+}
+
+// keepPrefix masks secrets, whose length is not worth keeping, but their
+// first n characters.
+func keepPrefix(n int) func(string) string {
+	return func(s string) string {
+		if len(s) <= 2*n {
+			return "****"
+		}
+		return s[:n] + "****"
+	}
+}
@@ -0,0 +1,255 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const procName = "redact"
+
+func init() {
+	processors.RegisterPlugin(procName,
+		checks.ConfigChecked(New,
+			checks.AllowedFields("fields", "detectors", "mask", "key", "target_field", "ignore_missing", "when")))
+	jsprocessor.RegisterPlugin("Redact", New)
+}
+
+type processor struct {
+	config    config
+	detectors []*detector
+	log       *logp.Logger
+}
+
+// match is a sensitive value found in a string.
+type match struct {
+	start, end int
+	detector   *detector
+}
+
+// New constructs a new redact processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("failed to unpack the %v configuration: %w", procName, err)
+	}
+
+	p := &processor{
+		config: c,
+		log:    logp.NewLogger(procName),
+	}
+	for i := range detectors {
+		if slices.Contains(c.Detectors, detectors[i].name) {
+			p.detectors = append(p.detectors, &detectors[i])
+		}
+	}
+	return p, nil
+}
+
+// Run redacts the configured fields, or all the string fields of the event.
+// A field that can't be redacted doesn't prevent redacting the others.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	counts := map[string]int{}
+	var errs []error
+
+	if len(p.config.Fields) == 0 {
+		p.redactMap(event.Fields, "", counts)
+	}
+	for _, field := range p.config.Fields {
+		value, err := event.GetValue(field)
+		if err != nil {
+			if p.config.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+				continue
+			}
+			errs = append(errs, fmt.Errorf("could not fetch value for key: %s, Error: %w", field, err))
+			continue
+		}
+		if redacted, changed := p.redactValue(value, field, counts); changed {
+			if _, err := event.PutValue(field, redacted); err != nil {
+				errs = append(errs, fmt.Errorf("could not put value: %v, %w", field, err))
+			}
+		}
+	}
+
+	if p.config.TargetField != "" {
+		for name, n := range counts {
+			key := p.config.TargetField + "." + name
+			if prev, err := event.GetValue(key); err == nil {
+				if prev, ok := prev.(int); ok {
+					n += prev
+				}
+			}
+			_, _ = event.PutValue(key, n)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		err = fmt.Errorf("failed to redact fields in %v processor: %w", procName, err)
+		p.log.Debugw(err.Error(), logp.TypeKey, logp.EventType)
+		return event, err
+	}
+	return event, nil
+}
+
+// redactMap redacts the values of m in place, but the target field.
+func (p *processor) redactMap(m map[string]interface{}, path string, counts map[string]int) bool {
+	changed := false
+	for k, v := range m {
+		key := k
+		if path != "" {
+			key = path + "." + k
+		}
+		if key == p.config.TargetField {
+			continue
+		}
+		if redacted, ok := p.redactValue(v, key, counts); ok {
+			m[k] = redacted
+			changed = true
+		}
+	}
+	return changed
+}
+
+// redactValue redacts a string, or the strings held by an array or an
+// object. Arrays are copied rather than modified, as they may be shared
+// between events.
+func (p *processor) redactValue(value interface{}, path string, counts map[string]int) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		return p.redactString(v, counts)
+	case []string:
+		var out []string
+		for i, s := range v {
+			if redacted, ok := p.redactString(s, counts); ok {
+				if out == nil {
+					out = slices.Clone(v)
+				}
+				out[i] = redacted
+			}
+		}
+		if out == nil {
+			return v, false
+		}
+		return out, true
+	case []interface{}:
+		var out []interface{}
+		for i, elem := range v {
+			if redacted, ok := p.redactValue(elem, path, counts); ok {
+				if out == nil {
+					out = slices.Clone(v)
+				}
+				out[i] = redacted
+			}
+		}
+		if out == nil {
+			return v, false
+		}
+		return out, true
+	case mapstr.M:
+		return v, p.redactMap(v, path, counts)
+	case map[string]interface{}:
+		return v, p.redactMap(v, path, counts)
+	default:
+		return value, false
+	}
+}
+
+// redactString masks the sensitive values found in s. Overlapping matches
+// are resolved in favor of the earliest, then the longest one.
+func (p *processor) redactString(s string, counts map[string]int) (string, bool) {
+	var matches []match
+	for _, d := range p.detectors {
+		for _, loc := range d.re.FindAllStringSubmatchIndex(s, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) > 2 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			if d.validate != nil {
+				i, j := d.validate(s[start:end])
+				if i == j {
+					continue
+				}
+				start, end = start+i, start+j
+			}
+			matches = append(matches, match{start: start, end: end, detector: d})
+		}
+	}
+	if len(matches) == 0 {
+		return s, false
+	}
+
+	slices.SortStableFunc(matches, func(a, b match) int {
+		if a.start != b.start {
+			return cmp.Compare(a.start, b.start)
+		}
+		return cmp.Compare(b.end, a.end)
+	})
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m.start < last {
+			continue
+		}
+		b.WriteString(s[last:m.start])
+		b.WriteString(p.mask(m.detector, s[m.start:m.end]))
+		last = m.end
+		counts[m.detector.name]++
+	}
+	b.WriteString(s[last:])
+	return b.String(), true
+}
+
+func (p *processor) mask(d *detector, value string) string {
+	switch p.config.Mask {
+	case maskPartial:
+		return d.partial(value)
+	case maskHash:
+		return "[REDACTED:" + d.name + ":" + p.hash(value) + "]"
+	default:
+		return "[REDACTED:" + d.name + "]"
+	}
+}
+
+// hash returns a short keyed hash of a value, so values with few
+// possibilities like card numbers can't be brute forced.
+func (p *processor) hash(value string) string {
+	h := hmac.New(sha256.New, []byte(p.config.Key))
+	h.Write([]byte(value))
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func (p *processor) String() string {
+	return procName + "=[detectors=" + strings.Join(p.config.Detectors, ",") +
+		" mask=" + p.config.Mask + " fields=" + strings.Join(p.config.Fields, ",") + "]"
+}
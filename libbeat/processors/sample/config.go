@@ -0,0 +1,49 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"errors"
+
+	"github.com/elastic/beats/v7/libbeat/conditions"
+)
+
+type config struct {
+	Rate     float64      `config:"rate" validate:"min=0,max=1"`
+	KeyField string       `config:"key_field"`
+	Rules    []ruleConfig `config:"rules"`
+}
+
+// ruleConfig sets the rate of the events matching a condition.
+type ruleConfig struct {
+	When *conditions.Config `config:"when" validate:"required"`
+	Rate *float64           `config:"rate" validate:"required"`
+}
+
+func defaultConfig() config {
+	return config{
+		Rate: 1,
+	}
+}
+
+func (c *ruleConfig) Validate() error {
+	if *c.Rate < 0 || *c.Rate > 1 {
+		return errors.New("rate must be between 0 and 1")
+	}
+	return nil
+}
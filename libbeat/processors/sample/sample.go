@@ -0,0 +1,151 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const (
+	procName = "sample"
+
+	// rateField holds the rate an event was kept with, so downstream
+	// consumers can re-weight counts.
+	rateField = "sample.rate"
+
+	// keyField holds the key field an event was kept by, when its rate only
+	// depends on draws derived from that key.
+	keyField = "sample.key_field"
+)
+
+func init() {
+	processors.RegisterPlugin(procName, New)
+	jsprocessor.RegisterPlugin("Sample", New)
+}
+
+type sample struct {
+	config
+	rules []rule
+}
+
+type rule struct {
+	condition conditions.Condition
+	rate      float64
+}
+
+// New constructs a new sample processor.
+func New(c *conf.C) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v processor configuration: %w", procName, err)
+	}
+
+	p := &sample{config: config}
+	for i, r := range config.Rules {
+		cond, err := conditions.NewCondition(r.When)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize the condition of rule %d: %w", i, err)
+		}
+		p.rules = append(p.rules, rule{condition: cond, rate: *r.Rate})
+	}
+	return p, nil
+}
+
+func (p *sample) String() string {
+	json, _ := json.Marshal(p.config)
+	return procName + "=" + string(json)
+}
+
+// Run keeps the event with the rate of the first rule it matches, or with
+// the default rate. Kept events get the rate in the sample.rate field, and
+// the key field they were kept by in the sample.key_field field.
+func (p *sample) Run(event *beat.Event) (*beat.Event, error) {
+	rate := p.rate(event)
+	value, keyed := p.value(event)
+	if value >= rate {
+		return nil, nil
+	}
+
+	// When events are sampled more than once, the rates of independent draws
+	// multiply. Samplers using the same key field draw the same value, so
+	// the event is kept with the lowest of their rates.
+	if v, err := event.GetValue(rateField); err == nil {
+		if prev, ok := v.(float64); ok {
+			if prevKey, _ := event.GetValue(keyField); keyed && prevKey == p.KeyField {
+				rate = min(rate, prev)
+			} else {
+				rate *= prev
+				keyed = false
+			}
+		}
+	}
+	if _, err := event.PutValue(rateField, rate); err != nil {
+		return event, fmt.Errorf("failed to set the %v field: %w", rateField, err)
+	}
+	if keyed {
+		if _, err := event.PutValue(keyField, p.KeyField); err != nil {
+			return event, fmt.Errorf("failed to set the %v field: %w", keyField, err)
+		}
+	} else if err := event.Delete(keyField); err != nil && !errors.Is(err, mapstr.ErrKeyNotFound) {
+		return event, fmt.Errorf("failed to delete the %v field: %w", keyField, err)
+	}
+	return event, nil
+}
+
+func (p *sample) rate(event *beat.Event) float64 {
+	for _, r := range p.rules {
+		if r.condition.Check(event) {
+			return r.rate
+		}
+	}
+	return p.Rate
+}
+
+// value returns a number in [0, 1) that decides whether the event is kept,
+// and whether it was derived from the key field. It is derived from the key
+// field when it is set, so all events sharing a key are kept or dropped
+// together. Events missing the key field are sampled randomly.
+func (p *sample) value(event *beat.Event) (float64, bool) {
+	if p.KeyField != "" {
+		if v, err := event.GetValue(p.KeyField); err == nil {
+			return hashValue(v), true
+		}
+	}
+	return rand.Float64(), false //nolint:gosec // Sampling does not need a secure source.
+}
+
+// hashValue maps a key to a number uniformly distributed in [0, 1).
+func hashValue(key interface{}) float64 {
+	s, ok := key.(string)
+	if !ok {
+		s = fmt.Sprint(key)
+	}
+	return float64(xxhash.Sum64String(s)>>11) / (1 << 53)
+}
@@ -0,0 +1,225 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newSample(t *testing.T, settings mapstr.M) beat.Processor {
+	t.Helper()
+	p, err := New(conf.MustNewConfigFrom(settings))
+	require.NoError(t, err)
+	return p
+}
+
+func countKept(t *testing.T, p beat.Processor, n int) int {
+	t.Helper()
+	kept := 0
+	for i := range n {
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"message": fmt.Sprint(i)}})
+		require.NoError(t, err)
+		if event != nil {
+			kept++
+		}
+	}
+	return kept
+}
+
+func TestSampleRate(t *testing.T) {
+	assert.Equal(t, 0, countKept(t, newSample(t, mapstr.M{"rate": 0}), 1000))
+	assert.Equal(t, 1000, countKept(t, newSample(t, mapstr.M{}), 1000))
+
+	kept := countKept(t, newSample(t, mapstr.M{"rate": 0.25}), 10000)
+	assert.InDelta(t, 2500, kept, 300)
+
+	event, err := newSample(t, mapstr.M{"rate": 1}).Run(&beat.Event{Fields: mapstr.M{"message": "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{"message": "a", "sample": mapstr.M{"rate": 1.0}}, event.Fields)
+}
+
+func TestSampleKeyField(t *testing.T) {
+	p := newSample(t, mapstr.M{"rate": 0.5, "key_field": "trace.id"})
+
+	keptTraces := 0
+	for trace := range 1000 {
+		var kept []bool
+		for range 5 {
+			event, err := p.Run(&beat.Event{Fields: mapstr.M{"trace": mapstr.M{"id": fmt.Sprintf("%032x", trace)}}})
+			require.NoError(t, err)
+			kept = append(kept, event != nil)
+		}
+		for _, k := range kept[1:] {
+			require.Equal(t, kept[0], k, "events of trace %d must be kept or dropped together", trace)
+		}
+		if kept[0] {
+			keptTraces++
+		}
+	}
+	assert.InDelta(t, 500, keptTraces, 80)
+
+	// The decision doesn't depend on the processor instance, so the events of
+	// a trace are sampled the same way on every host.
+	other := newSample(t, mapstr.M{"rate": 0.5, "key_field": "trace.id"})
+	for trace := range 100 {
+		fields := mapstr.M{"trace": mapstr.M{"id": trace}}
+		a, err := p.Run(&beat.Event{Fields: fields.Clone()})
+		require.NoError(t, err)
+		b, err := other.Run(&beat.Event{Fields: fields.Clone()})
+		require.NoError(t, err)
+		assert.Equal(t, a != nil, b != nil)
+	}
+}
+
+func TestSampleRules(t *testing.T) {
+	p := newSample(t, mapstr.M{
+		"rate": 0,
+		"rules": []mapstr.M{
+			{
+				"when": mapstr.M{"range": mapstr.M{"http.response.status_code.gte": 500}},
+				"rate": 1,
+			},
+			{
+				"when": mapstr.M{"equals": mapstr.M{"http.response.status_code": 404}},
+				"rate": 0.5,
+			},
+		},
+	})
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{"http": mapstr.M{"response": mapstr.M{"status_code": 503}}}})
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	rate, err := event.GetValue("sample.rate")
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, rate)
+
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"http": mapstr.M{"response": mapstr.M{"status_code": 200}}}})
+	require.NoError(t, err)
+	assert.Nil(t, event)
+
+	kept := 0
+	for range 1000 {
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"http": mapstr.M{"response": mapstr.M{"status_code": 404}}}})
+		require.NoError(t, err)
+		if event != nil {
+			rate, err := event.GetValue("sample.rate")
+			require.NoError(t, err)
+			assert.Equal(t, 0.5, rate)
+			kept++
+		}
+	}
+	assert.InDelta(t, 500, kept, 80)
+}
+
+func TestSampleRatesMultiply(t *testing.T) {
+	p := newSample(t, mapstr.M{"rate": 1})
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{"sample": mapstr.M{"rate": 0.1}}})
+	require.NoError(t, err)
+	rate, err := event.GetValue("sample.rate")
+	require.NoError(t, err)
+	assert.Equal(t, 0.1, rate)
+
+	// A keyed draw is independent of a previous random one.
+	p = newSample(t, mapstr.M{"rate": 1, "key_field": "trace.id"})
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"trace": mapstr.M{"id": "a"}, "sample": mapstr.M{"rate": 0.1}}})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{"rate": 0.1}, event.Fields["sample"])
+}
+
+func TestSampleChainedKeyField(t *testing.T) {
+	first := newSample(t, mapstr.M{"rate": 0.5, "key_field": "trace.id"})
+	second := newSample(t, mapstr.M{"rate": 0.2, "key_field": "trace.id"})
+
+	// Both samplers hash the same key, so the traces kept by the second one
+	// are a subset of those kept by the first one, and the rate of the
+	// chain is the lowest rate rather than the product.
+	kept := 0
+	for trace := range 10000 {
+		event := &beat.Event{Fields: mapstr.M{"trace": mapstr.M{"id": fmt.Sprintf("%032x", trace)}}}
+		event, err := first.Run(event)
+		require.NoError(t, err)
+		if event == nil {
+			continue
+		}
+		event, err = second.Run(event)
+		require.NoError(t, err)
+		if event == nil {
+			continue
+		}
+		assert.Equal(t, mapstr.M{"rate": 0.2, "key_field": "trace.id"}, event.Fields["sample"])
+		kept++
+	}
+	assert.InDelta(t, 2000, kept, 200)
+
+	// Draws on another key are independent.
+	other := newSample(t, mapstr.M{"rate": 0.5, "key_field": "span.id"})
+	event, err := other.Run(&beat.Event{Fields: mapstr.M{
+		"span":   mapstr.M{"id": "0"}, // Kept with a rate of 0.5.
+		"sample": mapstr.M{"rate": 0.2, "key_field": "trace.id"},
+	}})
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	assert.Equal(t, mapstr.M{"rate": 0.1}, event.Fields["sample"])
+}
+
+func TestSampleConfig(t *testing.T) {
+	tests := map[string]struct {
+		settings mapstr.M
+		err      string
+	}{
+		"rate above 1": {
+			settings: mapstr.M{"rate": 1.5},
+			err:      "requires value <= 1",
+		},
+		"negative rate": {
+			settings: mapstr.M{"rate": -0.5},
+			err:      "requires value >= 0",
+		},
+		"rule without rate": {
+			settings: mapstr.M{"rules": []mapstr.M{{"when": mapstr.M{"has_fields": []string{"error"}}}}},
+			err:      "missing required field accessing 'rules.0.rate'",
+		},
+		"rule without condition": {
+			settings: mapstr.M{"rules": []mapstr.M{{"rate": 0.5}}},
+			err:      "missing required field accessing 'rules.0.when'",
+		},
+		"invalid rule rate": {
+			settings: mapstr.M{"rules": []mapstr.M{{"when": mapstr.M{"has_fields": []string{"error"}}, "rate": 2}}},
+			err:      "rate must be between 0 and 1",
+		},
+		"invalid condition": {
+			settings: mapstr.M{"rules": []mapstr.M{{"when": mapstr.M{"unknown": mapstr.M{"a": 1}}, "rate": 0.5}}},
+			err:      "failed to initialize the condition of rule 0",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(conf.MustNewConfigFrom(tc.settings))
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
@@ -30,6 +30,9 @@ type parseError struct {
 }
 
 func (e *parseError) Error() string {
+	if e.field == "" {
+		return fmt.Sprintf("failed parsing time '%v'", e.time)
+	}
 	return fmt.Sprintf("failed parsing time field %v='%v'", e.field, e.time)
 }
 
@@ -0,0 +1,97 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package timestamp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// Parser converts values to time.Time using the same layouts as the
+// timestamp processor. Besides Go time layouts, the special layouts UNIX and
+// UNIX_MS accept numeric epoch values.
+type Parser struct {
+	layouts []string
+	tz      *time.Location
+}
+
+// NewParser returns a Parser that tries the layouts in order. Timestamps that
+// don't carry a time zone are interpreted in tz, or in UTC if tz is nil.
+func NewParser(layouts []string, tz *time.Location) *Parser {
+	if tz == nil {
+		tz = time.UTC
+	}
+	return &Parser{layouts: layouts, tz: tz}
+}
+
+// Parse returns the timestamp of the first layout that matches v.
+func (p *Parser) Parse(v interface{}) (time.Time, error) {
+	detailedErr := &parseError{time: v}
+
+	for _, layout := range p.layouts {
+		ts, err := p.parseByLayout(v, layout)
+		if err == nil {
+			return ts, nil
+		}
+		var parseError *time.ParseError
+		if errors.As(err, &parseError) {
+			detailedErr.causes = append(detailedErr.causes, &parseErrorCause{parseError})
+		} else {
+			detailedErr.causes = append(detailedErr.causes, err)
+		}
+	}
+
+	return time.Time{}, detailedErr
+}
+
+func (p *Parser) parseByLayout(v interface{}, layout string) (time.Time, error) {
+	switch layout {
+	case "UNIX":
+		if sec, ok := common.TryToInt(v); ok {
+			return time.Unix(int64(sec), 0), nil
+		} else if sec, ok := common.TryToFloat64(v); ok {
+			return time.Unix(0, int64(sec*float64(time.Second))), nil
+		}
+		return time.Time{}, errors.New("could not parse time field as int or float")
+	case "UNIX_MS":
+		if ms, ok := common.TryToInt(v); ok {
+			return time.Unix(0, int64(ms)*int64(time.Millisecond)), nil
+		} else if ms, ok := common.TryToFloat64(v); ok {
+			return time.Unix(0, int64(ms*float64(time.Millisecond))), nil
+		}
+		return time.Time{}, errors.New("could not parse time field as int or float")
+	default:
+		str, ok := v.(string)
+		if !ok {
+			return time.Time{}, fmt.Errorf("unexpected type %T for time field", v)
+		}
+
+		ts, err := time.ParseInLocation(layout, str, p.tz)
+		if err == nil {
+			// Use current year if no year is zero.
+			if ts.Year() == 0 {
+				currentYear := time.Now().In(ts.Location()).Year()
+				ts = ts.AddDate(currentYear, 0, 0)
+			}
+		}
+		return ts, err
+	}
+}
@@ -127,64 +127,23 @@ func (p *processor) tryToTime(value interface{}) (time.Time, error) {
 }
 
 func (p *processor) parseValue(v interface{}) (time.Time, error) {
-	detailedErr := &parseError{}
-
-	for _, layout := range p.Layouts {
-		ts, err := p.parseValueByLayout(v, layout)
-		if err == nil {
-			return ts, nil
-		}
-		var parseError *time.ParseError
-		if errors.As(err, &parseError) {
-			detailedErr.causes = append(detailedErr.causes, &parseErrorCause{parseError})
-		} else {
-			detailedErr.causes = append(detailedErr.causes, err)
-		}
+	parser := Parser{layouts: p.Layouts, tz: p.tz}
+	ts, err := parser.Parse(v)
+	if err == nil {
+		return ts, nil
 	}
 
-	detailedErr.field = p.Field
-	detailedErr.time = v
+	var detailedErr *parseError
+	if errors.As(err, &detailedErr) {
+		detailedErr.field = p.Field
+	}
 
 	if p.isDebug {
 		if p.IgnoreFailure {
-			p.log.Debugw("(Ignored) Failure parsing time field.", "error", detailedErr)
+			p.log.Debugw("(Ignored) Failure parsing time field.", "error", err)
 		} else {
-			p.log.Debugw("Failure parsing time field.", "error", detailedErr)
-		}
-	}
-	return time.Time{}, detailedErr
-}
-
-func (p *processor) parseValueByLayout(v interface{}, layout string) (time.Time, error) {
-	switch layout {
-	case "UNIX":
-		if sec, ok := common.TryToInt(v); ok {
-			return time.Unix(int64(sec), 0), nil
-		} else if sec, ok := common.TryToFloat64(v); ok {
-			return time.Unix(0, int64(sec*float64(time.Second))), nil
-		}
-		return time.Time{}, errors.New("could not parse time field as int or float")
-	case "UNIX_MS":
-		if ms, ok := common.TryToInt(v); ok {
-			return time.Unix(0, int64(ms)*int64(time.Millisecond)), nil
-		} else if ms, ok := common.TryToFloat64(v); ok {
-			return time.Unix(0, int64(ms*float64(time.Millisecond))), nil
-		}
-		return time.Time{}, errors.New("could not parse time field as int or float")
-	default:
-		str, ok := v.(string)
-		if !ok {
-			return time.Time{}, fmt.Errorf("unexpected type %T for time field", v)
-		}
-
-		ts, err := time.ParseInLocation(layout, str, p.tz)
-		if err == nil {
-			// Use current year if no year is zero.
-			if ts.Year() == 0 {
-				currentYear := time.Now().In(ts.Location()).Year()
-				ts = ts.AddDate(currentYear, 0, 0)
-			}
+			p.log.Debugw("Failure parsing time field.", "error", err)
 		}
-		return ts, err
 	}
+	return time.Time{}, err
 }
@@ -338,3 +338,21 @@ func TestMetadataTarget(t *testing.T) {
 	assert.Equal(t, evt.Fields, newEvt.Fields)
 	assert.Equal(t, evt.Timestamp, newEvt.Timestamp)
 }
+
+func TestParser(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	p := NewParser([]string{"UNIX", "2006-01-02 15:04:05"}, berlin)
+
+	ts, err := p.Parse(expected.Unix())
+	require.NoError(t, err)
+	assert.True(t, expected.Equal(ts), "got %v", ts)
+
+	ts, err = p.Parse("2015-03-07 12:06:39")
+	require.NoError(t, err)
+	assert.True(t, expected.Equal(ts), "got %v", ts)
+
+	_, err = p.Parse("not a timestamp")
+	assert.EqualError(t, err, "failed parsing time 'not a timestamp'")
+}
@@ -0,0 +1,85 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCache holds the most recently used parsed user agents. When it is
+// full, the least recently used one is evicted to make room for a new one.
+// It is safe for concurrent use.
+type lruCache struct {
+	mu      sync.Mutex
+	maxSize int
+	entries map[string]*list.Element
+	lru     list.List
+}
+
+type lruEntry struct {
+	key string
+	ua  userAgent
+}
+
+func newLRUCache(maxSize int) *lruCache {
+	return &lruCache{
+		maxSize: maxSize,
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached user agent for key and marks it as recently used.
+func (c *lruCache) get(key string) (userAgent, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return userAgent{}, false
+	}
+	c.lru.MoveToFront(elem)
+	//nolint:errcheck // The cache only holds entries of this type.
+	return elem.Value.(*lruEntry).ua, true
+}
+
+// put stores the user agent for key, evicting the least recently used
+// entry if the cache is full.
+func (c *lruCache) put(key string, ua userAgent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		//nolint:errcheck // The cache only holds entries of this type.
+		elem.Value.(*lruEntry).ua = ua
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	if c.lru.Len() >= c.maxSize {
+		oldest := c.lru.Back()
+		//nolint:errcheck // The cache only holds entries of this type.
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+		c.lru.Remove(oldest)
+	}
+	c.entries[key] = c.lru.PushFront(&lruEntry{key: key, ua: ua})
+}
+
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
@@ -0,0 +1,52 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(2)
+	c.put("a", userAgent{name: "A"})
+	c.put("b", userAgent{name: "B"})
+
+	// Using a makes b the least recently used entry.
+	ua, ok := c.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "A", ua.name)
+
+	c.put("c", userAgent{name: "C"})
+	_, ok = c.get("b")
+	assert.False(t, ok, "b must be evicted")
+	_, ok = c.get("a")
+	assert.True(t, ok)
+	_, ok = c.get("c")
+	assert.True(t, ok)
+
+	// Overwriting an entry doesn't evict anything.
+	c.put("a", userAgent{name: "A2"})
+	ua, ok = c.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "A2", ua.name)
+	_, ok = c.get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 2, c.len())
+}
@@ -0,0 +1,204 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// regexes is the uap-core regexes.yaml file format, see
+// https://github.com/ua-parser/uap-core/blob/master/docs/specification.md.
+type regexes struct {
+	UserAgentParsers []struct {
+		Regex               string `yaml:"regex"`
+		RegexFlag           string `yaml:"regex_flag"`
+		FamilyReplacement   string `yaml:"family_replacement"`
+		MajorReplacement    string `yaml:"v1_replacement"`
+		MinorReplacement    string `yaml:"v2_replacement"`
+		PatchReplacement    string `yaml:"v3_replacement"`
+		PatchMinReplacement string `yaml:"v4_replacement"`
+	} `yaml:"user_agent_parsers"`
+	OSParsers []struct {
+		Regex               string `yaml:"regex"`
+		RegexFlag           string `yaml:"regex_flag"`
+		OSReplacement       string `yaml:"os_replacement"`
+		MajorReplacement    string `yaml:"os_v1_replacement"`
+		MinorReplacement    string `yaml:"os_v2_replacement"`
+		PatchReplacement    string `yaml:"os_v3_replacement"`
+		PatchMinReplacement string `yaml:"os_v4_replacement"`
+	} `yaml:"os_parsers"`
+	DeviceParsers []struct {
+		Regex             string `yaml:"regex"`
+		RegexFlag         string `yaml:"regex_flag"`
+		DeviceReplacement string `yaml:"device_replacement"`
+	} `yaml:"device_parsers"`
+}
+
+// pattern is a regular expression with the replacements of the values it
+// extracts. An empty replacement takes the value of the matching capture
+// group, other replacements can reference capture groups with $1 to $9.
+type pattern struct {
+	re           *regexp.Regexp
+	replacements []string
+}
+
+// apply returns the values extracted from s, or nil if s doesn't match.
+func (p *pattern) apply(s string) []string {
+	match := p.re.FindStringSubmatch(s)
+	if match == nil {
+		return nil
+	}
+	values := make([]string, len(p.replacements))
+	for i, replacement := range p.replacements {
+		switch {
+		case replacement == "":
+			if i+1 < len(match) {
+				values[i] = match[i+1]
+			}
+		case strings.Contains(replacement, "$"):
+			values[i] = strings.TrimSpace(expandGroups(replacement, match))
+		default:
+			values[i] = replacement
+		}
+	}
+	return values
+}
+
+// expandGroups replaces the $1 to $9 references of s with the matching
+// capture groups. References to groups that didn't match are removed.
+func expandGroups(s string, match []string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '$' && i+1 < len(s) && s[i+1] >= '1' && s[i+1] <= '9' {
+			if group := int(s[i+1] - '0'); group < len(match) {
+				b.WriteString(match[group])
+			}
+			i++
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// parser parses user agent strings with the patterns of a uap-core regexes
+// file. Patterns are tried in order and the first match wins.
+type parser struct {
+	agents  []pattern
+	os      []pattern
+	devices []pattern
+}
+
+// userAgent holds the parsed fields of a user agent string.
+type userAgent struct {
+	name      string
+	version   string
+	osName    string
+	osVersion string
+	device    string
+}
+
+func newParser(data []byte) (*parser, error) {
+	var r regexes
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse regexes: %w", err)
+	}
+	if len(r.UserAgentParsers) == 0 && len(r.OSParsers) == 0 && len(r.DeviceParsers) == 0 {
+		return nil, errors.New("no user_agent_parsers, os_parsers or device_parsers found")
+	}
+
+	p := &parser{}
+	var err error
+	for _, r := range r.UserAgentParsers {
+		p.agents, err = addPattern(p.agents, r.Regex, r.RegexFlag,
+			r.FamilyReplacement, r.MajorReplacement, r.MinorReplacement, r.PatchReplacement, r.PatchMinReplacement)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user_agent_parsers: %w", err)
+		}
+	}
+	for _, r := range r.OSParsers {
+		p.os, err = addPattern(p.os, r.Regex, r.RegexFlag,
+			r.OSReplacement, r.MajorReplacement, r.MinorReplacement, r.PatchReplacement, r.PatchMinReplacement)
+		if err != nil {
+			return nil, fmt.Errorf("invalid os_parsers: %w", err)
+		}
+	}
+	for _, r := range r.DeviceParsers {
+		p.devices, err = addPattern(p.devices, r.Regex, r.RegexFlag, r.DeviceReplacement)
+		if err != nil {
+			return nil, fmt.Errorf("invalid device_parsers: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// addPattern compiles a pattern and appends it to patterns. Patterns that use
+// syntax not supported by the Go regexp package, like lookarounds, fail to
+// compile.
+func addPattern(patterns []pattern, expr, flag string, replacements ...string) ([]pattern, error) {
+	if flag == "i" {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return patterns, fmt.Errorf("failed to compile pattern %q: %w", expr, err)
+	}
+	return append(patterns, pattern{re: re, replacements: replacements}), nil
+}
+
+// parse parses a user agent string. The name and device are "Other" when
+// no pattern matches, like in the Elasticsearch user_agent ingest
+// processor.
+func (p *parser) parse(s string) userAgent {
+	ua := userAgent{name: "Other", device: "Other"}
+	if values := firstMatch(p.agents, s); values != nil && values[0] != "" {
+		ua.name = values[0]
+		ua.version = joinVersion(values[1:])
+	}
+	if values := firstMatch(p.os, s); values != nil && values[0] != "" {
+		ua.osName = values[0]
+		ua.osVersion = joinVersion(values[1:])
+	}
+	if values := firstMatch(p.devices, s); values != nil && values[0] != "" {
+		ua.device = values[0]
+	}
+	return ua
+}
+
+func firstMatch(patterns []pattern, s string) []string {
+	for i := range patterns {
+		if values := patterns[i].apply(s); values != nil {
+			return values
+		}
+	}
+	return nil
+}
+
+// joinVersion joins the version parts up to the first empty one.
+func joinVersion(parts []string) string {
+	n := 0
+	for n < len(parts) && parts[n] != "" {
+		n++
+	}
+	return strings.Join(parts[:n], ".")
+}
@@ -0,0 +1,116 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRegexFile = "testdata/regexes.yaml"
+
+func newTestParser(t *testing.T) *parser {
+	t.Helper()
+	data, err := os.ReadFile(testRegexFile)
+	require.NoError(t, err)
+	p, err := newParser(data)
+	require.NoError(t, err)
+	return p
+}
+
+func TestParse(t *testing.T) {
+	p := newTestParser(t)
+
+	tests := map[string]userAgent{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/51.0.2704.103 Safari/537.36": {
+			name: "Chrome", version: "51.0.2704.103", osName: "Windows", osVersion: "10", device: "Other",
+		},
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91": {
+			name: "Edge", version: "120.0.2210.91", osName: "Windows", osVersion: "10", device: "Other",
+		},
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 12_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.0 Mobile/15E148 Safari/604.1": {
+			name: "Safari", version: "12.0", osName: "iOS", osVersion: "12.1", device: "iPhone",
+		},
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:109.0) Gecko/20100101 Firefox/115.0": {
+			name: "Firefox", version: "115.0", osName: "Mac OS X", osVersion: "10.15", device: "Mac",
+		},
+		"Mozilla/5.0 (Linux; Android 13; SM-S901B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Mobile Safari/537.36": {
+			name: "Chrome", version: "112.0.0.0", osName: "Android", osVersion: "13", device: "Samsung SM-S901B",
+		},
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": {
+			name: "Googlebot", version: "2.1", device: "Spider",
+		},
+		"CURL/7.88.1": {
+			name: "curl", version: "7.88.1", device: "Other",
+		},
+		"unknown agent": {
+			name: "Other", device: "Other",
+		},
+		"": {
+			name: "Other", device: "Other",
+		},
+	}
+	for s, want := range tests {
+		assert.Equal(t, want, p.parse(s), s)
+	}
+}
+
+func TestExpandGroups(t *testing.T) {
+	match := []string{"Nokia 3310", "Nokia", "3310"}
+	assert.Equal(t, "Nokia 3310", expandGroups("$1 $2", match))
+	assert.Equal(t, "3310 ", expandGroups("$2 $3", match))
+	assert.Equal(t, "$ and $x", expandGroups("$ and $x", match))
+	assert.Equal(t, "Nokia$", expandGroups("$1$", match))
+}
+
+func TestNewParserErrors(t *testing.T) {
+	_, err := newParser([]byte("user_agent_parsers: [invalid"))
+	assert.ErrorContains(t, err, "failed to parse regexes")
+
+	_, err = newParser([]byte("other: []"))
+	assert.ErrorContains(t, err, "no user_agent_parsers")
+
+	_, err = newParser([]byte(`user_agent_parsers: [{regex: '(?<!Mobile )(Safari)(?!/)'}]`))
+	assert.ErrorContains(t, err, "invalid user_agent_parsers: failed to compile pattern")
+
+	_, err = newParser([]byte(`os_parsers: [{regex: '(Windows'}]`))
+	assert.ErrorContains(t, err, "invalid os_parsers: failed to compile pattern")
+}
+
+func BenchmarkParse(b *testing.B) {
+	data, err := os.ReadFile(testRegexFile)
+	require.NoError(b, err)
+	p, err := newParser(data)
+	require.NoError(b, err)
+
+	const ua = "Mozilla/5.0 (Linux; Android 13; SM-S901B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Mobile Safari/537.36"
+	b.Run("parser", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			p.parse(ua)
+		}
+	})
+	b.Run("cache", func(b *testing.B) {
+		proc := &processor{parser: p, cache: newLRUCache(100)}
+		for i := 0; i < b.N; i++ {
+			proc.parse(ua)
+		}
+	})
+}
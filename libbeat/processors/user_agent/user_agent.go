@@ -0,0 +1,147 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const (
+	procName = "user_agent"
+	logName  = "processor." + procName
+)
+
+func init() {
+	processors.RegisterPlugin(procName, New)
+	jsprocessor.RegisterPlugin("UserAgent", New)
+}
+
+type processor struct {
+	config
+	log    *logp.Logger
+	parser *parser
+	cache  *lruCache
+}
+
+// New constructs a new user_agent processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v processor configuration: %w", procName, err)
+	}
+
+	return newUserAgent(c, logp.NewLogger(logName))
+}
+
+func newUserAgent(c config, log *logp.Logger) (*processor, error) {
+	data, err := os.ReadFile(c.RegexFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the regex file of the %v processor: %w", procName, err)
+	}
+	parser, err := newParser(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex file %v: %w", c.RegexFile, err)
+	}
+
+	p := &processor{config: c, log: log, parser: parser}
+	if c.CacheSize > 0 {
+		p.cache = newLRUCache(c.CacheSize)
+	}
+	return p, nil
+}
+
+func (p *processor) String() string {
+	json, _ := json.Marshal(p.config)
+	return procName + "=" + string(json)
+}
+
+// Run parses the user agent field into the user_agent fields.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	v, err := event.GetValue(p.Field)
+	if err != nil {
+		if p.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return event, nil
+		}
+		return p.fail(event, fmt.Errorf("%v source field [%v] not found: %w", procName, p.Field, err))
+	}
+	s, ok := v.(string)
+	if !ok {
+		return p.fail(event, fmt.Errorf("%v source field [%v] is not a string", procName, p.Field))
+	}
+
+	for k, v := range p.fields(p.parse(s), s) {
+		if _, err := event.PutValue(p.TargetField+"."+k, v); err != nil {
+			return p.fail(event, fmt.Errorf("failed to write to target field [%v]: %w", p.TargetField, err))
+		}
+	}
+	return event, nil
+}
+
+func (p *processor) fail(event *beat.Event, err error) (*beat.Event, error) {
+	if p.IgnoreFailure {
+		return event, nil
+	}
+	return event, err
+}
+
+// parse parses s, using the cache for user agents that were seen recently.
+func (p *processor) parse(s string) userAgent {
+	if p.cache == nil {
+		return p.parser.parse(s)
+	}
+	if ua, ok := p.cache.get(s); ok {
+		return ua
+	}
+	ua := p.parser.parse(s)
+	p.cache.put(s, ua)
+	return ua
+}
+
+// fields returns the ECS user_agent fields of ua relative to the target
+// field.
+func (p *processor) fields(ua userAgent, original string) mapstr.M {
+	fields := mapstr.M{
+		"name":        ua.name,
+		"device.name": ua.device,
+	}
+	if p.Field != p.TargetField+".original" {
+		fields["original"] = original
+	}
+	if ua.version != "" {
+		fields["version"] = ua.version
+	}
+	if ua.osName != "" {
+		fields["os.name"] = ua.osName
+		fields["os.full"] = ua.osName
+		if ua.osVersion != "" {
+			fields["os.version"] = ua.osVersion
+			fields["os.full"] = ua.osName + " " + ua.osVersion
+		}
+	}
+	return fields
+}
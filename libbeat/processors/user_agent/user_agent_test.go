@@ -0,0 +1,160 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const chromeOnAndroid = "Mozilla/5.0 (Linux; Android 13; SM-S901B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Mobile Safari/537.36"
+
+func TestProcessorRun(t *testing.T) {
+	parsed := mapstr.M{
+		"original": chromeOnAndroid,
+		"name":     "Chrome",
+		"version":  "112.0.0.0",
+		"os": mapstr.M{
+			"name":    "Android",
+			"version": "13",
+			"full":    "Android 13",
+		},
+		"device": mapstr.M{"name": "Samsung SM-S901B"},
+	}
+
+	tests := map[string]struct {
+		config  mapstr.M
+		fields  mapstr.M
+		want    mapstr.M
+		wantErr string
+	}{
+		"default fields": {
+			fields: mapstr.M{"user_agent": mapstr.M{"original": chromeOnAndroid}},
+			want:   mapstr.M{"user_agent": parsed},
+		},
+		"custom fields": {
+			config: mapstr.M{"field": "http.user_agent", "target_field": "client.user_agent"},
+			fields: mapstr.M{"http": mapstr.M{"user_agent": chromeOnAndroid}},
+			want: mapstr.M{
+				"http":   mapstr.M{"user_agent": chromeOnAndroid},
+				"client": mapstr.M{"user_agent": parsed},
+			},
+		},
+		"no match": {
+			fields: mapstr.M{"user_agent": mapstr.M{"original": "my-app"}},
+			want: mapstr.M{"user_agent": mapstr.M{
+				"original": "my-app",
+				"name":     "Other",
+				"device":   mapstr.M{"name": "Other"},
+			}},
+		},
+		"missing field": {
+			fields:  mapstr.M{},
+			want:    mapstr.M{},
+			wantErr: "user_agent source field [user_agent.original] not found",
+		},
+		"ignore missing": {
+			config: mapstr.M{"ignore_missing": true},
+			fields: mapstr.M{},
+			want:   mapstr.M{},
+		},
+		"not a string": {
+			fields:  mapstr.M{"user_agent": mapstr.M{"original": 42}},
+			want:    mapstr.M{"user_agent": mapstr.M{"original": 42}},
+			wantErr: "user_agent source field [user_agent.original] is not a string",
+		},
+		"ignore failure": {
+			config: mapstr.M{"ignore_failure": true},
+			fields: mapstr.M{"user_agent": mapstr.M{"original": 42}},
+			want:   mapstr.M{"user_agent": mapstr.M{"original": 42}},
+		},
+		"no cache": {
+			config: mapstr.M{"cache_size": 0},
+			fields: mapstr.M{"user_agent": mapstr.M{"original": chromeOnAndroid}},
+			want:   mapstr.M{"user_agent": parsed},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := mapstr.M{"regex_file": testRegexFile}
+			cfg.DeepUpdate(tc.config)
+			p, err := New(conf.MustNewConfigFrom(cfg))
+			require.NoError(t, err)
+
+			// Run twice so the second run uses the cache.
+			for range 2 {
+				event, err := p.Run(&beat.Event{Fields: tc.fields.Clone()})
+				if tc.wantErr != "" {
+					assert.ErrorContains(t, err, tc.wantErr)
+				} else {
+					assert.NoError(t, err)
+				}
+				assert.Equal(t, tc.want, event.Fields)
+			}
+		})
+	}
+}
+
+func TestProcessorCache(t *testing.T) {
+	c := defaultConfig()
+	c.RegexFile = testRegexFile
+	c.CacheSize = 1
+	p, err := newUserAgent(c, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+
+	const firefox = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:109.0) Gecko/20100101 Firefox/115.0"
+	assert.Equal(t, "Chrome", p.parse(chromeOnAndroid).name)
+	assert.Equal(t, "Firefox", p.parse(firefox).name)
+	assert.Equal(t, 1, p.cache.len(), "the cache must not grow beyond cache_size")
+
+	// The least recently used user agent is evicted for the new one.
+	_, ok := p.cache.get(chromeOnAndroid)
+	assert.False(t, ok)
+	ua, ok := p.cache.get(firefox)
+	assert.True(t, ok)
+	assert.Equal(t, "Firefox", ua.name)
+}
+
+func TestProcessorConfig(t *testing.T) {
+	tests := map[string]mapstr.M{
+		"missing regex file": {},
+		"regex file not found": {
+			"regex_file": "testdata/missing.yaml",
+		},
+		"negative cache size": {
+			"regex_file": testRegexFile,
+			"cache_size": -1,
+		},
+		"empty target field": {
+			"regex_file":   testRegexFile,
+			"target_field": "",
+		},
+	}
+	for name, cfg := range tests {
+		_, err := New(conf.MustNewConfigFrom(cfg))
+		assert.Error(t, err, name)
+	}
+}
@@ -35,6 +35,13 @@ type Config struct {
 
 	// Event queue
 	Queue config.Namespace `config:"queue"`
+
+	// Priority lanes, each with its own queue
+	PriorityLanes []PriorityLaneConfig `config:"priority_lanes"`
+}
+
+func (c *Config) Validate() error {
+	return validatePriorityLanes(c.PriorityLanes)
 }
 
 // validateClientConfig checks a ClientConfig can be used with (*Pipeline).ConnectWith.
@@ -62,6 +62,41 @@ type consumerTarget struct {
 	ch         chan publisher.Batch
 	timeToLive int
 	batchSize  int
+
+	// The priority lanes read in addition to the default queue, and the
+	// weight of the default queue in the scheduling of the lanes.
+	lanes         []laneTarget
+	defaultWeight int
+}
+
+// laneTarget is the queue of a priority lane and its scheduling weight.
+type laneTarget struct {
+	queue  queue.Queue
+	weight int
+}
+
+// consumerLane is the read state of a priority lane. Lane 0 reads the
+// default queue of the target.
+type consumerLane struct {
+	reader queueReader
+
+	// Whether there's an outstanding request to the lane's queueReader
+	pendingRead bool
+
+	// The batch read from the lane's queue and waiting to be sent, if any
+	batch *ttlBatch
+
+	// The virtual start and finish times of the lane's batches, used for
+	// weighted fair scheduling between the lanes.
+	start, finish float64
+
+	// The virtual time the lane became busy, and the number of events it
+	// sent since then with the given weight. Finish times are computed from
+	// them instead of being accumulated batch by batch, so rounding errors
+	// don't add up and reorder lanes whose times should be equal.
+	busySince  float64
+	sentEvents int
+	weight     int
 }
 
 // retryRequest is used by ttlBatch to add itself back to the eventConsumer
@@ -110,15 +145,16 @@ func (c *eventConsumer) run() {
 	log.Debug("start pipeline event consumer")
 
 	var (
-		// Whether there's an outstanding request to queueReader
-		pendingRead bool
+		// The read state of the default queue and the priority lanes.
+		lanes = []*consumerLane{{reader: c.queueReader}}
+
+		// The virtual time of the lane scheduler, it is the start time of
+		// the last batch sent from a lane.
+		virtualTime float64
 
 		// The batches waiting to be retried.
 		retryBatches []*ttlBatch
 
-		// The batch read from the queue and waiting to be sent, if any
-		queueBatch *ttlBatch
-
 		// The output channel (and associated parameters) that will receive
 		// the batches we're loading.
 		target consumerTarget
@@ -126,26 +162,39 @@ func (c *eventConsumer) run() {
 
 outerLoop:
 	for {
-		// If possible, start reading the next batch in the background.
-		// We require a non-nil target channel so we don't queue up a large
-		// batch before we know the real requested size for our output.
-		if queueBatch == nil && !pendingRead && target.queue != nil && target.ch != nil {
-			pendingRead = true
-			c.queueReader.req <- queueReaderRequest{
-				queue:      target.queue,
-				retryer:    c,
-				batchSize:  target.batchSize,
-				timeToLive: target.timeToLive,
+		// If possible, start reading the next batch of each lane in the
+		// background. We require a non-nil target channel so we don't queue
+		// up a large batch before we know the real requested size for our
+		// output.
+		if target.queue != nil && target.ch != nil {
+			for len(lanes) <= len(target.lanes) {
+				lanes = append(lanes, c.newLane())
+			}
+			for i, lane := range lanes {
+				q := target.laneQueue(i)
+				if lane.batch != nil || lane.pendingRead || q == nil {
+					continue
+				}
+				lane.pendingRead = true
+				lane.reader.req <- queueReaderRequest{
+					queue:      q,
+					retryer:    c,
+					batchSize:  target.batchSize,
+					timeToLive: target.timeToLive,
+					lane:       i,
+				}
 			}
 		}
 
 		var active *ttlBatch
 		// Choose the active batch: if we have batches to retry, use the first
-		// one. Otherwise, use a new batch if we have one.
+		// one. Otherwise, use a new batch from the lane that is next in
+		// line if we have one.
+		activeLane := nextLane(lanes)
 		if len(retryBatches) > 0 {
 			active = retryBatches[0]
-		} else if queueBatch != nil {
-			active = queueBatch
+		} else if activeLane >= 0 {
+			active = lanes[activeLane].batch
 		}
 
 		// If we have a batch, we'll point the output channel at the target
@@ -167,14 +216,15 @@ outerLoop:
 				retryBatches = retryBatches[1:]
 			} else {
 				// This was directly from the queue, clear the value so we can
-				// fetch a new one
-				queueBatch = nil
+				// fetch a new one, and account for it in the lane's schedule
+				virtualTime = lanes[activeLane].sent(target.laneWeight(activeLane))
 			}
 
 		case target = <-c.targetChan:
 
-		case queueBatch = <-c.queueReader.resp:
-			pendingRead = false
+		case resp := <-c.queueReader.resp:
+			// All lane readers share the response channel of c.queueReader.
+			lanes[resp.lane].received(resp.batch, virtualTime)
 
 		case req := <-c.retryChan:
 			if req.decreaseTTL {
@@ -198,8 +248,87 @@ outerLoop:
 		}
 	}
 
-	// Close the queueReader request channel so it knows to shutdown.
-	close(c.queueReader.req)
+	// Close the queueReader request channels so they know to shutdown.
+	for _, lane := range lanes {
+		close(lane.reader.req)
+	}
+}
+
+// newLane starts the queue reader of an additional priority lane. Its
+// responses are sent to the response channel of c.queueReader.
+func (c *eventConsumer) newLane() *consumerLane {
+	reader := queueReader{
+		req:  make(chan queueReaderRequest, 1),
+		resp: c.queueReader.resp,
+	}
+	// Like c.queueReader, lane readers are not waited for on shutdown.
+	go reader.run(c.logger)
+	return &consumerLane{reader: reader}
+}
+
+// received stores a batch read from the lane's queue. A lane that was
+// idle starts at the current virtual time, so it can't claim the share of
+// the output it didn't use while it was empty.
+func (l *consumerLane) received(batch *ttlBatch, virtualTime float64) {
+	l.pendingRead = false
+	l.batch = batch
+	if batch == nil {
+		return
+	}
+	if l.finish < virtualTime {
+		l.busySince, l.sentEvents = virtualTime, 0
+		l.finish = virtualTime
+	}
+	l.start = l.finish
+}
+
+// sent clears the lane's batch once it has been sent to the output and
+// returns the new virtual time.
+func (l *consumerLane) sent(weight int) float64 {
+	if weight != l.weight {
+		l.busySince, l.sentEvents, l.weight = l.start, 0, weight
+	}
+	l.sentEvents += len(l.batch.Events())
+	l.finish = l.busySince + float64(l.sentEvents)/float64(weight)
+	l.batch = nil
+	return l.start
+}
+
+// nextLane returns the index of the lane whose batch should be sent next,
+// or -1 if no lane has a batch. Lanes are served in the order of the
+// virtual start times of their batches, which gives each lane a share of
+// the output proportional to its weight while it has events.
+func nextLane(lanes []*consumerLane) int {
+	next := -1
+	for i, lane := range lanes {
+		if lane.batch == nil {
+			continue
+		}
+		if next < 0 || lane.start < lanes[next].start {
+			next = i
+		}
+	}
+	return next
+}
+
+// laneQueue returns the queue of lane i, lane 0 being the default queue.
+func (t consumerTarget) laneQueue(i int) queue.Queue {
+	if i == 0 {
+		return t.queue
+	}
+	if i <= len(t.lanes) {
+		return t.lanes[i-1].queue
+	}
+	return nil
+}
+
+// laneWeight returns the scheduling weight of lane i.
+func (t consumerTarget) laneWeight(i int) int {
+	weight := t.defaultWeight
+	if i > 0 && i <= len(t.lanes) {
+		weight = t.lanes[i-1].weight
+	}
+	return max(weight, 1)
 }
 
 func (c *eventConsumer) setTarget(target consumerTarget) {
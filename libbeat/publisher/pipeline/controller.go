@@ -53,6 +53,12 @@ type outputController struct {
 	// is called.
 	queueFactory queue.QueueFactory
 
+	// The priority lanes, each with its own queue, and the scheduling weight
+	// of the default queue. Lane queues are created along with the default
+	// queue.
+	lanes         []*priorityLane
+	defaultWeight int
+
 	// consumer is a helper goroutine that reads event batches from the queue
 	// and sends them to workerChan for an output worker to process.
 	consumer *eventConsumer
@@ -87,12 +93,16 @@ func newOutputController(
 	monitors Monitors,
 	retryObserver retryObserver,
 	queueFactory queue.QueueFactory,
+	lanes []*priorityLane,
+	defaultWeight int,
 	inputQueueSize int,
 ) (*outputController, error) {
 	controller := &outputController{
 		beat:           beat,
 		monitors:       monitors,
 		queueFactory:   queueFactory,
+		lanes:          lanes,
+		defaultWeight:  defaultWeight,
 		workerChan:     make(chan publisher.Batch),
 		consumer:       newEventConsumer(monitors.Logger, retryObserver),
 		inputQueueSize: inputQueueSize,
@@ -151,13 +161,22 @@ func (c *outputController) Set(outGrp outputs.Group) {
 		targetChan = nil
 	}
 
+	var lanes []laneTarget
+	if c.queue != nil {
+		for _, lane := range c.lanes {
+			lanes = append(lanes, laneTarget{queue: lane.queue, weight: lane.weight})
+		}
+	}
+
 	// Resume consumer targeting the new work queue
 	c.consumer.setTarget(
 		consumerTarget{
-			queue:      c.queue,
-			ch:         targetChan,
-			batchSize:  outGrp.BatchSize,
-			timeToLive: outGrp.Retry + 1,
+			queue:         c.queue,
+			ch:            targetChan,
+			batchSize:     outGrp.BatchSize,
+			timeToLive:    outGrp.Retry + 1,
+			lanes:         lanes,
+			defaultWeight: c.defaultWeight,
 		})
 }
 
@@ -193,10 +212,21 @@ func (c *outputController) closeQueue(timeout time.Duration) {
 	c.queueLock.Lock()
 	defer c.queueLock.Unlock()
 	if c.queue != nil {
-		c.queue.Close()
-		select {
-		case <-c.queue.Done():
-		case <-time.After(timeout):
+		queues := []queue.Queue{c.queue}
+		for _, lane := range c.lanes {
+			queues = append(queues, lane.queue)
+		}
+		for _, q := range queues {
+			q.Close()
+		}
+		deadline := time.After(timeout)
+	waitLoop:
+		for _, q := range queues {
+			select {
+			case <-q.Done():
+			case <-deadline:
+				break waitLoop
+			}
 		}
 	}
 	for _, req := range c.pendingRequests {
@@ -225,7 +255,7 @@ func (c *outputController) queueProducer(config queue.ProducerConfig) queue.Prod
 		// queue doesn't exist we'll need to block until it does, and
 		// in that case we need to manually unlock before we start waiting.
 		defer c.queueLock.Unlock()
-		return c.queue.Producer(config)
+		return c.producer(config)
 	}
 	// If there's no queue yet, create a producer request, release the
 	// queue lock, and wait to receive our producer.
@@ -271,6 +301,15 @@ func (c *outputController) createQueueIfNeeded(outGrp outputs.Group) {
 	}
 	queueObserver := queue.NewQueueObserver(pipelineMetrics)
 
+	// With priority lanes, each lane's queue reports its metrics under
+	// "pipeline.lanes.<name>.queue" and the totals of all lanes are
+	// reported under "pipeline.queue".
+	var totals *laneTotals
+	if len(c.lanes) > 0 {
+		totals = newLaneTotals(queueObserver, len(c.lanes)+1)
+		queueObserver = newLaneObserver(pipelineMetrics, totals, 0, defaultLaneName)
+	}
+
 	queue, err := factory(logger, queueObserver, c.inputQueueSize, outGrp.EncoderFactory)
 	if err != nil {
 		logger.Errorf("queue creation failed, falling back to default memory queue, check your queue configuration")
@@ -279,6 +318,16 @@ func (c *outputController) createQueueIfNeeded(outGrp outputs.Group) {
 	}
 	c.queue = queue
 
+	for i, lane := range c.lanes {
+		laneObserver := newLaneObserver(pipelineMetrics, totals, i+1, lane.name)
+		lane.queue, err = lane.factory(logger, laneObserver, c.inputQueueSize, outGrp.EncoderFactory)
+		if err != nil {
+			logger.Errorf("queue creation failed for priority lane %s, falling back to default memory queue, check your queue configuration", lane.name)
+			s, _ := memqueue.SettingsForUserConfig(nil)
+			lane.queue = memqueue.NewQueue(logger, laneObserver, s, c.inputQueueSize, outGrp.EncoderFactory)
+		}
+	}
+
 	if c.monitors.Telemetry != nil {
 		queueReg := c.monitors.Telemetry.NewRegistry("queue")
 		monitoring.NewString(queueReg, "name").Set(c.queue.QueueType())
@@ -287,11 +336,20 @@ func (c *outputController) createQueueIfNeeded(outGrp outputs.Group) {
 	// Now that we've created a queue, go through and unblock any callers
 	// that are waiting for a producer.
 	for _, req := range c.pendingRequests {
-		req.responseChan <- c.queue.Producer(req.config)
+		req.responseChan <- c.producer(req.config)
 	}
 	c.pendingRequests = nil
 }
 
+// producer creates a producer for the queue, routing events to the
+// priority lanes if there are any. The caller must hold queueLock.
+func (c *outputController) producer(config queue.ProducerConfig) queue.Producer {
+	if len(c.lanes) == 0 {
+		return c.queue.Producer(config)
+	}
+	return newLaneProducer(c.queue, c.lanes, config)
+}
+
 // emptyProducer is a placeholder queue producer that is used only when
 // publishDisabled is set, so beats don't block forever waiting for
 // a producer for a nonexistent queue.
@@ -0,0 +1,323 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/hybridqueue"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// defaultLaneName is the name of the lane holding the events that don't
+// match any priority lane. It uses the pipeline's queue.
+const defaultLaneName = "default"
+
+var laneNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// PriorityLaneConfig configures a priority lane. Events matching the
+// condition of a lane are queued in the lane's own queue, and the consumer
+// reads from all lanes in proportion to their weights.
+type PriorityLaneConfig struct {
+	Name      string             `config:"name" validate:"required"`
+	Weight    int                `config:"weight" validate:"min=1"`
+	Condition *conditions.Config `config:"when"`
+	Queue     conf.Namespace     `config:"queue"`
+}
+
+func (c *PriorityLaneConfig) InitDefaults() {
+	c.Weight = 1
+}
+
+func (c *PriorityLaneConfig) Validate() error {
+	if !laneNamePattern.MatchString(c.Name) {
+		return fmt.Errorf("invalid priority lane name %q, only letters, digits, '_' and '-' are allowed", c.Name)
+	}
+
+	if c.Name == defaultLaneName {
+		if c.Condition != nil {
+			return errors.New("the default priority lane can't have a condition")
+		}
+		if c.Queue.IsSet() {
+			return errors.New("the default priority lane uses the pipeline queue and can't configure its own")
+		}
+		return nil
+	}
+
+	if c.Condition == nil {
+		return fmt.Errorf("priority lane %q requires a condition", c.Name)
+	}
+	// Disk based queues of different lanes must not share a directory.
+	switch c.Queue.Name() {
+	case diskqueue.QueueType:
+		if !c.Queue.Config().HasField("path") {
+			return fmt.Errorf("the disk queue of priority lane %q requires a path", c.Name)
+		}
+	case hybridqueue.QueueType:
+		disk, err := c.Queue.Config().Child("disk", -1)
+		if err != nil || !disk.HasField("path") {
+			return fmt.Errorf("the hybrid queue of priority lane %q requires a disk.path", c.Name)
+		}
+	}
+	return nil
+}
+
+func validatePriorityLanes(lanes []PriorityLaneConfig) error {
+	names := map[string]bool{}
+	for _, lane := range lanes {
+		if names[lane.Name] {
+			return fmt.Errorf("duplicate priority lane %q", lane.Name)
+		}
+		names[lane.Name] = true
+	}
+	return nil
+}
+
+// priorityLane is a configured priority lane and, once the output is set,
+// its queue.
+type priorityLane struct {
+	name      string
+	weight    int
+	condition conditions.Condition
+	factory   queue.QueueFactory
+	queue     queue.Queue
+}
+
+// newPriorityLanes returns the lanes other than the default one, in the
+// order their conditions are checked, and the weight of the default lane.
+func newPriorityLanes(configs []PriorityLaneConfig) ([]*priorityLane, int, error) {
+	defaultWeight := 1
+	var lanes []*priorityLane
+	for _, cfg := range configs {
+		if cfg.Name == defaultLaneName {
+			defaultWeight = cfg.Weight
+			continue
+		}
+
+		condition, err := conditions.NewCondition(cfg.Condition)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid condition of priority lane %q: %w", cfg.Name, err)
+		}
+
+		// Lanes without their own queue configuration use a memory queue.
+		queueType := defaultQueueType
+		if name := cfg.Queue.Name(); name != "" {
+			queueType = name
+		}
+		factory, err := queueFactoryForUserConfig(queueType, cfg.Queue.Config())
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid queue of priority lane %q: %w", cfg.Name, err)
+		}
+
+		lanes = append(lanes, &priorityLane{
+			name:      cfg.Name,
+			weight:    cfg.Weight,
+			condition: condition,
+			factory:   factory,
+		})
+	}
+	return lanes, defaultWeight, nil
+}
+
+// laneProducer publishes each event to the first lane whose condition
+// matches it, or to the default lane.
+type laneProducer struct {
+	lanes []*priorityLane
+
+	// producers[0] publishes to the default lane, producers[i+1] to lanes[i].
+	producers []queue.Producer
+
+	// acks keeps the acknowledgements of the lanes in publishing order, it
+	// is nil if the producer was created without an ACK callback.
+	acks *queue.ACKMerger
+}
+
+func newLaneProducer(defaultQueue queue.Queue, lanes []*priorityLane, cfg queue.ProducerConfig) *laneProducer {
+	p := &laneProducer{lanes: lanes}
+	if cfg.ACK != nil {
+		p.acks = queue.NewACKMerger(len(lanes)+1, cfg.ACK)
+	}
+
+	p.producers = make([]queue.Producer, len(lanes)+1)
+	p.producers[0] = defaultQueue.Producer(p.laneProducerConfig(0))
+	for i, lane := range lanes {
+		p.producers[i+1] = lane.queue.Producer(p.laneProducerConfig(i + 1))
+	}
+	return p
+}
+
+func (p *laneProducer) laneProducerConfig(lane int) queue.ProducerConfig {
+	if p.acks == nil {
+		return queue.ProducerConfig{}
+	}
+	return queue.ProducerConfig{ACK: func(count int) {
+		p.acks.ACK(lane, count)
+	}}
+}
+
+func (p *laneProducer) Publish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, true)
+}
+
+func (p *laneProducer) TryPublish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, false)
+}
+
+func (p *laneProducer) publish(entry queue.Entry, shouldBlock bool) (queue.EntryID, bool) {
+	lane := p.laneFor(entry)
+	p.acks.Add(lane)
+
+	var id queue.EntryID
+	var ok bool
+	if shouldBlock {
+		id, ok = p.producers[lane].Publish(entry)
+	} else {
+		id, ok = p.producers[lane].TryPublish(entry)
+	}
+	if !ok {
+		p.acks.Remove()
+	}
+	return id, ok
+}
+
+// laneFor returns the index of the producer for the event.
+func (p *laneProducer) laneFor(entry queue.Entry) int {
+	event, ok := entry.(publisher.Event)
+	if !ok {
+		return 0
+	}
+	for i, lane := range p.lanes {
+		if lane.condition.Check(&event.Content) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (p *laneProducer) Close() {
+	for _, producer := range p.producers {
+		producer.Close()
+	}
+}
+
+// laneObserver reports the metrics of a lane's queue for the lane, and
+// adds them up with the other lanes for the pipeline.
+type laneObserver struct {
+	queue.Observer
+	totals *laneTotals
+	lane   int
+}
+
+// laneTotals reports the metrics of all lanes to the pipeline observer.
+// The gauges that queues set rather than update are summed up here.
+type laneTotals struct {
+	mu       sync.Mutex
+	observer queue.Observer
+
+	maxEvents      []int
+	maxBytes       []int
+	restoredEvents []int
+	restoredBytes  []int
+}
+
+// newLaneObserver returns the queue observer of a lane, reporting its
+// metrics under "pipeline.lanes.<name>.queue".
+func newLaneObserver(pipelineMetrics *monitoring.Registry, totals *laneTotals, lane int, name string) queue.Observer {
+	var laneMetrics *monitoring.Registry
+	if pipelineMetrics != nil {
+		lanesMetrics := pipelineMetrics.GetRegistry("lanes")
+		if lanesMetrics == nil {
+			lanesMetrics = pipelineMetrics.NewRegistry("lanes")
+		}
+		laneMetrics = lanesMetrics.GetRegistry(name)
+		if laneMetrics == nil {
+			laneMetrics = lanesMetrics.NewRegistry(name)
+		}
+	}
+	return laneObserver{
+		Observer: queue.NewQueueObserver(laneMetrics),
+		totals:   totals,
+		lane:     lane,
+	}
+}
+
+func newLaneTotals(observer queue.Observer, lanes int) *laneTotals {
+	return &laneTotals{
+		observer:       observer,
+		maxEvents:      make([]int, lanes),
+		maxBytes:       make([]int, lanes),
+		restoredEvents: make([]int, lanes),
+		restoredBytes:  make([]int, lanes),
+	}
+}
+
+func (o laneObserver) MaxEvents(value int) {
+	o.Observer.MaxEvents(value)
+	o.totals.mu.Lock()
+	defer o.totals.mu.Unlock()
+	o.totals.maxEvents[o.lane] = value
+	o.totals.observer.MaxEvents(sum(o.totals.maxEvents))
+}
+
+func (o laneObserver) MaxBytes(value int) {
+	o.Observer.MaxBytes(value)
+	o.totals.mu.Lock()
+	defer o.totals.mu.Unlock()
+	o.totals.maxBytes[o.lane] = value
+	o.totals.observer.MaxBytes(sum(o.totals.maxBytes))
+}
+
+func (o laneObserver) Restore(eventCount int, byteCount int) {
+	o.Observer.Restore(eventCount, byteCount)
+	o.totals.mu.Lock()
+	defer o.totals.mu.Unlock()
+	o.totals.restoredEvents[o.lane] = eventCount
+	o.totals.restoredBytes[o.lane] = byteCount
+	o.totals.observer.Restore(sum(o.totals.restoredEvents), sum(o.totals.restoredBytes))
+}
+
+func (o laneObserver) AddEvent(byteCount int) {
+	o.Observer.AddEvent(byteCount)
+	o.totals.observer.AddEvent(byteCount)
+}
+
+func (o laneObserver) ConsumeEvents(eventCount int, byteCount int) {
+	o.Observer.ConsumeEvents(eventCount, byteCount)
+	o.totals.observer.ConsumeEvents(eventCount, byteCount)
+}
+
+func (o laneObserver) RemoveEvents(eventCount int, byteCount int) {
+	o.Observer.RemoveEvents(eventCount, byteCount)
+	o.totals.observer.RemoveEvents(eventCount, byteCount)
+}
+
+func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
@@ -0,0 +1,263 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestPriorityLaneConfig(t *testing.T) {
+	tests := map[string]struct {
+		config            map[string]interface{}
+		wantErr           string
+		wantDefaultWeight int
+	}{
+		"lane with memory queue": {
+			config: map[string]interface{}{"priority_lanes": []map[string]interface{}{
+				{"name": "security", "weight": 4, "when.equals.kind": "alert", "queue.mem.events": 4096},
+			}},
+			wantDefaultWeight: 1,
+		},
+		"default lane weight": {
+			config: map[string]interface{}{"priority_lanes": []map[string]interface{}{
+				{"name": "default", "weight": 2},
+				{"name": "security", "when.equals.kind": "alert"},
+			}},
+			wantDefaultWeight: 2,
+		},
+		"lane without condition": {
+			config: map[string]interface{}{"priority_lanes": []map[string]interface{}{
+				{"name": "security"},
+			}},
+			wantErr: "requires a condition",
+		},
+		"default lane with condition": {
+			config: map[string]interface{}{"priority_lanes": []map[string]interface{}{
+				{"name": "default", "when.equals.kind": "alert"},
+			}},
+			wantErr: "can't have a condition",
+		},
+		"invalid name": {
+			config: map[string]interface{}{"priority_lanes": []map[string]interface{}{
+				{"name": "high priority", "when.equals.kind": "alert"},
+			}},
+			wantErr: "invalid priority lane name",
+		},
+		"invalid weight": {
+			config: map[string]interface{}{"priority_lanes": []map[string]interface{}{
+				{"name": "security", "weight": 0, "when.equals.kind": "alert"},
+			}},
+			wantErr: "requires value >= 1",
+		},
+		"duplicate name": {
+			config: map[string]interface{}{"priority_lanes": []map[string]interface{}{
+				{"name": "security", "when.equals.kind": "alert"},
+				{"name": "security", "when.equals.kind": "signal"},
+			}},
+			wantErr: "duplicate priority lane",
+		},
+		"disk queue without path": {
+			config: map[string]interface{}{"priority_lanes": []map[string]interface{}{
+				{"name": "security", "when.equals.kind": "alert", "queue.disk.max_size": "1GB"},
+			}},
+			wantErr: "requires a path",
+		},
+		"hybrid queue without path": {
+			config: map[string]interface{}{"priority_lanes": []map[string]interface{}{
+				{"name": "security", "when.equals.kind": "alert", "queue.hybrid.disk.max_size": "1GB"},
+			}},
+			wantErr: "requires a disk.path",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var config Config
+			err := conf.MustNewConfigFrom(tc.config).Unpack(&config)
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			lanes, defaultWeight, err := newPriorityLanes(config.PriorityLanes)
+			require.NoError(t, err)
+			require.Len(t, lanes, 1)
+			assert.Equal(t, "security", lanes[0].name)
+			assert.Equal(t, tc.wantDefaultWeight, defaultWeight)
+		})
+	}
+}
+
+func TestLaneProducer(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	newQueue := func() queue.Queue {
+		q := memqueue.NewQueue(logger, nil, memqueue.Settings{Events: 32, MaxGetRequest: 1}, 0, nil)
+		t.Cleanup(func() { q.Close() })
+		return q
+	}
+
+	lanes := newTestLanes(t, map[string]interface{}{"name": "high", "when.equals.priority": "high"})
+	lanes[0].queue = newQueue()
+	defaultQueue := newQueue()
+
+	var acked atomic.Int64
+	producer := newLaneProducer(defaultQueue, lanes, queue.ProducerConfig{
+		ACK: func(count int) { acked.Add(int64(count)) },
+	})
+	defer producer.Close()
+
+	for _, priority := range []string{"low", "high", "low"} {
+		_, ok := producer.Publish(publisher.Event{
+			Content: beat.Event{Fields: mapstr.M{"priority": priority}},
+		})
+		require.True(t, ok)
+	}
+
+	getOne := func(q queue.Queue, want string) queue.Batch {
+		batch, err := q.Get(1)
+		require.NoError(t, err)
+		require.Equal(t, 1, batch.Count())
+		event, ok := batch.Entry(0).(publisher.Event)
+		require.True(t, ok)
+		assert.Equal(t, want, event.Content.Fields["priority"])
+		return batch
+	}
+
+	// The high priority event must not be acknowledged before the low
+	// priority event that was published before it.
+	getOne(lanes[0].queue, "high").Done()
+	getOne(defaultQueue, "low").Done()
+	require.Eventually(t, func() bool { return acked.Load() == 2 }, time.Second, time.Millisecond)
+
+	getOne(defaultQueue, "low").Done()
+	require.Eventually(t, func() bool { return acked.Load() == 3 }, time.Second, time.Millisecond)
+}
+
+func newTestLanes(t *testing.T, lanes ...map[string]interface{}) []*priorityLane {
+	t.Helper()
+	var config Config
+	require.NoError(t, conf.MustNewConfigFrom(map[string]interface{}{"priority_lanes": lanes}).Unpack(&config))
+	priorityLanes, _, err := newPriorityLanes(config.PriorityLanes)
+	require.NoError(t, err)
+	return priorityLanes
+}
+
+func TestLaneScheduling(t *testing.T) {
+	target := consumerTarget{
+		defaultWeight: 1,
+		lanes:         []laneTarget{{weight: 3}},
+	}
+	lanes := []*consumerLane{{}, {}}
+	var virtualTime float64
+	newBatch := func() *ttlBatch {
+		return &ttlBatch{events: make([]publisher.Event, 1)}
+	}
+
+	// send sends n batches, refilling the lanes in fill, and returns the
+	// number of batches sent per lane.
+	send := func(n int, fill ...int) []int {
+		sent := make([]int, len(lanes))
+		for _, i := range fill {
+			if lanes[i].batch == nil {
+				lanes[i].received(newBatch(), virtualTime)
+			}
+		}
+		for range n {
+			next := nextLane(lanes)
+			require.GreaterOrEqual(t, next, 0)
+			virtualTime = lanes[next].sent(target.laneWeight(next))
+			sent[next]++
+			for _, i := range fill {
+				if i == next {
+					lanes[i].received(newBatch(), virtualTime)
+				}
+			}
+		}
+		return sent
+	}
+
+	assert.Equal(t, []int{10, 30}, send(40, 0, 1), "backlogged lanes must be served according to their weights")
+
+	// A lane that was idle doesn't get to catch up on the share it didn't
+	// use in the meantime.
+	lanes[1].batch = nil
+	assert.Equal(t, []int{20, 0}, send(20, 0))
+	assert.Equal(t, []int{2, 6}, send(8, 0, 1))
+}
+
+func TestLaneQueueMetrics(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	logger := logptest.NewTestingLogger(t, "")
+	lanes := newTestLanes(t, map[string]interface{}{
+		"name": "security", "when.equals.kind": "alert", "queue.mem.events": 200, "queue.mem.flush.min_events": 100,
+	})
+	controller := outputController{
+		queueFactory: memqueue.FactoryForSettings(memqueue.Settings{Events: 1000}),
+		lanes:        lanes,
+		consumer: &eventConsumer{
+			targetChan:    make(chan consumerTarget, 4),
+			retryObserver: nilObserver,
+		},
+		monitors: Monitors{Metrics: reg},
+		beat: beat.Info{
+			Logger: logger,
+		},
+	}
+	controller.Set(outputs.Group{
+		Clients: []outputs.Client{newMockClient(nil)},
+	})
+
+	for name, want := range map[string]uint64{
+		"pipeline.queue.max_events":                1200,
+		"pipeline.lanes.default.queue.max_events":  1000,
+		"pipeline.lanes.security.queue.max_events": 200,
+	} {
+		entry := reg.Get(name)
+		require.NotNil(t, entry, "%s must exist", name)
+		value, ok := entry.(*monitoring.Uint)
+		require.True(t, ok, "%s must be a *monitoring.Uint", name)
+		assert.Equal(t, want, value.Get(), name)
+	}
+
+	// Events published to a lane are counted for the lane and the pipeline.
+	producer := controller.queueProducer(queue.ProducerConfig{})
+	_, ok := producer.Publish(publisher.Event{})
+	require.True(t, ok)
+	require.Eventually(t, func() bool {
+		return reg.Get("pipeline.queue.added.events").(*monitoring.Uint).Get() == 1 &&
+			reg.Get("pipeline.lanes.default.queue.added.events").(*monitoring.Uint).Get() == 1
+	}, time.Second, time.Millisecond)
+	assert.Zero(t, reg.Get("pipeline.lanes.security.queue.added.events").(*monitoring.Uint).Get())
+}
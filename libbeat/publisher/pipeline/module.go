@@ -97,6 +97,7 @@ func LoadWithSettings(
 		return nil, err
 	}
 
+	settings.PriorityLanes = config.PriorityLanes
 	p, err := New(beatInfo, monitors, config.Queue, out, settings)
 	if err != nil {
 		return nil, err
@@ -32,6 +32,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/publisher/processing"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/hybridqueue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
@@ -80,6 +81,10 @@ type Settings struct {
 	Processors processing.Supporter
 
 	InputQueueSize int
+
+	// PriorityLanes configures the priority lanes of the pipeline, events
+	// that don't match any lane use the pipeline queue.
+	PriorityLanes []PriorityLaneConfig
 }
 
 // WaitCloseMode enumerates the possible behaviors of WaitClose in a pipeline.
@@ -146,7 +151,12 @@ func New(
 		return nil, err
 	}
 
-	output, err := newOutputController(beat, monitors, p.observer, queueFactory, settings.InputQueueSize)
+	lanes, defaultWeight, err := newPriorityLanes(settings.PriorityLanes)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := newOutputController(beat, monitors, p.observer, queueFactory, lanes, defaultWeight, settings.InputQueueSize)
 	if err != nil {
 		return nil, err
 	}
@@ -292,6 +302,12 @@ func queueFactoryForUserConfig(queueType string, userConfig *conf.C) (queue.Queu
 			return nil, err
 		}
 		return diskqueue.FactoryForSettings(settings), nil
+	case hybridqueue.QueueType:
+		settings, err := hybridqueue.SettingsForUserConfig(userConfig)
+		if err != nil {
+			return nil, err
+		}
+		return hybridqueue.FactoryForSettings(settings), nil
 	default:
 		return nil, fmt.Errorf("unrecognized queue type '%v'", queueType)
 	}
@@ -26,8 +26,8 @@ import (
 // queueReader is a standalone stateless helper goroutine to dispatch
 // reads of the queue without blocking eventConsumer's main loop.
 type queueReader struct {
-	req  chan queueReaderRequest // "give me a batch for this target"
-	resp chan *ttlBatch          // "here is your batch, or nil"
+	req  chan queueReaderRequest  // "give me a batch for this target"
+	resp chan queueReaderResponse // "here is your batch, or nil"
 }
 
 type queueReaderRequest struct {
@@ -35,12 +35,21 @@ type queueReaderRequest struct {
 	retryer    retryer
 	batchSize  int
 	timeToLive int
+
+	// lane is the priority lane the batch is read for, it is returned as is
+	// in the response.
+	lane int
+}
+
+type queueReaderResponse struct {
+	lane  int
+	batch *ttlBatch
 }
 
 func makeQueueReader() queueReader {
 	qr := queueReader{
 		req:  make(chan queueReaderRequest, 1),
-		resp: make(chan *ttlBatch),
+		resp: make(chan queueReaderResponse),
 	}
 	return qr
 }
@@ -60,7 +69,7 @@ func (qr *queueReader) run(logger *logp.Logger) {
 			batch = newBatch(req.retryer, queueBatch, req.timeToLive)
 		}
 		select {
-		case qr.resp <- batch:
+		case qr.resp <- queueReaderResponse{lane: req.lane, batch: batch}:
 		case <-qr.req:
 			// If the request channel unblocks before we've sent our response,
 			// it means we're shutting down and the pending request can be
@@ -0,0 +1,105 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package queue
+
+import (
+	"sync"
+)
+
+// ACKMerger forwards the acknowledgements of a producer whose events are
+// published to several queues, or sources, to a single callback in the
+// order the events were published. Each source must acknowledge its own
+// events in order, but the sources can progress independently.
+//
+// Add and Remove can be called on a nil ACKMerger, which does nothing, so
+// producers without an ACK callback don't need to special-case it.
+type ACKMerger struct {
+	mu sync.Mutex
+	cb func(count int)
+
+	// runs holds the number of consecutive events published to the same
+	// source that haven't been acknowledged yet, oldest first.
+	runs []ackRun
+
+	// Acknowledgements per source that can't be forwarded yet because older
+	// events in another source are still pending.
+	acked []int
+}
+
+type ackRun struct {
+	source int
+	count  int
+}
+
+// NewACKMerger returns an ACKMerger for the given number of sources that
+// forwards acknowledgements to cb.
+func NewACKMerger(sources int, cb func(count int)) *ACKMerger {
+	return &ACKMerger{cb: cb, acked: make([]int, sources)}
+}
+
+// Add records an event that is being published to source. It must be
+// called before the event is published.
+func (m *ACKMerger) Add(source int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if last := len(m.runs) - 1; last >= 0 && m.runs[last].source == source {
+		m.runs[last].count++
+		return
+	}
+	m.runs = append(m.runs, ackRun{source: source, count: 1})
+}
+
+// Remove forgets the last event added, if it couldn't be published.
+func (m *ACKMerger) Remove() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	last := len(m.runs) - 1
+	m.runs[last].count--
+	if m.runs[last].count == 0 {
+		m.runs = m.runs[:last]
+	}
+}
+
+// ACK handles the acknowledgement of count events by source.
+func (m *ACKMerger) ACK(source int, count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.acked[source] += count
+
+	total := 0
+	for len(m.runs) > 0 {
+		run := &m.runs[0]
+		n := min(m.acked[run.source], run.count)
+		total += n
+		m.acked[run.source] -= n
+		run.count -= n
+		if run.count > 0 {
+			break
+		}
+		m.runs = m.runs[1:]
+	}
+	if total > 0 {
+		m.cb(total)
+	}
+}
@@ -0,0 +1,55 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACKMerger(t *testing.T) {
+	var forwarded []int
+	m := NewACKMerger(2, func(count int) { forwarded = append(forwarded, count) })
+
+	// 0, 0, 1, 1, 0
+	m.Add(0)
+	m.Add(0)
+	m.Add(1)
+	m.Add(1)
+	m.Add(0)
+
+	// The second source acknowledges its events first, they can't be
+	// forwarded before the older events of the first source.
+	m.ACK(1, 2)
+	assert.Empty(t, forwarded)
+
+	m.ACK(0, 1)
+	m.ACK(0, 2)
+	assert.Equal(t, []int{1, 4}, forwarded)
+
+	// Failed publishes are forgotten.
+	m.Add(1)
+	m.Remove()
+	assert.Empty(t, m.runs)
+
+	// A nil merger ignores events.
+	var nilMerger *ACKMerger
+	nilMerger.Add(0)
+	nilMerger.Remove()
+}
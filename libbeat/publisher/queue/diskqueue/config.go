@@ -66,6 +66,14 @@ type Settings struct {
 
 	// UseCompression enables or disables LZ4 compression
 	UseCompression bool
+
+	// EncryptionKey enables AES-GCM encryption of the data frames written
+	// to new segments. It must be 16, 24 or 32 bytes long.
+	EncryptionKey []byte
+
+	// PreviousEncryptionKeys are only used to decrypt existing segments
+	// that were written with an earlier EncryptionKey.
+	PreviousEncryptionKeys [][]byte
 }
 
 // userConfig holds the parameters for a disk queue that are configurable
@@ -80,6 +88,33 @@ type userConfig struct {
 
 	RetryInterval    *time.Duration `config:"retry_interval" validate:"positive"`
 	MaxRetryInterval *time.Duration `config:"max_retry_interval" validate:"positive"`
+
+	Encryption encryptionConfig `config:"encryption"`
+}
+
+// encryptionConfig holds the base64 encoded keys used to encrypt the queue.
+// Keys are usually referenced from the keystore, e.g. "${QUEUE_KEY}".
+type encryptionConfig struct {
+	Enabled      bool     `config:"enabled"`
+	Key          string   `config:"key"`
+	PreviousKeys []string `config:"previous_keys"`
+}
+
+func (c *encryptionConfig) Validate() error {
+	if c.Enabled && c.Key == "" {
+		return errors.New("disk queue encryption requires a key")
+	}
+	if c.Key != "" {
+		if _, err := decodeEncryptionKey(c.Key); err != nil {
+			return fmt.Errorf("invalid disk queue encryption key: %w", err)
+		}
+	}
+	for i, key := range c.PreviousKeys {
+		if _, err := decodeEncryptionKey(key); err != nil {
+			return fmt.Errorf("invalid disk queue encryption previous_keys.%d: %w", i, err)
+		}
+	}
+	return nil
 }
 
 func (c *userConfig) Validate() error {
@@ -163,6 +198,15 @@ func SettingsForUserConfig(config *config.C) (Settings, error) {
 		settings.MaxRetryInterval = *userConfig.MaxRetryInterval
 	}
 
+	// The keys have already been checked by encryptionConfig.Validate.
+	if userConfig.Encryption.Enabled {
+		settings.EncryptionKey, _ = decodeEncryptionKey(userConfig.Encryption.Key)
+	}
+	for _, key := range userConfig.Encryption.PreviousKeys {
+		decoded, _ := decodeEncryptionKey(key)
+		settings.PreviousEncryptionKeys = append(settings.PreviousEncryptionKeys, decoded)
+	}
+
 	return settings, nil
 }
 
@@ -18,6 +18,7 @@
 package diskqueue
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
@@ -28,10 +29,41 @@ type diskQueueBatch struct {
 	frames []*readFrame
 }
 
+// ErrEmpty is returned by TryGet when every event in the queue has been read.
+var ErrEmpty = errors.New("all events in the disk queue have been read")
+
 func (dq *diskQueue) Get(eventCount int) (queue.Batch, error) {
 	// We can always eventually read at least one frame unless the queue or the
 	// consumer is closed.
 	frame, ok := <-dq.readerLoop.output
+	return dq.getBatch(frame, ok, eventCount)
+}
+
+// TryGet is like Get, but returns ErrEmpty instead of waiting for new events
+// once every event in the queue has been read.
+func (dq *diskQueue) TryGet(eventCount int) (queue.Batch, error) {
+	dq.idleLock.Lock()
+	idle := dq.idle
+	dq.idleLock.Unlock()
+
+	select {
+	case frame, ok := <-dq.readerLoop.output:
+		return dq.getBatch(frame, ok, eventCount)
+	case <-idle:
+	}
+	// The last frames may have been sent to the output channel right before
+	// the queue became idle.
+	select {
+	case frame, ok := <-dq.readerLoop.output:
+		return dq.getBatch(frame, ok, eventCount)
+	default:
+		return nil, ErrEmpty
+	}
+}
+
+// getBatch returns a batch starting with the given frame, adding the frames
+// that can be read without blocking up to eventCount.
+func (dq *diskQueue) getBatch(frame *readFrame, ok bool, eventCount int) (queue.Batch, error) {
 	if !ok {
 		return nil, fmt.Errorf("tried to read from a closed disk queue")
 	}
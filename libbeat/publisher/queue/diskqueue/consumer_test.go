@@ -44,6 +44,31 @@ func TestQueueGetObserver(t *testing.T) {
 	assertRegistryUint(t, reg, "queue.consumed.bytes", eventCount*123, "Get call should report consumed bytes")
 }
 
+func TestQueueTryGet(t *testing.T) {
+	dq := diskQueue{
+		observer: queue.NewQueueObserver(nil),
+		readerLoop: &readerLoop{
+			output: make(chan *readFrame, 2),
+		},
+		idle: make(chan struct{}),
+	}
+	dq.readerLoop.output <- &readFrame{}
+	dq.readerLoop.output <- &readFrame{}
+
+	// Frames that are already in the output channel are returned even if
+	// the queue is idle.
+	close(dq.idle)
+	batch, err := dq.TryGet(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, batch.Count())
+	batch, err = dq.TryGet(0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, batch.Count())
+
+	_, err = dq.TryGet(1)
+	assert.ErrorIs(t, err, ErrEmpty)
+}
+
 func assertRegistryUint(t *testing.T, reg *monitoring.Registry, key string, expected uint64, message string) {
 	t.Helper()
 
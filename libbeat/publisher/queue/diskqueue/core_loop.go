@@ -32,6 +32,8 @@ func (dq *diskQueue) run() {
 	dq.maybeDeleteACKed()
 
 	for {
+		dq.updateIdle()
+
 		select {
 		// Endpoints used by the producer / consumer API implementation.
 		case producerWriteRequest := <-dq.producerWriteRequestChan:
@@ -49,6 +51,10 @@ func (dq *diskQueue) run() {
 
 		case <-dq.close:
 			dq.handleShutdown()
+			// Wait for the writer loop to finalize the current segment, so
+			// its frame count is up to date once the queue is done.
+			<-dq.writerLoop.finished
+			close(dq.done)
 			return
 
 		// Writer loop handling
@@ -398,6 +404,25 @@ func (dq *diskQueue) maybeReadPending() {
 	dq.reading = true
 }
 
+// Closes the idle channel once there is nothing left to read or write, so
+// TryGet can tell that every frame has been sent to the reader loop's output
+// channel, and replaces it once there is.
+func (dq *diskQueue) updateIdle() {
+	idle := !dq.reading && !dq.writing && len(dq.pendingFrames) == 0
+	dq.idleLock.Lock()
+	defer dq.idleLock.Unlock()
+	select {
+	case <-dq.idle:
+		if !idle {
+			dq.idle = make(chan struct{})
+		}
+	default:
+		if idle {
+			close(dq.idle)
+		}
+	}
+}
+
 // If the acked list is nonempty, and there are no outstanding deletion
 // requests, send one.
 func (dq *diskQueue) maybeDeleteACKed() {
@@ -0,0 +1,417 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The data region of an encrypted segment is a sequence of blocks. Each
+// block is prefixed by its 4-byte little-endian length and holds the id of
+// the key used to encrypt it, followed by a random nonce and the AES-GCM
+// sealed data.
+const (
+	encryptionKeyIDSize = 4
+	encryptionNonceSize = 12
+	encryptionTagSize   = 16
+	encryptionOverhead  = encryptionKeyIDSize + encryptionNonceSize + encryptionTagSize
+
+	// encryptionBlockSize is the amount of data buffered by the
+	// EncryptionWriter before a block is sealed and written.
+	encryptionBlockSize = 64 * 1024
+	// maxEncryptedBlockSize guards against allocating huge buffers for
+	// corrupted block lengths.
+	maxEncryptedBlockSize = 16 * 1024 * 1024
+)
+
+var errEncryptedFrameTooShort = errors.New("encrypted data block is too short")
+
+// frameCipher encrypts and decrypts the blocks of encrypted segments.
+// New blocks are encrypted with the current key, blocks written with a
+// previous key can still be decrypted as long as it is configured.
+type frameCipher struct {
+	// current is nil if the queue only decrypts existing segments.
+	current *frameKey
+	keys    map[uint32]*frameKey
+}
+
+type frameKey struct {
+	id   uint32
+	aead cipher.AEAD
+}
+
+// newFrameCipher returns the cipher for the keys in settings, or nil if no
+// keys are configured.
+func newFrameCipher(settings Settings) (*frameCipher, error) {
+	if len(settings.EncryptionKey) == 0 && len(settings.PreviousEncryptionKeys) == 0 {
+		return nil, nil
+	}
+
+	c := &frameCipher{keys: map[uint32]*frameKey{}}
+	for _, key := range settings.PreviousEncryptionKeys {
+		if _, err := c.addKey(key); err != nil {
+			return nil, err
+		}
+	}
+	if len(settings.EncryptionKey) > 0 {
+		current, err := c.addKey(settings.EncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		c.current = current
+	}
+	return c, nil
+}
+
+func (c *frameCipher) addKey(key []byte) (*frameKey, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid disk queue encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid disk queue encryption key: %w", err)
+	}
+	k := &frameKey{id: encryptionKeyID(key), aead: aead}
+	c.keys[k.id] = k
+	return k, nil
+}
+
+// encryptionKeyID identifies a key without revealing it.
+func encryptionKeyID(key []byte) uint32 {
+	sum := sha256.Sum256(key)
+	return binary.BigEndian.Uint32(sum[:encryptionKeyIDSize])
+}
+
+// encrypts returns true if new frames are encrypted.
+func (c *frameCipher) encrypts() bool {
+	return c != nil && c.current != nil
+}
+
+// encrypt seals a block of data with the current key.
+func (c *frameCipher) encrypt(plaintext []byte) ([]byte, error) {
+	out := make([]byte, encryptionKeyIDSize+encryptionNonceSize, len(plaintext)+encryptionOverhead)
+	binary.BigEndian.PutUint32(out, c.current.id)
+	nonce := out[encryptionKeyIDSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("couldn't generate nonce: %w", err)
+	}
+	// The key id is authenticated so blocks can't be moved between keys.
+	return c.current.aead.Seal(out, nonce, plaintext, out[:encryptionKeyIDSize]), nil
+}
+
+// decrypt opens an encrypted block, appending the data to dst.
+func (c *frameCipher) decrypt(dst, data []byte) ([]byte, error) {
+	key, err := c.frameKey(data)
+	if err != nil {
+		return nil, err
+	}
+	nonce := data[encryptionKeyIDSize : encryptionKeyIDSize+encryptionNonceSize]
+	plaintext, err := key.aead.Open(dst, nonce, data[encryptionKeyIDSize+encryptionNonceSize:], data[:encryptionKeyIDSize])
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt data block with key %08x: %w", key.id, err)
+	}
+	return plaintext, nil
+}
+
+// frameKey returns the key an encrypted block was written with.
+func (c *frameCipher) frameKey(data []byte) (*frameKey, error) {
+	if len(data) < encryptionOverhead {
+		return nil, errEncryptedFrameTooShort
+	}
+	id := binary.BigEndian.Uint32(data)
+	if c != nil {
+		if key, ok := c.keys[id]; ok {
+			return key, nil
+		}
+	}
+	return nil, unknownKeyError{id: id}
+}
+
+// checkSegment makes sure the first block of an encrypted segment can be
+// decrypted, so a missing or wrong key is reported on startup rather than
+// when the segment is eventually read.
+func (c *frameCipher) checkSegment(settings Settings, segment *queueSegment) error {
+	file, err := os.Open(settings.segmentPath(segment.id))
+	if err != nil {
+		// Unreadable segments are handled by the reader loop.
+		return nil
+	}
+	defer file.Close()
+	header, err := readSegmentHeader(file)
+	if err != nil || header.options&ENABLE_ENCRYPTION == 0 {
+		return nil
+	}
+	if c == nil {
+		return fmt.Errorf(
+			"disk queue segment %d is encrypted but no encryption key is configured", segment.id)
+	}
+
+	var unknownKey unknownKeyError
+	_, err = NewEncryptionReader(file, c).Read(make([]byte, 1))
+	switch {
+	case err == nil || errors.Is(err, io.EOF):
+		return nil
+	case errors.As(err, &unknownKey):
+		return fmt.Errorf(
+			"disk queue segment %d is encrypted with key %08x which is not configured, "+
+				"add it to queue.disk.encryption.previous_keys", segment.id, unknownKey.id)
+	default:
+		return fmt.Errorf("couldn't decrypt disk queue segment %d: %w", segment.id, err)
+	}
+}
+
+// EncryptionWriter encrypts the data written to a segment. Data is
+// buffered and sealed in blocks, a block is written once the buffer is
+// full or the writer is synced or closed.
+type EncryptionWriter struct {
+	dst    WriteCloseSyncer
+	cipher *frameCipher
+	buf    bytes.Buffer
+
+	// pending is the part of a sealed block that has not been written
+	// yet because of a write error.
+	pending []byte
+}
+
+// NewEncryptionWriter returns a writer encrypting data with the current
+// key of c.
+func NewEncryptionWriter(w WriteCloseSyncer, c *frameCipher) *EncryptionWriter {
+	return &EncryptionWriter{dst: w, cipher: c}
+}
+
+// Write buffers p. If a previous block could not be written, it is written
+// first and p is only accepted once that succeeds, so write errors can be
+// retried by the caller.
+func (w *EncryptionWriter) Write(p []byte) (int, error) {
+	if err := w.writePending(); err != nil {
+		return 0, err
+	}
+	w.buf.Write(p)
+	if w.buf.Len() >= encryptionBlockSize {
+		// Errors are returned by the next call, p has been accepted.
+		_ = w.flush()
+	}
+	return len(p), nil
+}
+
+// flush seals the buffered data as a block and writes it.
+func (w *EncryptionWriter) flush() error {
+	if err := w.writePending(); err != nil {
+		return err
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	sealed, err := w.cipher.encrypt(w.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	w.buf.Reset()
+	w.pending = binary.LittleEndian.AppendUint32(make([]byte, 0, 4+len(sealed)), uint32(len(sealed))) //nolint:gosec // blocks are much smaller than 4GiB
+	w.pending = append(w.pending, sealed...)
+	return w.writePending()
+}
+
+// writePending writes the rest of the last sealed block. Errors are not
+// retried here: the rest of the block is kept, and the writer loop retries
+// the write through its callbackRetryWriter, with backoff and until the
+// queue is closed.
+func (w *EncryptionWriter) writePending() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	n, err := w.dst.Write(w.pending)
+	w.pending = w.pending[n:]
+	if err != nil {
+		return err
+	}
+	w.pending = nil
+	return nil
+}
+
+func (w *EncryptionWriter) Close() error {
+	if err := w.flush(); err != nil {
+		_ = w.dst.Close()
+		return err
+	}
+	return w.dst.Close()
+}
+
+func (w *EncryptionWriter) Sync() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.dst.Sync()
+}
+
+// EncryptionReader decrypts the blocks of an encrypted segment.
+type EncryptionReader struct {
+	src    io.ReadCloser
+	cipher *frameCipher
+
+	// raw holds a block that has only partially been read, in case the
+	// writer has not finished writing it yet.
+	raw []byte
+	// plain holds the decrypted data of the current block, off is the
+	// position of the next byte to return.
+	plain []byte
+	off   int
+}
+
+// NewEncryptionReader returns a reader decrypting the blocks read from r.
+func NewEncryptionReader(r io.ReadCloser, c *frameCipher) *EncryptionReader {
+	return &EncryptionReader{src: r, cipher: c}
+}
+
+func (r *EncryptionReader) Read(p []byte) (int, error) {
+	if r.off == len(r.plain) {
+		if err := r.nextBlock(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain[r.off:])
+	r.off += n
+	return n, nil
+}
+
+// nextBlock reads and decrypts the next block. If the block is incomplete,
+// the data read so far is kept and io.EOF is returned.
+func (r *EncryptionReader) nextBlock() error {
+	if err := r.fill(4); err != nil {
+		return err
+	}
+	length := binary.LittleEndian.Uint32(r.raw)
+	if length > maxEncryptedBlockSize {
+		return fmt.Errorf("encrypted data block length %d is too large", length)
+	}
+	if err := r.fill(4 + int(length)); err != nil {
+		return err
+	}
+	plain, err := r.cipher.decrypt(r.plain[:0], r.raw[4:])
+	if err != nil {
+		return err
+	}
+	r.plain, r.off = plain, 0
+	r.raw = r.raw[:0]
+	return nil
+}
+
+// fill reads from src until raw holds n bytes.
+func (r *EncryptionReader) fill(n int) error {
+	if cap(r.raw) < n {
+		raw := make([]byte, len(r.raw), n)
+		copy(raw, r.raw)
+		r.raw = raw
+	}
+	for len(r.raw) < n {
+		m, err := r.src.Read(r.raw[len(r.raw):n])
+		r.raw = r.raw[:len(r.raw)+m]
+		if err != nil && len(r.raw) < n {
+			if readErrorIsRetriable(err) {
+				continue
+			}
+			return err
+		}
+		if m == 0 && err == nil {
+			return io.ErrNoProgress
+		}
+	}
+	return nil
+}
+
+func (r *EncryptionReader) Close() error {
+	return r.src.Close()
+}
+
+// Reset discards any buffered data, it assumes that the caller has already
+// set src to the start of a block.
+func (r *EncryptionReader) Reset() {
+	r.raw = r.raw[:0]
+	r.plain = r.plain[:0]
+	r.off = 0
+}
+
+// encryptedSegmentSize returns the size of an encrypted segment as seen
+// through an EncryptionReader, the header plus the decrypted data of all
+// complete blocks. The blocks don't need to be decrypted to compute it.
+func encryptedSegmentSize(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	fileSize := info.Size()
+
+	size := uint64(segmentHeaderSize)
+	var length [4]byte
+	for offset := int64(segmentHeaderSize); offset+4 <= fileSize; {
+		if _, err := file.ReadAt(length[:], offset); err != nil {
+			return size, err
+		}
+		blockLength := binary.LittleEndian.Uint32(length[:])
+		if blockLength < encryptionOverhead {
+			return size, errEncryptedFrameTooShort
+		}
+		offset += 4 + int64(blockLength)
+		if offset > fileSize {
+			// The last block is incomplete.
+			break
+		}
+		size += uint64(blockLength - encryptionOverhead)
+	}
+	return size, nil
+}
+
+// unknownKeyError is returned for blocks encrypted with a key that is not
+// configured.
+type unknownKeyError struct {
+	id uint32
+}
+
+func (e unknownKeyError) Error() string {
+	return fmt.Sprintf("data block is encrypted with unknown key %08x", e.id)
+}
+
+// decodeEncryptionKey decodes a base64 encoded AES key.
+func decodeEncryptionKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("encryption key must be 16, 24 or 32 bytes long, got %d bytes", len(key))
+	}
+}
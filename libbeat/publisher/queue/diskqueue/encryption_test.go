@@ -0,0 +1,404 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, 32)
+	testKey2 = bytes.Repeat([]byte{2}, 16)
+)
+
+func TestFrameCipherRoundTrip(t *testing.T) {
+	old, err := newFrameCipher(Settings{EncryptionKey: testKey1})
+	require.NoError(t, err)
+	current, err := newFrameCipher(Settings{
+		EncryptionKey:          testKey2,
+		PreviousEncryptionKeys: [][]byte{testKey1},
+	})
+	require.NoError(t, err)
+
+	plaintext := []byte("some serialized event")
+	oldFrame, err := old.encrypt(plaintext)
+	require.NoError(t, err)
+	assert.NotContains(t, string(oldFrame), string(plaintext))
+	assert.Len(t, oldFrame, len(plaintext)+encryptionOverhead)
+
+	// Frames written with a previous key can still be decrypted.
+	decrypted, err := current.decrypt(nil, oldFrame)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	// But the old key can't decrypt frames written with the new one.
+	newFrame, err := current.encrypt(plaintext)
+	require.NoError(t, err)
+	_, err = old.decrypt(nil, newFrame)
+	assert.ErrorAs(t, err, &unknownKeyError{})
+
+	// Tampering with the frame is detected.
+	newFrame[len(newFrame)-1] ^= 0xff
+	_, err = current.decrypt(nil, newFrame)
+	assert.ErrorContains(t, err, "couldn't decrypt data block")
+
+	_, err = current.decrypt(nil, newFrame[:encryptionOverhead-1])
+	assert.ErrorIs(t, err, errEncryptedFrameTooShort)
+}
+
+func TestEncryptionReaderWriter(t *testing.T) {
+	c, err := newFrameCipher(Settings{EncryptionKey: testKey1})
+	require.NoError(t, err)
+
+	var dst bytes.Buffer
+	w := NewEncryptionWriter(NopWriteCloseSyncer(NopWriteCloser(&dst)), c)
+	data := bytes.Repeat([]byte("0123456789"), encryptionBlockSize/5)
+	_, err = w.Write(data[:10])
+	require.NoError(t, err)
+	assert.Zero(t, dst.Len(), "data must be buffered until the block is complete")
+	_, err = w.Write(data[10:])
+	require.NoError(t, err)
+	require.NoError(t, w.Sync())
+	assert.NotContains(t, dst.String(), "0123456789")
+
+	// An incomplete block is kept until the rest of it has been written.
+	written := dst.Bytes()
+	src := &bytes.Buffer{}
+	r := NewEncryptionReader(io.NopCloser(src), c)
+	src.Write(written[:len(written)-1])
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	src.Write(written[len(written)-1:])
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, append(got, rest...))
+}
+
+func TestEncryptedSegmentSize(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	settings.EncryptionKey = testKey1
+
+	qs := &queueSegment{id: 0}
+	sw, err := qs.getWriter(settings)
+	require.NoError(t, err)
+	for _, data := range []string{"abc", "defg"} {
+		_, err = sw.Write([]byte(data))
+		require.NoError(t, err)
+		require.NoError(t, sw.Sync())
+	}
+	require.NoError(t, sw.Close())
+
+	size, err := encryptedSegmentSize(settings.segmentPath(qs.id))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(segmentHeaderSize+7), size)
+}
+
+func TestEncryptedQueue(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	settings.EncryptionKey = testKey1
+
+	const eventCount = 10
+	dq := newTestEncryptedQueue(t, settings)
+	producer := dq.Producer(queue.ProducerConfig{})
+	for i := 0; i < eventCount; i++ {
+		_, ok := producer.Publish(publisher.Event{Content: beat.Event{
+			Timestamp: time.Now(),
+			Fields:    mapstr.M{"message": "secret", "n": i},
+		}})
+		require.True(t, ok)
+	}
+
+	// Only the first half is acknowledged, the rest stays in the queue.
+	events := readTestEvents(t, dq, eventCount/2)
+	assert.Equal(t, "secret", events[0].Content.Fields["message"])
+	assert.EqualValues(t, 0, events[0].Content.Fields["n"])
+
+	require.NoError(t, dq.Close())
+	<-dq.Done()
+
+	segments, err := scanExistingSegments(logptest.NewTestingLogger(t, ""), settings)
+	require.NoError(t, err)
+	require.NotEmpty(t, segments)
+	requireEncryptedSegments(t, settings, segments)
+
+	// Restarting without the key must fail on startup.
+	noKey := settings
+	noKey.EncryptionKey = nil
+	_, err = NewQueue(logptest.NewTestingLogger(t, ""), nil, noKey, nil)
+	assert.ErrorContains(t, err, "is encrypted but no encryption key is configured")
+
+	rotatedWithoutPrevious := settings
+	rotatedWithoutPrevious.EncryptionKey = testKey2
+	_, err = NewQueue(logptest.NewTestingLogger(t, ""), nil, rotatedWithoutPrevious, nil)
+	assert.ErrorContains(t, err, "which is not configured")
+
+	// After rotating the key, existing segments are read with the previous key.
+	rotated := rotatedWithoutPrevious
+	rotated.PreviousEncryptionKeys = [][]byte{testKey1}
+	dq = newTestEncryptedQueue(t, rotated)
+	events = readTestEvents(t, dq, eventCount/2)
+	assert.Equal(t, "secret", events[0].Content.Fields["message"])
+	assert.EqualValues(t, eventCount/2, events[0].Content.Fields["n"])
+	require.NoError(t, dq.Close())
+	<-dq.Done()
+}
+
+func TestEncryptedCompressedQueue(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	settings.EncryptionKey = testKey1
+	settings.UseCompression = true
+
+	const eventCount = 10
+	dq := newTestEncryptedQueue(t, settings)
+	producer := dq.Producer(queue.ProducerConfig{})
+	for i := 0; i < eventCount; i++ {
+		_, ok := producer.Publish(publisher.Event{Content: beat.Event{
+			Timestamp: time.Now(),
+			Fields:    mapstr.M{"message": "secret", "n": i},
+		}})
+		require.True(t, ok)
+	}
+
+	events := readTestEvents(t, dq, eventCount)
+	for i, event := range events {
+		assert.Equal(t, "secret", event.Content.Fields["message"])
+		assert.EqualValues(t, i, event.Content.Fields["n"])
+	}
+
+	segments, err := scanExistingSegments(logptest.NewTestingLogger(t, ""), settings)
+	require.NoError(t, err)
+	require.NotEmpty(t, segments)
+	requireEncryptedSegments(t, settings, segments)
+
+	require.NoError(t, dq.Close())
+	<-dq.Done()
+}
+
+// requireEncryptedSegments checks that the segments are flagged as
+// encrypted and don't contain the plaintext events.
+func requireEncryptedSegments(t *testing.T, settings Settings, segments []*queueSegment) {
+	t.Helper()
+	for _, segment := range segments {
+		data, err := os.ReadFile(settings.segmentPath(segment.id))
+		require.NoError(t, err)
+		header, err := readSegmentHeader(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.NotZero(t, header.options&ENABLE_ENCRYPTION)
+		if settings.UseCompression {
+			assert.NotZero(t, header.options&ENABLE_COMPRESSION)
+		}
+		assert.NotContains(t, string(data), "secret")
+	}
+}
+
+func TestEncryptionConfig(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(testKey1)
+	previous := base64.StdEncoding.EncodeToString(testKey2)
+
+	tests := map[string]struct {
+		config  map[string]interface{}
+		wantErr string
+	}{
+		"disabled": {
+			config: map[string]interface{}{},
+		},
+		"enabled": {
+			config: map[string]interface{}{
+				"enabled":       true,
+				"key":           key,
+				"previous_keys": []string{previous},
+			},
+		},
+		"missing key": {
+			config:  map[string]interface{}{"enabled": true},
+			wantErr: "requires a key",
+		},
+		"invalid key": {
+			config:  map[string]interface{}{"enabled": true, "key": "not base64!"},
+			wantErr: "not valid base64",
+		},
+		"short key": {
+			config:  map[string]interface{}{"enabled": true, "key": base64.StdEncoding.EncodeToString([]byte("short"))},
+			wantErr: "must be 16, 24 or 32 bytes long",
+		},
+		"invalid previous key": {
+			config:  map[string]interface{}{"previous_keys": []string{"nope"}},
+			wantErr: "previous_keys.0",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.MustNewConfigFrom(map[string]interface{}{"max_size": "1GB", "encryption": tc.config})
+			settings, err := SettingsForUserConfig(cfg)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if name == "enabled" {
+				assert.Equal(t, testKey1, settings.EncryptionKey)
+				assert.Equal(t, [][]byte{testKey2}, settings.PreviousEncryptionKeys)
+			} else {
+				assert.Empty(t, settings.EncryptionKey)
+			}
+		})
+	}
+}
+
+func newTestEncryptedQueue(t *testing.T, settings Settings) *diskQueue {
+	t.Helper()
+	dq, err := NewQueue(logptest.NewTestingLogger(t, ""), nil, settings, nil)
+	require.NoError(t, err)
+	return dq
+}
+
+// readTestEvents reads and acknowledges count events from the queue, which
+// may take more than one batch.
+func readTestEvents(t *testing.T, dq *diskQueue, count int) []publisher.Event {
+	t.Helper()
+	var events []publisher.Event
+	for len(events) < count {
+		batch, err := dq.Get(count - len(events))
+		require.NoError(t, err)
+		for i := 0; i < batch.Count(); i++ {
+			event, ok := batch.Entry(i).(publisher.Event)
+			require.True(t, ok)
+			events = append(events, event)
+		}
+		batch.Done()
+	}
+	return events
+}
+
+// TestRestoreUncleanSegments checks that the frames of compressed and
+// encrypted segments are counted after an unclean shutdown, when their
+// headers still have a frame count of 0.
+func TestRestoreUncleanSegments(t *testing.T) {
+	tests := map[string]struct {
+		compression bool
+		key         []byte
+	}{
+		"compressed":           {compression: true},
+		"encrypted":            {key: testKey1},
+		"compressed encrypted": {compression: true, key: testKey1},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			settings := DefaultSettings()
+			settings.Path = t.TempDir()
+			settings.UseCompression = tc.compression
+			settings.EncryptionKey = tc.key
+
+			const eventCount = 10
+			written := make(chan int, eventCount)
+			dq := newTestEncryptedQueue(t, settings)
+			producer := dq.Producer(queue.ProducerConfig{ACK: func(count int) { written <- count }})
+			for i := 0; i < eventCount; i++ {
+				_, ok := producer.Publish(publisher.Event{Content: beat.Event{
+					Timestamp: time.Now(),
+					Fields:    mapstr.M{"message": "secret", "n": i},
+				}})
+				require.True(t, ok)
+			}
+			for n := 0; n < eventCount; n += <-written {
+			}
+			require.NoError(t, dq.Close())
+			<-dq.Done()
+
+			// Reset the frame counts, like in segments that were not closed.
+			segments, err := scanExistingSegments(logptest.NewTestingLogger(t, ""), settings)
+			require.NoError(t, err)
+			require.NotEmpty(t, segments)
+			for _, segment := range segments {
+				f, err := os.OpenFile(settings.segmentPath(segment.id), os.O_WRONLY, 0)
+				require.NoError(t, err)
+				_, err = f.WriteAt(make([]byte, 4), 4)
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+			}
+
+			dq = newTestEncryptedQueue(t, settings)
+			assert.Equal(t, eventCount, dq.RestoredEventCount())
+			events := readTestEvents(t, dq, eventCount)
+			for i, event := range events {
+				assert.EqualValues(t, i, event.Content.Fields["n"])
+			}
+			require.NoError(t, dq.Close())
+			<-dq.Done()
+		})
+	}
+}
+
+func TestEncryptionWriterRetry(t *testing.T) {
+	c, err := newFrameCipher(Settings{EncryptionKey: testKey1})
+	require.NoError(t, err)
+
+	var dst bytes.Buffer
+	failing := &failingWriter{Writer: &dst, failures: 2}
+	w := NewEncryptionWriter(NopWriteCloseSyncer(NopWriteCloser(failing)), c)
+	_, err = w.Write([]byte("abc"))
+	require.NoError(t, err)
+
+	// Failed writes are returned to the caller instead of being retried, the
+	// block is written by the next call that succeeds.
+	assert.ErrorIs(t, w.Sync(), syscall.EAGAIN)
+	n, err := w.Write([]byte("def"))
+	assert.ErrorIs(t, err, syscall.EAGAIN)
+	assert.Zero(t, n)
+	_, err = w.Write([]byte("def"))
+	require.NoError(t, err)
+	require.NoError(t, w.Sync())
+
+	got, err := io.ReadAll(NewEncryptionReader(io.NopCloser(&dst), c))
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef", string(got))
+}
+
+// failingWriter fails the first writes without writing anything.
+type failingWriter struct {
+	io.Writer
+	failures int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.failures > 0 {
+		w.failures--
+		return 0, syscall.EAGAIN
+	}
+	return w.Writer.Write(p)
+}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/elastic-agent-libs/logp"
@@ -39,6 +40,12 @@ type diskQueue struct {
 	// Metadata related to the segment files.
 	segments diskQueueSegments
 
+	// The number of events that were pending on disk when the queue was
+	// opened, and whether there were any segments left to read. The count
+	// is only as accurate as the segment headers and frames allow.
+	restoredEventCount int
+	restored           bool
+
 	// Metadata related to consumer acks / positions of the oldest remaining
 	// frame.
 	acks *diskQueueACKs
@@ -65,6 +72,12 @@ type diskQueue struct {
 	// otherwise.
 	deleting bool
 
+	// idle is closed by the core loop while every frame in the queue has
+	// been sent to the reader loop's output channel, and replaced once there
+	// are frames left to read or write. Used by TryGet.
+	idleLock sync.Mutex
+	idle     chan struct{}
+
 	// The API channel used by diskQueueProducer to write events.
 	producerWriteRequestChan chan producerWriteRequest
 
@@ -162,7 +175,7 @@ func NewQueue(
 
 	// Index any existing data segments to be placed in segments.reading.
 	initialSegments, err :=
-		scanExistingSegments(logger, settings.directoryPath())
+		scanExistingSegments(logger, settings)
 	if err != nil {
 		return nil, err
 	}
@@ -198,6 +211,18 @@ func NewQueue(
 		nextReadPosition = queuePosition{segmentID: initialSegments[0].id}
 	}
 
+	// Encrypted segments that can't be decrypted with the configured keys
+	// would otherwise only fail once the reader loop gets to them.
+	cipher, err := newFrameCipher(settings)
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range initialSegments {
+		if err := cipher.checkSegment(settings, segment); err != nil {
+			return nil, err
+		}
+	}
+
 	// Count just the active events to report in the log
 	activeFrameCount := 0
 	for _, segment := range initialSegments {
@@ -222,6 +247,8 @@ func NewQueue(
 			nextID:           nextSegmentID,
 			nextReadPosition: nextReadPosition.byteIndex,
 		},
+		restoredEventCount: activeFrameCount,
+		restored:           len(initialSegments) > 0,
 
 		acks: newDiskQueueACKs(logger, nextReadPosition, positionFile),
 
@@ -231,6 +258,8 @@ func NewQueue(
 
 		producerWriteRequestChan: make(chan producerWriteRequest),
 
+		idle: make(chan struct{}),
+
 		close: make(chan struct{}),
 		done:  make(chan struct{}),
 	}
@@ -268,6 +297,20 @@ func (dq *diskQueue) BufferConfig() queue.BufferConfig {
 	return queue.BufferConfig{MaxEvents: 0}
 }
 
+// RestoredEventCount returns the number of events that were already pending
+// on disk when the queue was opened. They are read before any new events.
+func (dq *diskQueue) RestoredEventCount() int {
+	return dq.restoredEventCount
+}
+
+// HasRestoredEvents returns true if there were segments left to read when
+// the queue was opened. Unlike RestoredEventCount, it doesn't depend on the
+// frame counts of the segments, the restored events can be read with
+// TryGet until it returns ErrEmpty.
+func (dq *diskQueue) HasRestoredEvents() bool {
+	return dq.restored
+}
+
 func (dq *diskQueue) Producer(cfg queue.ProducerConfig) queue.Producer {
 	return &diskQueueProducer{
 		queue:   dq,
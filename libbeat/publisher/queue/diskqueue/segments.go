@@ -153,6 +153,7 @@ const (
 	_                  uint32 = 1 << iota // 0x1
 	ENABLE_COMPRESSION                    // 0x2
 	ENABLE_PROTOBUF                       // 0x4
+	ENABLE_ENCRYPTION                     // 0x8
 )
 
 // Sort order: we store loaded segments in ascending order by their id.
@@ -162,9 +163,10 @@ func (s bySegmentID) Len() int           { return len(s) }
 func (s bySegmentID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s bySegmentID) Less(i, j int) bool { return s[i].id < s[j].id }
 
-// Scan the given path for segment files, and return them in a list
+// Scan the queue directory for segment files, and return them in a list
 // ordered by segment id.
-func scanExistingSegments(logger *logp.Logger, pathStr string) ([]*queueSegment, error) {
+func scanExistingSegments(logger *logp.Logger, settings Settings) ([]*queueSegment, error) {
+	pathStr := settings.directoryPath()
 	dirEntries, err := os.ReadDir(pathStr)
 	if err != nil {
 		return nil, fmt.Errorf("could not read queue directory '%s': %w", pathStr, err)
@@ -184,7 +186,7 @@ func scanExistingSegments(logger *logp.Logger, pathStr string) ([]*queueSegment,
 			// don't match the "[uint64].seg" pattern.
 			if id, err := strconv.ParseUint(components[0], 10, 64); err == nil {
 				fullPath := path.Join(pathStr, file.Name())
-				header, err := readSegmentHeaderWithFrameCount(fullPath)
+				header, err := readSegmentHeaderWithFrameCount(settings, fullPath)
 				if header == nil {
 					logger.Errorf("couldn't load segment file '%v': %v", fullPath, err)
 					continue
@@ -197,11 +199,28 @@ func scanExistingSegments(logger *logp.Logger, pathStr string) ([]*queueSegment,
 						"error loading segment file '%v', data may be incomplete: %v",
 						fullPath, err)
 				}
+				byteCount := uint64(file.Size())
+				var sizeErr error
+				switch {
+				case header.options&ENABLE_COMPRESSION != 0:
+					// Positions within the segment refer to the decompressed
+					// data, so its size is only known once it is decoded.
+					byteCount, sizeErr = decodedSegmentSize(settings, fullPath)
+				case header.options&ENABLE_ENCRYPTION != 0:
+					// Positions within the segment don't include the
+					// encryption overhead.
+					byteCount, sizeErr = encryptedSegmentSize(fullPath)
+				}
+				if sizeErr != nil {
+					logger.Warnf(
+						"error loading segment file '%v', data may be incomplete: %v",
+						fullPath, sizeErr)
+				}
 				segments = append(segments, &queueSegment{
 					id:            segmentID(id),
 					schemaVersion: &header.version,
 					frameCount:    header.frameCount,
-					byteCount:     uint64(file.Size()),
+					byteCount:     byteCount,
 				})
 			}
 		}
@@ -255,8 +274,24 @@ func (segment *queueSegment) getReader(queueSettings Settings) (*segmentReader,
 		sr.serializationFormat = SerializationCBOR
 	}
 
+	var src io.ReadCloser = sr.src
+	if (header.options & ENABLE_ENCRYPTION) == ENABLE_ENCRYPTION {
+		cipher, err := newFrameCipher(queueSettings)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if cipher == nil {
+			file.Close()
+			return nil, fmt.Errorf(
+				"segment %d is encrypted but no encryption key is configured", segment.id)
+		}
+		sr.er = NewEncryptionReader(sr.src, cipher)
+		src = sr.er
+	}
+
 	if (header.options & ENABLE_COMPRESSION) == ENABLE_COMPRESSION {
-		sr.cr = NewCompressionReader(sr.src)
+		sr.cr = NewCompressionReader(src)
 	}
 	return sr, nil
 }
@@ -276,6 +311,15 @@ func (segment *queueSegment) getWriter(queueSettings Settings) (*segmentWriter,
 		options = options | ENABLE_COMPRESSION
 	}
 
+	cipher, err := newFrameCipher(queueSettings)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if cipher.encrypts() {
+		options = options | ENABLE_ENCRYPTION
+	}
+
 	sw := &segmentWriter{}
 	sw.dst = file
 
@@ -283,8 +327,14 @@ func (segment *queueSegment) getWriter(queueSettings Settings) (*segmentWriter,
 		return nil, err
 	}
 
+	var dst WriteCloseSyncer = sw.dst
+	if (options & ENABLE_ENCRYPTION) == ENABLE_ENCRYPTION {
+		sw.ew = NewEncryptionWriter(sw.dst, cipher)
+		dst = sw.ew
+	}
+
 	if (options & ENABLE_COMPRESSION) == ENABLE_COMPRESSION {
-		sw.cw = NewCompressionWriter(sw.dst)
+		sw.cw = NewCompressionWriter(dst)
 	}
 
 	return sw, nil
@@ -316,7 +366,7 @@ func (segment *queueSegment) getWriterWithRetry(
 // file was not closed cleanly), it attempts to calculate it manually
 // by scanning the file, and returns a struct with the "correct"
 // frame count.
-func readSegmentHeaderWithFrameCount(path string) (*segmentHeader, error) {
+func readSegmentHeaderWithFrameCount(settings Settings, path string) (*segmentHeader, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf(
@@ -325,8 +375,7 @@ func readSegmentHeaderWithFrameCount(path string) (*segmentHeader, error) {
 	defer file.Close()
 	// Wrap the handle to retry non-fatal errors and always return the full
 	// requested data length if possible, then read the raw header.
-	reader := autoRetryReader{file}
-	header, err := readSegmentHeader(reader)
+	header, err := readSegmentHeader(autoRetryReader{file})
 	if err != nil {
 		return nil, err
 	}
@@ -343,46 +392,115 @@ func readSegmentHeaderWithFrameCount(path string) (*segmentHeader, error) {
 	//   and still has the placeholder value of 0.
 	// In either case, the right thing to do is to scan the file
 	// and fill in the frame count manually.
+	frames, skip, err := segmentFrames(settings, file, header)
+	if err != nil {
+		return header, err
+	}
+	header.frameCount, _, err = scanFrames(frames, skip)
+	// If we encountered an error, we still return a valid header as
+	// long as we successfully scanned at least one frame first.
+	if header.frameCount > 0 {
+		return header, err
+	}
+	if err == nil {
+		err = io.EOF
+	}
+	return nil, err
+}
+
+// decodedSegmentSize returns the size of a compressed segment as seen
+// through a segmentReader, the header plus the decoded data of all complete
+// frames.
+func decodedSegmentSize(settings Settings, path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	header, err := readSegmentHeader(autoRetryReader{file})
+	if err != nil {
+		return 0, err
+	}
+	frames, skip, err := segmentFrames(settings, file, header)
+	if err != nil {
+		return segmentHeaderSize, err
+	}
+	_, size, err := scanFrames(frames, skip)
+	return segmentHeaderSize + size, err
+}
+
+// segmentFrames returns a reader for the frames following the header of
+// a segment file, and a function skipping the given number of bytes. The
+// data of compressed or encrypted segments is decoded like in getReader,
+// using the keys from settings, and can't be skipped without reading it.
+func segmentFrames(
+	settings Settings, file *os.File, header *segmentHeader,
+) (io.Reader, func(n int64) error, error) {
+	if header.options&(ENABLE_COMPRESSION|ENABLE_ENCRYPTION) == 0 {
+		return autoRetryReader{file}, func(n int64) error {
+			_, err := file.Seek(n, io.SeekCurrent)
+			return err
+		}, nil
+	}
+
+	var data io.ReadCloser = file
+	if header.options&ENABLE_ENCRYPTION != 0 {
+		cipher, err := newFrameCipher(settings)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cipher == nil {
+			return nil, nil, errors.New("segment is encrypted but no encryption key is configured")
+		}
+		data = NewEncryptionReader(data, cipher)
+	}
+	if header.options&ENABLE_COMPRESSION != 0 {
+		data = NewCompressionReader(data)
+	}
+	return autoRetryReader{data}, func(n int64) error {
+		_, err := io.CopyN(io.Discard, data, n)
+		return err
+	}, nil
+}
+
+// scanFrames counts the complete frames read from frames and returns their
+// total size. It stops at the end of the data or at the first frame that is
+// truncated or corrupted, in which case an error is returned.
+func scanFrames(frames io.Reader, skip func(n int64) error) (uint32, uint64, error) {
+	var count uint32
+	var size uint64
 	for {
 		var frameLength uint32
-		err = binary.Read(reader, binary.LittleEndian, &frameLength)
+		err := binary.Read(frames, binary.LittleEndian, &frameLength)
 		if err != nil {
 			// EOF at a frame boundary means we successfully scanned all frames.
-			if errors.Is(err, io.EOF) && header.frameCount > 0 {
-				return header, nil
+			if errors.Is(err, io.EOF) {
+				return count, size, nil
 			}
-			// All other errors mean we are done scanning, exit the loop.
-			break
+			return count, size, err
 		}
 		// Length is encoded in both the first and last four bytes of a frame. To
 		// detect truncated / corrupted frames, seek to the last four bytes of
 		// the current frame to make sure the trailing length matches before
 		// advancing to the next frame (otherwise we might accept an impossible
 		// length).
-		_, err = file.Seek(int64(frameLength-8), io.SeekCurrent)
-		if err != nil {
-			break
+		if frameLength < frameMetadataSize {
+			return count, size, fmt.Errorf("invalid frame length: %v", frameLength)
+		}
+		if err := skip(int64(frameLength - 8)); err != nil {
+			return count, size, err
 		}
 		var duplicateLength uint32
-		err = binary.Read(reader, binary.LittleEndian, &duplicateLength)
-		if err != nil {
-			break
+		if err := binary.Read(frames, binary.LittleEndian, &duplicateLength); err != nil {
+			return count, size, err
 		}
 		if frameLength != duplicateLength {
-			err = fmt.Errorf(
+			return count, size, fmt.Errorf(
 				"mismatched frame length: %v vs %v", frameLength, duplicateLength)
-			break
 		}
-
-		header.frameCount++
-	}
-	// If we ended up here instead of returning directly, then
-	// we encountered an error. We still return a valid header as
-	// long as we successfully scanned at least one frame first.
-	if header.frameCount > 0 {
-		return header, err
+		count++
+		size += uint64(frameLength)
 	}
-	return nil, err
 }
 
 // readSegmentHeader decodes a raw header from the given reader and
@@ -443,6 +561,7 @@ func (segments *diskQueueSegments) sizeOnDisk() uint64 {
 // less compressable.
 type segmentReader struct {
 	src                 io.ReadSeekCloser
+	er                  *EncryptionReader
 	cr                  *CompressionReader
 	serializationFormat SerializationFormat
 }
@@ -451,6 +570,9 @@ func (r *segmentReader) Read(p []byte) (int, error) {
 	if r.cr != nil {
 		return r.cr.Read(p)
 	}
+	if r.er != nil {
+		return r.er.Read(p)
+	}
 	return r.src.Read(p)
 }
 
@@ -458,11 +580,14 @@ func (r *segmentReader) Close() error {
 	if r.cr != nil {
 		return r.cr.Close()
 	}
+	if r.er != nil {
+		return r.er.Close()
+	}
 	return r.src.Close()
 }
 
 func (r *segmentReader) Seek(offset int64, whence int) (int64, error) {
-	if r.cr != nil {
+	if r.cr != nil || r.er != nil {
 		//can't seek before segment header
 		if (offset + int64(whence)) < segmentHeaderSize {
 			return 0, fmt.Errorf("illegal seek offset %d, whence %d", offset, whence)
@@ -470,10 +595,15 @@ func (r *segmentReader) Seek(offset int64, whence int) (int64, error) {
 		if _, err := r.src.Seek(segmentHeaderSize, io.SeekStart); err != nil {
 			return 0, fmt.Errorf("could not seek past segment header: %w", err)
 		}
-		if err := r.cr.Reset(); err != nil {
-			return 0, fmt.Errorf("could not reset compression: %w", err)
+		if r.er != nil {
+			r.er.Reset()
+		}
+		if r.cr != nil {
+			if err := r.cr.Reset(); err != nil {
+				return 0, fmt.Errorf("could not reset compression: %w", err)
+			}
 		}
-		written, err := io.CopyN(io.Discard, r.cr, (offset+int64(whence))-segmentHeaderSize)
+		written, err := io.CopyN(io.Discard, r, (offset+int64(whence))-segmentHeaderSize)
 		return written + segmentHeaderSize, err
 	}
 	return r.src.Seek(offset, whence)
@@ -488,6 +618,7 @@ func (r *segmentReader) Seek(offset int64, whence int) (int64, error) {
 // data less compressable.
 type segmentWriter struct {
 	dst *os.File
+	ew  *EncryptionWriter
 	cw  *CompressionWriter
 }
 
@@ -495,6 +626,9 @@ func (w *segmentWriter) Write(p []byte) (int, error) {
 	if w.cw != nil {
 		return w.cw.Write(p)
 	}
+	if w.ew != nil {
+		return w.ew.Write(p)
+	}
 	return w.dst.Write(p)
 }
 
@@ -502,6 +636,9 @@ func (w *segmentWriter) Close() error {
 	if w.cw != nil {
 		return w.cw.Close()
 	}
+	if w.ew != nil {
+		return w.ew.Close()
+	}
 	return w.dst.Close()
 }
 
@@ -509,6 +646,9 @@ func (w *segmentWriter) Sync() error {
 	if w.cw != nil {
 		return w.cw.Sync()
 	}
+	if w.ew != nil {
+		return w.ew.Sync()
+	}
 	return w.dst.Sync()
 }
 
@@ -19,6 +19,7 @@ package diskqueue
 
 import (
 	"io"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,6 +28,7 @@ import (
 func TestSegmentsRoundTrip(t *testing.T) {
 	tests := map[string]struct {
 		id        segmentID
+		encrypt   bool
 		compress  bool
 		plaintext []byte
 	}{
@@ -40,6 +42,17 @@ func TestSegmentsRoundTrip(t *testing.T) {
 			compress:  true,
 			plaintext: []byte("compression only"),
 		},
+		"With Encryption": {
+			id:        3,
+			encrypt:   true,
+			plaintext: []byte("encryption only"),
+		},
+		"With Encryption and Compression": {
+			id:        4,
+			encrypt:   true,
+			compress:  true,
+			plaintext: []byte("encryption and compression"),
+		},
 	}
 	dir := t.TempDir()
 	for name, tc := range tests {
@@ -47,6 +60,9 @@ func TestSegmentsRoundTrip(t *testing.T) {
 		settings := DefaultSettings()
 		settings.Path = dir
 		settings.UseCompression = tc.compress
+		if tc.encrypt {
+			settings.EncryptionKey = testKey1
+		}
 		qs := &queueSegment{
 			id: tc.id,
 		}
@@ -83,6 +99,7 @@ func TestSegmentsRoundTrip(t *testing.T) {
 func TestSegmentReaderSeek(t *testing.T) {
 	tests := map[string]struct {
 		id         segmentID
+		encrypt    bool
 		compress   bool
 		plaintexts [][]byte
 	}{
@@ -96,12 +113,26 @@ func TestSegmentReaderSeek(t *testing.T) {
 			compress:   true,
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 		},
+		"With Encryption": {
+			id:         3,
+			encrypt:    true,
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+		},
+		"With Encryption and Compression": {
+			id:         4,
+			encrypt:    true,
+			compress:   true,
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+		},
 	}
 	dir := t.TempDir()
 	for name, tc := range tests {
 		settings := DefaultSettings()
 		settings.Path = dir
 		settings.UseCompression = tc.compress
+		if tc.encrypt {
+			settings.EncryptionKey = testKey1
+		}
 
 		qs := &queueSegment{
 			id: tc.id,
@@ -175,3 +206,31 @@ func TestSegmentReaderSeekLocations(t *testing.T) {
 		assert.NotNil(t, err, name)
 	}
 }
+
+// The first option bit was never used, segments that have it set must not
+// be read as encrypted.
+func TestSegmentReaderUnusedOption(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	plaintext := []byte("no encryption")
+
+	qs := &queueSegment{id: 0}
+	sw, err := qs.getWriter(settings)
+	assert.NoError(t, err)
+	_, err = sw.Write(plaintext)
+	assert.NoError(t, err)
+	assert.NoError(t, sw.Close())
+
+	f, err := os.OpenFile(settings.segmentPath(qs.id), os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = f.WriteAt([]byte{0x1, 0, 0, 0}, 8)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	sr, err := qs.getReader(settings)
+	assert.NoError(t, err)
+	dst, err := io.ReadAll(sr)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, dst)
+	assert.NoError(t, sr.Close())
+}
@@ -90,10 +90,19 @@ type writerLoop struct {
 	// changes, this handle is closed and a new one is created.
 	outputFile *segmentWriter
 
+	// The number of frames written to currentSegment. The core loop only
+	// updates currentSegment.frameCount once it gets our response, which
+	// can happen while we finalize the segment on shutdown.
+	currentFrameCount uint32
+
 	currentRetryInterval time.Duration
 
 	// buffer Used to gather write information so there is only one write syscall
 	buffer *bytes.Buffer
+
+	// finished is closed once the run loop has closed the current segment
+	// file after requestChan was closed.
+	finished chan struct{}
 }
 
 func newWriterLoop(
@@ -110,17 +119,19 @@ func newWriterLoop(
 
 		currentRetryInterval: settings.RetryInterval,
 		buffer:               buffer,
+		finished:             make(chan struct{}),
 	}
 }
 
 func (wl *writerLoop) run() {
+	defer close(wl.finished)
 	for {
 		request, ok := <-wl.requestChan
 		if !ok {
 			// The request channel is closed, we are done. If there is an active
 			// segment file, finalize its frame count and close it.
 			if wl.outputFile != nil {
-				_ = wl.outputFile.UpdateCount(wl.currentSegment.frameCount)
+				_ = wl.outputFile.UpdateCount(wl.currentFrameCount)
 				_ = wl.outputFile.Sync()
 				wl.outputFile.Close()
 				wl.outputFile = nil
@@ -164,7 +175,7 @@ outerLoop:
 			if wl.outputFile != nil {
 				// Update the header with the frame count (including the ones we
 				// just wrote), try to sync to disk, then close the file.
-				_ = wl.outputFile.UpdateCount(wl.currentSegment.frameCount + curSegmentResponse.framesWritten)
+				_ = wl.outputFile.UpdateCount(wl.currentFrameCount)
 				_ = wl.outputFile.Sync()
 				wl.outputFile.Close()
 				wl.outputFile = nil
@@ -174,6 +185,7 @@ outerLoop:
 				curSegmentResponse = writerLoopSegmentResponse{}
 			}
 			wl.currentSegment = frameRequest.segment
+			wl.currentFrameCount = 0
 			file, err := wl.currentSegment.getWriterWithRetry(
 				wl.settings, wl.retryCallback)
 			if err != nil {
@@ -219,6 +231,7 @@ outerLoop:
 		// last complete frame. (This almost never matters, but it allows for
 		// more controlled recovery after a bad shutdown.)
 		curSegmentResponse.framesWritten++
+		wl.currentFrameCount++
 		curSegmentResponse.bytesWritten += uint64(frameSize)
 
 		// Update the ACKs that will be sent at the end of the request.
@@ -0,0 +1,90 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	c "github.com/elastic/elastic-agent-libs/config"
+)
+
+// Settings contains the configuration fields to create a new hybrid queue.
+type Settings struct {
+	// Mem configures the in-memory queue that holds events under normal
+	// load. Once it holds Mem.Events events, new events spill to disk.
+	Mem memqueue.Settings
+
+	// Disk configures the queue that receives spilled events.
+	Disk diskqueue.Settings
+
+	// If positive, new events also spill to disk when the output hasn't
+	// acknowledged any event for this long while the memory queue holds
+	// unacknowledged events.
+	SpillAfter time.Duration
+}
+
+// userConfig holds the parameters for a hybrid queue that are configurable
+// by the end user in the beats yml file.
+type userConfig struct {
+	Mem        *c.C          `config:"mem"`
+	Disk       *c.C          `config:"disk"`
+	SpillAfter time.Duration `config:"spill_after"`
+}
+
+func (u *userConfig) Validate() error {
+	if u.Disk == nil {
+		return errors.New("the hybrid queue requires a disk configuration")
+	}
+	if u.SpillAfter < 0 {
+		return errors.New("spill_after must not be negative")
+	}
+	return nil
+}
+
+var defaultConfig = userConfig{
+	SpillAfter: 30 * time.Second,
+}
+
+// SettingsForUserConfig unpacks a ucfg config from a Beats queue
+// configuration and returns the equivalent hybridqueue.Settings object.
+func SettingsForUserConfig(cfg *c.C) (Settings, error) {
+	config := defaultConfig
+	if cfg != nil {
+		if err := cfg.Unpack(&config); err != nil {
+			return Settings{}, fmt.Errorf("couldn't unpack hybrid queue config: %w", err)
+		}
+	}
+
+	memSettings, err := memqueue.SettingsForUserConfig(config.Mem)
+	if err != nil {
+		return Settings{}, err
+	}
+	diskSettings, err := diskqueue.SettingsForUserConfig(config.Disk)
+	if err != nil {
+		return Settings{}, err
+	}
+	return Settings{
+		Mem:        memSettings,
+		Disk:       diskSettings,
+		SpillAfter: config.SpillAfter,
+	}, nil
+}
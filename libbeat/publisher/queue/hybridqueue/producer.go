@@ -0,0 +1,100 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+)
+
+// The sources of a producer's acknowledgements.
+const (
+	memSource = iota
+	diskSource
+)
+
+type producer struct {
+	queue *hybridQueue
+	mem   queue.Producer
+	disk  queue.Producer
+
+	// acks is nil if the producer was created without an ACK callback.
+	acks *queue.ACKMerger
+}
+
+func newProducer(q *hybridQueue, cfg queue.ProducerConfig) *producer {
+	p := &producer{queue: q}
+	if cfg.ACK != nil {
+		p.acks = queue.NewACKMerger(2, cfg.ACK)
+	}
+
+	// The memory producer always needs an ACK callback to track how full
+	// the memory queue is.
+	p.mem = q.mem.Producer(queue.ProducerConfig{ACK: func(count int) {
+		q.memACKed(count)
+		if p.acks != nil {
+			p.acks.ACK(memSource, count)
+		}
+	}})
+
+	var diskConfig queue.ProducerConfig
+	if p.acks != nil {
+		diskConfig.ACK = func(count int) { p.acks.ACK(diskSource, count) }
+	}
+	p.disk = q.disk.Producer(diskConfig)
+	return p
+}
+
+func (p *producer) Publish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, true)
+}
+
+func (p *producer) TryPublish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, false)
+}
+
+func (p *producer) publish(entry queue.Entry, shouldBlock bool) (queue.EntryID, bool) {
+	spill := p.queue.reserve()
+	target, source := p.mem, memSource
+	if spill {
+		target, source = p.disk, diskSource
+	}
+
+	p.acks.Add(source)
+	var id queue.EntryID
+	var ok bool
+	if shouldBlock {
+		id, ok = target.Publish(entry)
+	} else {
+		id, ok = target.TryPublish(entry)
+	}
+	if !ok {
+		p.acks.Remove()
+	}
+
+	if spill {
+		p.queue.diskPublished(ok)
+	} else {
+		p.queue.memPublished(ok)
+	}
+	return id, ok
+}
+
+func (p *producer) Close() {
+	p.mem.Close()
+	p.disk.Close()
+}
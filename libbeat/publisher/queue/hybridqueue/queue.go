@@ -0,0 +1,345 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// The string used to specify this queue in beats configurations.
+const QueueType = "hybrid"
+
+// hybridQueue keeps events in a memory queue and spills them to a disk
+// queue when the memory queue is full or the output stops acknowledging
+// events. While spilling, all new events are written to disk so they are
+// read in order: first the events that were already in memory, then the
+// spilled events. Once every spilled event has been read, new events go
+// to memory again.
+type hybridQueue struct {
+	logger   *logp.Logger
+	settings Settings
+
+	mem  queue.Queue
+	disk spillQueue
+
+	mu sync.Mutex
+
+	// spilling is true while new events are written to disk.
+	spilling bool
+
+	// restoring is true until the events that were spilled before the
+	// last shutdown have been read. Their number isn't known, so the disk
+	// queue is read until it has no unread events left.
+	restoring bool
+
+	// The number of events in the memory queue that haven't been
+	// acknowledged yet, including the ones that are being published.
+	memPending int
+
+	// The time of the last acknowledgement from the memory queue, or the
+	// time it went from empty to non-empty. Used to detect an unavailable
+	// output.
+	lastACK time.Time
+
+	// The number of events published to each queue that haven't been
+	// returned by Get yet.
+	memUnread  int
+	diskUnread int
+
+	// The number of events that are being published to the disk queue.
+	diskPublishing int
+
+	// wakeup is closed and replaced when Get may be able to make progress.
+	wakeup chan struct{}
+
+	// getMu serializes Get calls, so the unread counts reflect what the
+	// next call can read without blocking.
+	getMu sync.Mutex
+
+	closeOnce sync.Once
+	close     chan struct{}
+	done      chan struct{}
+}
+
+// spillQueue is the part of the disk queue used to read the events spilled
+// before the last shutdown.
+type spillQueue interface {
+	queue.Queue
+	TryGet(eventCount int) (queue.Batch, error)
+}
+
+// FactoryForSettings is a simple wrapper around NewQueue so a concrete
+// Settings object can be wrapped in a queue-agnostic interface for
+// later use by the pipeline.
+func FactoryForSettings(settings Settings) queue.QueueFactory {
+	return func(
+		logger *logp.Logger,
+		observer queue.Observer,
+		inputQueueSize int,
+		encoderFactory queue.EncoderFactory,
+	) (queue.Queue, error) {
+		return NewQueue(logger, observer, settings, inputQueueSize, encoderFactory)
+	}
+}
+
+// NewQueue creates a hybrid queue. Events that were spilled to disk before
+// the previous shutdown are read before any new events.
+func NewQueue(
+	logger *logp.Logger,
+	observer queue.Observer,
+	settings Settings,
+	inputQueueSize int,
+	encoderFactory queue.EncoderFactory,
+) (*hybridQueue, error) {
+	logger = logger.Named("hybridqueue")
+	if observer == nil {
+		observer = queue.NewQueueObserver(nil)
+	}
+
+	disk, err := diskqueue.NewQueue(logger, observer, settings.Disk, encoderFactory)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create the disk queue for spilled events: %w", err)
+	}
+	mem := memqueue.NewQueue(logger, observer, settings.Mem, inputQueueSize, encoderFactory)
+
+	q := &hybridQueue{
+		logger:   logger,
+		settings: settings,
+		mem:      mem,
+		disk:     disk,
+		wakeup:   make(chan struct{}),
+		close:    make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if disk.HasRestoredEvents() {
+		logger.Info("Found spilled events on disk, they are read before new events")
+		q.spilling = true
+		q.restoring = true
+	}
+
+	go func() {
+		<-mem.Done()
+		<-disk.Done()
+		close(q.done)
+	}()
+	return q, nil
+}
+
+//
+// hybridQueue implementation of the queue.Queue interface
+//
+
+func (q *hybridQueue) Close() error {
+	var err error
+	q.closeOnce.Do(func() {
+		close(q.close)
+		err = errors.Join(q.mem.Close(), q.disk.Close())
+	})
+	return err
+}
+
+func (q *hybridQueue) Done() <-chan struct{} {
+	return q.done
+}
+
+func (q *hybridQueue) QueueType() string {
+	return QueueType
+}
+
+func (q *hybridQueue) BufferConfig() queue.BufferConfig {
+	// The disk queue has no fixed event limit.
+	return queue.BufferConfig{MaxEvents: 0}
+}
+
+func (q *hybridQueue) Producer(cfg queue.ProducerConfig) queue.Producer {
+	return newProducer(q, cfg)
+}
+
+func (q *hybridQueue) Get(eventCount int) (queue.Batch, error) {
+	q.getMu.Lock()
+	defer q.getMu.Unlock()
+
+	for {
+		q.mu.Lock()
+		switch {
+		case q.memUnread > 0:
+			// Events in memory were always published before the events
+			// that are currently on disk. They are still read after Close,
+			// the memory queue is only done once they are acknowledged.
+			q.mu.Unlock()
+			return q.getFrom(q.mem, &q.memUnread, eventCount)
+		case q.closing():
+			// Spilled events stay on disk until the next start.
+			q.mu.Unlock()
+			return nil, io.EOF
+		case q.restoring:
+			// diskUnread only counts the events spilled since the start,
+			// if it changes while the disk queue is read there may be new
+			// events to read.
+			spilled := q.diskUnread
+			q.mu.Unlock()
+			batch, err := q.disk.TryGet(eventCount)
+			if !errors.Is(err, diskqueue.ErrEmpty) {
+				return batch, err
+			}
+			q.mu.Lock()
+			if q.diskUnread != spilled {
+				q.mu.Unlock()
+				continue
+			}
+			if q.diskPublishing == 0 {
+				q.restoring = false
+				q.diskUnread = 0
+				q.logger.Info("All events spilled before the last shutdown have been read")
+				q.maybeStopSpilling()
+				q.mu.Unlock()
+				continue
+			}
+		case q.diskUnread > 0:
+			q.mu.Unlock()
+			return q.getFrom(q.disk, &q.diskUnread, eventCount)
+		}
+		wakeup := q.wakeup
+		q.mu.Unlock()
+
+		select {
+		case <-wakeup:
+		case <-q.close:
+		}
+	}
+}
+
+func (q *hybridQueue) closing() bool {
+	select {
+	case <-q.close:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *hybridQueue) getFrom(src queue.Queue, unread *int, eventCount int) (queue.Batch, error) {
+	batch, err := src.Get(eventCount)
+	if err != nil {
+		return nil, err
+	}
+	q.mu.Lock()
+	*unread -= batch.Count()
+	q.maybeStopSpilling()
+	q.mu.Unlock()
+	return batch, nil
+}
+
+// reserve decides which queue the next event is published to. Events are
+// spilled to disk if the memory queue is full or the output hasn't
+// acknowledged any event for SpillAfter, and keep being spilled until Get
+// has read all of them.
+func (q *hybridQueue) reserve() (spill bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.spilling {
+		switch {
+		case q.memPending >= q.settings.Mem.Events:
+			q.startSpilling("the memory queue is full")
+		case q.stalled():
+			q.startSpilling(fmt.Sprintf(
+				"the output hasn't acknowledged any events for %v", q.settings.SpillAfter))
+		}
+	}
+	if q.spilling {
+		q.diskPublishing++
+		return true
+	}
+	if q.memPending == 0 {
+		q.lastACK = time.Now()
+	}
+	q.memPending++
+	return false
+}
+
+func (q *hybridQueue) stalled() bool {
+	return q.settings.SpillAfter > 0 &&
+		q.memPending > 0 &&
+		time.Since(q.lastACK) >= q.settings.SpillAfter
+}
+
+func (q *hybridQueue) startSpilling(reason string) {
+	q.spilling = true
+	q.logger.Infof("Spilling new events to disk: %s", reason)
+}
+
+// memPublished is called once a publish reserved for the memory queue
+// is done.
+func (q *hybridQueue) memPublished(ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if ok {
+		q.memUnread++
+		q.notify()
+	} else {
+		q.memPending--
+	}
+}
+
+// diskPublished is called once a publish reserved for the disk queue
+// is done.
+func (q *hybridQueue) diskPublished(ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.diskPublishing--
+	if ok {
+		q.diskUnread++
+		q.notify()
+	} else {
+		q.maybeStopSpilling()
+	}
+}
+
+// maybeStopSpilling queues new events in memory again once all spilled
+// events have been read. Events that are still unread in memory are older
+// than the new ones, so the order is preserved. The caller must hold q.mu.
+func (q *hybridQueue) maybeStopSpilling() {
+	if q.spilling && !q.restoring && q.diskUnread <= 0 && q.diskPublishing == 0 {
+		q.spilling = false
+		q.logger.Info("All spilled events have been read, queueing new events in memory")
+	}
+}
+
+func (q *hybridQueue) memACKed(count int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.memPending -= count
+	q.lastACK = time.Now()
+}
+
+// notify wakes up a Get call that is waiting for events. The caller must
+// hold q.mu.
+func (q *hybridQueue) notify() {
+	close(q.wakeup)
+	q.wakeup = make(chan struct{})
+}
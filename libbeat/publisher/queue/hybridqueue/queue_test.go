@@ -0,0 +1,324 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/queuetest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestProduceConsumer(t *testing.T) {
+	const events = 500
+	const batchSize = 32
+
+	testWith := func(factory queuetest.QueueFactory) func(t *testing.T) {
+		return func(t *testing.T) {
+			t.Run("single", func(t *testing.T) {
+				queuetest.TestSingleProducerConsumer(t, events, batchSize, factory)
+			})
+			t.Run("multi", func(t *testing.T) {
+				queuetest.TestMultiProducerConsumer(t, events, batchSize, factory)
+			})
+		}
+	}
+
+	t.Run("memory", testWith(makeTestQueue(events*4)))
+	t.Run("spilling", testWith(makeTestQueue(batchSize)))
+}
+
+func makeTestQueue(memEvents int) queuetest.QueueFactory {
+	return func(t *testing.T) queue.Queue {
+		// The queuetest helpers don't wait for the queue to shut down, so
+		// it must not log to the test once it's over.
+		q, err := NewQueue(logp.NewLogger(""), nil, testSettings(t, memEvents), 0, nil)
+		require.NoError(t, err)
+		return q
+	}
+}
+
+func testSettings(t *testing.T, memEvents int) Settings {
+	disk := diskqueue.DefaultSettings()
+	disk.Path = t.TempDir()
+	return Settings{
+		Mem:  memqueue.Settings{Events: memEvents, MaxGetRequest: memEvents},
+		Disk: disk,
+	}
+}
+
+func TestSpillAndDrainInOrder(t *testing.T) {
+	q, err := NewQueue(logptest.NewTestingLogger(t, ""), nil, testSettings(t, 4), 0, nil)
+	require.NoError(t, err)
+	defer q.Close()
+
+	var acked atomic.Int64
+	producer := q.Producer(queue.ProducerConfig{ACK: func(count int) { acked.Add(int64(count)) }})
+	publishEvents(t, producer, 0, 10)
+	assert.True(t, q.spilling, "events must spill once the memory queue is full")
+
+	events := getEvents(t, q, 10)
+	for i, event := range events {
+		assert.EqualValues(t, i, event.Content.Fields["n"], "events must be read in order")
+	}
+
+	// Once the spilled events have been read, new events go to memory again.
+	assert.False(t, q.spilling)
+	publishEvents(t, producer, 10, 1)
+	q.mu.Lock()
+	assert.Equal(t, 1, q.memUnread)
+	q.mu.Unlock()
+	events = getEvents(t, q, 1)
+	assert.EqualValues(t, 10, events[0].Content.Fields["n"])
+
+	assert.Eventually(t, func() bool { return acked.Load() == 11 },
+		5*time.Second, 10*time.Millisecond, "all events must be acknowledged")
+}
+
+func TestSpillWhenOutputStalls(t *testing.T) {
+	settings := testSettings(t, 100)
+	settings.SpillAfter = 20 * time.Millisecond
+	q, err := NewQueue(logptest.NewTestingLogger(t, ""), nil, settings, 0, nil)
+	require.NoError(t, err)
+	defer q.Close()
+
+	producer := q.Producer(queue.ProducerConfig{})
+	publishEvents(t, producer, 0, 1)
+	assert.False(t, q.spilling)
+
+	// The event is read but never acknowledged.
+	batch, err := q.Get(1)
+	require.NoError(t, err)
+	require.Equal(t, 1, batch.Count())
+	time.Sleep(2 * settings.SpillAfter)
+
+	publishEvents(t, producer, 1, 1)
+	assert.True(t, q.spilling, "events must spill when the output doesn't acknowledge them")
+	events := getEvents(t, q, 1)
+	assert.EqualValues(t, 1, events[0].Content.Fields["n"])
+}
+
+func TestSpilledEventsAreRestored(t *testing.T) {
+	settings := testSettings(t, 2)
+	q, err := NewQueue(logptest.NewTestingLogger(t, ""), nil, settings, 0, nil)
+	require.NoError(t, err)
+
+	var acked atomic.Int64
+	producer := q.Producer(queue.ProducerConfig{ACK: func(count int) { acked.Add(int64(count)) }})
+	publishEvents(t, producer, 0, 5)
+
+	// Consuming the events in memory lets the acknowledgements of the
+	// spilled events through once they are written.
+	getEvents(t, q, 2)
+	require.Eventually(t, func() bool { return acked.Load() == 5 },
+		5*time.Second, 10*time.Millisecond, "spilled events must be written")
+	producer.Close()
+	require.NoError(t, q.Close())
+	<-q.Done()
+
+	// Only the spilled events survive a restart, they are read before any
+	// new event.
+	q, err = NewQueue(logptest.NewTestingLogger(t, ""), nil, settings, 0, nil)
+	require.NoError(t, err)
+	defer q.Close()
+	assert.True(t, q.spilling)
+
+	producer = q.Producer(queue.ProducerConfig{})
+	publishEvents(t, producer, 5, 1)
+	events := getEvents(t, q, 4)
+	for i, event := range events {
+		assert.EqualValues(t, i+2, event.Content.Fields["n"])
+	}
+}
+
+// TestRestoreAfterCrash checks that all spilled events are read after a
+// shutdown that didn't update the frame counts in the segment headers.
+func TestRestoreAfterCrash(t *testing.T) {
+	tests := map[string]func(*diskqueue.Settings){
+		"plain":      func(*diskqueue.Settings) {},
+		"compressed": func(s *diskqueue.Settings) { s.UseCompression = true },
+		"encrypted":  func(s *diskqueue.Settings) { s.EncryptionKey = bytes.Repeat([]byte{1}, 32) },
+		"compressed encrypted": func(s *diskqueue.Settings) {
+			s.UseCompression = true
+			s.EncryptionKey = bytes.Repeat([]byte{1}, 32)
+		},
+	}
+	for name, configure := range tests {
+		t.Run(name, func(t *testing.T) {
+			settings := testSettings(t, 2)
+			configure(&settings.Disk)
+			q, err := NewQueue(logptest.NewTestingLogger(t, ""), nil, settings, 0, nil)
+			require.NoError(t, err)
+
+			var acked atomic.Int64
+			producer := q.Producer(queue.ProducerConfig{ACK: func(count int) { acked.Add(int64(count)) }})
+			publishEvents(t, producer, 0, 10)
+			getEvents(t, q, 2)
+			require.Eventually(t, func() bool { return acked.Load() == 10 },
+				5*time.Second, 10*time.Millisecond, "spilled events must be written")
+			producer.Close()
+			require.NoError(t, q.Close())
+			<-q.Done()
+
+			// Reset the frame counts, like in segments that were not closed.
+			segments, err := filepath.Glob(filepath.Join(settings.Disk.Path, "*.seg"))
+			require.NoError(t, err)
+			require.NotEmpty(t, segments)
+			for _, path := range segments {
+				f, err := os.OpenFile(path, os.O_WRONLY, 0)
+				require.NoError(t, err)
+				_, err = f.WriteAt(make([]byte, 4), 4)
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+			}
+
+			q, err = NewQueue(logptest.NewTestingLogger(t, ""), nil, settings, 0, nil)
+			require.NoError(t, err)
+			defer q.Close()
+			producer = q.Producer(queue.ProducerConfig{})
+			publishEvents(t, producer, 10, 1)
+			events := getEvents(t, q, 9)
+			for i, event := range events {
+				assert.EqualValues(t, i+2, event.Content.Fields["n"], "events must be read in order")
+			}
+
+			// Once a Get finds the disk queue empty, new events go to memory
+			// again.
+			got := make(chan queue.Batch, 1)
+			go func() {
+				batch, _ := q.Get(1)
+				got <- batch
+			}()
+			require.Eventually(t, func() bool {
+				q.mu.Lock()
+				defer q.mu.Unlock()
+				return !q.restoring && !q.spilling
+			}, 5*time.Second, 10*time.Millisecond, "spilling must stop once the disk queue is empty")
+			publishEvents(t, producer, 11, 1)
+			select {
+			case batch := <-got:
+				require.NotNil(t, batch)
+				require.Equal(t, 1, batch.Count())
+				event, ok := batch.Entry(0).(publisher.Event)
+				require.True(t, ok)
+				assert.EqualValues(t, 11, event.Content.Fields["n"])
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "the new event must be read from memory")
+			}
+		})
+	}
+}
+
+func TestCloseWithUnreadEventsInMemory(t *testing.T) {
+	settings := testSettings(t, 2)
+	q, err := NewQueue(logptest.NewTestingLogger(t, ""), nil, settings, 0, nil)
+	require.NoError(t, err)
+
+	// The disk queue acknowledges the spilled events once they are written.
+	var written atomic.Int64
+	p := newProducer(q, queue.ProducerConfig{})
+	p.disk.Close()
+	p.disk = q.disk.Producer(queue.ProducerConfig{ACK: func(count int) { written.Add(int64(count)) }})
+	publishEvents(t, p, 0, 5)
+	require.Eventually(t, func() bool {
+		return written.Load() == 3
+	}, 5*time.Second, 10*time.Millisecond, "spilled events must be written")
+	p.Close()
+	require.NoError(t, q.Close())
+
+	// The events in memory can still be read and acknowledged after Close,
+	// the spilled events are kept on disk.
+	events := getEvents(t, q, 2)
+	for i, event := range events {
+		assert.EqualValues(t, i, event.Content.Fields["n"])
+	}
+	_, err = q.Get(1)
+	assert.ErrorIs(t, err, io.EOF)
+
+	select {
+	case <-q.Done():
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the queue must be done once the events in memory are acknowledged")
+	}
+
+	q, err = NewQueue(logptest.NewTestingLogger(t, ""), nil, settings, 0, nil)
+	require.NoError(t, err)
+	defer q.Close()
+	events = getEvents(t, q, 3)
+	for i, event := range events {
+		assert.EqualValues(t, i+2, event.Content.Fields["n"])
+	}
+}
+
+func TestConfig(t *testing.T) {
+	cfg := config.MustNewConfigFrom(mapstr.M{
+		"mem":         mapstr.M{"events": 1024, "flush.min_events": 512},
+		"disk":        mapstr.M{"max_size": "1GB", "path": "/tmp/queue"},
+		"spill_after": "1m",
+	})
+	settings, err := SettingsForUserConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 1024, settings.Mem.Events)
+	assert.Equal(t, uint64(1_000_000_000), settings.Disk.MaxBufferSize)
+	assert.Equal(t, "/tmp/queue", settings.Disk.Path)
+	assert.Equal(t, time.Minute, settings.SpillAfter)
+
+	_, err = SettingsForUserConfig(config.MustNewConfigFrom(mapstr.M{"mem.events": 4096}))
+	assert.ErrorContains(t, err, "requires a disk configuration")
+}
+
+func publishEvents(t *testing.T, producer queue.Producer, first, count int) {
+	t.Helper()
+	for i := first; i < first+count; i++ {
+		_, ok := producer.Publish(queuetest.MakeEvent(mapstr.M{"n": i}))
+		require.True(t, ok)
+	}
+}
+
+// getEvents reads count events from the queue and acknowledges them.
+func getEvents(t *testing.T, q *hybridQueue, count int) []publisher.Event {
+	t.Helper()
+	var events []publisher.Event
+	for len(events) < count {
+		batch, err := q.Get(count - len(events))
+		require.NoError(t, err)
+		for i := 0; i < batch.Count(); i++ {
+			event, ok := batch.Entry(i).(publisher.Event)
+			require.True(t, ok)
+			events = append(events, event)
+		}
+		batch.Done()
+	}
+	return events
+}
@@ -31,10 +31,12 @@ const (
 	patternMode multilineType = iota
 	countMode
 	whilePatternMode
+	startEndMode
 
 	patternStr      = "pattern"
 	countStr        = "count"
 	whilePatternStr = "while_pattern"
+	startEndStr     = "start_end"
 )
 
 var (
@@ -42,10 +44,13 @@ var (
 		patternStr:      patternMode,
 		countStr:        countMode,
 		whilePatternStr: whilePatternMode,
+		startEndStr:     startEndMode,
 	}
 
 	ErrMissingPattern = errors.New("multiline.pattern cannot be empty when pattern based matching is selected")
 	ErrMissingCount   = errors.New("multiline.count cannot be empty when count based aggregation is selected")
+
+	ErrMissingStartEndPattern = errors.New("multiline.start_pattern and multiline.end_pattern cannot be empty when start_end based matching is selected")
 )
 
 // Config holds the options of multiline readers.
@@ -61,6 +66,10 @@ type Config struct {
 
 	LinesCount  int  `config:"count_lines" validate:"positive"`
 	SkipNewLine bool `config:"skip_newline"`
+
+	StartPattern *match.Matcher `config:"start_pattern"`
+	EndPattern   *match.Matcher `config:"end_pattern"`
+	MaxDepth     *int           `config:"max_depth"`
 }
 
 // Validate validates the Config option for multiline reader.
@@ -80,6 +89,13 @@ func (c *Config) Validate() error {
 		if c.Pattern == nil {
 			return ErrMissingPattern
 		}
+	} else if c.Type == startEndMode {
+		if c.StartPattern == nil || c.EndPattern == nil {
+			return ErrMissingStartEndPattern
+		}
+		if c.MaxDepth != nil && *c.MaxDepth < 1 {
+			return fmt.Errorf("multiline.max_depth must be at least 1, got %d", *c.MaxDepth)
+		}
 	} else {
 		return fmt.Errorf("unknown multiline type %d", c.Type)
 	}
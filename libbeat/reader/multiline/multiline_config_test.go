@@ -55,6 +55,22 @@ func TestInvalidConfiguration(t *testing.T) {
 			},
 			expectedError: ErrMissingPattern,
 		},
+		"missing end pattern when start_end type is selected": {
+			config: map[string]interface{}{
+				"type":          "start_end",
+				"start_pattern": "^<record>",
+			},
+			expectedError: ErrMissingStartEndPattern,
+		},
+		"invalid max depth": {
+			config: map[string]interface{}{
+				"type":          "start_end",
+				"start_pattern": "^<record>",
+				"end_pattern":   "^</record>",
+				"max_depth":     0,
+			},
+			expectedError: fmt.Errorf("multiline.max_depth must be at least 1"),
+		},
 	}
 
 	for name, test := range testcases {
@@ -86,6 +102,14 @@ func TestValidConfiguration(t *testing.T) {
 				"pattern": "^\n",
 			},
 		},
+		"correct start_end based multiline": {
+			config: map[string]interface{}{
+				"type":          "start_end",
+				"start_pattern": "^<record>",
+				"end_pattern":   "^</record>",
+				"max_depth":     3,
+			},
+		},
 		"correct count based multiline": {
 			config: map[string]interface{}{
 				"type":        "count",
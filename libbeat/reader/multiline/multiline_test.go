@@ -22,6 +22,7 @@ package multiline
 import (
 	"bytes"
 	"errors"
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -29,6 +30,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/beats/v7/libbeat/common/match"
 	"github.com/elastic/beats/v7/libbeat/reader"
@@ -284,6 +286,135 @@ func TestMultilineWhilePattern(t *testing.T) {
 	)
 }
 
+func TestMultilineStartEnd(t *testing.T) {
+	start := match.MustCompile(`^\s*<record>`)
+	end := match.MustCompile(`^\s*</record>`)
+	testMultilineOK(t,
+		Config{
+			Type:         startEndMode,
+			StartPattern: &start,
+			EndPattern:   &end,
+		},
+		3,
+		"<record>\n  <a>1</a>\n</record>\n",
+		"outside of a record\n",
+		"<record>\n</record>\n",
+	)
+	// without nesting the first end line closes the event
+	testMultilineOK(t,
+		Config{
+			Type:         startEndMode,
+			StartPattern: &start,
+			EndPattern:   &end,
+		},
+		4,
+		"<record>\n  <record>\n  </record>\n",
+		"  <a>1</a>\n",
+		"</record>\n",
+		"outside of a record\n",
+	)
+	// nested
+	maxDepth := 2
+	testMultilineOK(t,
+		Config{
+			Type:         startEndMode,
+			StartPattern: &start,
+			EndPattern:   &end,
+			MaxDepth:     &maxDepth,
+		},
+		2,
+		"<record>\n  <record>\n  </record>\n  <a>1</a>\n</record>\n",
+		"outside of a record\n",
+	)
+	// the blocks nested deeper than max_depth are regular lines, their end
+	// lines don't close the enclosing blocks
+	testMultilineOK(t,
+		Config{
+			Type:         startEndMode,
+			StartPattern: &start,
+			EndPattern:   &end,
+			MaxDepth:     &maxDepth,
+		},
+		2,
+		"<record>\n  <record>\n    <record>\n      <record>\n      </record>\n    </record>\n  </record>\n  <a>1</a>\n</record>\n",
+		"outside of a record\n",
+	)
+	// unterminated event is returned at EOF
+	testMultilineOK(t,
+		Config{
+			Type:         startEndMode,
+			StartPattern: &start,
+			EndPattern:   &end,
+		},
+		2,
+		"<record>\n</record>\n",
+		"<record>\n  <a>1</a>\n",
+	)
+	// truncated
+	maxLines := 2
+	testMultilineTruncated(t,
+		Config{
+			Type:         startEndMode,
+			StartPattern: &start,
+			EndPattern:   &end,
+			MaxLines:     &maxLines,
+		},
+		1,
+		true,
+		[]string{
+			"<record>\n  <a>1</a>\n</record>\n"},
+		[]string{
+			"<record>\n  <a>1</a>\n"},
+	)
+}
+
+func TestMultilineStartEndFlushOnEndPattern(t *testing.T) {
+	start := match.MustCompile(`^<record>`)
+	end := match.MustCompile(`^</record>`)
+	timeout := time.Hour
+	cfg := Config{
+		Type:         startEndMode,
+		StartPattern: &start,
+		EndPattern:   &end,
+		Timeout:      &timeout,
+	}
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	enc, err := encoding.Plain(pr)
+	require.NoError(t, err)
+	var r reader.Reader
+	r, err = readfile.NewEncodeReader(pr, readfile.Config{
+		Codec:      enc,
+		BufferSize: 4096,
+		Terminator: readfile.LineFeed,
+	})
+	require.NoError(t, err)
+	r, err = New(readfile.NewStripNewline(r, readfile.LineFeed), "\n", 1<<20, &cfg)
+	require.NoError(t, err)
+
+	go func() {
+		_, _ = pw.Write([]byte("<record>\nline\n</record>\n"))
+	}()
+
+	// The event must be returned as soon as its end line is read, without
+	// waiting for the next line or the timeout.
+	done := make(chan reader.Message, 1)
+	go func() {
+		message, err := r.Next()
+		assert.NoError(t, err)
+		done <- message
+	}()
+
+	select {
+	case message := <-done:
+		assert.Equal(t, "<record>\nline\n</record>", string(message.Content))
+	case <-time.After(5 * time.Second):
+		t.Fatal("multiline event was not flushed on the end pattern")
+	}
+}
+
 func testMultilineOK(t *testing.T, cfg Config, events int, expected ...string) {
 	_, buf := createLineBuffer(expected...)
 	r := createMultilineTestReader(t, buf, cfg)
@@ -0,0 +1,238 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package multiline
+
+import (
+	"io"
+
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// defaultMaxDepth disables nesting, start lines within an event are
+// regular lines.
+const defaultMaxDepth = 1
+
+// MultiLine reader combining multiple line events into one multi-line event.
+//
+// An event starts with a line matching the start pattern and ends with a line
+// matching the end pattern. The event is returned as soon as its end line is
+// read. Lines outside of an event are returned as they are.
+//
+// If the maximum depth is larger than 1, events can be nested: a start line
+// within an event opens a nested block, which must be closed by its own end
+// line before the event ends. Start lines beyond the maximum depth are
+// regular lines, and so are the end lines closing their blocks.
+//
+// Errors will force the multiline reader to return the currently active
+// multiline event first and finally return the actual error on next call to Next.
+type startEndReader struct {
+	reader    reader.Reader
+	start     lineMatcherFunc
+	end       lineMatcherFunc
+	maxDepth  int
+	depth     int
+	overflow  int // blocks opened beyond maxDepth
+	logger    *logp.Logger
+	msgBuffer *messageBuffer
+	state     func(*startEndReader) (reader.Message, error)
+}
+
+func newMultilineStartEndReader(
+	r reader.Reader,
+	separator string,
+	maxBytes int,
+	config *Config,
+) (reader.Reader, error) {
+	maxLines := defaultMaxLines
+	if config.MaxLines != nil {
+		maxLines = *config.MaxLines
+	}
+
+	maxDepth := defaultMaxDepth
+	if config.MaxDepth != nil {
+		maxDepth = *config.MaxDepth
+	}
+
+	tout := defaultMultilineTimeout
+	if config.Timeout != nil {
+		tout = *config.Timeout
+	}
+
+	if tout > 0 {
+		r = readfile.NewTimeoutReader(r, sigMultilineTimeout, tout)
+	}
+
+	pr := &startEndReader{
+		reader:    r,
+		start:     lineMatcher(*config.StartPattern),
+		end:       lineMatcher(*config.EndPattern),
+		maxDepth:  maxDepth,
+		msgBuffer: newMessageBuffer(maxBytes, maxLines, []byte(separator), config.SkipNewLine),
+		logger:    logp.NewLogger("reader_multiline"),
+		state:     (*startEndReader).readFirst,
+	}
+	return pr, nil
+}
+
+// Next returns next multi-line event.
+func (pr *startEndReader) Next() (reader.Message, error) {
+	return pr.state(pr)
+}
+
+func (pr *startEndReader) readFirst() (reader.Message, error) {
+	for {
+		message, err := pr.reader.Next()
+		if err != nil {
+			// no lines buffered -> ignore timeout
+			if err == sigMultilineTimeout {
+				continue
+			}
+
+			// pass error to caller (next layer) for handling
+			return message, err
+		}
+
+		if message.Bytes == 0 {
+			continue
+		}
+
+		// not the start of an event, return message
+		if !pr.start(message.Content) {
+			return message, nil
+		}
+
+		// Start new multiline event
+		pr.msgBuffer.startNewMessage(message)
+		if pr.track(message.Content) {
+			return pr.flush(), nil
+		}
+		pr.setState((*startEndReader).readNext)
+		return pr.readNext()
+	}
+}
+
+func (pr *startEndReader) readNext() (reader.Message, error) {
+	for {
+		message, err := pr.reader.Next()
+		if err != nil {
+			// handle multiline timeout signal
+			if err == sigMultilineTimeout {
+				// no lines buffered -> ignore timeout
+				if pr.msgBuffer.isEmpty() {
+					continue
+				}
+
+				pr.logger.Debug("Multiline event flushed because timeout reached.")
+
+				// return collected multiline event and
+				// empty buffer for new multiline event
+				return pr.flush(), nil
+			}
+
+			// handle error without any bytes returned from reader
+			if message.Bytes == 0 {
+				// no lines buffered -> return error
+				if pr.msgBuffer.isEmpty() {
+					return reader.Message{}, err
+				}
+
+				// lines buffered, return multiline and error on next read
+				return pr.collectMessageAfterError(err)
+			}
+
+			// add the last line and return multiline and error on next read
+			pr.msgBuffer.addLine(message)
+			return pr.collectMessageAfterError(err)
+		}
+
+		// add line to current multiline event, which is returned right away
+		// if the line closes it
+		pr.msgBuffer.addLine(message)
+		if pr.track(message.Content) {
+			return pr.flush(), nil
+		}
+	}
+}
+
+// track updates the nesting depth with a line of the current event and
+// reports whether the line completes the event. If nesting is enabled, the
+// blocks opened beyond the maximum depth are counted apart, so their end
+// lines don't close the blocks they are nested in.
+func (pr *startEndReader) track(content []byte) bool {
+	if pr.start(content) {
+		switch {
+		case pr.depth < pr.maxDepth:
+			pr.depth++
+		case pr.maxDepth > 1:
+			pr.overflow++
+		}
+	}
+	if pr.end(content) {
+		if pr.overflow > 0 {
+			pr.overflow--
+		} else {
+			pr.depth--
+		}
+	}
+	return pr.depth <= 0
+}
+
+// flush returns the current multiline event and waits for the next one.
+func (pr *startEndReader) flush() reader.Message {
+	msg := pr.msgBuffer.finalize()
+	pr.resetState()
+	return msg
+}
+
+func (pr *startEndReader) collectMessageAfterError(err error) (reader.Message, error) {
+	msg := pr.msgBuffer.finalize()
+	pr.msgBuffer.setErr(err)
+	pr.setState((*startEndReader).readFailed)
+	return msg, nil
+}
+
+// readFailed returns empty message and error and resets line reader
+func (pr *startEndReader) readFailed() (reader.Message, error) {
+	err := pr.msgBuffer.err
+	pr.msgBuffer.setErr(nil)
+	pr.resetState()
+	return reader.Message{}, err
+}
+
+// resetState sets state of the reader to readFirst
+func (pr *startEndReader) resetState() {
+	pr.depth = 0
+	pr.overflow = 0
+	pr.setState((*startEndReader).readFirst)
+}
+
+// setState sets state to the given function
+func (pr *startEndReader) setState(next func(pr *startEndReader) (reader.Message, error)) {
+	pr.state = next
+}
+
+func (pr *startEndReader) Close() error {
+	pr.setState((*startEndReader).readClosed)
+	return pr.reader.Close()
+}
+
+func (pr *startEndReader) readClosed() (reader.Message, error) {
+	return reader.Message{}, io.EOF
+}
@@ -0,0 +1,100 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package readfile
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionFromPath(t *testing.T) {
+	tests := map[string]Compression{
+		"/var/log/app.log":       CompressionNone,
+		"/var/log/app.log.1":     CompressionNone,
+		"/var/log/app.log.1.gz":  CompressionGzip,
+		"/var/log/app.log.2.GZ":  CompressionGzip,
+		"/var/log/app.log.1.zst": CompressionZstd,
+		"/var/log/app.gzip":      CompressionNone,
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, CompressionFromPath(path), path)
+	}
+}
+
+func TestDecompressReader(t *testing.T) {
+	content := bytes.Repeat([]byte("a line of a rotated log file\n"), 100)
+
+	compressed := map[Compression][]byte{
+		CompressionNone: content,
+		CompressionGzip: gzipCompress(t, content),
+		CompressionZstd: zstdCompress(t, content),
+	}
+	for c, data := range compressed {
+		t.Run("compression "+string(c), func(t *testing.T) {
+			r, err := NewDecompressReader(bytes.NewReader(data), c)
+			require.NoError(t, err)
+			defer r.Close()
+
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, content, got)
+		})
+	}
+
+	t.Run("incomplete stream", func(t *testing.T) {
+		for _, c := range []Compression{CompressionGzip, CompressionZstd} {
+			data := compressed[c]
+			r, err := NewDecompressReader(bytes.NewReader(data[:len(data)/2]), c)
+			require.NoError(t, err, c)
+			_, err = io.ReadAll(r)
+			assert.ErrorIs(t, err, io.ErrUnexpectedEOF, c)
+			r.Close()
+		}
+	})
+
+	t.Run("unsupported compression", func(t *testing.T) {
+		_, err := NewDecompressReader(bytes.NewReader(content), "lz4")
+		assert.Error(t, err)
+	})
+}
+
+func gzipCompress(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func zstdCompress(t *testing.T, data []byte) []byte {
+	t.Helper()
+	w, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	defer w.Close()
+	return w.EncodeAll(data, nil)
+}
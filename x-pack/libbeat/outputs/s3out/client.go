@@ -0,0 +1,271 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package s3out
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/fileout"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// uploader is the subset of the S3 API used by the output.
+type uploader interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+type clientSettings struct {
+	bucket      string
+	path        *fileout.PathFormatString
+	filename    string
+	instanceID  string
+	compression string
+	extension   string
+	maxBytes    int
+	maxEvents   int
+	maxAge      time.Duration
+	timeout     time.Duration
+	index       string
+	codec       codec.Codec
+	observer    outputs.Observer
+}
+
+// client buffers the events of one or more batches into an object and
+// uploads it once the object is large enough, holds enough events or is old
+// enough. Batches are only acknowledged after the object holding their events
+// has been uploaded.
+type client struct {
+	clientSettings
+
+	log      *logp.Logger
+	uploader uploader
+
+	mu     sync.Mutex
+	object *object
+	seq    uint64
+}
+
+// object is an NDJSON object that is being filled with events.
+type object struct {
+	buf     bytes.Buffer
+	events  int
+	batches []publisher.Batch
+	opened  time.Time
+	timer   *time.Timer
+}
+
+func newClient(s clientSettings, up uploader, log *logp.Logger) *client {
+	return &client{
+		clientSettings: s,
+		log:            log,
+		uploader:       up,
+	}
+}
+
+// Connect is a no-op, requests are sent through the S3 client.
+func (c *client) Connect(_ context.Context) error {
+	return nil
+}
+
+// Close uploads the pending object, if any.
+func (c *client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushLocked(context.Background())
+}
+
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.object == nil {
+		c.object = c.newObject()
+	}
+	obj := c.object
+
+	dropped := 0
+	for i := range events {
+		event := &events[i]
+		serialized, err := c.codec.Encode(c.index, &event.Content)
+		if err != nil {
+			if event.Guaranteed() {
+				c.log.Errorf("Failed to serialize the event: %+v", err)
+			} else {
+				c.log.Warnf("Failed to serialize the event: %+v", err)
+			}
+			dropped++
+			continue
+		}
+		obj.buf.Write(serialized)
+		obj.buf.WriteByte('\n')
+		obj.events++
+	}
+	c.observer.PermanentErrors(dropped)
+	obj.batches = append(obj.batches, batch)
+
+	if obj.buf.Len() >= c.maxBytes || (c.maxEvents > 0 && obj.events >= c.maxEvents) {
+		return c.flushLocked(ctx)
+	}
+	return nil
+}
+
+func (c *client) newObject() *object {
+	obj := &object{opened: time.Now()}
+	obj.timer = time.AfterFunc(c.maxAge, func() {
+		c.flushExpired(obj)
+	})
+	return obj
+}
+
+// flushExpired uploads obj once it reached the maximum age, unless it has
+// been uploaded in the meantime.
+func (c *client) flushExpired(obj *object) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.object != obj {
+		return
+	}
+	if err := c.flushLocked(context.Background()); err != nil {
+		c.log.Errorf("Failed to upload object after %v: %v", c.maxAge, err)
+	}
+}
+
+// flushLocked uploads the current object and acknowledges all batches it
+// holds. If the upload fails, the batches are returned to the pipeline to
+// be retried as a whole. The caller must hold c.mu.
+func (c *client) flushLocked(ctx context.Context) error {
+	obj := c.object
+	if obj == nil {
+		return nil
+	}
+	c.object = nil
+	obj.timer.Stop()
+
+	if obj.events == 0 {
+		for _, batch := range obj.batches {
+			batch.ACK()
+		}
+		return nil
+	}
+
+	key, err := c.objectKey(obj.opened)
+	if err != nil {
+		c.log.Errorf("Dropping %d events, failed to build object key: %v", obj.events, err)
+		c.observer.PermanentErrors(obj.events)
+		for _, batch := range obj.batches {
+			batch.Drop()
+		}
+		return nil
+	}
+
+	body, err := c.compress(obj.buf.Bytes())
+	if err != nil {
+		c.observer.RetryableErrors(obj.events)
+		for _, batch := range obj.batches {
+			batch.Retry()
+		}
+		return fmt.Errorf("failed to compress object %s: %w", key, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	begin := time.Now()
+	_, err = c.uploader.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      awssdk.String(c.bucket),
+		Key:         awssdk.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: awssdk.String(c.contentType()),
+	})
+	if err != nil {
+		c.observer.WriteError(err)
+		c.observer.RetryableErrors(obj.events)
+		for _, batch := range obj.batches {
+			batch.Retry()
+		}
+		return fmt.Errorf("failed to upload object %s to bucket %s: %w", key, c.bucket, err)
+	}
+
+	c.observer.WriteBytes(len(body))
+	c.observer.ReportLatency(time.Since(begin))
+	c.observer.AckedEvents(obj.events)
+	for _, batch := range obj.batches {
+		batch.ACK()
+	}
+	c.log.Debugf("Uploaded object %s with %d events (%d bytes)", key, obj.events, len(body))
+	return nil
+}
+
+// objectKey builds a unique object key from the path template rendered
+// with the time the object was opened.
+func (c *client) objectKey(opened time.Time) (string, error) {
+	opened = opened.UTC()
+	dir, err := c.path.Run(opened)
+	if err != nil {
+		return "", err
+	}
+	c.seq++
+	name := fmt.Sprintf("%s-%s-%s-%06d%s",
+		c.filename, opened.Format("20060102T150405Z"), c.instanceID, c.seq, c.extension)
+	return path.Join(dir, name), nil
+}
+
+func (c *client) compress(data []byte) ([]byte, error) {
+	var w io.WriteCloser
+	var buf bytes.Buffer
+	switch c.compression {
+	case compressionGzip:
+		w = gzip.NewWriter(&buf)
+	case compressionZstd:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		w = zw
+	default:
+		return data, nil
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *client) contentType() string {
+	switch c.compression {
+	case compressionGzip:
+		return "application/gzip"
+	case compressionZstd:
+		return "application/zstd"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+func (c *client) String() string {
+	return "s3(" + c.bucket + ")"
+}
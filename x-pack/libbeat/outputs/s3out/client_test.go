@@ -0,0 +1,224 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package s3out
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// fakeObjectStore is a minimal stand-in for an S3-compatible object store
+// that only supports path-style PutObject requests.
+type fakeObjectStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	fail    bool
+}
+
+func (s *fakeObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if s.fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, `<Error><Code>SlowDown</Code><Message>try later</Message></Error>`)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	s.objects[r.URL.Path] = body
+	w.Header().Set("ETag", `"etag"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *fakeObjectStore) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k := range s.objects {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (s *fakeObjectStore) get(key string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objects[key]
+}
+
+func newTestClient(t *testing.T, mod func(*clientSettings)) (*client, *fakeObjectStore) {
+	t.Helper()
+
+	store := &fakeObjectStore{objects: map[string][]byte{}}
+	srv := httptest.NewServer(store)
+	t.Cleanup(srv.Close)
+
+	s3Client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		BaseEndpoint: awssdk.String(srv.URL),
+		UsePathStyle: true,
+		Retryer:      awssdk.NopRetryer{},
+	})
+
+	cfg := defaultConfig()
+	s := clientSettings{
+		bucket:      "archive",
+		path:        cfg.Path,
+		filename:    "testbeat",
+		instanceID:  "abcdef01",
+		compression: compressionNone,
+		extension:   ".ndjson",
+		maxBytes:    1024 * 1024,
+		maxAge:      time.Hour,
+		timeout:     5 * time.Second,
+		index:       "testbeat",
+		codec:       json.New("1.2.3", json.Config{}),
+		observer:    outputs.NewNilObserver(),
+	}
+	if mod != nil {
+		mod(&s)
+	}
+	c := newClient(s, s3Client, logptest.NewTestingLogger(t, ""))
+	t.Cleanup(func() { _ = c.Close() })
+	return c, store
+}
+
+func testBatch(messages ...string) *outest.Batch {
+	events := make([]beat.Event, len(messages))
+	for i, msg := range messages {
+		events[i] = beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": msg}}
+	}
+	return outest.NewBatch(events...)
+}
+
+func TestRollOnEventCount(t *testing.T) {
+	c, store := newTestClient(t, func(s *clientSettings) {
+		s.maxEvents = 3
+	})
+
+	first := testBatch("a", "b")
+	require.NoError(t, c.Publish(context.Background(), first))
+	assert.Empty(t, first.Signals, "batch must not be acknowledged before the upload")
+	assert.Empty(t, store.keys())
+
+	second := testBatch("c")
+	require.NoError(t, c.Publish(context.Background(), second))
+	require.Len(t, first.Signals, 1)
+	assert.Equal(t, outest.BatchACK, first.Signals[0].Tag)
+	require.Len(t, second.Signals, 1)
+	assert.Equal(t, outest.BatchACK, second.Signals[0].Tag)
+
+	keys := store.keys()
+	require.Len(t, keys, 1)
+	assert.True(t, strings.HasPrefix(keys[0], "/archive/"), keys[0])
+	assert.True(t, strings.HasSuffix(keys[0], "-abcdef01-000001.ndjson"), keys[0])
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(store.get(keys[0])))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[2], `"message":"c"`)
+}
+
+func TestRollOnSizeWithGzip(t *testing.T) {
+	c, store := newTestClient(t, func(s *clientSettings) {
+		s.maxBytes = 10
+		s.compression = compressionGzip
+		s.extension = ".ndjson.gz"
+	})
+
+	batch := testBatch("a long enough message")
+	require.NoError(t, c.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	keys := store.keys()
+	require.Len(t, keys, 1)
+	gz, err := gzip.NewReader(bytes.NewReader(store.get(keys[0])))
+	require.NoError(t, err)
+	data, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"message":"a long enough message"`)
+}
+
+func TestRollOnAge(t *testing.T) {
+	c, store := newTestClient(t, func(s *clientSettings) {
+		s.maxAge = 50 * time.Millisecond
+	})
+
+	batch := testBatch("a")
+	require.NoError(t, c.Publish(context.Background(), batch))
+	require.Eventually(t, func() bool {
+		return len(store.keys()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+}
+
+func TestUploadFailureRetriesAllBatches(t *testing.T) {
+	c, store := newTestClient(t, func(s *clientSettings) {
+		s.maxEvents = 2
+	})
+	store.mu.Lock()
+	store.fail = true
+	store.mu.Unlock()
+
+	first := testBatch("a")
+	second := testBatch("b")
+	require.NoError(t, c.Publish(context.Background(), first))
+	require.Error(t, c.Publish(context.Background(), second))
+
+	for _, b := range []*outest.Batch{first, second} {
+		require.Len(t, b.Signals, 1)
+		assert.Equal(t, outest.BatchRetry, b.Signals[0].Tag)
+	}
+	assert.Empty(t, store.keys())
+}
+
+func TestCloseFlushesPendingObject(t *testing.T) {
+	c, store := newTestClient(t, nil)
+
+	batch := testBatch("a")
+	require.NoError(t, c.Publish(context.Background(), batch))
+	require.NoError(t, c.Close())
+
+	assert.Len(t, store.keys(), 1)
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+}
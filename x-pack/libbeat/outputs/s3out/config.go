@@ -0,0 +1,97 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package s3out
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/fileout"
+	awscommon "github.com/elastic/beats/v7/x-pack/libbeat/common/aws"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+
+	defaultPath = "%{+yyyy}/%{+MM}/%{+dd}"
+)
+
+type s3Config struct {
+	AWSConfig awscommon.ConfigAWS `config:",inline"`
+
+	Bucket            string                    `config:"bucket" validate:"required"`
+	Path              *fileout.PathFormatString `config:"path"`
+	Filename          string                    `config:"filename"`
+	PathStyle         bool                      `config:"path_style"`
+	Codec             codec.Config              `config:"codec"`
+	Compression       string                    `config:"compression"`
+	RotateEveryKb     uint                      `config:"rotate_every_kb" validate:"min=1"`
+	RotateEveryEvents int                       `config:"rotate_every_events" validate:"min=0"`
+	RotateEvery       time.Duration             `config:"rotate_every"`
+	Timeout           time.Duration             `config:"timeout"`
+	BulkMaxSize       int                       `config:"bulk_max_size"`
+	MaxRetries        int                       `config:"max_retries"`
+	Backoff           backoff                   `config:"backoff"`
+	Queue             config.Namespace          `config:"queue"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+func defaultConfig() s3Config {
+	path := &fileout.PathFormatString{}
+	_ = path.Unpack(defaultPath)
+
+	return s3Config{
+		Path:          path,
+		Compression:   compressionGzip,
+		RotateEveryKb: 10 * 1024,
+		RotateEvery:   5 * time.Minute,
+		Timeout:       60 * time.Second,
+		BulkMaxSize:   2048,
+		MaxRetries:    3,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+	}
+}
+
+func (c *s3Config) Validate() error {
+	switch c.Compression {
+	case compressionNone, compressionGzip, compressionZstd:
+	default:
+		return fmt.Errorf("unsupported compression %q, must be one of %s, %s or %s",
+			c.Compression, compressionNone, compressionGzip, compressionZstd)
+	}
+
+	if c.RotateEvery <= 0 {
+		return errors.New("rotate_every must be greater than 0")
+	}
+	if c.Timeout <= 0 {
+		return errors.New("timeout must be greater than 0")
+	}
+
+	return nil
+}
+
+// objectExtension returns the file extension of uploaded objects.
+func (c *s3Config) objectExtension() string {
+	switch c.Compression {
+	case compressionGzip:
+		return ".ndjson.gz"
+	case compressionZstd:
+		return ".ndjson.zst"
+	default:
+		return ".ndjson"
+	}
+}
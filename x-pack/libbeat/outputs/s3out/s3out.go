@@ -0,0 +1,90 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package s3out
+
+import (
+	"strings"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	awscommon "github.com/elastic/beats/v7/x-pack/libbeat/common/aws"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func init() {
+	outputs.RegisterType("s3", makeS3)
+}
+
+const logSelector = "s3"
+
+func makeS3(
+	_ outputs.IndexManager,
+	beatInfo beat.Info,
+	observer outputs.Observer,
+	cfg *config.C,
+) (outputs.Group, error) {
+	s3Cfg := defaultConfig()
+	if err := cfg.Unpack(&s3Cfg); err != nil {
+		return outputs.Fail(err)
+	}
+
+	awsConfig, err := awscommon.InitializeAWSConfig(s3Cfg.AWSConfig)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+	s3Client := s3.NewFromConfig(awsConfig, s3Cfg.s3ConfigModifier)
+
+	enc, err := codec.CreateEncoder(beatInfo, s3Cfg.Codec)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	filename := s3Cfg.Filename
+	if filename == "" {
+		filename = beatInfo.Beat
+	}
+
+	log := beatInfo.Logger.Named(logSelector)
+	log.Infof("Initialized s3 output. bucket=%v max_size_bytes=%v max_events=%v max_age=%v compression=%v",
+		s3Cfg.Bucket, s3Cfg.RotateEveryKb*1024, s3Cfg.RotateEveryEvents, s3Cfg.RotateEvery, s3Cfg.Compression)
+
+	var client outputs.NetworkClient = newClient(clientSettings{
+		bucket:      s3Cfg.Bucket,
+		path:        s3Cfg.Path,
+		filename:    filename,
+		instanceID:  beatInfo.EphemeralID.String()[:8],
+		compression: s3Cfg.Compression,
+		extension:   s3Cfg.objectExtension(),
+		maxBytes:    int(s3Cfg.RotateEveryKb) * 1024,
+		maxEvents:   s3Cfg.RotateEveryEvents,
+		maxAge:      s3Cfg.RotateEvery,
+		timeout:     s3Cfg.Timeout,
+		index:       beatInfo.Beat,
+		codec:       enc,
+		observer:    observer,
+	}, s3Client, log)
+	client = outputs.WithBackoff(client, s3Cfg.Backoff.Init, s3Cfg.Backoff.Max)
+
+	return outputs.SuccessNet(s3Cfg.Queue, false, s3Cfg.BulkMaxSize, s3Cfg.MaxRetries, nil, []outputs.NetworkClient{client})
+}
+
+// s3ConfigModifier applies the output configuration to the S3 client
+// options. A custom endpoint allows using S3-compatible object stores.
+func (c s3Config) s3ConfigModifier(o *s3.Options) {
+	if c.AWSConfig.FIPSEnabled {
+		o.EndpointOptions.UseFIPSEndpoint = awssdk.FIPSEndpointStateEnabled
+	}
+	if endpoint := c.AWSConfig.Endpoint; endpoint != "" {
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "https://" + endpoint
+		}
+		o.BaseEndpoint = awssdk.String(endpoint)
+	}
+	o.UsePathStyle = c.PathStyle
+}